@@ -0,0 +1,123 @@
+package posthog
+
+import (
+	"errors"
+	"time"
+)
+
+// AdaptiveBatching configures a batching strategy adjusting the batch size and
+// the flush interval to the rate of messages, see Config.AdaptiveBatching.
+//
+// On every tick of the flush timer the client compares the number of messages
+// queued since the previous tick with the current batch size. During bursts,
+// when batches fill up before the timer fires, the batch size is doubled and
+// the interval halved so fewer but larger requests are sent without lagging.
+// When idle, the batch size is halved and the interval doubled so a trickle
+// of messages doesn't produce a request on every tick.
+// Batches are still bounded by the 500KB payload limit whatever their size.
+type AdaptiveBatching struct {
+
+	// The bounds of the batch size, the strategy starts from Config.BatchSize.
+	// Default to a quarter and four times the configured batch size.
+	MinBatchSize int
+	MaxBatchSize int
+
+	// The bounds of the flush interval, the strategy starts from
+	// Config.Interval. Default to a quarter and four times the configured
+	// interval.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+func (a AdaptiveBatching) validate() error {
+	if a.MinBatchSize < 0 || a.MaxBatchSize < 0 {
+		return errors.New("negative batch sizes are not supported")
+	}
+	if a.MinInterval < 0 || a.MaxInterval < 0 {
+		return errors.New("negative time intervals are not supported")
+	}
+	if a.MaxBatchSize != 0 && a.MinBatchSize > a.MaxBatchSize {
+		return errors.New("the minimum batch size is greater than the maximum")
+	}
+	if a.MaxInterval != 0 && a.MinInterval > a.MaxInterval {
+		return errors.New("the minimum interval is greater than the maximum")
+	}
+	return nil
+}
+
+// Sets the zero bounds to their defaults relative to the initial batch size
+// and interval.
+func (a AdaptiveBatching) withDefaults(batchSize int, interval time.Duration) AdaptiveBatching {
+	if a.MinBatchSize == 0 {
+		a.MinBatchSize = batchSize / 4
+		if a.MinBatchSize == 0 {
+			a.MinBatchSize = 1
+		}
+	}
+	if a.MaxBatchSize == 0 {
+		a.MaxBatchSize = batchSize * 4
+	}
+	if a.MinInterval == 0 {
+		a.MinInterval = interval / 4
+	}
+	if a.MaxInterval == 0 {
+		a.MaxInterval = interval * 4
+	}
+	return a
+}
+
+// Tracks the current batch size and interval of the adaptive strategy, it is
+// owned by the backend goroutine.
+type batchingController struct {
+	bounds    AdaptiveBatching
+	batchSize int
+	interval  time.Duration
+}
+
+func newBatchingController(bounds AdaptiveBatching, batchSize int, interval time.Duration) *batchingController {
+	return &batchingController{
+		bounds:    bounds,
+		batchSize: clampInt(batchSize, bounds.MinBatchSize, bounds.MaxBatchSize),
+		interval:  clampDuration(interval, bounds.MinInterval, bounds.MaxInterval),
+	}
+}
+
+// Adjusts the batch size and interval given the number of messages queued
+// during the last interval, it reports whether they changed.
+func (b *batchingController) adjust(received int) (changed bool) {
+	batchSize, interval := b.batchSize, b.interval
+
+	switch {
+	case received >= b.batchSize:
+		batchSize, interval = batchSize*2, interval/2
+	case received < b.batchSize/4:
+		batchSize, interval = batchSize/2, interval*2
+	}
+
+	batchSize = clampInt(batchSize, b.bounds.MinBatchSize, b.bounds.MaxBatchSize)
+	interval = clampDuration(interval, b.bounds.MinInterval, b.bounds.MaxInterval)
+
+	changed = batchSize != b.batchSize || interval != b.interval
+	b.batchSize, b.interval = batchSize, interval
+	return
+}
+
+func clampInt(v int, min int, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func clampDuration(v time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
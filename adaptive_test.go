@@ -0,0 +1,70 @@
+package posthog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchingControllerAdjust(t *testing.T) {
+	bounds := AdaptiveBatching{}.withDefaults(100, 4*time.Second)
+	b := newBatchingController(bounds, 100, 4*time.Second)
+
+	tests := []struct {
+		received  int
+		batchSize int
+		interval  time.Duration
+		changed   bool
+	}{
+		{received: 100, batchSize: 200, interval: 2 * time.Second, changed: true},
+		{received: 500, batchSize: 400, interval: time.Second, changed: true},
+		{received: 1000, batchSize: 400, interval: time.Second, changed: false},
+		{received: 150, batchSize: 400, interval: time.Second, changed: false},
+		{received: 0, batchSize: 200, interval: 2 * time.Second, changed: true},
+		{received: 0, batchSize: 100, interval: 4 * time.Second, changed: true},
+		{received: 0, batchSize: 50, interval: 8 * time.Second, changed: true},
+		{received: 0, batchSize: 25, interval: 16 * time.Second, changed: true},
+		{received: 0, batchSize: 25, interval: 16 * time.Second, changed: false},
+	}
+
+	for i, test := range tests {
+		changed := b.adjust(test.received)
+		if changed != test.changed || b.batchSize != test.batchSize || b.interval != test.interval {
+			t.Errorf("#%d: expected %d/%s (changed: %t), got %d/%s (changed: %t)",
+				i, test.batchSize, test.interval, test.changed, b.batchSize, b.interval, changed)
+		}
+	}
+}
+
+func TestMessageQueuesSetBatchSize(t *testing.T) {
+	qs := messageQueues{maxBatchSize: 10, maxBatchBytes: maxBatchBytes}
+	q := qs.get("key")
+
+	for i := 0; i != 3; i++ {
+		q.push(message{json: []byte(`{}`)})
+	}
+
+	qs.setBatchSize(2)
+
+	if msgs := q.push(message{json: []byte(`{}`)}); len(msgs) != 4 {
+		t.Errorf("expected a queue over the new batch size to be flushed, got %d messages", len(msgs))
+	}
+	if q := qs.get("other"); q.maxBatchSize != 2 {
+		t.Errorf("expected new queues to use the new batch size, got %d", q.maxBatchSize)
+	}
+}
+
+func TestConfigInvalidAdaptiveBatching(t *testing.T) {
+	c := Config{
+		AdaptiveBatching: &AdaptiveBatching{MinBatchSize: 100, MaxBatchSize: 10},
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "AdaptiveBatching" {
+		t.Error("invalid field error reported:", e)
+	}
+}
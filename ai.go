@@ -0,0 +1,162 @@
+package posthog
+
+import (
+	"time"
+)
+
+// The events of PostHog LLM observability.
+const (
+	AIGenerationEvent = "$ai_generation"
+	AITraceEvent      = "$ai_trace"
+)
+
+// An AIGeneration is a call to an LLM, captured with CaptureAIGeneration.
+type AIGeneration struct {
+	// The user the generation was made for, the generation is captured
+	// without creating a person when empty.
+	DistinctId string
+
+	// The trace the generation belongs to, a trace is generated when empty.
+	TraceId string
+
+	// The ID of the generation and of the span or trace containing it, they
+	// are optional.
+	SpanId   string
+	ParentId string
+
+	// The model and provider of the LLM, like "gpt-4o" and "openai".
+	Model    string
+	Provider string
+
+	// The messages sent to the model and the choices it returned, usually in
+	// the format of the API of the provider. They are optional.
+	Input  interface{}
+	Output interface{}
+
+	InputTokens  int
+	OutputTokens int
+
+	// How long the call took.
+	Latency time.Duration
+
+	// The cost of the call in USD, computed by PostHog from the model and the
+	// tokens when zero.
+	InputCostUsd  float64
+	OutputCostUsd float64
+
+	// The status of the response of the provider.
+	HttpStatus int
+
+	// The error of a failed call.
+	Error error
+
+	// Properties added to the event.
+	Properties Properties
+}
+
+// An AITrace groups the generations and spans of an operation, like the
+// handling of a message of a chatbot, captured with CaptureAITrace.
+type AITrace struct {
+	// The user the operation was made for, the trace is captured without
+	// creating a person when empty.
+	DistinctId string
+
+	// The ID shared by the generations of the trace.
+	TraceId string
+
+	// The name of the operation.
+	Name string
+
+	// The state before and after the operation, they are optional.
+	InputState  interface{}
+	OutputState interface{}
+
+	// How long the operation took.
+	Latency time.Duration
+
+	// The error of a failed operation.
+	Error error
+
+	// Properties added to the event.
+	Properties Properties
+}
+
+// CaptureAIGeneration captures a $ai_generation event for LLM observability.
+func CaptureAIGeneration(client Client, generation AIGeneration) error {
+	p := NewProperties().Merge(generation.Properties)
+
+	traceId := generation.TraceId
+	if traceId == "" {
+		traceId = uid()
+	}
+	p.Set("$ai_trace_id", traceId).
+		Set("$ai_model", generation.Model).
+		Set("$ai_provider", generation.Provider).
+		Set("$ai_input_tokens", generation.InputTokens).
+		Set("$ai_output_tokens", generation.OutputTokens).
+		Set("$ai_latency", generation.Latency.Seconds())
+	setIfNotEmpty(p, "$ai_span_id", generation.SpanId)
+	setIfNotEmpty(p, "$ai_parent_id", generation.ParentId)
+	if generation.Input != nil {
+		p.Set("$ai_input", generation.Input)
+	}
+	if generation.Output != nil {
+		p.Set("$ai_output_choices", generation.Output)
+	}
+	if generation.InputCostUsd != 0 || generation.OutputCostUsd != 0 {
+		p.Set("$ai_input_cost_usd", generation.InputCostUsd).
+			Set("$ai_output_cost_usd", generation.OutputCostUsd).
+			Set("$ai_total_cost_usd", generation.InputCostUsd+generation.OutputCostUsd)
+	}
+	if generation.HttpStatus != 0 {
+		p.Set("$ai_http_status", generation.HttpStatus)
+	}
+	setAIError(p, generation.Error)
+
+	return client.Enqueue(Capture{
+		DistinctId: personlessDistinctId(generation.DistinctId, p),
+		Event:      AIGenerationEvent,
+		Properties: p,
+	})
+}
+
+// CaptureAITrace captures a $ai_trace event for LLM observability.
+func CaptureAITrace(client Client, trace AITrace) error {
+	if trace.TraceId == "" {
+		return FieldError{
+			Type:  "posthog.AITrace",
+			Name:  "TraceId",
+			Value: trace.TraceId,
+		}
+	}
+
+	p := NewProperties().Merge(trace.Properties).
+		Set("$ai_trace_id", trace.TraceId).
+		Set("$ai_latency", trace.Latency.Seconds())
+	setIfNotEmpty(p, "$ai_span_name", trace.Name)
+	if trace.InputState != nil {
+		p.Set("$ai_input_state", trace.InputState)
+	}
+	if trace.OutputState != nil {
+		p.Set("$ai_output_state", trace.OutputState)
+	}
+	setAIError(p, trace.Error)
+
+	return client.Enqueue(Capture{
+		DistinctId: personlessDistinctId(trace.DistinctId, p),
+		Event:      AITraceEvent,
+		Properties: p,
+	})
+}
+
+func setAIError(p Properties, err error) {
+	if err != nil {
+		p.Set("$ai_is_error", true).Set("$ai_error", err.Error())
+	}
+}
+
+func setIfNotEmpty(p Properties, name string, value string) {
+	if value != "" {
+		p.Set(name, value)
+	}
+}
@@ -0,0 +1,85 @@
+package posthog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCaptureAIGeneration(t *testing.T) {
+	client := &testEnqueueClient{}
+	err := CaptureAIGeneration(client, AIGeneration{
+		DistinctId:    "user",
+		TraceId:       "trace",
+		Model:         "gpt-4o",
+		Provider:      "openai",
+		Input:         []map[string]string{{"role": "user", "content": "hi"}},
+		InputTokens:   10,
+		OutputTokens:  20,
+		Latency:       1500 * time.Millisecond,
+		InputCostUsd:  0.25,
+		OutputCostUsd: 0.5,
+		HttpStatus:    200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := client.msgs[0].(Capture)
+	expected := Properties{
+		"$ai_trace_id":        "trace",
+		"$ai_model":           "gpt-4o",
+		"$ai_provider":        "openai",
+		"$ai_input":           []map[string]string{{"role": "user", "content": "hi"}},
+		"$ai_input_tokens":    10,
+		"$ai_output_tokens":   20,
+		"$ai_latency":         1.5,
+		"$ai_input_cost_usd":  0.25,
+		"$ai_output_cost_usd": 0.5,
+		"$ai_total_cost_usd":  0.75,
+		"$ai_http_status":     200,
+	}
+	if msg.Event != "$ai_generation" || msg.DistinctId != "user" || !reflect.DeepEqual(msg.Properties, expected) {
+		t.Errorf("invalid generation: %#v", msg)
+	}
+}
+
+func TestCaptureAIGenerationAnonymous(t *testing.T) {
+	client := &testEnqueueClient{}
+	CaptureAIGeneration(client, AIGeneration{Model: "gpt-4o", Error: errors.New("rate limited")})
+
+	msg := client.msgs[0].(Capture)
+	if msg.DistinctId == "" || msg.Properties["$process_person_profile"] != false || msg.Properties["$ai_trace_id"] == "" {
+		t.Errorf("expected an anonymous generation with a trace, got %#v", msg)
+	}
+	if msg.Properties["$ai_is_error"] != true || msg.Properties["$ai_error"] != "rate limited" {
+		t.Errorf("expected the error, got %v", msg.Properties)
+	}
+	if _, ok := msg.Properties["$ai_total_cost_usd"]; ok {
+		t.Error("expected the cost to be computed by PostHog")
+	}
+}
+
+func TestCaptureAITrace(t *testing.T) {
+	client := &testEnqueueClient{}
+	if _, ok := CaptureAITrace(client, AITrace{DistinctId: "user"}).(FieldError); !ok {
+		t.Error("expected traces without ID to be invalid")
+	}
+
+	err := CaptureAITrace(client, AITrace{
+		DistinctId: "user",
+		TraceId:    "trace",
+		Name:       "answer_message",
+		Latency:    2 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := client.msgs[0].(Capture)
+	expected := Properties{"$ai_trace_id": "trace", "$ai_span_name": "answer_message", "$ai_latency": 2.0}
+	if msg.Event != "$ai_trace" || !reflect.DeepEqual(msg.Properties, expected) {
+		t.Errorf("invalid trace: %#v", msg)
+	}
+}
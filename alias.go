@@ -12,7 +12,10 @@ type Alias struct {
 
 	Alias      string
 	DistinctId string
-	Timestamp  time.Time
+
+	// The unique identifier of the message, generated by Enqueue when empty.
+	Uuid      string
+	Timestamp time.Time
 }
 
 func (msg Alias) internal() {
@@ -20,12 +23,8 @@ func (msg Alias) internal() {
 }
 
 func (msg Alias) Validate() error {
-	if len(msg.DistinctId) == 0 {
-		return FieldError{
-			Type:  "posthog.Alias",
-			Name:  "DistinctId",
-			Value: msg.DistinctId,
-		}
+	if err := validateDistinctId("posthog.Alias", "DistinctId", msg.DistinctId); err != nil {
+		return err
 	}
 
 	if len(msg.Alias) == 0 {
@@ -51,6 +50,7 @@ type AliasInApi struct {
 	Library        string    `json:"library"`
 	LibraryVersion string    `json:"library_version"`
 	Timestamp      time.Time `json:"timestamp"`
+	Uuid           string    `json:"uuid,omitempty"`
 
 	Properties AliasInApiProperties `json:"properties"`
 
@@ -67,6 +67,7 @@ func (msg Alias) APIfy() APIMessage {
 		Library:        library,
 		LibraryVersion: libraryVersion,
 		Timestamp:      msg.Timestamp,
+		Uuid:           msg.Uuid,
 		Properties: AliasInApiProperties{
 			DistinctId: msg.DistinctId,
 			Alias:      msg.Alias,
@@ -0,0 +1,50 @@
+package posthog
+
+import (
+	"context"
+	"time"
+)
+
+// The scope of an annotation, which charts it is shown on.
+type AnnotationScope string
+
+const (
+	AnnotationScopeProject      AnnotationScope = "project"
+	AnnotationScopeOrganization AnnotationScope = "organization"
+)
+
+// An Annotation marks a point in time on the charts of PostHog, like a deploy.
+type Annotation struct {
+	Id         int             `json:"id,omitempty"`
+	Content    string          `json:"content"`
+	DateMarker time.Time       `json:"date_marker"`
+	Scope      AnnotationScope `json:"scope"`
+}
+
+func (c *client) CreateAnnotation(content string, timestamp time.Time, scope AnnotationScope) (Annotation, error) {
+	return c.CreateAnnotationCtx(context.Background(), content, timestamp, scope)
+}
+
+func (c *client) CreateAnnotationCtx(ctx context.Context, content string, timestamp time.Time, scope AnnotationScope) (Annotation, error) {
+	if content == "" {
+		return Annotation{}, ConfigError{
+			Reason: "annotation content required",
+			Field:  "content",
+			Value:  content,
+		}
+	}
+	if scope == "" {
+		scope = AnnotationScopeProject
+	}
+	if timestamp.IsZero() {
+		timestamp = c.now()
+	}
+
+	var annotation Annotation
+	err := c.projectRequest(ctx, "POST", "annotations/", Annotation{
+		Content:    content,
+		DateMarker: timestamp,
+		Scope:      scope,
+	}, &annotation)
+	return annotation, err
+}
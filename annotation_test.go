@@ -0,0 +1,58 @@
+package posthog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreateAnnotation(t *testing.T) {
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/projects/@current/annotations/" {
+			if r.Method != "POST" || r.Header.Get("Authorization") != "Bearer some very secret key" {
+				t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Authorization"))
+			}
+			var annotation Annotation
+			json.NewDecoder(r.Body).Decode(&annotation)
+			if annotation.Content != "Deploy v1.2.3" || !annotation.DateMarker.Equal(timestamp) || annotation.Scope != "project" {
+				t.Errorf("unexpected annotation: %+v", annotation)
+			}
+			annotation.Id = 42
+			json.NewEncoder(w).Encode(annotation)
+			return
+		}
+		w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+	})
+	defer client.Close()
+
+	annotation, err := client.CreateAnnotation("Deploy v1.2.3", timestamp, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if annotation.Id != 42 {
+		t.Errorf("expected the created annotation, got %+v", annotation)
+	}
+
+	_, err = client.CreateAnnotation("", timestamp, "")
+	if _, ok := err.(ConfigError); !ok {
+		t.Error("expected a ConfigError for an empty content")
+	}
+}
+
+func TestCreateAnnotationRequiresPersonalApiKey(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{Transport: offlineTransport(t), Logger: testLogger{t.Logf, t.Logf}})
+	defer client.Close()
+
+	if _, err := client.CreateAnnotation("Deploy v1.2.3", time.Time{}, ""); err == nil {
+		t.Error("expected an error without personal API key")
+	}
+}
@@ -0,0 +1,47 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The prefix of the endpoints of the private API, scoped to the project of the
+// personal API key.
+const projectApiEndpoint = "api/projects/@current/"
+
+// Sends a request to an endpoint of the private API of the project with the
+// personal API key, the body is sent as JSON when it isn't nil and the
+// response is decoded into v when it isn't nil. Errors returned by the API
+// are *APIError.
+func (c *client) projectRequest(ctx context.Context, method string, endpoint string, body interface{}, v interface{}) error {
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using the private API"
+		c.log(LogLevelError, errorMessage)
+		return errors.New(errorMessage)
+	}
+
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	url := c.Endpoint + "/" + projectApiEndpoint + endpoint
+	headers := [][2]string{{"Authorization", "Bearer " + c.featureFlagsPoller.apiKeys().personal}}
+	status, resBody, err := doRequest(ctx, &c.http, method, url, b, headers)
+	if err != nil {
+		c.report(url, status, resBody, err)
+		return fmt.Errorf("%s %s failed: %w", method, endpoint, err)
+	}
+
+	if v != nil && len(resBody) != 0 {
+		if err := json.Unmarshal(resBody, v); err != nil {
+			return fmt.Errorf("unable to parse the response of %s %s: %w", method, endpoint, err)
+		}
+	}
+	return nil
+}
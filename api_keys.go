@@ -0,0 +1,47 @@
+package posthog
+
+import (
+	"errors"
+)
+
+// Returns the project API key of the client.
+func (c *client) apiKey() string {
+	return c.key.Load().(string)
+}
+
+func (c *client) SetProjectApiKey(apiKey string) error {
+	if apiKey == "" {
+		return ConfigError{
+			Reason: "project API key required",
+			Field:  "apiKey",
+			Value:  apiKey,
+		}
+	}
+
+	c.key.Store(apiKey)
+	if c.featureFlagsPoller != nil {
+		c.featureFlagsPoller.rotateApiKeys(func(keys *apiKeys) { keys.project = apiKey })
+	}
+	return nil
+}
+
+func (c *client) SetPersonalApiKey(personalApiKey string) error {
+	if personalApiKey == "" {
+		return ConfigError{
+			Reason: "personal API key required",
+			Field:  "PersonalApiKey",
+			Value:  personalApiKey,
+		}
+	}
+
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return errors.New(errorMessage)
+	}
+	c.featureFlagsPoller.rotateApiKeys(func(keys *apiKeys) { keys.personal = personalApiKey })
+
+	// Fetches may have been failing since the previous key was revoked.
+	c.featureFlagsPoller.ForceReload()
+	return nil
+}
@@ -0,0 +1,101 @@
+package posthog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetApiKeys(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations, tokens, batchKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+			tokens = append(tokens, r.URL.Query().Get("token"))
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		case strings.HasPrefix(r.URL.Path, "/batch"):
+			body, _ := ioutil.ReadAll(r.Body)
+			var batch struct {
+				ApiKey string `json:"api_key"`
+			}
+			json.Unmarshal(body, &batch)
+			batchKeys = append(batchKeys, batch.ApiKey)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("old project key", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "old personal key",
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+
+	waitFor := func(done func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			ok := done()
+			mu.Unlock()
+			if ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for definitions to be fetched, got %v %v", authorizations, tokens)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(func() bool { return len(authorizations) > 0 })
+	if authorizations[0] != "Bearer old personal key" || tokens[0] != "old project key" {
+		t.Errorf("expected the first fetch to use the old keys, got %q %q", authorizations[0], tokens[0])
+	}
+
+	client.Enqueue(Capture{DistinctId: "user", Event: "before"})
+	if err := client.SetProjectApiKey("new project key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetPersonalApiKey("new personal key"); err != nil {
+		t.Fatal(err)
+	}
+	client.Enqueue(Capture{DistinctId: "user", Event: "after"})
+
+	waitFor(func() bool {
+		last := len(authorizations) - 1
+		return authorizations[last] == "Bearer new personal key" && tokens[last] == "new project key"
+	})
+
+	client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Messages with different keys are sent in separate batches, in any order.
+	sort.Strings(batchKeys)
+	if len(batchKeys) != 2 || batchKeys[0] != "new project key" || batchKeys[1] != "old project key" {
+		t.Errorf("expected messages to be sent with the key they were enqueued with, got %v", batchKeys)
+	}
+}
+
+func TestSetApiKeysInvalid(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{Transport: offlineTransport(t)})
+	defer client.Close()
+
+	if _, ok := client.SetProjectApiKey("").(ConfigError); !ok {
+		t.Error("expected a ConfigError for an empty project API key")
+	}
+	if _, ok := client.SetPersonalApiKey("").(ConfigError); !ok {
+		t.Error("expected a ConfigError for an empty personal API key")
+	}
+	if err := client.SetPersonalApiKey("some very secret key"); err == nil {
+		t.Error("expected an error setting a personal API key without feature flags")
+	}
+}
@@ -0,0 +1,176 @@
+package posthog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Passed to Callback.Failure for messages that the API rejected individually,
+// it carries the reason given by the server.
+type MessageRejectedError struct {
+
+	// The machine-readable reason of the rejection, like "invalid_payload".
+	Code string
+
+	// A human-readable message explaining why the message was rejected.
+	Detail string
+
+	// The error of the request when the whole batch was rejected because of
+	// this message, usually an *APIError. It is nil when only this message
+	// was dropped.
+	Err error
+}
+
+func (e *MessageRejectedError) Error() string {
+	msg := "message rejected"
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *MessageRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Callbacks may implement this interface to be notified of warnings the API
+// attached to messages it accepted, like properties that were truncated.
+type WarningCallback interface {
+	Callback
+
+	// This method is called for every warning attached to a message.
+	Warning(m APIMessage, warning string)
+}
+
+// The body of /batch responses. Accepted batches may list the messages that
+// were dropped or accepted with warnings, while rejected batches carry an
+// error whose attribute points at the invalid message (like "batch.3.event").
+type batchResponse struct {
+	Rejected []messageOutcome `json:"rejected"`
+	Warnings []messageOutcome `json:"warnings"`
+
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	Attr   string `json:"attr"`
+}
+
+// Identifies a message of a batch either by its UUID or its position.
+type messageOutcome struct {
+	Uuid   string `json:"uuid"`
+	Index  *int   `json:"index"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func (o messageOutcome) String() string {
+	if o.Code == "" {
+		return o.Detail
+	}
+	return o.Code + ": " + o.Detail
+}
+
+// Returns the position of the message the outcome applies to, or -1 when it
+// isn't part of the batch.
+func (o messageOutcome) find(msgs []message) int {
+	if o.Index != nil {
+		if *o.Index >= 0 && *o.Index < len(msgs) {
+			return *o.Index
+		}
+		return -1
+	}
+	if o.Uuid == "" {
+		return -1
+	}
+	for i, m := range msgs {
+		var v struct {
+			Uuid string `json:"uuid"`
+		}
+		if json.Unmarshal(m.json, &v) == nil && v.Uuid == o.Uuid {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the position of the message pointed at by the error attribute of a
+// rejected batch, or -1.
+func (r batchResponse) attrIndex(msgs []message) int {
+	parts := strings.Split(r.Attr, ".")
+	if len(parts) < 2 || parts[0] != "batch" {
+		return -1
+	}
+	i, err := strconv.Atoi(parts[1])
+	if err != nil || i < 0 || i >= len(msgs) {
+		return -1
+	}
+	return i
+}
+
+// Reports the outcome of a batch upload to the callbacks, mapping the
+// rejections and warnings found in the response body to the messages they
+// apply to. err is the error of the upload, if any.
+func (c *client) notifyOutcomes(msgs []message, body []byte, err error) {
+	var res batchResponse
+	if len(body) != 0 {
+		if jsonErr := json.Unmarshal(body, &res); jsonErr != nil {
+			c.log(LogLevelDebug, "response body is not a batch response", LogField{"error", jsonErr})
+		}
+	}
+
+	for _, w := range res.Warnings {
+		i := w.find(msgs)
+		if i < 0 {
+			c.log(LogLevelWarn, "batch warning", LogField{"warning", w.String()})
+			continue
+		}
+		c.log(LogLevelWarn, "message warning", LogField{"warning", w.String()}, LogField{"message", msgs[i].msg})
+		if cb, ok := c.Callback.(WarningCallback); ok {
+			cb.Warning(msgs[i].msg, w.String())
+		}
+	}
+
+	rejected := map[int]error{}
+	if err != nil {
+		if i := res.attrIndex(msgs); i >= 0 {
+			rejected[i] = &MessageRejectedError{Code: res.Code, Detail: res.Detail, Err: err}
+		}
+	}
+	for _, r := range res.Rejected {
+		if i := r.find(msgs); i >= 0 {
+			rejected[i] = &MessageRejectedError{Code: r.Code, Detail: r.Detail, Err: err}
+		}
+	}
+
+	if len(rejected) == 0 {
+		if err != nil {
+			c.notifyFailure(msgs, err)
+		} else {
+			c.notifySuccess(msgs)
+		}
+		return
+	}
+
+	remaining := make([]message, 0, len(msgs)-len(rejected))
+	for i, m := range msgs {
+		if rerr, ok := rejected[i]; ok {
+			c.log(LogLevelError, "message rejected", LogField{"error", rerr}, LogField{"message", m.msg})
+			c.notifyFailure([]message{m}, rerr)
+		} else {
+			remaining = append(remaining, m)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return
+	}
+	if err != nil {
+		c.notifyFailure(remaining, fmt.Errorf("batch rejected because of another message: %w", err))
+	} else {
+		c.notifySuccess(remaining)
+	}
+}
@@ -0,0 +1,115 @@
+package posthog
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type outcomeCallback struct {
+	mutex    sync.Mutex
+	success  []string
+	failure  map[string]error
+	warnings map[string]string
+	done     chan struct{}
+	pending  int
+}
+
+func newOutcomeCallback(n int) *outcomeCallback {
+	return &outcomeCallback{
+		failure:  map[string]error{},
+		warnings: map[string]string{},
+		done:     make(chan struct{}),
+		pending:  n,
+	}
+}
+
+func (c *outcomeCallback) Success(m APIMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.success = append(c.success, m.(CaptureInApi).Uuid)
+	c.notify()
+}
+
+func (c *outcomeCallback) Failure(m APIMessage, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failure[m.(CaptureInApi).Uuid] = err
+	c.notify()
+}
+
+func (c *outcomeCallback) Warning(m APIMessage, warning string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.warnings[m.(CaptureInApi).Uuid] = warning
+}
+
+func (c *outcomeCallback) notify() {
+	if c.pending--; c.pending == 0 {
+		close(c.done)
+	}
+}
+
+func sendBatchWithResponse(t *testing.T, status int, body string) *outcomeCallback {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cb := newOutcomeCallback(2)
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:  server.URL,
+		Logger:    testLogger{t.Logf, t.Logf},
+		Callback:  cb,
+		BatchSize: 2,
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A", Uuid: "u0"})
+	client.Enqueue(Capture{DistinctId: "1", Event: "B", Uuid: "u1"})
+	<-cb.done
+	return cb
+}
+
+func TestBatchResponseRejectedMessages(t *testing.T) {
+	cb := sendBatchWithResponse(t, http.StatusOK, `{
+		"status": 1,
+		"rejected": [{"index": 1, "code": "invalid_event", "detail": "event name is reserved"}],
+		"warnings": [{"uuid": "u0", "detail": "property truncated"}]
+	}`)
+
+	if len(cb.success) != 1 || cb.success[0] != "u0" {
+		t.Errorf("expected the first message to succeed, got %v", cb.success)
+	}
+
+	var rejected *MessageRejectedError
+	if !errors.As(cb.failure["u1"], &rejected) || rejected.Code != "invalid_event" || rejected.Err != nil {
+		t.Errorf("expected the second message to be rejected, got %v", cb.failure["u1"])
+	}
+
+	if cb.warnings["u0"] != "property truncated" {
+		t.Errorf("expected a warning for the first message, got %v", cb.warnings)
+	}
+}
+
+func TestBatchResponseRejectedBatch(t *testing.T) {
+	cb := sendBatchWithResponse(t, http.StatusBadRequest, `{
+		"type": "validation_error",
+		"code": "invalid_payload",
+		"detail": "Invalid payload: event name is required.",
+		"attr": "batch.0.event"
+	}`)
+
+	var rejected *MessageRejectedError
+	var apiErr *APIError
+	if err := cb.failure["u0"]; !errors.As(err, &rejected) || rejected.Code != "invalid_payload" || !errors.As(err, &apiErr) {
+		t.Errorf("expected the first message to be identified as the cause, got %v", err)
+	}
+
+	if err := cb.failure["u1"]; errors.As(err, &rejected) || !errors.As(err, &apiErr) {
+		t.Errorf("expected the second message to fail with the batch, got %v", err)
+	}
+}
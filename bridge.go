@@ -0,0 +1,82 @@
+package posthog
+
+import (
+	"context"
+	"io"
+)
+
+// Values implementing this interface are used as a source of messages by
+// the Bridge function, they typically wrap a Kafka consumer, an SQS poller or
+// any other queue an ingestion sidecar reads from.
+type Source interface {
+
+	// Next blocks until a message is available and returns it. Returning
+	// io.EOF stops the bridge without error, any other error stops it and is
+	// returned by Bridge.
+	Next(ctx context.Context) (Message, error)
+}
+
+// Sources implementing this optional interface are notified once a message
+// returned by Next was handed to the client, with the error returned by
+// EnqueueCtx. This is the place to commit Kafka offsets or delete SQS messages.
+type Acker interface {
+	Ack(msg Message, err error)
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func(ctx context.Context) (Message, error)
+
+func (f SourceFunc) Next(ctx context.Context) (Message, error) { return f(ctx) }
+
+// ChannelSource returns a Source reading messages from ch, the source returns
+// io.EOF when ch is closed.
+func ChannelSource(ch <-chan Message) Source {
+	return SourceFunc(func(ctx context.Context) (Message, error) {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil, io.EOF
+			}
+			return msg, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// Bridge reads messages from src and enqueues them on client until src is
+// exhausted, ctx is canceled or the client is closed, so they go through the
+// same validation and batching as messages enqueued by the application.
+//
+// Messages the client rejects (because they are invalid for example) don't
+// stop the bridge, they are reported to the source if it implements Acker.
+// Bridge returns nil when src returns io.EOF, ctx.Err() when ctx is canceled
+// and ErrClosed if the client was closed.
+func Bridge(ctx context.Context, client Client, src Source) error {
+	acker, _ := src.(Acker)
+
+	for {
+		msg, err := src.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+
+		// Waiting for room in a full queue stops when ctx is canceled.
+		err = client.EnqueueCtx(ctx, msg)
+		if acker != nil {
+			acker.Ack(msg, err)
+		}
+		if err == ErrClosed {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package posthog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testAcker struct {
+	Source
+	acks []error
+}
+
+func (a *testAcker) Ack(msg Message, err error) {
+	a.acks = append(a.acks, err)
+}
+
+func TestBridge(t *testing.T) {
+	sent := make(chan APIMessage, 2)
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Transport: testTransportOK,
+		BatchSize: 1,
+		Callback: testCallback{
+			func(m APIMessage) { sent <- m },
+			nil,
+		},
+	})
+	defer client.Close()
+
+	ch := make(chan Message, 3)
+	ch <- Capture{Event: "download", DistinctId: "123"}
+	ch <- Capture{Event: "download"}
+	ch <- Identify{DistinctId: "123"}
+	close(ch)
+
+	src := &testAcker{Source: ChannelSource(ch)}
+	if err := Bridge(context.Background(), client, src); err != nil {
+		t.Fatal("bridge returned an error:", err)
+	}
+
+	if len(src.acks) != 3 || src.acks[0] != nil || src.acks[1] == nil || src.acks[2] != nil {
+		t.Errorf("invalid acknowledgements: %v", src.acks)
+	}
+
+	for i := 0; i != 2; i++ {
+		<-sent
+	}
+}
+
+func TestBridgeClosedClient(t *testing.T) {
+	client := New("Csyjlnlun3OzyNJAafdlv")
+	client.Close()
+
+	ch := make(chan Message, 1)
+	ch <- Capture{Event: "download", DistinctId: "123"}
+
+	if err := Bridge(context.Background(), client, ChannelSource(ch)); err != ErrClosed {
+		t.Error("expected ErrClosed, got", err)
+	}
+}
+
+func TestBridgeCanceled(t *testing.T) {
+	client := New("Csyjlnlun3OzyNJAafdlv")
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := Bridge(ctx, client, ChannelSource(make(chan Message))); err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
+
+// A client whose queue stays full, enqueuing blocks until the context is done.
+type testFullQueueClient struct {
+	Client
+}
+
+func (c *testFullQueueClient) EnqueueCtx(ctx context.Context, msg Message) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestBridgeCanceledWhileQueueIsFull(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan Message, 1)
+	ch <- Capture{Event: "download", DistinctId: "123"}
+
+	src := &testAcker{Source: ChannelSource(ch)}
+	if err := Bridge(ctx, &testFullQueueClient{}, src); err != context.DeadlineExceeded {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+	if len(src.acks) != 1 || src.acks[0] != context.DeadlineExceeded {
+		t.Errorf("expected the message to be acknowledged with the error, got %v", src.acks)
+	}
+}
@@ -10,8 +10,11 @@ type Capture struct {
 	// the application, its value is always overwritten by the library.
 	Type string
 
-	DistinctId       string
-	Event            string
+	DistinctId string
+	Event      string
+
+	// The unique identifier of the message, generated by Enqueue when empty.
+	Uuid             string
 	Timestamp        time.Time
 	Properties       Properties
 	Groups           Groups
@@ -31,12 +34,8 @@ func (msg Capture) Validate() error {
 		}
 	}
 
-	if len(msg.DistinctId) == 0 {
-		return FieldError{
-			Type:  "posthog.Capture",
-			Name:  "DistinctId",
-			Value: msg.DistinctId,
-		}
+	if err := validateDistinctId("posthog.Capture", "DistinctId", msg.DistinctId); err != nil {
+		return err
 	}
 
 	return nil
@@ -47,6 +46,7 @@ type CaptureInApi struct {
 	Library        string    `json:"library"`
 	LibraryVersion string    `json:"library_version"`
 	Timestamp      time.Time `json:"timestamp"`
+	Uuid           string    `json:"uuid,omitempty"`
 
 	DistinctId       string     `json:"distinct_id"`
 	Event            string     `json:"event"`
@@ -75,6 +75,7 @@ func (msg Capture) APIfy() APIMessage {
 		Library:        library,
 		LibraryVersion: libraryVersion,
 		Timestamp:      msg.Timestamp,
+		Uuid:           msg.Uuid,
 		DistinctId:     msg.DistinctId,
 		Event:          msg.Event,
 		Properties:     myProperties,
@@ -0,0 +1,135 @@
+package posthog
+
+import (
+	"time"
+)
+
+// A CaptureBuilder builds Capture messages with chained calls, as an
+// alternative to struct literals:
+//
+//	err := posthog.NewCapture("signed_up").
+//		DistinctId(id).
+//		Prop("plan", "pro").
+//		Set("email", email).
+//		Group("company", "acme").
+//		Send(client)
+//
+// The message is validated when it is built. Builders aren't safe to use
+// concurrently.
+type CaptureBuilder struct {
+	msg Capture
+}
+
+// Returns a builder of a capture of event.
+func NewCapture(event string) *CaptureBuilder {
+	return &CaptureBuilder{msg: Capture{Event: event}}
+}
+
+// Sets the distinct ID of the user the event is captured for.
+func (b *CaptureBuilder) DistinctId(distinctId string) *CaptureBuilder {
+	b.msg.DistinctId = distinctId
+	return b
+}
+
+// Sets a property of the event.
+func (b *CaptureBuilder) Prop(name string, value interface{}) *CaptureBuilder {
+	if b.msg.Properties == nil {
+		b.msg.Properties = NewProperties()
+	}
+	b.msg.Properties.Set(name, value)
+	return b
+}
+
+// Sets multiple properties of the event, overwriting the ones already set.
+func (b *CaptureBuilder) Props(properties Properties) *CaptureBuilder {
+	if b.msg.Properties == nil {
+		b.msg.Properties = NewProperties()
+	}
+	b.msg.Properties.Merge(properties)
+	return b
+}
+
+// Sets a property of the user, sent as $set.
+func (b *CaptureBuilder) Set(name string, value interface{}) *CaptureBuilder {
+	return b.setPersonProperty("$set", name, value)
+}
+
+// Sets a property of the user unless it is already set, sent as $set_once.
+func (b *CaptureBuilder) SetOnce(name string, value interface{}) *CaptureBuilder {
+	return b.setPersonProperty("$set_once", name, value)
+}
+
+func (b *CaptureBuilder) setPersonProperty(key string, name string, value interface{}) *CaptureBuilder {
+	if b.msg.Properties == nil {
+		b.msg.Properties = NewProperties()
+	}
+	properties, ok := b.msg.Properties[key].(Properties)
+	if !ok {
+		properties = NewProperties()
+		b.msg.Properties[key] = properties
+	}
+	properties.Set(name, value)
+	return b
+}
+
+// Attaches the event to a group.
+func (b *CaptureBuilder) Group(groupType string, key interface{}) *CaptureBuilder {
+	if b.msg.Groups == nil {
+		b.msg.Groups = NewGroups()
+	}
+	b.msg.Groups.Set(groupType, key)
+	return b
+}
+
+// Sets the time the event happened at, the current time is used otherwise.
+func (b *CaptureBuilder) Timestamp(t time.Time) *CaptureBuilder {
+	b.msg.Timestamp = t
+	return b
+}
+
+// Sets the UUID of the event, one is generated otherwise.
+func (b *CaptureBuilder) Uuid(uuid string) *CaptureBuilder {
+	b.msg.Uuid = uuid
+	return b
+}
+
+// Attaches the feature flags of the user to the event.
+func (b *CaptureBuilder) SendFeatureFlags() *CaptureBuilder {
+	b.msg.SendFeatureFlags = true
+	return b
+}
+
+// Returns the capture, or an error if it is invalid. The builder can still be
+// used afterwards, changes don't affect the returned message.
+func (b *CaptureBuilder) Build() (Capture, error) {
+	msg := b.msg
+
+	if b.msg.Properties != nil {
+		msg.Properties = NewProperties().Merge(b.msg.Properties)
+		for _, key := range []string{"$set", "$set_once"} {
+			if properties, ok := msg.Properties[key].(Properties); ok {
+				msg.Properties[key] = NewProperties().Merge(properties)
+			}
+		}
+	}
+	if b.msg.Groups != nil {
+		msg.Groups = NewGroups()
+		for k, v := range b.msg.Groups {
+			msg.Groups[k] = v
+		}
+	}
+
+	if err := msg.Validate(); err != nil {
+		return Capture{}, err
+	}
+	return msg, nil
+}
+
+// Builds the capture and enqueues it on the client.
+func (b *CaptureBuilder) Send(client Client) error {
+	msg, err := b.Build()
+	if err != nil {
+		return err
+	}
+	return client.Enqueue(msg)
+}
@@ -1,6 +1,9 @@
 package posthog
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestCaptureMissingEvent(t *testing.T) {
 	capture := Capture{
@@ -52,3 +55,59 @@ func TestCaptureValidWithDistinctId(t *testing.T) {
 		t.Error("validating a valid capture object failed:", capture, err)
 	}
 }
+
+func TestCaptureBuilder(t *testing.T) {
+	b := NewCapture("signed_up").
+		DistinctId("1").
+		Prop("plan", "pro").
+		Group("company", "acme")
+
+	msg, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Event != "signed_up" || msg.DistinctId != "1" || msg.Properties["plan"] != "pro" || msg.Groups["company"] != "acme" {
+		t.Errorf("invalid capture built: %#v", msg)
+	}
+
+	b.Prop("plan", "free")
+	if msg.Properties["plan"] != "pro" {
+		t.Error("changes to the builder should not affect built messages")
+	}
+
+	if _, err := NewCapture("signed_up").Build(); err == nil {
+		t.Error("expected a capture without distinct ID to be invalid")
+	}
+
+	client := &testEnqueueClient{}
+	if err := b.Send(client); err != nil || len(client.msgs) != 1 {
+		t.Errorf("expected the capture to be enqueued, got %v %v", client.msgs, err)
+	}
+}
+
+func TestCaptureBuilderPersonProperties(t *testing.T) {
+	b := NewCapture("signed_up").
+		DistinctId("1").
+		Set("email", "max@example.com").
+		Set("plan", "pro").
+		SetOnce("initial_referrer", "example.com")
+
+	msg, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Properties{
+		"$set":      Properties{"email": "max@example.com", "plan": "pro"},
+		"$set_once": Properties{"initial_referrer": "example.com"},
+	}
+	if !reflect.DeepEqual(msg.Properties, expected) {
+		t.Errorf("expected %v, got %v", expected, msg.Properties)
+	}
+
+	b.Set("plan", "free")
+	if msg.Properties["$set"].(Properties)["plan"] != "pro" {
+		t.Error("changes to the builder should not affect built messages")
+	}
+}
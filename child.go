@@ -0,0 +1,124 @@
+package posthog
+
+import (
+	"context"
+	"math/rand"
+)
+
+// Options of the child clients created by Client.With.
+type Option func(*childClient)
+
+// Adds properties to every event captured by the child client, they are
+// merged with the properties of the capture following Config.PropertyMerge.
+// Properties of nested children overwrite the ones of their parent, unless
+// the strategy is MergeDeep.
+func WithProperties(properties Properties) Option {
+	return func(c *childClient) {
+		strategy := MergeCallerWins
+		if c.client.PropertyMerge == MergeDeep {
+			strategy = MergeDeep
+		}
+		c.properties = NewProperties().Merge(c.properties).MergeWith(properties, strategy)
+	}
+}
+
+// Sends only a ratio of the events captured by the child client, between 0
+// (none) and 1 (all, the default). Other messages are never sampled.
+func WithSampleRate(rate float64) Option {
+	return func(c *childClient) {
+		if rate < 0 {
+			rate = 0
+		}
+		if rate > 1 {
+			rate = 1
+		}
+		c.sampleRate = rate
+	}
+}
+
+// Sends the messages of the child client to the project of apiKey. Feature
+// flags are still evaluated with the project of the parent client.
+func WithApiKey(apiKey string) Option {
+	return func(c *childClient) {
+		c.key = apiKey
+	}
+}
+
+// A child client shares the queue, transport and feature flags of its parent
+// and only overrides how messages are enqueued.
+type childClient struct {
+	*client
+
+	// The project API key set by WithApiKey, the key of the parent is used
+	// when it is empty.
+	key        string
+	properties Properties
+	sampleRate float64
+	random     func() float64
+
+	// The values of flags forced by WithFlagOverrides, by key.
+	flagOverrides map[string]interface{}
+}
+
+func (c *client) With(opts ...Option) Client {
+	child := &childClient{
+		client:     c,
+		properties: NewProperties(),
+		sampleRate: 1,
+		random:     rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(child)
+	}
+	return child
+}
+
+// Returns a child client inheriting the options of this child.
+func (c *childClient) With(opts ...Option) Client {
+	child := *c
+	for _, opt := range opts {
+		opt(&child)
+	}
+	return &child
+}
+
+func (c *childClient) Enqueue(msg Message) error {
+	_, err := c.EnqueueWithResult(msg)
+	return err
+}
+
+// Sampled out captures aren't sent and return an empty result without error.
+func (c *childClient) EnqueueWithResult(msg Message) (EnqueueResult, error) {
+	return c.enqueue(context.Background(), msg)
+}
+
+func (c *childClient) EnqueueCtx(ctx context.Context, msg Message) error {
+	_, err := c.enqueue(ctx, msg)
+	return err
+}
+
+func (c *childClient) enqueue(ctx context.Context, msg Message) (EnqueueResult, error) {
+	msg = dereferenceMessage(msg)
+
+	if m, ok := msg.(Capture); ok {
+		if c.sampleRate < 1 && c.random() >= c.sampleRate {
+			return EnqueueResult{}, nil
+		}
+		if len(c.properties) != 0 {
+			m.Properties = NewProperties().Merge(c.properties).MergeWith(m.Properties, c.client.PropertyMerge)
+		}
+		msg = m
+	}
+
+	key := c.key
+	if key == "" {
+		key = c.apiKey()
+	}
+	return c.client.enqueue(ctx, msg, key)
+}
+
+// Closing a child client does nothing, the queue is owned by the parent
+// client.
+func (c *childClient) Close() error {
+	return nil
+}
@@ -0,0 +1,113 @@
+package posthog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClientWith(t *testing.T) {
+	var mutex sync.Mutex
+	batches := map[string][]CaptureInApi{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b struct {
+			ApiKey   string         `json:"api_key"`
+			Messages []CaptureInApi `json:"batch"`
+		}
+		json.NewDecoder(r.Body).Decode(&b)
+		mutex.Lock()
+		batches[b.ApiKey] = append(batches[b.ApiKey], b.Messages...)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("parent", Config{
+		Endpoint: server.URL,
+		Logger:   testLogger{t.Logf, t.Logf},
+	})
+
+	child := client.With(WithApiKey("tenant"), WithProperties(NewProperties().Set("tenant", "acme").Set("module", "billing")))
+	sampled := child.With(WithSampleRate(0))
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "parent"})
+	child.Enqueue(Capture{DistinctId: "1", Event: "child", Properties: NewProperties().Set("module", "invoices")})
+
+	if err := sampled.Enqueue(Capture{DistinctId: "1", Event: "sampled"}); err != nil {
+		t.Error("expected sampled out captures not to fail, got", err)
+	}
+
+	if err := child.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := client.Enqueue(Capture{DistinctId: "1", Event: "parent"}); err != nil {
+		t.Error("expected closing a child not to close the parent, got", err)
+	}
+	client.Close()
+
+	if n := len(batches["parent"]); n != 2 {
+		t.Errorf("expected 2 messages sent to the parent project, got %d", n)
+	}
+
+	if msgs := batches["tenant"]; len(msgs) != 1 {
+		t.Errorf("expected 1 message sent to the child project, got %+v", msgs)
+	} else if p := msgs[0].Properties; msgs[0].Event != "child" || p["tenant"] != "acme" || p["module"] != "invoices" {
+		t.Errorf("expected default properties to be merged, got %+v", p)
+	}
+}
+
+func TestClientWithFlagOverrides(t *testing.T) {
+	var records []FlagEvaluationRecord
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader: strings.NewReader(`{"flags": [
+			{"key": "new-checkout", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 0}]}},
+			{"key": "other-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}
+		]}`),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+		OnFlagEvaluated: func(record FlagEvaluationRecord) {
+			records = append(records, record)
+		},
+	})
+	defer client.Close()
+
+	canary := client.With(WithFlagOverrides(map[string]interface{}{"new-checkout": "variant-b"}))
+	nested := canary.With(WithFlagOverrides(map[string]interface{}{"other-flag": nil}))
+
+	payload := FeatureFlagPayload{Key: "new-checkout", DistinctId: "some-distinct-id"}
+	if value, _ := client.GetFeatureFlag(payload); value != false {
+		t.Error("Expected the parent not to be overridden, got", value)
+	}
+	if value, err := canary.GetFeatureFlag(payload); err != nil || value != "variant-b" {
+		t.Error("Expected the overridden variant, got", value, err)
+	}
+	if enabled, _ := canary.IsFeatureEnabled(payload); enabled == nil || !*enabled {
+		t.Error("Expected the overridden flag to be enabled, got", enabled)
+	}
+	if result, _ := nested.GetFeatureFlagResult(payload); result.Value != "variant-b" || !result.EvaluatedLocally {
+		t.Error("Expected nested children to inherit overrides, got", result)
+	}
+	if value, _ := canary.ForUser("some-distinct-id").GetFeatureFlag("new-checkout"); value != "variant-b" {
+		t.Error("Expected users of the child to be overridden, got", value)
+	}
+	if enabled, _ := nested.IsFeatureEnabled(FeatureFlagPayload{Key: "other-flag", DistinctId: "some-distinct-id"}); enabled != nil {
+		t.Error("Expected a nil override to make the flag undefined, got", enabled)
+	}
+
+	flags, err := nested.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id"})
+	if err != nil || !reflect.DeepEqual(flags, map[string]interface{}{"new-checkout": "variant-b"}) {
+		t.Error("Expected the overrides to be applied to all flags, got", flags, err)
+	}
+
+	if results, _ := canary.EvaluateFlagForMany("new-checkout", []string{"a", "b"}, nil); results["a"] != "variant-b" || results["b"] != "variant-b" {
+		t.Error("Expected the override for every distinct ID, got", results)
+	}
+
+	if len(records) == 0 || !records[1].Overridden || records[0].Overridden {
+		t.Errorf("Expected overridden evaluations to be reported, got %+v", records)
+	}
+}
@@ -0,0 +1,231 @@
+// Command posthog sends messages and evaluates feature flags with the PostHog
+// Go SDK, it is meant to verify project keys and flag targeting from CI and
+// terminals.
+//
+//	posthog --api-key phc_... capture --distinct-id user-1 --event signed_up
+//	posthog --api-key phc_... --personal-api-key phx_... flag --key beta --distinct-id user-1
+//
+// Keys and the endpoint can also be set with the POSTHOG_API_KEY,
+// POSTHOG_PERSONAL_API_KEY and POSTHOG_ENDPOINT environment variables. The
+// --debug flag tails the SDK debug output to stderr.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/posthog/posthog-go"
+	"github.com/urfave/cli"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "posthog"
+	app.Usage = "Send messages and evaluate feature flags with PostHog"
+	app.Version = posthog.Version
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "api-key", Usage: "the project API key", EnvVar: "POSTHOG_API_KEY"},
+		cli.StringFlag{Name: "personal-api-key", Usage: "the personal API key, required for feature flags", EnvVar: "POSTHOG_PERSONAL_API_KEY"},
+		cli.StringFlag{Name: "endpoint", Usage: "the PostHog instance URL", EnvVar: "POSTHOG_ENDPOINT", Value: posthog.DefaultEndpoint},
+		cli.BoolFlag{Name: "debug", Usage: "print the SDK debug output to stderr"},
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:    "capture",
+			Aliases: []string{"send"},
+			Usage:   "capture an event",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "distinct-id", Usage: "the distinct ID of the user"},
+				cli.StringFlag{Name: "event", Usage: "the name of the event"},
+				cli.StringFlag{Name: "properties", Usage: "the event properties as a JSON object"},
+			},
+			Action: func(c *cli.Context) error {
+				return send(c, posthog.Capture{
+					DistinctId: c.String("distinct-id"),
+					Event:      c.String("event"),
+					Properties: parseJSON(c.String("properties")),
+				})
+			},
+		},
+		{
+			Name:  "identify",
+			Usage: "set properties of a user",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "distinct-id", Usage: "the distinct ID of the user"},
+				cli.StringFlag{Name: "properties", Usage: "the user properties as a JSON object"},
+			},
+			Action: func(c *cli.Context) error {
+				return send(c, posthog.Identify{
+					DistinctId: c.String("distinct-id"),
+					Properties: parseJSON(c.String("properties")),
+				})
+			},
+		},
+		{
+			Name:  "alias",
+			Usage: "link two distinct IDs",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "distinct-id", Usage: "the distinct ID of the user"},
+				cli.StringFlag{Name: "alias", Usage: "the alias of the distinct ID"},
+			},
+			Action: func(c *cli.Context) error {
+				return send(c, posthog.Alias{
+					DistinctId: c.String("distinct-id"),
+					Alias:      c.String("alias"),
+				})
+			},
+		},
+		{
+			Name:  "flag",
+			Usage: "evaluate a feature flag for a distinct ID",
+			Flags: append(flagFlags(),
+				cli.StringFlag{Name: "key", Usage: "the key of the feature flag"},
+			),
+			Action: func(c *cli.Context) error {
+				client, err := newClient(c, nil)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				value, err := client.GetFeatureFlag(posthog.FeatureFlagPayload{
+					Key:                   c.String("key"),
+					DistinctId:            c.String("distinct-id"),
+					Groups:                parseJSON(c.String("groups")),
+					PersonProperties:      parseJSON(c.String("person-properties")),
+					OnlyEvaluateLocally:   c.Bool("local-only"),
+					SendFeatureFlagEvents: new(bool),
+				})
+				if err != nil {
+					return err
+				}
+				return printJSON(value)
+			},
+		},
+		{
+			Name:  "flags",
+			Usage: "evaluate all feature flags for a distinct ID",
+			Flags: flagFlags(),
+			Action: func(c *cli.Context) error {
+				client, err := newClient(c, nil)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				flags, err := client.GetAllFlags(posthog.FeatureFlagPayloadNoKey{
+					DistinctId:          c.String("distinct-id"),
+					Groups:              parseJSON(c.String("groups")),
+					PersonProperties:    parseJSON(c.String("person-properties")),
+					OnlyEvaluateLocally: c.Bool("local-only"),
+				})
+				if err != nil {
+					return err
+				}
+				return printJSON(flags)
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Flags shared by the commands evaluating feature flags.
+func flagFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{Name: "distinct-id", Usage: "the distinct ID of the user"},
+		cli.StringFlag{Name: "groups", Usage: "the groups of the user as a JSON object"},
+		cli.StringFlag{Name: "person-properties", Usage: "the properties of the user as a JSON object"},
+		cli.BoolFlag{Name: "local-only", Usage: "only evaluate flags locally, without calling /decide"},
+	}
+}
+
+// Creates a client configured from the global flags, messages are sent one by
+// one so failures can be reported for each of them.
+func newClient(c *cli.Context, callback posthog.Callback) (posthog.Client, error) {
+	logger := posthog.StdLogger(log.New(ioutil.Discard, "", 0))
+	if c.GlobalBool("debug") {
+		logger = posthog.StdLogger(log.New(os.Stderr, "posthog ", log.LstdFlags))
+	}
+
+	return posthog.NewWithConfig(c.GlobalString("api-key"), posthog.Config{
+		Endpoint:       c.GlobalString("endpoint"),
+		PersonalApiKey: c.GlobalString("personal-api-key"),
+		BatchSize:      1,
+		Verbose:        c.GlobalBool("debug"),
+		Logger:         logger,
+		Callback:       callback,
+	})
+}
+
+// Sends a message and waits for it to be uploaded.
+func send(c *cli.Context, msg posthog.Message) error {
+	cb := &callback{}
+
+	client, err := newClient(c, cb)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Enqueue(msg); err != nil {
+		client.Close()
+		return err
+	}
+
+	// Closing the client flushes the message.
+	client.Close()
+	return cb.err()
+}
+
+// parseJSON parses a JSON formatted string into a map, an empty string is
+// parsed as an empty map.
+func parseJSON(v string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == "" {
+		return m
+	}
+	if err := json.Unmarshal([]byte(v), &m); err != nil {
+		log.Fatalf("could not parse json %q: %s", v, err)
+	}
+	return m
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// callback implements the posthog.Callback interface, it records the first
+// upload failure so the command can exit with an error.
+type callback struct {
+	mutex   sync.Mutex
+	failure error
+}
+
+func (c *callback) Failure(m posthog.APIMessage, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.failure == nil {
+		c.failure = fmt.Errorf("could not upload message: %w", err)
+	}
+}
+
+func (c *callback) Success(_ posthog.APIMessage) {}
+
+func (c *callback) err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.failure
+}
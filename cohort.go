@@ -0,0 +1,89 @@
+package posthog
+
+// Cohorts can reference other cohorts, a definition nested deeper than this
+// is most likely cyclic and isn't evaluated locally.
+const maxCohortDepth = 16
+
+// The prefix of the person properties holding the membership of a person in a
+// cohort, followed by the ID of the cohort.
+const cohortMembershipPrefix = "$cohort/"
+
+// Matches a property referencing a cohort by ID against the definition of the
+// cohort. Cohorts without definition, like static cohorts, are matched with
+// the membership property when it is given, see CohortMembershipProperty,
+// and the match is inconclusive otherwise.
+func matchCohort(property Property, properties Properties, cohorts map[string]CohortProperties, depth int) (bool, error) {
+	if depth > maxCohortDepth {
+		return false, &InconclusiveMatchError{msg: "Cohort definitions are nested too deeply"}
+	}
+
+	id := propertyString(property.Value)
+	cohort, ok := cohorts[id]
+	if !ok {
+		if member, ok := properties[cohortMembershipPrefix+id].(bool); ok {
+			return member, nil
+		}
+		return false, &InconclusiveMatchError{msg: "Can't match cohort without a given cohort definition"}
+	}
+
+	return matchCohortProperties(cohort, properties, cohorts, depth+1)
+}
+
+// Matches a group of a cohort definition, nested groups and cohorts are
+// matched recursively. An inconclusive value only makes the group inconclusive
+// when the other values don't determine the result, like a value that doesn't
+// match in an AND group.
+func matchCohortProperties(group CohortProperties, properties Properties, cohorts map[string]CohortProperties, depth int) (bool, error) {
+	if len(group.Values) == 0 {
+		return true, nil
+	}
+
+	var inconclusiveErr error
+
+	for _, value := range group.Values {
+		var isMatch bool
+		var err error
+
+		switch value.Type {
+		case "AND", "OR":
+			isMatch, err = matchCohortProperties(value, properties, cohorts, depth)
+		default:
+			property := Property{Key: value.Key, Operator: value.Operator, Value: value.Value, Type: value.Type}
+			if property.Operator == "" {
+				property.Operator = "exact"
+			}
+
+			if property.Type == "cohort" {
+				isMatch, err = matchCohort(property, properties, cohorts, depth)
+			} else {
+				isMatch, err = matchProperty(property, properties)
+			}
+
+			if value.Negation {
+				isMatch = !isMatch
+			}
+		}
+
+		if err != nil {
+			if _, ok := err.(*InconclusiveMatchError); ok {
+				inconclusiveErr = err
+				continue
+			}
+			return false, err
+		}
+
+		if group.Type == "OR" && isMatch {
+			return true, nil
+		}
+		if group.Type != "OR" && !isMatch {
+			return false, nil
+		}
+	}
+
+	if inconclusiveErr != nil {
+		return false, inconclusiveErr
+	}
+
+	// Every value of an AND group matched, or none of an OR group did.
+	return group.Type != "OR", nil
+}
@@ -0,0 +1,92 @@
+package posthog
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// A Cohort of the project, returned by Client.GetCohorts.
+type Cohort struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Static cohorts are lists of persons uploaded or saved from an insight,
+	// their definitions aren't part of the flag definitions.
+	IsStatic bool `json:"is_static"`
+
+	// The number of persons in the cohort, nil while it is computed.
+	Count *int `json:"count"`
+}
+
+// Returns the person property holding the membership of a person in the
+// cohort. Static cohorts can't be matched by local evaluation, a flag
+// condition on one is matched with this property when it is passed in the
+// person properties, with the value returned by Client.IsInCohort.
+//
+//	inBeta, err := client.IsInCohort(ctx, 12, distinctId)
+//	...
+//	client.GetFeatureFlag(posthog.FeatureFlagPayload{
+//		Key:              "new-checkout",
+//		DistinctId:       distinctId,
+//		PersonProperties: posthog.NewProperties().Set(posthog.CohortMembershipProperty(12), inBeta),
+//	})
+func CohortMembershipProperty(cohortId int) string {
+	return cohortMembershipPrefix + strconv.Itoa(cohortId)
+}
+
+func (c *client) GetCohorts(ctx context.Context) ([]Cohort, error) {
+	var cohorts []Cohort
+	query := url.Values{"limit": {"100"}}
+	for {
+		var page struct {
+			Next    *string  `json:"next"`
+			Results []Cohort `json:"results"`
+		}
+		if err := c.projectRequest(ctx, "GET", "cohorts/?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		cohorts = append(cohorts, page.Results...)
+
+		if page.Next == nil || *page.Next == "" {
+			return cohorts, nil
+		}
+		next, err := url.Parse(*page.Next)
+		if err != nil {
+			return nil, err
+		}
+		query = next.Query()
+	}
+}
+
+func (c *client) IsInCohort(ctx context.Context, cohortId int, distinctId string) (bool, error) {
+	if err := validateDistinctId("posthog.IsInCohort", "distinctId", distinctId); err != nil {
+		return false, err
+	}
+
+	var persons struct {
+		Results []struct {
+			Uuid string `json:"uuid"`
+		} `json:"results"`
+	}
+	if err := c.projectRequest(ctx, "GET", "persons/?"+url.Values{"distinct_id": {distinctId}}.Encode(), nil, &persons); err != nil {
+		return false, err
+	}
+	if len(persons.Results) == 0 {
+		return false, nil
+	}
+
+	var cohorts struct {
+		Results []Cohort `json:"results"`
+	}
+	if err := c.projectRequest(ctx, "GET", "persons/cohorts/?"+url.Values{"person_id": {persons.Results[0].Uuid}}.Encode(), nil, &cohorts); err != nil {
+		return false, err
+	}
+	for _, cohort := range cohorts.Results {
+		if cohort.Id == cohortId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
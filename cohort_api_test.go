@@ -0,0 +1,106 @@
+package posthog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetCohorts(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/projects/@current/cohorts/" && r.URL.Query().Get("offset") == "":
+			w.Write([]byte(`{"next": "` + server.URL + `/api/projects/1/cohorts/?limit=100&offset=100", "results": [{"id": 1, "name": "Beta testers", "is_static": true, "count": 12}]}`))
+		case r.URL.Path == "/api/projects/@current/cohorts/" && r.URL.Query().Get("offset") == "100":
+			w.Write([]byte(`{"next": null, "results": [{"id": 2, "name": "Power users", "is_static": false, "count": null}]}`))
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+	})
+	defer client.Close()
+
+	cohorts, err := client.GetCohorts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cohorts) != 2 || cohorts[0].Name != "Beta testers" || !cohorts[0].IsStatic || *cohorts[0].Count != 12 || cohorts[1].Id != 2 || cohorts[1].Count != nil {
+		t.Errorf("unexpected cohorts: %+v", cohorts)
+	}
+}
+
+func TestIsInCohort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/projects/@current/persons/":
+			if r.URL.Query().Get("distinct_id") == "member" {
+				w.Write([]byte(`{"results": [{"uuid": "0190-member"}]}`))
+			} else {
+				w.Write([]byte(`{"results": []}`))
+			}
+		case r.URL.Path == "/api/projects/@current/persons/cohorts/":
+			if r.URL.Query().Get("person_id") != "0190-member" {
+				t.Errorf("unexpected person: %s", r.URL)
+			}
+			w.Write([]byte(`{"results": [{"id": 1}, {"id": 12}]}`))
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	tests := []struct {
+		cohortId   int
+		distinctId string
+		member     bool
+	}{
+		{12, "member", true},
+		{13, "member", false},
+		{12, "unknown", false},
+	}
+	for _, test := range tests {
+		if member, err := client.IsInCohort(ctx, test.cohortId, test.distinctId); err != nil || member != test.member {
+			t.Errorf("%d %s: expected %v, got %v %v", test.cohortId, test.distinctId, test.member, member, err)
+		}
+	}
+}
+
+func TestStaticCohortMatchedWithMembershipProperty(t *testing.T) {
+	flag := FeatureFlag{
+		Key:    "beta-feature",
+		Active: true,
+		Filters: Filter{Groups: []PropertyGroup{{
+			Properties: []Property{{Key: "id", Value: 12.0, Type: "cohort"}},
+		}}},
+	}
+
+	var inconclusiveErr *InconclusiveMatchError
+	if _, err := matchFeatureFlagProperties(flag, "user", Properties{}, nil, nil); !errors.As(err, &inconclusiveErr) {
+		t.Errorf("expected an inconclusive match without membership, got %v", err)
+	}
+
+	for _, member := range []bool{true, false} {
+		properties := NewProperties().Set(CohortMembershipProperty(12), member)
+		if result, err := matchFeatureFlagProperties(flag, "user", properties, nil, nil); err != nil || result != member {
+			t.Errorf("expected %v, got %v %v", member, result, err)
+		}
+	}
+}
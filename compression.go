@@ -0,0 +1,74 @@
+package posthog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+)
+
+// A Compressor compresses the payload of batches before they are uploaded,
+// see Config.Compression. The zstd subpackage provides a zstd implementation.
+// Compressors must be safe to use concurrently.
+type Compressor interface {
+
+	// The value of the Content-Encoding header of compressed requests.
+	Encoding() string
+
+	// Returns the compressed payload.
+	Compress(b []byte) ([]byte, error)
+}
+
+// A Compressor using gzip.
+type GzipCompressor struct {
+
+	// The compression level, between gzip.HuffmanOnly and
+	// gzip.BestCompression. The zero value uses gzip.DefaultCompression.
+	Level int
+}
+
+// Writers are expensive to allocate so they are reused, one pool per level.
+var gzipWriters [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+func (c GzipCompressor) level() int {
+	if c.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return c.Level
+}
+
+func (c GzipCompressor) validate() error {
+	if level := c.level(); level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return fmt.Errorf("invalid gzip compression level %d", c.Level)
+	}
+	return nil
+}
+
+func (c GzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+func (c GzipCompressor) Compress(b []byte) ([]byte, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	pool := &gzipWriters[c.level()-gzip.HuffmanOnly]
+
+	w, ok := pool.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w, _ = gzip.NewWriterLevel(&buf, c.level())
+	}
+	defer pool.Put(w)
+
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
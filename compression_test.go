@@ -0,0 +1,80 @@
+package posthog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzipCompression(t *testing.T) {
+	events := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected a gzip encoded request, got %q", r.Header.Get("Content-Encoding"))
+		}
+
+		var b struct{ Batch []CaptureInApi }
+		if gz, err := gzip.NewReader(r.Body); err != nil {
+			t.Error(err)
+		} else if err := json.NewDecoder(gz).Decode(&b); err != nil {
+			t.Error(err)
+		}
+		if len(b.Batch) == 1 {
+			events <- b.Batch[0].Event
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:    server.URL,
+		Logger:      testLogger{t.Logf, t.Logf},
+		Compression: GzipCompressor{Level: gzip.BestSpeed},
+		BatchSize:   1,
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A"})
+
+	if event := <-events; event != "A" {
+		t.Errorf("expected the compressed batch to be decoded, got %q", event)
+	}
+}
+
+func TestGzipCompressorReusesWriters(t *testing.T) {
+	c := GzipCompressor{}
+
+	for i := 0; i != 3; i++ {
+		b, err := c.Compress([]byte(`{"event":"A"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := ioutil.ReadAll(gz); string(s) != `{"event":"A"}` {
+			t.Errorf("invalid gzip payload: %q", s)
+		}
+	}
+}
+
+func TestConfigInvalidCompression(t *testing.T) {
+	c := Config{
+		Compression: GzipCompressor{Level: 42},
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "Compression" {
+		t.Error("invalid field error reported:", e)
+	}
+}
@@ -1,6 +1,7 @@
 package posthog
 
 import (
+	"io"
 	"net/http"
 	"time"
 
@@ -27,9 +28,189 @@ type Config struct {
 	// timer triggers.
 	Interval time.Duration
 
+	// When set to true the client doesn't flush messages from a background
+	// timer, instead the flush interval is checked on every call to Enqueue
+	// and the call that finds it elapsed sends queued messages before
+	// returning. This is meant for environments like Cloud Run or Cloud
+	// Functions where CPU is throttled outside of request handling and timer
+	// goroutines may never get scheduled.
+	// Messages are still sent in the background when a batch is full.
+	InlineFlush bool
+
+	// When set to true the client starts no goroutines, messages are batched
+	// as they are enqueued but only sent when the application calls Pump,
+	// which also fetches feature flag definitions once the polling interval
+	// elapsed. This is meant for environments where libraries must not own
+	// goroutines, like plugins or WASM. Flush and Close send the queued
+	// messages on the calling goroutine.
+	ManualPump bool
+
+	// Messages with a timestamp in a zone other than UTC that is further than
+	// this from the current time are logged as warnings, since they usually
+	// come from a local wall clock mistaken for UTC and skew daily metrics.
+	// One hour by default.
+	TimestampSkewThreshold time.Duration
+
+	// When set to true messages with an invalid distinct ID (see
+	// DistinctIdError) are sent with a generated anonymous ID instead of
+	// being rejected by Enqueue. Empty distinct IDs are still rejected.
+	AnonymizeInvalidDistinctIds bool
+
+	// When set to true the client fails loudly on errors that are otherwise
+	// only logged: background failures (flag definitions that couldn't be
+	// fetched, dropped messages) are passed to ErrorHandler and Enqueue
+	// returns an error when feature flags can't be attached to a capture.
+	// Meant for staging environments that prefer loud failures.
+	Strict bool
+
+	// The function called with background errors in strict mode, it is
+	// required when Strict is set and ignored otherwise. It may be called
+	// concurrently from multiple goroutines.
+	ErrorHandler func(error)
+
+	// The schemas captures are checked against when they are enqueued.
+	// Captures that don't match their schema are logged as warnings, unless
+	// RejectSchemaViolations is set.
+	Schemas *SchemaRegistry
+
+	// When set to true Enqueue returns a *SchemaViolationError for captures
+	// that don't match their schema instead of sending them.
+	RejectSchemaViolations bool
+
+	// The naming convention the names of captured events are checked against
+	// when they are enqueued. Names breaking it are logged as warnings, unless
+	// RejectEventNameViolations is set.
+	EventNaming *EventNamingConvention
+
+	// When set to true Enqueue returns an *EventNameError for captures whose
+	// name breaks the naming convention instead of sending them.
+	RejectEventNameViolations bool
+
+	// When set every batch sent to PostHog is also written to this sink,
+	// whether the upload succeeds or not.
+	Tee *NDJSONSink
+
+	// When set batches that are dropped after failing to be uploaded are
+	// written to this sink so they can be replayed later on.
+	Fallback *NDJSONSink
+
+	// The store used to persist state of the client, like the feature flag
+	// calls that were already reported, so it is shared between processes.
+	// When nil the state is kept in memory by each client.
+	Store Store
+
+	// How default properties, like the ones of child clients created with
+	// Client.With, are merged with the properties of captured events. The
+	// properties of the event win by default.
+	PropertyMerge MergeStrategy
+
+	// The maximum number of local feature flag evaluations kept in memory,
+	// keyed by distinct ID, flag and properties. Services evaluating many
+	// flags for the same user skip repeated hashing and condition matching.
+	// Evaluations aren't cached when zero, the cache is cleared when flag
+	// definitions are reloaded.
+	LocalEvaluationCacheSize int
+
+	// How long local evaluations are cached, DefaultLocalEvaluationCacheTTL
+	// by default.
+	LocalEvaluationCacheTTL time.Duration
+
+	// The maximum number of remote flag evaluations kept in memory, keyed by
+	// distinct ID, groups and properties. Services evaluating flags that
+	// can't be evaluated locally many times for the same user then call
+	// /flags once for all of them. Evaluations aren't cached when zero, the
+	// cache is cleared when flags are reloaded.
+	RemoteEvaluationCacheSize int
+
+	// How long remote evaluations are cached,
+	// DefaultRemoteEvaluationCacheTTL by default.
+	RemoteEvaluationCacheTTL time.Duration
+
+	// When set to true every captured event is enriched with the feature
+	// flags of its distinct ID, like Capture.SendFeatureFlags does for a
+	// single event. Flags are evaluated locally once definitions are loaded,
+	// so it requires a PersonalApiKey or offline definitions.
+	SendFeatureFlags bool
+
+	// Whether evaluating a feature flag captures a $feature_flag_called event,
+	// which powers flag usage analytics. Events are only sent once per
+	// distinct ID and flag. True when nil, it can be overridden by each call
+	// with FeatureFlagPayload.SendFeatureFlagEvents.
+	SendFeatureFlagEvents *bool
+
 	// Interval at which to fetch new feature flags, 5min by default
 	DefaultFeatureFlagsPollingInterval time.Duration
 
+	// How long flag definitions are used after the last successful fetch.
+	// When fetches keep failing past it, flags evaluate to nil with a
+	// *StaleFlagsError instead of being served from outdated definitions.
+	// Definitions are used until they are replaced when zero, offline
+	// definitions never go stale.
+	MaxFlagStaleness time.Duration
+
+	// The backoff applied when fetching flag definitions fails, so an
+	// erroring or rate limiting flags endpoint isn't polled at the regular
+	// interval. The function is called with the number of consecutive failed
+	// fetches minus one and returns how long to wait before the next one,
+	// the regular interval resumes after a successful fetch.
+	// By default the wait doubles from the polling interval with some jitter,
+	// up to DefaultFeatureFlagsMaxBackoff. Use NewBacko for other caps.
+	FeatureFlagsBackoff func(int) time.Duration
+
+	// The timeout of the requests made to evaluate feature flags and fetch
+	// their definitions, DefaultFeatureFlagRequestTimeout by default. It is
+	// shorter than the timeout of batch uploads since flags are usually
+	// evaluated while handling a request. It is ignored by transports that
+	// don't support timeouts.
+	FeatureFlagRequestTimeout time.Duration
+
+	// The number of pages of flag definitions fetched at once when the
+	// definitions span several pages, DefaultFeatureFlagsPageConcurrency by
+	// default. Definitions are only used once all pages are fetched.
+	FeatureFlagsPageConcurrency int
+
+	// The path of a JSON file of flag definitions, in the format returned by
+	// the local evaluation endpoint. When set flags are evaluated offline:
+	// definitions are loaded from the file when the client is created instead
+	// of being fetched, and flags that can't be evaluated locally aren't sent
+	// to /decide. It doesn't require a PersonalApiKey, which makes it
+	// suitable for air-gapped environments and tests.
+	FeatureFlagsFile string
+
+	// Same as FeatureFlagsFile but definitions are read from this reader,
+	// once.
+	FeatureFlagsReader io.Reader
+
+	// When set to true FeatureFlagsFile is checked for changes at the polling
+	// interval and definitions are reloaded when it was modified.
+	WatchFeatureFlagsFile bool
+
+	// The function called after flag definitions were loaded when they differ
+	// from the previous ones, with old being nil for the first load. It lets
+	// applications invalidate caches or reconfigure subsystems when a flag
+	// changes. It is called by the goroutine fetching definitions, which
+	// waits for it to return.
+	OnFeatureFlagsChanged func(old, new []FeatureFlag)
+
+	// When set to true the client also subscribes to the server-sent events
+	// of the flag stream endpoint and reloads flag definitions as soon as
+	// they change, instead of waiting up to a full polling interval. Polling
+	// keeps going in case the stream is interrupted. It has no effect with
+	// ManualPump.
+	FeatureFlagsStreaming bool
+
+	// The function called after each flag evaluation of GetFeatureFlag,
+	// IsFeatureEnabled, GetFeatureFlagResult and GetAllFlags, to log or audit
+	// flag decisions. GetAllFlags reports a record for every flag it returns.
+	// It is called by the goroutine evaluating the flag, which waits for it to
+	// return.
+	OnFlagEvaluated func(FlagEvaluationRecord)
+
+	// The endpoint flags that can't be evaluated locally are evaluated with.
+	// By default /flags is called and the client falls back to /decide when
+	// the instance doesn't support /flags yet.
+	FlagsEndpoint FlagsEndpoint
+
 	// The HTTP transport used by the client, this allows an application to
 	// redefine how requests are being sent at the HTTP level (for example,
 	// to change the connection pooling policy).
@@ -46,6 +227,10 @@ type Config struct {
 	// application when messages sends to the backend API succeeded or failed.
 	Callback Callback
 
+	// The compressor applied to the payload of batches, like GzipCompressor.
+	// Batches are sent uncompressed when nil.
+	Compression Compressor
+
 	// The maximum number of messages that will be sent in one API call.
 	// Messages will be sent when they've been queued up to the maximum batch
 	// size or when the flushing interval timer triggers.
@@ -53,6 +238,13 @@ type Config struct {
 	// which is independent from the number of embedded messages.
 	BatchSize int
 
+	// When set the batch size and flush interval adapt to the rate of
+	// messages within the given bounds, growing batches and flushing more
+	// often during bursts and the opposite when idle. BatchSize and Interval
+	// are the starting point. It has no effect with InlineFlush or
+	// ManualPump, which don't flush from a timer.
+	AdaptiveBatching *AdaptiveBatching
+
 	// When set to true the client will send more frequent and detailed messages
 	// to its logger.
 	Verbose bool
@@ -91,9 +283,33 @@ const DefaultEndpoint = "https://app.posthog.com"
 // none was explicitly set.
 const DefaultInterval = 5 * time.Second
 
+// This constant sets the default threshold after which local-zone message
+// timestamps are reported as skewed.
+const DefaultTimestampSkewThreshold = time.Hour
+
 // Specifies the default interval at which to fetch new feature flags
 const DefaultFeatureFlagsPollingInterval = 5 * time.Minute
 
+// This constant sets the default upper limit of the wait between failed
+// fetches of flag definitions, it is raised to the polling interval if that's
+// longer.
+const DefaultFeatureFlagsMaxBackoff = 30 * time.Minute
+
+// This constant sets the default timeout of feature flag requests.
+const DefaultFeatureFlagRequestTimeout = 3 * time.Second
+
+// This constant sets the default number of pages of flag definitions fetched
+// at once.
+const DefaultFeatureFlagsPageConcurrency = 4
+
+// This constant sets the default duration local feature flag evaluations are
+// cached for when the cache is enabled.
+const DefaultLocalEvaluationCacheTTL = 10 * time.Second
+
+// This constant sets the default duration remote feature flag evaluations are
+// cached for when the cache is enabled.
+const DefaultRemoteEvaluationCacheTTL = 10 * time.Second
+
 // This constant sets the default batch size used by client instances if none
 // was explicitly set.
 const DefaultBatchSize = 250
@@ -109,6 +325,128 @@ func (c *Config) validate() error {
 		}
 	}
 
+	if c.TimestampSkewThreshold < 0 {
+		return ConfigError{
+			Reason: "negative time intervals are not supported",
+			Field:  "TimestampSkewThreshold",
+			Value:  c.TimestampSkewThreshold,
+		}
+	}
+
+	if c.MaxFlagStaleness < 0 {
+		return ConfigError{
+			Reason: "negative time intervals are not supported",
+			Field:  "MaxFlagStaleness",
+			Value:  c.MaxFlagStaleness,
+		}
+	}
+
+	if c.FeatureFlagsPageConcurrency < 0 {
+		return ConfigError{
+			Reason: "negative concurrency is not supported",
+			Field:  "FeatureFlagsPageConcurrency",
+			Value:  c.FeatureFlagsPageConcurrency,
+		}
+	}
+
+	if c.FeatureFlagRequestTimeout < 0 {
+		return ConfigError{
+			Reason: "negative timeouts are not supported",
+			Field:  "FeatureFlagRequestTimeout",
+			Value:  c.FeatureFlagRequestTimeout,
+		}
+	}
+
+	if c.Strict && c.ErrorHandler == nil {
+		return ConfigError{
+			Reason: "strict mode requires an error handler",
+			Field:  "ErrorHandler",
+			Value:  c.ErrorHandler,
+		}
+	}
+
+	if c.FeatureFlagsFile != "" && c.FeatureFlagsReader != nil {
+		return ConfigError{
+			Reason: "flag definitions can't be loaded from both a file and a reader",
+			Field:  "FeatureFlagsReader",
+			Value:  c.FeatureFlagsReader,
+		}
+	}
+
+	if c.WatchFeatureFlagsFile && c.FeatureFlagsFile == "" {
+		return ConfigError{
+			Reason: "watching flag definitions requires a file",
+			Field:  "WatchFeatureFlagsFile",
+			Value:  c.WatchFeatureFlagsFile,
+		}
+	}
+
+	if c.SendFeatureFlags && c.PersonalApiKey == "" && c.FeatureFlagsFile == "" && c.FeatureFlagsReader == nil {
+		return ConfigError{
+			Reason: "sending feature flags with events requires a personal API key",
+			Field:  "SendFeatureFlags",
+			Value:  c.SendFeatureFlags,
+		}
+	}
+
+	if c.LocalEvaluationCacheSize < 0 {
+		return ConfigError{
+			Reason: "negative cache sizes are not supported",
+			Field:  "LocalEvaluationCacheSize",
+			Value:  c.LocalEvaluationCacheSize,
+		}
+	}
+
+	if c.LocalEvaluationCacheTTL < 0 {
+		return ConfigError{
+			Reason: "negative time intervals are not supported",
+			Field:  "LocalEvaluationCacheTTL",
+			Value:  c.LocalEvaluationCacheTTL,
+		}
+	}
+
+	if c.RemoteEvaluationCacheSize < 0 {
+		return ConfigError{
+			Reason: "negative cache sizes are not supported",
+			Field:  "RemoteEvaluationCacheSize",
+			Value:  c.RemoteEvaluationCacheSize,
+		}
+	}
+
+	if c.RemoteEvaluationCacheTTL < 0 {
+		return ConfigError{
+			Reason: "negative time intervals are not supported",
+			Field:  "RemoteEvaluationCacheTTL",
+			Value:  c.RemoteEvaluationCacheTTL,
+		}
+	}
+
+	if c.FlagsEndpoint < FlagsEndpointAuto || c.FlagsEndpoint > FlagsEndpointDecide {
+		return ConfigError{
+			Reason: "unknown flags endpoint",
+			Field:  "FlagsEndpoint",
+			Value:  c.FlagsEndpoint,
+		}
+	}
+
+	if c.PropertyMerge < MergeCallerWins || c.PropertyMerge > MergeDeep {
+		return ConfigError{
+			Reason: "unknown property merge strategy",
+			Field:  "PropertyMerge",
+			Value:  c.PropertyMerge,
+		}
+	}
+
+	if gz, ok := c.Compression.(GzipCompressor); ok {
+		if err := gz.validate(); err != nil {
+			return ConfigError{
+				Reason: err.Error(),
+				Field:  "Compression",
+				Value:  c.Compression,
+			}
+		}
+	}
+
 	if c.BatchSize < 0 {
 		return ConfigError{
 			Reason: "negative batch sizes are not supported",
@@ -117,6 +455,16 @@ func (c *Config) validate() error {
 		}
 	}
 
+	if c.AdaptiveBatching != nil {
+		if err := c.AdaptiveBatching.validate(); err != nil {
+			return ConfigError{
+				Reason: err.Error(),
+				Field:  "AdaptiveBatching",
+				Value:  c.AdaptiveBatching,
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -131,10 +479,38 @@ func makeConfig(c Config) Config {
 		c.Interval = DefaultInterval
 	}
 
+	if c.TimestampSkewThreshold == 0 {
+		c.TimestampSkewThreshold = DefaultTimestampSkewThreshold
+	}
+
 	if c.DefaultFeatureFlagsPollingInterval == 0 {
 		c.DefaultFeatureFlagsPollingInterval = DefaultInterval
 	}
 
+	if c.FeatureFlagsBackoff == nil {
+		cap := DefaultFeatureFlagsMaxBackoff
+		if c.DefaultFeatureFlagsPollingInterval > cap {
+			cap = c.DefaultFeatureFlagsPollingInterval
+		}
+		c.FeatureFlagsBackoff = NewBacko(c.DefaultFeatureFlagsPollingInterval, 2, 0.25, cap).Duration
+	}
+
+	if c.FeatureFlagRequestTimeout == 0 {
+		c.FeatureFlagRequestTimeout = DefaultFeatureFlagRequestTimeout
+	}
+
+	if c.FeatureFlagsPageConcurrency == 0 {
+		c.FeatureFlagsPageConcurrency = DefaultFeatureFlagsPageConcurrency
+	}
+
+	if c.LocalEvaluationCacheTTL == 0 {
+		c.LocalEvaluationCacheTTL = DefaultLocalEvaluationCacheTTL
+	}
+
+	if c.RemoteEvaluationCacheTTL == 0 {
+		c.RemoteEvaluationCacheTTL = DefaultRemoteEvaluationCacheTTL
+	}
+
 	if c.Transport == nil {
 		c.Transport = http.DefaultTransport
 	}
@@ -147,6 +523,11 @@ func makeConfig(c Config) Config {
 		c.BatchSize = DefaultBatchSize
 	}
 
+	if c.AdaptiveBatching != nil {
+		a := c.AdaptiveBatching.withDefaults(c.BatchSize, c.Interval)
+		c.AdaptiveBatching = &a
+	}
+
 	if c.RetryAfter == nil {
 		c.RetryAfter = DefaultBacko().Duration
 	}
@@ -44,3 +44,83 @@ func TestConfigInvalidBatchSize(t *testing.T) {
 		t.Error("invalid field error reported:", e)
 	}
 }
+
+func TestConfigInvalidTimestampSkewThreshold(t *testing.T) {
+	c := Config{
+		TimestampSkewThreshold: -1 * time.Minute,
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "TimestampSkewThreshold" || e.Value.(time.Duration) != (-1*time.Minute) {
+		t.Error("invalid field error reported:", e)
+	}
+}
+
+func TestConfigInvalidFeatureFlagRequestTimeout(t *testing.T) {
+	c := Config{
+		FeatureFlagRequestTimeout: -1 * time.Second,
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "FeatureFlagRequestTimeout" || e.Value.(time.Duration) != (-1*time.Second) {
+		t.Error("invalid field error reported:", e)
+	}
+}
+
+func TestConfigStrictWithoutErrorHandler(t *testing.T) {
+	c := Config{
+		Strict: true,
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "ErrorHandler" {
+		t.Error("invalid field error reported:", e)
+	}
+}
+
+func TestConfigInvalidFlagsEndpoint(t *testing.T) {
+	c := Config{
+		FlagsEndpoint: FlagsEndpoint(42),
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "FlagsEndpoint" {
+		t.Error("invalid field error reported:", e)
+	}
+}
+
+func TestConfigInvalidPropertyMerge(t *testing.T) {
+	c := Config{
+		PropertyMerge: MergeStrategy(42),
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("no error returned when validating a malformed config")
+
+	} else if e, ok := err.(ConfigError); !ok {
+		t.Error("invalid error returned when checking a malformed config:", err)
+
+	} else if e.Field != "PropertyMerge" {
+		t.Error("invalid field error reported:", e)
+	}
+}
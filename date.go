@@ -0,0 +1,87 @@
+package posthog
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Relative dates like "-30d" or "1w" used by date conditions, they are always
+// interpreted as that long before the current time.
+var relativeDatePattern = regexp.MustCompile(`^-?([0-9]+)([hdwmy])$`)
+
+// Layouts accepted for absolute dates, both in flag definitions and property
+// values. Dates without a zone are in UTC.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Matches the is_date_before and is_date_after operators, the date of the
+// condition may be relative to now.
+func matchDate(property Property, overrideValue interface{}, now time.Time) (bool, error) {
+	date, ok := parseFlagDate(property.Value, now)
+	if !ok {
+		return false, &InconclusiveMatchError{msg: "The date set on the flag is not a valid format", err: &InvalidDateError{Property: property.Key, Value: property.Value}}
+	}
+
+	overrideDate, ok := parseDate(overrideValue)
+	if !ok {
+		return false, &InconclusiveMatchError{msg: "The date provided is not a valid format", err: &InvalidDateError{Property: property.Key, Value: overrideValue}}
+	}
+
+	if property.Operator == "is_date_before" {
+		return overrideDate.Before(date), nil
+	}
+	return overrideDate.After(date), nil
+}
+
+func parseFlagDate(value interface{}, now time.Time) (time.Time, bool) {
+	if s, ok := value.(string); ok {
+		if m := relativeDatePattern.FindStringSubmatch(s); m != nil {
+			return relativeDate(m[1], m[2], now)
+		}
+	}
+	return parseDate(value)
+}
+
+func relativeDate(number string, interval string, now time.Time) (time.Time, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n >= 10000 {
+		// Avoid overflows, nobody targets dates that far away.
+		return time.Time{}, false
+	}
+
+	switch interval {
+	case "h":
+		return now.Add(-time.Duration(n) * time.Hour), true
+	case "d":
+		return now.AddDate(0, 0, -n), true
+	case "w":
+		return now.AddDate(0, 0, -7*n), true
+	case "m":
+		return now.AddDate(0, -n, 0), true
+	default:
+		return now.AddDate(-n, 0, 0), true
+	}
+}
+
+func parseDate(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,62 @@
+package posthog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMatchDate(t *testing.T) {
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		operator string
+		value    interface{}
+		override interface{}
+		match    bool
+	}{
+		{"is_date_before", "2022-05-01", "2022-04-30", true},
+		{"is_date_before", "2022-05-01", "2022-05-01T00:00:01Z", false},
+		{"is_date_after", "2022-05-01T10:00:00+02:00", "2022-05-01T09:00:00Z", true},
+		{"is_date_after", "2022-05-01", time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC), false},
+		{"is_date_before", "-30d", "2022-03-31", true},
+		{"is_date_before", "-30d", "2022-04-02", false},
+		{"is_date_after", "-2h", "2022-05-01 11:00:00", true},
+		{"is_date_after", "1w", "2022-04-23", false},
+		{"is_date_after", "-1m", "2022-04-02", true},
+		{"is_date_before", "-1y", "2021-04-30", true},
+	}
+
+	for _, test := range tests {
+		property := Property{Key: "signup", Operator: test.operator, Value: test.value}
+		match, err := matchDate(property, test.override, now)
+		if err != nil || match != test.match {
+			t.Errorf("%s %v %v: expected %t, got %t %v", test.operator, test.value, test.override, test.match, match, err)
+		}
+	}
+}
+
+func TestMatchDateInvalid(t *testing.T) {
+	now := time.Now()
+
+	for _, test := range []struct{ value, override interface{} }{
+		{"not a date", "2022-05-01"},
+		{"-10000d", "2022-05-01"},
+		{"2022-05-01", "yesterday"},
+		{"2022-05-01", 42},
+	} {
+		property := Property{Key: "signup", Operator: "is_date_before", Value: test.value}
+		_, err := matchDate(property, test.override, now)
+
+		var inconclusiveErr *InconclusiveMatchError
+		var dateErr *InvalidDateError
+		if !errors.As(err, &inconclusiveErr) || !errors.As(err, &dateErr) {
+			t.Errorf("%v %v: expected an inconclusive match caused by an invalid date, got %v", test.value, test.override, err)
+		}
+	}
+
+	// The operator is supported by matchProperty.
+	if match, err := matchProperty(Property{Key: "signup", Operator: "is_date_before", Value: "2999-01-01"}, NewProperties().Set("signup", "2022-05-01")); err != nil || !match {
+		t.Errorf("expected the date to match, got %t %v", match, err)
+	}
+}
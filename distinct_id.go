@@ -0,0 +1,93 @@
+package posthog
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The maximum length of a distinct ID accepted by the client, longer IDs are
+// rejected by the API.
+const MaxDistinctIdLength = 200
+
+// Values that commonly end up as distinct IDs when a missing value gets
+// serialized, compared case-insensitively. Events sent with these IDs are all
+// attributed to the same garbage person.
+var sentinelDistinctIds = map[string]bool{
+	"null":            true,
+	"undefined":       true,
+	"none":            true,
+	"nil":             true,
+	"nan":             true,
+	"[object object]": true,
+}
+
+// Verifies that a distinct ID can identify a person. Empty IDs are reported
+// with a FieldError like other missing fields, other invalid IDs with a
+// DistinctIdError.
+func validateDistinctId(typ string, name string, id string) error {
+	if len(id) == 0 {
+		return FieldError{
+			Type:  typ,
+			Name:  name,
+			Value: id,
+		}
+	}
+
+	reason := ""
+	switch {
+	case strings.TrimSpace(id) == "":
+		reason = "whitespace-only distinct IDs are not supported"
+	case utf8.RuneCountInString(id) > MaxDistinctIdLength:
+		reason = "distinct IDs are limited to 200 characters"
+	case sentinelDistinctIds[strings.ToLower(strings.TrimSpace(id))]:
+		reason = "distinct ID is a placeholder for a missing value"
+	}
+
+	if reason != "" {
+		return DistinctIdError{
+			Type:   typ,
+			Name:   name,
+			Value:  id,
+			Reason: reason,
+		}
+	}
+
+	return nil
+}
+
+// Replaces invalid distinct IDs of a message with generated anonymous IDs so
+// the message is still sent, a warning is logged for each replaced ID.
+func (c *client) anonymizeDistinctIds(msg Message) Message {
+	anonymize := func(typ string, name string, id string) string {
+		if _, ok := validateDistinctId(typ, name, id).(DistinctIdError); !ok {
+			return id
+		}
+		anonId := c.uid()
+		c.log(LogLevelWarn, "replacing invalid distinct id", LogField{"type", typ}, LogField{"field", name}, LogField{"distinct_id", id}, LogField{"anon_distinct_id", anonId})
+		return anonId
+	}
+
+	switch m := msg.(type) {
+	case Capture:
+		m.DistinctId = anonymize("posthog.Capture", "DistinctId", m.DistinctId)
+		return m
+	case Identify:
+		m.DistinctId = anonymize("posthog.Identify", "DistinctId", m.DistinctId)
+		return m
+	case Alias:
+		m.DistinctId = anonymize("posthog.Alias", "DistinctId", m.DistinctId)
+		return m
+	}
+
+	return msg
+}
+
+// Returns distinctId, or a generated ID when it is empty along with the
+// property telling PostHog not to create a person for the event.
+func personlessDistinctId(distinctId string, properties Properties) string {
+	if distinctId != "" {
+		return distinctId
+	}
+	properties.Set("$process_person_profile", false)
+	return uid()
+}
@@ -0,0 +1,66 @@
+package posthog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDistinctId(t *testing.T) {
+	for _, id := range []string{"123456", "user@example.com", "nullable", strings.Repeat("a", MaxDistinctIdLength)} {
+		if err := validateDistinctId("posthog.Capture", "DistinctId", id); err != nil {
+			t.Errorf("%q: unexpected error: %s", id, err)
+		}
+	}
+
+	if _, ok := validateDistinctId("posthog.Capture", "DistinctId", "").(FieldError); !ok {
+		t.Error("empty distinct ids should be reported with a FieldError")
+	}
+
+	for _, id := range []string{" ", "\t\n", "null", "undefined", "None", " NULL ", strings.Repeat("a", MaxDistinctIdLength+1)} {
+		err := validateDistinctId("posthog.Capture", "DistinctId", id)
+		if e, ok := err.(DistinctIdError); !ok || e.Value != id || e.Reason == "" {
+			t.Errorf("%q: expected a DistinctIdError, got %v", id, err)
+		}
+	}
+}
+
+func TestEnqueueInvalidDistinctId(t *testing.T) {
+	client := New("0123456789")
+	defer client.Close()
+
+	if _, ok := client.Enqueue(Capture{DistinctId: "undefined", Event: "A"}).(DistinctIdError); !ok {
+		t.Error("expected Enqueue to reject sentinel distinct ids")
+	}
+
+	_, err := client.IsFeatureEnabled(FeatureFlagPayload{Key: "flag", DistinctId: "null"})
+	if _, ok := err.(DistinctIdError); !ok {
+		t.Error("expected flag evaluation to reject sentinel distinct ids, got", err)
+	}
+}
+
+func TestEnqueueAnonymizeInvalidDistinctIds(t *testing.T) {
+	body, server := mockServer()
+	defer server.Close()
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:                    server.URL,
+		BatchSize:                   1,
+		AnonymizeInvalidDistinctIds: true,
+		Logger:                      testLogger{t.Logf, t.Logf},
+		uid:                         mockId,
+		now:                         mockTime,
+	})
+	defer client.Close()
+
+	if err := client.Enqueue(Capture{DistinctId: "", Event: "A"}); err == nil {
+		t.Error("expected empty distinct ids to still be rejected")
+	}
+
+	if err := client.Enqueue(Capture{DistinctId: "None", Event: "A"}); err != nil {
+		t.Fatal("expected invalid distinct id to be replaced, got", err)
+	}
+
+	if res := string(<-body); !strings.Contains(res, `"distinct_id": "I'm unique"`) {
+		t.Errorf("expected the distinct id to be replaced with a generated one: %s", res)
+	}
+}
@@ -0,0 +1,97 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+const earlyAccessFeaturesEndpoint = "api/early_access_features/"
+
+// The event captured when a user opts in or out of an early access feature.
+const FeatureEnrollmentUpdateEvent = "$feature_enrollment_update"
+
+// An EarlyAccessFeature is a feature users can opt in to before it is
+// released, returned by Client.GetEarlyAccessFeatures.
+type EarlyAccessFeature struct {
+	Id               string `json:"id"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	DocumentationUrl string `json:"documentationUrl"`
+
+	// The stage of the feature, like "concept", "beta" or
+	// "general-availability".
+	Stage string `json:"stage"`
+
+	// The key of the feature flag enabling the feature for the users who
+	// enrolled.
+	FlagKey string `json:"flagKey"`
+}
+
+// Returns the person property recording the enrollment of a user in the early
+// access feature of the flag. The flags of early access features are enabled
+// for the persons with this property set to true.
+func FeatureEnrollmentProperty(flagKey string) string {
+	return "$feature_enrollment/" + flagKey
+}
+
+func (c *client) GetEarlyAccessFeatures() ([]EarlyAccessFeature, error) {
+	return c.GetEarlyAccessFeaturesCtx(context.Background())
+}
+
+func (c *client) GetEarlyAccessFeaturesCtx(ctx context.Context) ([]EarlyAccessFeature, error) {
+	u, err := url.Parse(c.Endpoint + "/" + earlyAccessFeaturesEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	searchParams := u.Query()
+	searchParams.Add("token", c.apiKey())
+	u.RawQuery = searchParams.Encode()
+
+	status, body, err := doRequest(ctx, &c.http, "GET", u.String(), []byte{}, nil)
+	if err != nil {
+		c.report(u.String(), status, body, err)
+		return nil, fmt.Errorf("unable to fetch early access features: %w", err)
+	}
+
+	var response struct {
+		EarlyAccessFeatures []EarlyAccessFeature `json:"earlyAccessFeatures"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("unable to parse early access features: %w", err)
+	}
+	return response.EarlyAccessFeatures, nil
+}
+
+// Opts the user in or out of the early access feature of the flag, by setting
+// the person property returned by FeatureEnrollmentProperty. The flag is
+// evaluated again by the handle with the new enrollment.
+func (u *User) SetFeatureEnrollment(flagKey string, enrolled bool) error {
+	property := FeatureEnrollmentProperty(flagKey)
+
+	u.mutex.Lock()
+	u.properties.Set(property, enrolled)
+	delete(u.flags, flagKey)
+	u.mutex.Unlock()
+
+	return u.client.Enqueue(Capture{
+		DistinctId: u.distinctId,
+		Event:      FeatureEnrollmentUpdateEvent,
+		Properties: NewProperties().
+			Set("$feature_flag", flagKey).
+			Set("$feature_enrollment", enrolled).
+			Set("$set", Properties{property: enrolled}),
+		Groups: u.groups(),
+	})
+}
+
+// Reports whether the user enrolled in the early access feature of the flag,
+// as known from the person properties set through the handle. Enrollments
+// made elsewhere are only reflected by the value of the flag, see
+// User.IsFeatureEnabled.
+func (u *User) IsEnrolled(flagKey string) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.properties[FeatureEnrollmentProperty(flagKey)] == true
+}
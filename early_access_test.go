@@ -0,0 +1,65 @@
+package posthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetEarlyAccessFeatures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/early_access_features/" || r.URL.Query().Get("token") != "Csyjlnlun3OzyNJAafdlv" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.Write([]byte(`{"earlyAccessFeatures": [{"id": "0190", "name": "Dark mode", "description": "", "stage": "beta", "documentationUrl": "https://example.com/docs", "flagKey": "dark-mode"}]}`))
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{Endpoint: server.URL})
+	defer client.Close()
+
+	features, err := client.GetEarlyAccessFeatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := EarlyAccessFeature{Id: "0190", Name: "Dark mode", Stage: "beta", DocumentationUrl: "https://example.com/docs", FlagKey: "dark-mode"}
+	if len(features) != 1 || features[0] != expected {
+		t.Errorf("expected %v, got %v", expected, features)
+	}
+}
+
+func TestGetEarlyAccessFeaturesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{Endpoint: server.URL, Logger: testLogger{t.Logf, t.Logf}})
+	defer client.Close()
+
+	if _, err := client.GetEarlyAccessFeatures(); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestUserSetFeatureEnrollment(t *testing.T) {
+	client := &testEnqueueClient{}
+	user := newUser(client, "user")
+	user.flags["dark-mode"] = false
+
+	if err := user.SetFeatureEnrollment("dark-mode", true); err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsEnrolled("dark-mode") || user.IsEnrolled("other") {
+		t.Error("expected the user to be enrolled in dark-mode only")
+	}
+	if _, ok := user.flags["dark-mode"]; ok {
+		t.Error("expected the flag to be evaluated again")
+	}
+
+	msg := client.msgs[0].(Capture)
+	set := msg.Properties["$set"].(Properties)
+	if msg.Event != "$feature_enrollment_update" || msg.Properties["$feature_flag"] != "dark-mode" || msg.Properties["$feature_enrollment"] != true || set["$feature_enrollment/dark-mode"] != true {
+		t.Errorf("invalid enrollment: %#v", msg)
+	}
+}
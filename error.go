@@ -3,6 +3,7 @@ package posthog
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Returned by the `NewWithConfig` function when the one of the configuration
@@ -44,6 +45,158 @@ func (e FieldError) Error() string {
 	return fmt.Sprintf("%s.%s: invalid field value: %#v", e.Type, e.Name, e.Value)
 }
 
+// Returned when a feature flag condition references a property that wasn't
+// passed in the person or group properties. It is wrapped by an
+// InconclusiveMatchError since the server may know the property value.
+type MissingPropertyError struct {
+
+	// The name of the missing property.
+	Property string
+}
+
+func (e *MissingPropertyError) Error() string {
+	return fmt.Sprintf("missing property %q", e.Property)
+}
+
+// Returned when a feature flag condition uses a regular expression that can't
+// be compiled.
+type InvalidRegexError struct {
+
+	// The name of the property the condition applies to.
+	Property string
+
+	// The regular expression as defined in the condition.
+	Pattern string
+
+	// The error returned when compiling the expression.
+	Err error
+}
+
+func (e *InvalidRegexError) Error() string {
+	return fmt.Sprintf("invalid regex %q for property %q: %s", e.Pattern, e.Property, e.Err)
+}
+
+func (e *InvalidRegexError) Unwrap() error {
+	return e.Err
+}
+
+// Returned when a feature flag condition compares values with gt, gte, lt or
+// lte and one of them is neither a number nor a version, or with a semver_
+// operator and one of them isn't a version.
+type NotOrderableError struct {
+
+	// The name of the property the condition applies to.
+	Property string
+
+	// The value that couldn't be ordered.
+	Value interface{}
+}
+
+func (e *NotOrderableError) Error() string {
+	return fmt.Sprintf("value %#v of property %q is not orderable", e.Value, e.Property)
+}
+
+// Returned when a feature flag condition compares dates with is_date_before
+// or is_date_after and one of them isn't a valid date.
+type InvalidDateError struct {
+
+	// The name of the property the condition applies to.
+	Property string
+
+	// The value that couldn't be parsed as a date.
+	Value interface{}
+}
+
+func (e *InvalidDateError) Error() string {
+	return fmt.Sprintf("value %#v of property %q is not a valid date", e.Value, e.Property)
+}
+
+// Returned by the feature flag methods when PostHog limits the flag requests
+// of the project, because its quota is exceeded or it sent too many requests.
+// Flags that need the server aren't requested again until Until, flags are
+// still evaluated locally with the definitions already loaded.
+type QuotaLimitedError struct {
+
+	// When flag requests resume.
+	Until time.Time
+}
+
+func (e *QuotaLimitedError) Error() string {
+	return fmt.Sprintf("feature flag requests are quota limited until %s", e.Until.Format(time.RFC3339))
+}
+
+// Returned by the feature flag methods when flag definitions weren't fetched
+// successfully for longer than Config.MaxFlagStaleness, flags aren't evaluated
+// until definitions are fetched again.
+type StaleFlagsError struct {
+
+	// How long ago definitions were last fetched.
+	Age time.Duration
+
+	// The maximum staleness of the configuration.
+	MaxStaleness time.Duration
+}
+
+func (e *StaleFlagsError) Error() string {
+	return fmt.Sprintf("feature flag definitions are stale: last fetched %s ago (max %s)", e.Age.Round(time.Second), e.MaxStaleness)
+}
+
+// Returned when a distinct ID is set but can't identify a person, like
+// whitespace-only IDs, IDs longer than MaxDistinctIdLength or placeholders
+// produced when serializing a missing value ("null", "undefined", "None").
+type DistinctIdError struct {
+
+	// The human-readable representation of the type of structure carrying the
+	// distinct ID.
+	Type string
+
+	// The name of the field carrying the distinct ID.
+	Name string
+
+	// The invalid distinct ID.
+	Value string
+
+	// A human-readable message explaining why the distinct ID is invalid.
+	Reason string
+}
+
+func (e DistinctIdError) Error() string {
+	return fmt.Sprintf("%s.%s: %s: %q", e.Type, e.Name, e.Reason, e.Value)
+}
+
+// Returned when a capture doesn't match the schema registered for its event,
+// see SchemaRegistry.
+type SchemaViolationError struct {
+
+	// The name of the captured event.
+	Event string
+
+	// The name of the property that doesn't match the schema.
+	Property string
+
+	// A human-readable message explaining why the property is invalid.
+	Reason string
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("event %q does not match its schema: property %q: %s", e.Event, e.Property, e.Reason)
+}
+
+// Returned when the name of a captured event breaks the naming convention,
+// see EventNamingConvention.
+type EventNameError struct {
+
+	// The name of the event.
+	Event string
+
+	// A human-readable message explaining which rule the name breaks.
+	Reason string
+}
+
+func (e *EventNameError) Error() string {
+	return fmt.Sprintf("invalid event name %q: %s", e.Event, e.Reason)
+}
+
 var (
 	// This error is returned by methods of the `Client` interface when they are
 	// called after the client was already closed.
@@ -53,8 +206,60 @@ var (
 	// already being sent and no more messages can be accepted.
 	ErrTooManyRequests = errors.New("too many requests are already in-flight")
 
+	// This error is returned by Pump when the client wasn't configured with
+	// ManualPump, its background goroutines already send messages.
+	ErrNotManualPump = errors.New("the client doesn't use manual pump mode")
+
 	// This error is used to notify the client callbacks that a message send
 	// failed because the JSON representation of a message exceeded the upper
 	// limit.
 	ErrMessageTooBig = errors.New("the message exceeds the maximum allowed size")
+
+	// This error is returned by the feature flag methods when the flag is
+	// neither defined locally nor known to the /decide endpoint.
+	ErrFlagNotFound = errors.New("feature flag not found")
+
+	// This error is returned by the feature flag methods when flags must be
+	// evaluated locally but their definitions haven't been loaded yet.
+	ErrFlagsNotLoaded = errors.New("feature flag definitions are not loaded")
+
+	// This error is returned by the feature flag methods when flags had to be
+	// evaluated by the /decide endpoint and the request failed. Use errors.Is
+	// to test for it since it carries the reason why local evaluation wasn't
+	// possible.
+	ErrRemoteEvaluationFailed = errors.New("remote feature flag evaluation failed")
 )
+
+// Returned when the /decide endpoint couldn't evaluate flags, it matches
+// ErrRemoteEvaluationFailed and unwraps to the local evaluation error if any.
+type remoteEvaluationError struct {
+	msg   string
+	cause error
+	local error
+}
+
+func (e *remoteEvaluationError) Error() string {
+	msg := ErrRemoteEvaluationFailed.Error() + ": " + e.msg
+	if e.cause != nil {
+		msg += ": " + e.cause.Error()
+	}
+	if e.local != nil {
+		msg += " (local evaluation: " + e.local.Error() + ")"
+	}
+	return msg
+}
+
+// Matches ErrRemoteEvaluationFailed and the cause of the failure, like
+// context.DeadlineExceeded.
+func (e *remoteEvaluationError) Is(target error) bool {
+	return target == ErrRemoteEvaluationFailed || (e.cause != nil && errors.Is(e.cause, target))
+}
+
+func (e *remoteEvaluationError) Unwrap() error {
+	return e.local
+}
+
+// Matches the cause of the failure, like a *QuotaLimitedError or an *APIError.
+func (e *remoteEvaluationError) As(target interface{}) bool {
+	return e.cause != nil && errors.As(e.cause, target)
+}
@@ -0,0 +1,73 @@
+package posthog
+
+import (
+	"errors"
+)
+
+func (c *client) EvaluateFlagForMany(key string, distinctIds []string, propsFor func(id string) Properties) (map[string]interface{}, error) {
+	if key == "" {
+		return nil, ConfigError{
+			Reason: "Feature Flag Key required",
+			Field:  "Key",
+			Value:  key,
+		}
+	}
+
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return nil, errors.New(errorMessage)
+	}
+	return c.featureFlagsPoller.evaluateFlagForMany(key, distinctIds, propsFor)
+}
+
+// Evaluates the flag locally for every distinct ID with the same snapshot of
+// the definitions, so the results are consistent even if definitions are
+// reloaded meanwhile. The evaluation cache is bypassed since every distinct ID
+// is evaluated once.
+func (poller *FeatureFlagsPoller) evaluateFlagForMany(key string, distinctIds []string, propsFor func(id string) Properties) (map[string]interface{}, error) {
+	if err := poller.waitForFirstFetch(poller.ctx); err != nil {
+		return nil, err
+	}
+
+	snapshot := poller.definitions()
+	if err := poller.staleness(); err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, ErrFlagsNotLoaded
+	}
+	i, ok := snapshot.index[key]
+	if !ok {
+		return nil, ErrFlagNotFound
+	}
+	flag := snapshot.flags[i]
+	if flag.Filters.AggregationGroupTypeIndex != nil {
+		return nil, errors.New("group flags can't be evaluated for many distinct IDs")
+	}
+
+	results := make(map[string]interface{}, len(distinctIds))
+	var failures int
+	var firstErr error
+	for _, distinctId := range distinctIds {
+		var properties Properties
+		if propsFor != nil {
+			properties = propsFor(distinctId)
+		}
+
+		value, err := snapshot.computeFlag(flag, distinctId, nil, properties, nil, nil)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failures++
+			continue
+		}
+		results[distinctId] = value
+	}
+
+	if failures > 0 {
+		poller.log(LogLevelWarn, "Unable to compute flag locally for some distinct IDs", LogField{"flag", key}, LogField{"count", failures}, LogField{"error", firstErr})
+	}
+	return results, nil
+}
@@ -0,0 +1,75 @@
+package posthog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateFlagForMany(t *testing.T) {
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(fixture("feature_flag/test-simple-flag-person-prop.json")),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	regions := map[string]string{"user-1": "USA", "user-2": "Canada"}
+	results, err := c.EvaluateFlagForMany("simple-flag", []string{"user-1", "user-2", "user-3"}, func(id string) Properties {
+		if region, ok := regions[id]; ok {
+			return NewProperties().Set("region", region)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results["user-1"] != true || results["user-2"] != false {
+		t.Errorf("Expected the flag to be evaluated for the distinct IDs with a region, got %v", results)
+	}
+
+	if _, err := c.EvaluateFlagForMany("unknown-flag", []string{"user-1"}, nil); err != ErrFlagNotFound {
+		t.Error("Expected ErrFlagNotFound, got", err)
+	}
+	if _, err := c.EvaluateFlagForMany("", []string{"user-1"}, nil); err == nil {
+		t.Error("Expected an error without a flag key")
+	}
+}
+
+func TestEvaluateFlagForManyMatchesGetFeatureFlag(t *testing.T) {
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(fixture("feature_flag/test-simple-flag.json")),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	distinctIds := make([]string, 100)
+	for i := range distinctIds {
+		distinctIds[i] = fmt.Sprintf("distinct-id-%d", i)
+	}
+	results, err := c.EvaluateFlagForMany("simple-flag", distinctIds, nil)
+	if err != nil || len(results) != len(distinctIds) {
+		t.Fatal("Expected a result per distinct ID, got", results, err)
+	}
+	for _, distinctId := range distinctIds {
+		value, _ := c.GetFeatureFlag(FeatureFlagPayload{Key: "simple-flag", DistinctId: distinctId})
+		if results[distinctId] != value {
+			t.Errorf("Expected %v for %s, got %v", value, distinctId, results[distinctId])
+		}
+	}
+}
+
+func BenchmarkEvaluateFlagForMany(b *testing.B) {
+	c := newBenchmarkClient(b)
+	defer c.Close()
+
+	distinctIds := make([]string, 1000)
+	for i := range distinctIds {
+		distinctIds[i] = fmt.Sprintf("distinct-id-%d", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.EvaluateFlagForMany("simple-flag", distinctIds, nil)
+	}
+}
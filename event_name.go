@@ -0,0 +1,83 @@
+package posthog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Names of events with a special meaning for PostHog, capturing them by hand
+// usually corrupts persons or groups.
+var ReservedEventNames = []string{
+	"$identify",
+	"$create_alias",
+	"$merge_dangerously",
+	"$groupidentify",
+	"$set",
+	"$snapshot",
+	"$feature_flag_called",
+}
+
+// Events sent by the SDK itself are never checked against the naming
+// convention.
+var sdkEventNames = map[string]bool{
+	"$feature_flag_called":       true,
+	ExceptionEvent:               true,
+	AIGenerationEvent:            true,
+	AITraceEvent:                 true,
+	FeatureEnrollmentUpdateEvent: true,
+}
+
+var snakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// An EventNamingConvention describes the names captured events must follow,
+// see Config.EventNaming. Each rule is optional.
+type EventNamingConvention struct {
+
+	// When set event names must match the expression.
+	Pattern *regexp.Regexp
+
+	// When set to true event names must be in snake_case, ignoring a leading
+	// `$`.
+	SnakeCase bool
+
+	// When set to true event names can't start with `$`, which is used by
+	// PostHog for its own events.
+	DisallowDollarPrefix bool
+
+	// When set to true the names in ReservedEventNames are rejected.
+	DisallowReserved bool
+
+	// Additional names that are rejected, like deprecated events.
+	Reserved []string
+}
+
+// Validate checks an event name against the convention, it returns an
+// *EventNameError when the name breaks one of the rules.
+func (c *EventNamingConvention) Validate(event string) error {
+	if c.DisallowReserved && containsString(ReservedEventNames, event) || containsString(c.Reserved, event) {
+		return &EventNameError{Event: event, Reason: "the name is reserved"}
+	}
+
+	if c.DisallowDollarPrefix && strings.HasPrefix(event, "$") {
+		return &EventNameError{Event: event, Reason: "names starting with $ are reserved for PostHog events"}
+	}
+
+	if c.SnakeCase && !snakeCase.MatchString(strings.TrimPrefix(event, "$")) {
+		return &EventNameError{Event: event, Reason: "the name is not in snake_case"}
+	}
+
+	if c.Pattern != nil && !c.Pattern.MatchString(event) {
+		return &EventNameError{Event: event, Reason: "the name doesn't match " + c.Pattern.String()}
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
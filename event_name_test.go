@@ -0,0 +1,68 @@
+package posthog
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestEventNamingConvention(t *testing.T) {
+	c := &EventNamingConvention{
+		Pattern:          regexp.MustCompile(`^(billing|auth)_`),
+		SnakeCase:        true,
+		DisallowReserved: true,
+		Reserved:         []string{"billing_legacy_event"},
+	}
+
+	tests := map[string]bool{
+		"billing_invoice_paid": true,
+		"auth_signed_in":       true,
+		"billing_InvoicePaid":  false,
+		"billing invoice paid": false,
+		"search_performed":     false,
+		"billing_legacy_event": false,
+		"$identify":            false,
+	}
+
+	for event, valid := range tests {
+		err := c.Validate(event)
+
+		var nameErr *EventNameError
+		if valid && err != nil {
+			t.Errorf("%s: expected the name to be valid, got %v", event, err)
+		} else if !valid && !errors.As(err, &nameErr) {
+			t.Errorf("%s: expected an EventNameError, got %v", event, err)
+		}
+	}
+
+	dollar := &EventNamingConvention{SnakeCase: true, DisallowDollarPrefix: true}
+	if err := dollar.Validate("$pageview"); err == nil {
+		t.Error("expected names starting with $ to be rejected")
+	}
+	if err := (&EventNamingConvention{SnakeCase: true}).Validate("$pageview"); err != nil {
+		t.Error("expected snake_case to ignore the leading $, got", err)
+	}
+}
+
+func TestClientRejectEventNameViolations(t *testing.T) {
+	client, _ := NewWithConfig("0123456789", Config{
+		Logger:                    testLogger{t.Logf, t.Logf},
+		Transport:                 testTransportOK,
+		EventNaming:               &EventNamingConvention{SnakeCase: true, DisallowDollarPrefix: true},
+		RejectEventNameViolations: true,
+	})
+	defer client.Close()
+
+	var nameErr *EventNameError
+	if err := client.Enqueue(Capture{DistinctId: "1", Event: "Signed Up"}); !errors.As(err, &nameErr) {
+		t.Error("expected the capture to be rejected, got", err)
+	}
+
+	if err := client.Enqueue(Capture{DistinctId: "1", Event: "signed_up"}); err != nil {
+		t.Error("expected a valid capture to be enqueued, got", err)
+	}
+
+	if err := client.Enqueue(Capture{DistinctId: "1", Event: "$feature_flag_called"}); err != nil {
+		t.Error("expected events of the SDK not to be checked, got", err)
+	}
+}
@@ -0,0 +1,141 @@
+package posthog
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// The event of exceptions tracked by PostHog error tracking.
+const ExceptionEvent = "$exception"
+
+// An exception of the $exception_list property of exception events. The
+// first exception of the list is the captured error, followed by the errors
+// it wraps.
+type Exception struct {
+	Type       string               `json:"type"`
+	Value      string               `json:"value"`
+	Mechanism  ExceptionMechanism   `json:"mechanism"`
+	Stacktrace *ExceptionStacktrace `json:"stacktrace,omitempty"`
+}
+
+// How an exception was captured.
+type ExceptionMechanism struct {
+	// False when the exception was a panic, see CapturePanic.
+	Handled bool `json:"handled"`
+
+	// True when the exception wasn't an error, like a panic with a string.
+	Synthetic bool `json:"synthetic"`
+}
+
+// The stack of an exception, the frames are ordered from the outermost call
+// to the one where the exception was captured.
+type ExceptionStacktrace struct {
+	Type   string           `json:"type"`
+	Frames []ExceptionFrame `json:"frames"`
+}
+
+type ExceptionFrame struct {
+	Filename string `json:"filename"`
+	Function string `json:"function"`
+	Lineno   int    `json:"lineno"`
+	Platform string `json:"platform"`
+
+	// False for the frames of the Go runtime.
+	InApp bool `json:"in_app"`
+}
+
+// NewException returns a capture of err for error tracking, with the type and
+// message of err and of the errors it wraps, and the stack of the caller.
+// The properties are sent along with the exception.
+func NewException(err error, distinctId string, properties Properties) Capture {
+	return newException(err, distinctId, properties, ExceptionMechanism{Handled: true}, 1)
+}
+
+// Builds the exception event, the stack starts skip frames above the caller
+// of newException.
+func newException(err error, distinctId string, properties Properties, mechanism ExceptionMechanism, skip int) Capture {
+	var list []Exception
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		list = append(list, Exception{
+			Type:      fmt.Sprintf("%T", e),
+			Value:     e.Error(),
+			Mechanism: mechanism,
+		})
+	}
+	if len(list) != 0 {
+		list[0].Stacktrace = &ExceptionStacktrace{Type: "raw", Frames: stackFrames(skip + 1)}
+	}
+
+	return Capture{
+		DistinctId: distinctId,
+		Event:      ExceptionEvent,
+		Properties: NewProperties().Merge(properties).Set("$exception_list", list),
+	}
+}
+
+// Returns the frames of the stack, skipping the given number of frames above
+// the caller of stackFrames.
+func stackFrames(skip int) []ExceptionFrame {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(skip+2, pcs)]
+
+	var frames []ExceptionFrame
+	callers := runtime.CallersFrames(pcs)
+	for {
+		frame, more := callers.Next()
+		frames = append(frames, ExceptionFrame{
+			Filename: frame.File,
+			Function: frame.Function,
+			Lineno:   frame.Line,
+			Platform: "go",
+			InApp:    !strings.HasPrefix(frame.Function, "runtime."),
+		})
+		if !more {
+			break
+		}
+	}
+
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+func (c *client) CaptureException(err error, distinctId string, properties Properties) error {
+	return c.Enqueue(newException(err, distinctId, properties, ExceptionMechanism{Handled: true}, 1))
+}
+
+func (c *childClient) CaptureException(err error, distinctId string, properties Properties) error {
+	return c.Enqueue(newException(err, distinctId, properties, ExceptionMechanism{Handled: true}, 1))
+}
+
+// CapturePanic captures the panic of the goroutine as an exception of the
+// user, and panics again with the same value once the exception is flushed.
+// It must be deferred:
+//
+//	defer posthog.CapturePanic(client, distinctId, nil)
+//
+// It does nothing when the goroutine isn't panicking.
+func CapturePanic(client Client, distinctId string, properties Properties) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	client.Enqueue(panicException(value, distinctId, properties, 1))
+	client.Flush()
+	panic(value)
+}
+
+// Builds the exception of a recovered panic, the stack starts at the panic.
+func panicException(value interface{}, distinctId string, properties Properties, skip int) Capture {
+	mechanism := ExceptionMechanism{Handled: false}
+	err, ok := value.(error)
+	if !ok {
+		err = fmt.Errorf("%v", value)
+		mechanism.Synthetic = true
+	}
+	return newException(err, distinctId, properties, mechanism, skip+1)
+}
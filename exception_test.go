@@ -0,0 +1,113 @@
+package posthog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewException(t *testing.T) {
+	err := fmt.Errorf("loading invoice: %w", errors.New("connection refused"))
+	msg := NewException(err, "user", Properties{"invoice": 42})
+
+	if msg.Event != "$exception" || msg.DistinctId != "user" || msg.Properties["invoice"] != 42 {
+		t.Errorf("invalid exception: %#v", msg)
+	}
+
+	list := msg.Properties["$exception_list"].([]Exception)
+	if len(list) != 2 {
+		t.Fatalf("expected the error and the error it wraps, got %#v", list)
+	}
+	if list[0].Type != "*fmt.wrapError" || list[0].Value != "loading invoice: connection refused" || !list[0].Mechanism.Handled {
+		t.Errorf("invalid exception: %#v", list[0])
+	}
+	if list[1].Type != "*errors.errorString" || list[1].Value != "connection refused" || list[1].Stacktrace != nil {
+		t.Errorf("invalid wrapped exception: %#v", list[1])
+	}
+
+	frames := list[0].Stacktrace.Frames
+	last := frames[len(frames)-1]
+	if last.Function != "github.com/posthog/posthog-go.TestNewException" || !strings.HasSuffix(last.Filename, "exception_test.go") || !last.InApp {
+		t.Errorf("expected the stack to end at the caller, got %#v", last)
+	}
+}
+
+func TestCaptureException(t *testing.T) {
+	body := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body <- b
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:    server.URL,
+		BatchSize:   1,
+		EventNaming: &EventNamingConvention{DisallowDollarPrefix: true},
+	})
+	defer client.Close()
+
+	if err := client.CaptureException(errors.New("boom"), "user", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var batch struct {
+		Batch []struct {
+			Event      string `json:"event"`
+			Properties struct {
+				ExceptionList []Exception `json:"$exception_list"`
+			} `json:"properties"`
+		} `json:"batch"`
+	}
+	json.Unmarshal(<-body, &batch)
+	if len(batch.Batch) != 1 || batch.Batch[0].Event != "$exception" {
+		t.Fatalf("expected an exception to be sent, got %+v", batch)
+	}
+	exception := batch.Batch[0].Properties.ExceptionList[0]
+	if exception.Value != "boom" || exception.Stacktrace == nil || exception.Stacktrace.Type != "raw" {
+		t.Errorf("invalid exception: %+v", exception)
+	}
+}
+
+func TestCapturePanic(t *testing.T) {
+	client := &testEnqueueClient{}
+
+	func() {
+		defer func() {
+			if value := recover(); value != "boom" {
+				t.Errorf("expected the panic to be propagated, got %v", value)
+			}
+		}()
+		defer CapturePanic(client, "user", nil)
+		panic("boom")
+	}()
+
+	if len(client.msgs) != 1 {
+		t.Fatalf("expected the panic to be captured, got %v", client.msgs)
+	}
+	list := client.msgs[0].(Capture).Properties["$exception_list"].([]Exception)
+	if list[0].Value != "boom" || list[0].Mechanism.Handled || !list[0].Mechanism.Synthetic {
+		t.Errorf("invalid exception: %#v", list[0])
+	}
+
+	frames := list[0].Stacktrace.Frames
+	last := frames[len(frames)-1]
+	if !strings.HasPrefix(last.Function, "runtime.") || last.InApp {
+		t.Errorf("expected the stack to end at the panic, got %#v", last)
+	}
+	if caller := frames[len(frames)-2]; !strings.HasPrefix(caller.Function, "github.com/posthog/posthog-go.TestCapturePanic") {
+		t.Errorf("expected the panicking function in the stack, got %#v", caller)
+	}
+
+	func() {
+		defer CapturePanic(client, "user", nil)
+	}()
+	if len(client.msgs) != 1 {
+		t.Error("expected nothing to be captured without panic")
+	}
+}
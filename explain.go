@@ -0,0 +1,179 @@
+package posthog
+
+import (
+	"errors"
+)
+
+// A trace of the local evaluation of a feature flag, returned by
+// Client.ExplainFeatureFlag to find out why a flag evaluates to its value for
+// a given person or group.
+type FlagExplanation struct {
+	Key string
+
+	// The value the flag evaluated to, as returned by GetFeatureFlag when the
+	// flag is evaluated locally. It is nil when Err is set.
+	Value interface{}
+
+	// Why the flag couldn't be evaluated, an *InconclusiveMatchError when only
+	// the server can evaluate it with the given properties.
+	Err error
+
+	// Why the conditions of the flag weren't checked, like an inactive flag
+	// or a missing group.
+	Reason string
+
+	// The group type the flag is rolled out by, empty for flags rolled out by
+	// person.
+	GroupType string
+
+	// The distinct ID, or the group key for group flags, hashed to roll out
+	// the flag and pick its variant.
+	HashedId string
+
+	// The conditions in the order they were checked. Conditions with a
+	// variant override are checked first and the conditions following the
+	// first match aren't checked.
+	Conditions []ConditionExplanation
+
+	// The hash value used to pick the variant of multivariate flags, nil when
+	// no variant was picked by hash. The variant whose range of rollout
+	// percentages contains the value is picked.
+	VariantHash *float64
+}
+
+// The check of a condition group of a flag.
+type ConditionExplanation struct {
+	// The index of the condition in the filters of the flag, super
+	// conditions are indexed separately.
+	Index int
+	Super bool
+
+	// The property comparisons in the order they were made, the comparisons
+	// following the first one that doesn't pass aren't made.
+	Properties []PropertyExplanation
+
+	// The rollout percentage of the condition and the hash value compared to
+	// it, the distinct ID is in the rollout when the value is at most the
+	// percentage divided by 100. RolloutHash is nil when the rollout wasn't
+	// checked.
+	RolloutPercentage *uint8
+	RolloutHash       *float64
+
+	// The variant set by the condition when it matches.
+	VariantOverride *string
+
+	Match bool
+	Err   error
+}
+
+// The comparison of a property of a condition group with the given
+// properties.
+type PropertyExplanation struct {
+	Key      string
+	Operator string
+	Type     string
+
+	// The value of the condition and the value given for the property,
+	// Given is nil when the property wasn't given.
+	Expected interface{}
+	Given    interface{}
+
+	Match bool
+	Err   error
+}
+
+func (c *client) ExplainFeatureFlag(flagConfig FeatureFlagPayload) (FlagExplanation, error) {
+	if err := flagConfig.validate(); err != nil {
+		return FlagExplanation{Key: flagConfig.Key}, err
+	}
+
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return FlagExplanation{Key: flagConfig.Key}, errors.New(errorMessage)
+	}
+	return c.featureFlagsPoller.explainFeatureFlag(flagConfig)
+}
+
+// Evaluates the flag locally like GetFeatureFlag and records the steps of the
+// evaluation. Results of previous evaluations aren't reused.
+func (poller *FeatureFlagsPoller) explainFeatureFlag(flagConfig FeatureFlagPayload) (FlagExplanation, error) {
+	explanation := FlagExplanation{Key: flagConfig.Key}
+
+	flag, ok, err := poller.getFeatureFlag(poller.ctx, flagConfig.Key)
+	if err != nil {
+		return explanation, err
+	}
+	if err := poller.staleness(); err != nil {
+		return explanation, err
+	}
+	if !ok {
+		if !poller.flagsLoaded() {
+			return explanation, ErrFlagsNotLoaded
+		}
+		return explanation, ErrFlagNotFound
+	}
+
+	explanation.Value, explanation.Err = poller.computeFlagLocally(flag, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties, &explanation)
+	if explanation.Err != nil {
+		explanation.Value = nil
+	}
+	return explanation, nil
+}
+
+// The methods recording the evaluation do nothing on a nil trace, so the
+// evaluation isn't slowed down when it isn't explained.
+
+func (e *FlagExplanation) explain(reason string) {
+	if e != nil {
+		e.Reason = reason
+	}
+}
+
+// Starts the trace of a condition. The returned pointer is only valid until
+// the next condition is started.
+func (e *FlagExplanation) condition(index int, super bool, condition PropertyGroup) *ConditionExplanation {
+	if e == nil {
+		return nil
+	}
+	e.Conditions = append(e.Conditions, ConditionExplanation{
+		Index:             index,
+		Super:             super,
+		RolloutPercentage: condition.RolloutPercentage,
+		VariantOverride:   condition.Variant,
+	})
+	return &e.Conditions[len(e.Conditions)-1]
+}
+
+func (c *ConditionExplanation) property(property Property, properties Properties, isMatch bool, err error) {
+	if c == nil {
+		return
+	}
+	explanation := PropertyExplanation{
+		Key:      property.Key,
+		Operator: property.Operator,
+		Type:     property.Type,
+		Expected: property.Value,
+		Match:    isMatch,
+		Err:      err,
+	}
+	if property.Type != "cohort" {
+		explanation.Given = properties[property.Key]
+	}
+	c.Properties = append(c.Properties, explanation)
+}
+
+func (c *ConditionExplanation) rollout(key string, distinctId string) {
+	if c == nil {
+		return
+	}
+	if hashValue, err := _hash(key, distinctId, ""); err == nil {
+		c.RolloutHash = &hashValue
+	}
+}
+
+func (c *ConditionExplanation) result(isMatch bool, err error) {
+	if c != nil {
+		c.Match, c.Err = isMatch, err
+	}
+}
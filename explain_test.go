@@ -0,0 +1,139 @@
+package posthog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newExplainClient(t *testing.T, definitions string) Client {
+	c, err := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader: strings.NewReader(definitions),
+		Transport:          offlineTransport(t),
+		Logger:             testLogger{t.Logf, t.Logf},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestExplainFeatureFlag(t *testing.T) {
+	c := newExplainClient(t, `{"flags": [{
+		"key": "beta-feature",
+		"active": true,
+		"filters": {
+			"groups": [
+				{"properties": [{"key": "email", "operator": "icontains", "value": "@example.com", "type": "person"}, {"key": "plan", "operator": "exact", "value": ["pro"], "type": "person"}], "rollout_percentage": null},
+				{"properties": [{"key": "country", "operator": "exact", "value": ["FR"], "type": "person"}], "rollout_percentage": 100, "variant": "second"},
+				{"properties": [], "rollout_percentage": 100}
+			],
+			"multivariate": {"variants": [{"key": "first", "rollout_percentage": 50}, {"key": "second", "rollout_percentage": 50}]}
+		}
+	}]}`)
+	defer c.Close()
+
+	explanation, err := c.ExplainFeatureFlag(FeatureFlagPayload{
+		Key:              "beta-feature",
+		DistinctId:       "some-distinct-id",
+		PersonProperties: NewProperties().Set("email", "someone@example.com").Set("plan", "free"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Err != nil || explanation.HashedId != "some-distinct-id" {
+		t.Fatalf("Expected the flag to be evaluated for the distinct ID, got %+v", explanation)
+	}
+
+	// The condition with a variant override is checked first.
+	conditions := explanation.Conditions
+	if len(conditions) != 3 || conditions[0].Index != 1 || conditions[1].Index != 0 || conditions[2].Index != 2 {
+		t.Fatalf("Expected the conditions in the order they were checked, got %+v", conditions)
+	}
+
+	if c := conditions[0]; c.Match || len(c.Properties) != 1 || c.Properties[0].Given != nil || *c.VariantOverride != "second" {
+		t.Errorf("Expected the country not to match, got %+v", c)
+	}
+
+	properties := conditions[1].Properties
+	if conditions[1].Match || len(properties) != 2 || !properties[0].Match || properties[1].Match || properties[1].Given != "free" {
+		t.Errorf("Expected the email to match and the plan not to, got %+v", conditions[1])
+	}
+
+	if c := conditions[2]; !c.Match || c.RolloutHash == nil || *c.RolloutPercentage != 100 {
+		t.Errorf("Expected the rollout to be checked, got %+v", c)
+	}
+
+	if explanation.VariantHash == nil {
+		t.Fatal("Expected the variant hash")
+	}
+	variant := "first"
+	if *explanation.VariantHash >= 0.5 {
+		variant = "second"
+	}
+	if explanation.Value != variant {
+		t.Errorf("Expected %s for the variant hash %f, got %v", variant, *explanation.VariantHash, explanation.Value)
+	}
+
+	value, _ := c.GetFeatureFlag(FeatureFlagPayload{
+		Key:                   "beta-feature",
+		DistinctId:            "some-distinct-id",
+		PersonProperties:      NewProperties().Set("email", "someone@example.com").Set("plan", "free"),
+		SendFeatureFlagEvents: new(bool),
+	})
+	if value != explanation.Value {
+		t.Errorf("Expected the value of GetFeatureFlag, got %v and %v", explanation.Value, value)
+	}
+}
+
+func TestExplainGroupFeatureFlag(t *testing.T) {
+	c := newExplainClient(t, `{
+		"flags": [{"key": "group-flag", "active": true, "filters": {"aggregation_group_type_index": 0, "groups": [{"properties": [{"key": "name", "value": ["Acme"], "operator": "exact", "type": "group", "group_type_index": 0}], "rollout_percentage": 100}]}}],
+		"group_type_mapping": {"0": "company"}
+	}`)
+	defer c.Close()
+
+	explanation, err := c.ExplainFeatureFlag(FeatureFlagPayload{
+		Key:             "group-flag",
+		DistinctId:      "some-distinct-id",
+		Groups:          Groups{"company": "acme-inc"},
+		GroupProperties: map[string]Properties{"company": NewProperties().Set("name", "Acme")},
+	})
+	if err != nil || explanation.Value != true {
+		t.Fatalf("Expected the flag to be enabled, got %+v %v", explanation, err)
+	}
+	if explanation.GroupType != "company" || explanation.HashedId != "acme-inc" {
+		t.Errorf("Expected the group key to be hashed, got %+v", explanation)
+	}
+
+	explanation, _ = c.ExplainFeatureFlag(FeatureFlagPayload{Key: "group-flag", DistinctId: "some-distinct-id"})
+	if explanation.Err == nil || explanation.Value != nil || explanation.Reason != "no company group was given" {
+		t.Errorf("Expected the missing group to be explained, got %+v", explanation)
+	}
+}
+
+func TestExplainFeatureFlagInconclusive(t *testing.T) {
+	c := newExplainClient(t, `{"flags": [
+		{"key": "cohort-flag", "active": true, "filters": {"groups": [{"properties": [{"key": "id", "value": 98, "type": "cohort"}], "rollout_percentage": 100}]}},
+		{"key": "inactive-flag", "active": false, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}
+	]}`)
+	defer c.Close()
+
+	explanation, err := c.ExplainFeatureFlag(FeatureFlagPayload{Key: "cohort-flag", DistinctId: "some-distinct-id"})
+	var inconclusiveErr *InconclusiveMatchError
+	if err != nil || !errors.As(explanation.Err, &inconclusiveErr) {
+		t.Fatalf("Expected the evaluation to be inconclusive, got %+v %v", explanation, err)
+	}
+	if c := explanation.Conditions[0]; c.Err == nil || c.Properties[0].Type != "cohort" || c.Properties[0].Err == nil {
+		t.Errorf("Expected the unknown cohort to be explained, got %+v", c)
+	}
+
+	explanation, _ = c.ExplainFeatureFlag(FeatureFlagPayload{Key: "inactive-flag", DistinctId: "some-distinct-id"})
+	if explanation.Value != false || explanation.Reason != "the flag is inactive" || len(explanation.Conditions) != 0 {
+		t.Errorf("Expected the inactive flag to be explained, got %+v", explanation)
+	}
+
+	if _, err := c.ExplainFeatureFlag(FeatureFlagPayload{Key: "unknown-flag", DistinctId: "some-distinct-id"}); err != ErrFlagNotFound {
+		t.Error("Expected ErrFlagNotFound, got", err)
+	}
+}
@@ -1,12 +1,31 @@
 package posthog
 
+// The arguments of the feature flag methods evaluating a single flag, like
+// GetFeatureFlag and IsFeatureEnabled. New options are added as fields so the
+// method signatures don't change.
 type FeatureFlagPayload struct {
-	Key                   string
-	DistinctId            string
-	Groups                Groups
-	PersonProperties      Properties
-	GroupProperties       map[string]Properties
-	OnlyEvaluateLocally   bool
+
+	// The key of the flag to evaluate.
+	Key string
+
+	// The distinct ID of the person the flag is evaluated for.
+	DistinctId string
+
+	// The groups of the person, keyed by group type, used by flags targeting
+	// groups.
+	Groups Groups
+
+	// Properties of the person and of their groups (keyed by group type) used
+	// to match flag conditions locally. They are also sent to /decide.
+	PersonProperties Properties
+	GroupProperties  map[string]Properties
+
+	// When set to true the flag is only evaluated from the flag definitions
+	// loaded by the client, /decide is never called.
+	OnlyEvaluateLocally bool
+
+	// Whether a $feature_flag_called event is captured for the evaluation,
+	// Config.SendFeatureFlagEvents applies when nil.
 	SendFeatureFlagEvents *bool
 }
 
@@ -27,6 +46,10 @@ func (c *FeatureFlagPayload) validate() error {
 		}
 	}
 
+	if err := validateDistinctId("posthog.FeatureFlagPayload", "DistinctId", c.DistinctId); err != nil {
+		return err
+	}
+
 	if c.Groups == nil {
 		c.Groups = Groups{}
 	}
@@ -38,14 +61,11 @@ func (c *FeatureFlagPayload) validate() error {
 	if c.GroupProperties == nil {
 		c.GroupProperties = map[string]Properties{}
 	}
-
-	if c.SendFeatureFlagEvents == nil {
-		tempTrue := true
-		c.SendFeatureFlagEvents = &tempTrue
-	}
 	return nil
 }
 
+// Same as FeatureFlagPayload for the methods evaluating all flags, like
+// GetAllFlags.
 type FeatureFlagPayloadNoKey struct {
 	DistinctId            string
 	Groups                Groups
@@ -64,6 +84,10 @@ func (c *FeatureFlagPayloadNoKey) validate() error {
 		}
 	}
 
+	if err := validateDistinctId("posthog.FeatureFlagPayloadNoKey", "DistinctId", c.DistinctId); err != nil {
+		return err
+	}
+
 	if c.Groups == nil {
 		c.Groups = Groups{}
 	}
@@ -1,14 +1,25 @@
 package posthog
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"testing"
+	"time"
 )
 
 func TestMatchPropertyValue(t *testing.T) {
@@ -49,6 +60,246 @@ func TestMatchPropertyInvalidOperator(t *testing.T) {
 	}
 
 }
+func TestMatchPropertyMissing(t *testing.T) {
+	property := Property{
+		Key:      "Browser",
+		Value:    "Chrome",
+		Operator: "exact",
+	}
+
+	_, err := matchProperty(property, NewProperties().Set("OS", "Mac"))
+
+	if _, ok := err.(*InconclusiveMatchError); !ok {
+		t.Error("Error type is not a match")
+	}
+
+	var missingErr *MissingPropertyError
+	if !errors.As(err, &missingErr) || missingErr.Property != "Browser" {
+		t.Error("Expected a MissingPropertyError, got", err)
+	}
+}
+
+func TestMatchPropertyIsNotSet(t *testing.T) {
+	property := Property{
+		Key:      "Browser",
+		Operator: "is_not_set",
+	}
+
+	if isMatch, err := matchProperty(property, NewProperties().Set("OS", "Mac")); err != nil || !isMatch {
+		t.Errorf("expected an absent property to match, got %t %v", isMatch, err)
+	}
+
+	if isMatch, err := matchProperty(property, NewProperties().Set("Browser", nil)); err != nil || isMatch {
+		t.Errorf("expected a present property not to match, got %t %v", isMatch, err)
+	}
+}
+
+func TestMatchPropertyIsSet(t *testing.T) {
+	property := Property{
+		Key:      "Browser",
+		Operator: "is_set",
+	}
+
+	if isMatch, err := matchProperty(property, NewProperties().Set("OS", "Mac")); err != nil || isMatch {
+		t.Errorf("expected an absent property not to match, got %t %v", isMatch, err)
+	}
+
+	if isMatch, err := matchProperty(property, NewProperties().Set("Browser", nil)); err != nil || !isMatch {
+		t.Errorf("expected a present property to match, got %t %v", isMatch, err)
+	}
+}
+
+func TestMatchPropertyNotOrderable(t *testing.T) {
+	property := Property{
+		Key:      "Number",
+		Value:    5,
+		Operator: "gt",
+	}
+
+	_, err := matchProperty(property, NewProperties().Set("Number", []int{7}))
+
+	var orderErr *NotOrderableError
+	if !errors.As(err, &orderErr) || orderErr.Property != "Number" {
+		t.Error("Expected a NotOrderableError, got", err)
+	}
+}
+
+func TestMatchPropertyCoercesStrings(t *testing.T) {
+	cases := []struct {
+		operator string
+		value    interface{}
+		override interface{}
+		isMatch  bool
+	}{
+		{"exact", "300", 300, true},
+		{"exact", 300, "300", true},
+		{"exact", json.Number("300"), " 300 ", true},
+		{"exact", "300.0", int64(300), true},
+		{"exact", "301", 300, false},
+		{"exact", "abc", 300, false},
+		{"exact", "true", true, true},
+		{"exact", true, "True", true},
+		{"exact", "false", true, false},
+		{"exact", []interface{}{"1", "2"}, 2, true},
+		{"is_not", "300", 300, false},
+		{"is_not", "true", false, true},
+		{"gt", "5", 7, true},
+		{"gt", 5, "7", true},
+		{"lt", "5", " 7 ", false},
+		{"gte", json.Number("5"), "5", true},
+		{"lte", "5.5", "5", true},
+	}
+
+	for _, c := range cases {
+		property := Property{Key: "key", Value: c.value, Operator: c.operator}
+		isMatch, err := matchProperty(property, NewProperties().Set("key", c.override))
+		if err != nil || isMatch != c.isMatch {
+			t.Errorf("%#v %s %#v: expected %t, got %t %v", c.override, c.operator, c.value, c.isMatch, isMatch, err)
+		}
+	}
+
+	property := Property{Key: "key", Value: 5, Operator: "gt"}
+	var orderErr *NotOrderableError
+	if _, err := matchProperty(property, NewProperties().Set("key", "five")); !errors.As(err, &orderErr) {
+		t.Error("Expected a NotOrderableError for a string that isn't a number, got", err)
+	}
+}
+
+func TestGetFeatureFlagSurfacesMatchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": [{"key": "regex-flag", "active": true, "filters": {"groups": [{"properties": [{"key": "email", "operator": "regex", "value": "?*", "type": "person"}], "rollout_percentage": 100}]}}]}`))
+		} else if isFlagsRequest(r) {
+			t.Error("invalid flags should not be evaluated remotely")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	payload := FeatureFlagPayload{
+		Key:              "regex-flag",
+		DistinctId:       "some-distinct-id",
+		PersonProperties: NewProperties().Set("email", "a@b.com"),
+	}
+
+	value, err := client.GetFeatureFlag(payload)
+	var regexErr *InvalidRegexError
+	if value != nil || !errors.As(err, &regexErr) {
+		t.Error("Expected an InvalidRegexError when the flag can't be evaluated, got", value, err)
+	}
+
+	payload.OnlyEvaluateLocally = true
+	if _, err = client.GetFeatureFlag(payload); !errors.As(err, &regexErr) {
+		t.Error("Expected an InvalidRegexError when evaluating locally, got", err)
+	}
+
+	// GetAllFlags leaves the flag out rather than evaluating it remotely.
+	flags, err := client.GetAllFlags(FeatureFlagPayloadNoKey{
+		DistinctId:       "some-distinct-id",
+		PersonProperties: NewProperties().Set("email", "a@b.com"),
+	})
+	if err != nil || len(flags) != 0 {
+		t.Error("Expected the invalid flag to be left out, got", flags, err)
+	}
+}
+
+func TestGroupFlagWithoutGroupIsInconclusive(t *testing.T) {
+	index := uint8(0)
+	flag := FeatureFlag{Key: "company-flag", Active: true}
+	flag.Filters.AggregationGroupTypeIndex = &index
+
+	snapshot := &flagSnapshot{groups: map[string]string{"0": "company"}}
+	_, err := snapshot.computeFlag(flag, "some-distinct-id", Groups{}, nil, nil, nil)
+	if !isInconclusive(err) {
+		t.Error("Expected an InconclusiveMatchError without the group of the flag, got", err)
+	}
+}
+
+func TestFeatureFlagErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": [{"key": "region-flag", "active": true, "filters": {"groups": [{"properties": [{"key": "region", "operator": "exact", "value": "USA", "type": "person"}], "rollout_percentage": 100}]}}]}`))
+		} else if isFlagsRequest(r) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	_, err := client.GetFeatureFlag(FeatureFlagPayload{Key: "unknown-flag", DistinctId: "-", OnlyEvaluateLocally: true})
+	if err != ErrFlagNotFound {
+		t.Error("Expected ErrFlagNotFound, got", err)
+	}
+
+	_, err = client.GetFeatureFlag(FeatureFlagPayload{Key: "region-flag", DistinctId: "-"})
+	if !errors.Is(err, ErrRemoteEvaluationFailed) {
+		t.Error("Expected ErrRemoteEvaluationFailed, got", err)
+	}
+	var missingErr *MissingPropertyError
+	if !errors.As(err, &missingErr) {
+		t.Error("Expected the local evaluation error to be wrapped, got", err)
+	}
+
+	_, err = client.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "-"})
+	if !errors.Is(err, ErrRemoteEvaluationFailed) {
+		t.Error("Expected ErrRemoteEvaluationFailed, got", err)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	unloaded, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       failing.URL,
+	})
+	defer unloaded.Close()
+
+	_, err = unloaded.GetFeatureFlag(FeatureFlagPayload{Key: "region-flag", DistinctId: "-", OnlyEvaluateLocally: true})
+	if err != ErrFlagsNotLoaded {
+		t.Error("Expected ErrFlagsNotLoaded, got", err)
+	}
+
+	_, err = unloaded.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "-", OnlyEvaluateLocally: true})
+	if err != ErrFlagsNotLoaded {
+		t.Error("Expected ErrFlagsNotLoaded, got", err)
+	}
+}
+
+func TestGetFeatureFlagNotFoundRemotely(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			w.Write([]byte(fixture("test-decide-v2.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	value, err := client.GetFeatureFlag(FeatureFlagPayload{Key: "unknown-flag", DistinctId: "-"})
+	if value != nil || err != ErrFlagNotFound {
+		t.Error("Expected ErrFlagNotFound, got", value, err)
+	}
+}
+
 func TestMatchPropertySlice(t *testing.T) {
 
 	property := Property{
@@ -140,6 +391,49 @@ func TestMatchPropertyNumber(t *testing.T) {
 	}
 }
 
+func TestMatchPropertyJSONNumber(t *testing.T) {
+	var flag FeatureFlag
+	err := unmarshalJSON([]byte(`{"key": "id-flag", "filters": {"groups": [{"properties": [
+		{"key": "id", "operator": "exact", "value": 9007199254740993},
+		{"key": "age", "operator": "exact", "value": [30, 40]},
+		{"key": "score", "operator": "gt", "value": 2.5}
+	]}]}}`), &flag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	properties := flag.Filters.Groups[0].Properties
+	if _, ok := properties[0].Value.(json.Number); !ok {
+		t.Fatalf("Expected property values to be decoded as json.Number, got %T", properties[0].Value)
+	}
+
+	tests := []struct {
+		property Property
+		value    interface{}
+		isMatch  bool
+	}{
+		{properties[0], int64(9007199254740993), true},
+		{properties[0], int64(9007199254740992), false},
+		{properties[0], uint64(9007199254740993), true},
+		{properties[1], 30, true},
+		{properties[1], 40.0, true},
+		{properties[1], int8(35), false},
+		{properties[2], json.Number("3"), true},
+		{properties[2], 2, false},
+	}
+
+	for _, test := range tests {
+		isMatch, err := matchProperty(test.property, NewProperties().Set(test.property.Key, test.value))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if isMatch != test.isMatch {
+			t.Errorf("%s %v %v: expected match to be %v", test.property.Operator, test.property.Value, test.value, test.isMatch)
+		}
+	}
+}
+
 func TestMatchPropertyRegex(t *testing.T) {
 
 	shouldMatch := []interface{}{"value.com", "value2.com"}
@@ -184,8 +478,9 @@ func TestMatchPropertyRegex(t *testing.T) {
 	shouldNotMatch = []interface{}{"value", "valu2"}
 	for _, val := range shouldNotMatch {
 		isMatch, err := matchProperty(property, NewProperties().Set("key", val))
-		if err != nil {
-			t.Error(err)
+		var regexErr *InvalidRegexError
+		if !errors.As(err, &regexErr) || regexErr.Pattern != "?*" {
+			t.Error("Expected an InvalidRegexError, got", err)
 		}
 
 		if isMatch {
@@ -214,6 +509,162 @@ func TestMatchPropertyRegex(t *testing.T) {
 	}
 }
 
+func TestMatchPropertyNonStringValues(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    interface{}
+		override interface{}
+		isMatch  bool
+	}{
+		{"regex", "^12", 123, true},
+		{"regex", 123, "1234", true},
+		{"not_regex", "^12", 4.5, true},
+		{"not_regex", "^true$", true, false},
+		{"icontains", "TRU", true, true},
+		{"exact", []int{1}, []int{1}, true},
+		{"exact", []interface{}{"a"}, map[string]interface{}{"a": 1}, false},
+		{"is_not", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}, true},
+	}
+
+	for _, test := range tests {
+		property := Property{Key: "key", Value: test.value, Operator: test.operator}
+
+		isMatch, err := matchProperty(property, NewProperties().Set("key", test.override))
+		if err != nil {
+			t.Errorf("%s %v %v: unexpected error: %s", test.operator, test.value, test.override, err)
+		}
+
+		if isMatch != test.isMatch {
+			t.Errorf("%s %v %v: expected match to be %v", test.operator, test.value, test.override, test.isMatch)
+		}
+	}
+}
+
+func TestFlagGroupNonStringKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-flag-group-properties.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	_, err := client.GetFeatureFlag(
+		FeatureFlagPayload{
+			Key:                 "group-flag",
+			DistinctId:          "some-distinct-id",
+			Groups:              Groups{"company": 42},
+			GroupProperties:     map[string]Properties{"company": NewProperties().Set("name", "Project Name 1")},
+			OnlyEvaluateLocally: true,
+		},
+	)
+
+	if err != nil {
+		t.Error("Group keys of any type should be supported:", err)
+	}
+}
+
+func TestFlagGroupPropertiesOfSeveralGroupTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": [
+				{"key": "company-flag", "active": true, "filters": {"aggregation_group_type_index": 0, "groups": [{"properties": [{"key": "plan", "operator": "exact", "value": "enterprise", "type": "group", "group_type_index": 0}], "rollout_percentage": 100}]}},
+				{"key": "project-flag", "active": true, "filters": {"aggregation_group_type_index": 1, "groups": [{"properties": [{"key": "plan", "operator": "exact", "value": "free", "type": "group", "group_type_index": 1}], "rollout_percentage": 100}]}}
+			], "group_type_mapping": {"0": "company", "1": "project"}}`))
+		} else if isFlagsRequest(r) {
+			var reqBody DecideRequestData
+			if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+				t.Error(err)
+			}
+			expected := map[string]Properties{"company": {"plan": "enterprise"}, "project": {"plan": "free"}}
+			if !reflect.DeepEqual(reqBody.GroupProperties, expected) {
+				t.Errorf("Expected the properties of all group types to be sent, got %v", reqBody.GroupProperties)
+			}
+			w.Write([]byte(`{"featureFlags": {"unknown-flag": true}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:        "some very secret key",
+		Endpoint:              server.URL,
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+	if err := client.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each flag is matched against the properties of its own group type.
+	payload := FeatureFlagPayload{
+		DistinctId: "some-distinct-id",
+		Groups:     Groups{"company": "acme", "project": "website"},
+		GroupProperties: map[string]Properties{
+			"company": NewProperties().Set("plan", "enterprise"),
+			"project": NewProperties().Set("plan", "free"),
+		},
+	}
+	for _, key := range []string{"company-flag", "project-flag"} {
+		payload.Key = key
+		payload.OnlyEvaluateLocally = true
+		if value, err := client.GetFeatureFlag(payload); err != nil || value != true {
+			t.Errorf("Expected %s to match the properties of its group, got %v %v", key, value, err)
+		}
+	}
+
+	payload.Key = "unknown-flag"
+	payload.OnlyEvaluateLocally = false
+	if value, err := client.GetFeatureFlag(payload); err != nil || value != "true" {
+		t.Error("Expected the flag to be evaluated remotely, got", value, err)
+	}
+}
+
+func TestGetAllFlagsSendsPropertiesToDecide(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			var reqBody DecideRequestData
+			if err := decoder.Decode(&reqBody); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(reqBody.PersonProperties, Properties{"region": "Canada"}) {
+				t.Errorf("Expected the person properties to be sent, got %v", reqBody.PersonProperties)
+			}
+			if !reflect.DeepEqual(reqBody.GroupProperties, map[string]Properties{"company": {"name": "Project Name 1"}}) {
+				t.Errorf("Expected the group properties to be sent, got %v", reqBody.GroupProperties)
+			}
+			w.Write([]byte(fixture("test-decide-v2.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	flags, err := client.GetAllFlags(FeatureFlagPayloadNoKey{
+		DistinctId:       "some-distinct-id",
+		Groups:           Groups{"company": "amazon"},
+		PersonProperties: NewProperties().Set("region", "Canada"),
+		GroupProperties:  map[string]Properties{"company": NewProperties().Set("name", "Project Name 1")},
+	})
+	if err != nil || flags["beta-feature2"] != "variant-2" {
+		t.Error("Expected the flags to be evaluated remotely, got", flags, err)
+	}
+}
+
 func TestMatchPropertyContains(t *testing.T) {
 	shouldMatch := []interface{}{"value", "value2", "value3", "value4", "343tfvalue5"}
 
@@ -251,7 +702,7 @@ func TestMatchPropertyContains(t *testing.T) {
 func TestFlagPersonProperty(t *testing.T) {
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
@@ -274,7 +725,7 @@ func TestFlagPersonProperty(t *testing.T) {
 		},
 	)
 
-	if isMatch != true {
+	if isMatch == nil || !*isMatch {
 		t.Error("Should match")
 	}
 
@@ -286,14 +737,14 @@ func TestFlagPersonProperty(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 }
 
 func TestFlagGroup(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			decoder := json.NewDecoder(r.Body)
 			decoder.DisallowUnknownFields()
 			var reqBody DecideRequestData
@@ -354,8 +805,8 @@ func TestFlagGroup(t *testing.T) {
 		},
 	)
 
-	if isMatch != false {
-		t.Error("Unknown flag shouldn't match known flags")
+	if isMatch != nil {
+		t.Error("Unknown flag should be undefined")
 	}
 }
 
@@ -379,7 +830,7 @@ func TestFlagGroupProperty(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -391,7 +842,7 @@ func TestFlagGroupProperty(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -404,14 +855,14 @@ func TestFlagGroupProperty(t *testing.T) {
 		},
 	)
 
-	if isMatch != true {
+	if isMatch == nil || !*isMatch {
 		t.Error("Should match")
 	}
 }
 
 func TestComplexDefinition(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-complex-definition.json"))) // Don't return anything for local eval
@@ -433,7 +884,7 @@ func TestComplexDefinition(t *testing.T) {
 		},
 	)
 
-	if isMatch != true {
+	if isMatch == nil || !*isMatch {
 		t.Error("Should match")
 	}
 
@@ -445,7 +896,7 @@ func TestComplexDefinition(t *testing.T) {
 		},
 	)
 
-	if isMatch != true {
+	if isMatch == nil || !*isMatch {
 		t.Error("Should match")
 	}
 
@@ -453,7 +904,7 @@ func TestComplexDefinition(t *testing.T) {
 
 func TestFallbackToDecide(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte("{}")) // Don't return anything for local eval
@@ -475,14 +926,14 @@ func TestFallbackToDecide(t *testing.T) {
 		},
 	)
 
-	if isMatch != true {
+	if isMatch == nil || !*isMatch {
 		t.Error("Should match")
 	}
 }
 
 func TestFeatureFlagsDontFallbackToDecideWhenOnlyLocalEvaluationIsTrue(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte("test-decide-v2.json"))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-feature-flags-dont-fallback-to-decide-when-only-local-evaluation-is-true.json")))
@@ -516,7 +967,7 @@ func TestFeatureFlagsDontFallbackToDecideWhenOnlyLocalEvaluationIsTrue(t *testin
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -540,14 +991,14 @@ func TestFeatureFlagsDontFallbackToDecideWhenOnlyLocalEvaluationIsTrue(t *testin
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 }
 
 func TestFeatureFlagDefaultsDontHinderEvaluation(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-false.json")))
@@ -568,7 +1019,7 @@ func TestFeatureFlagDefaultsDontHinderEvaluation(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -579,7 +1030,7 @@ func TestFeatureFlagDefaultsDontHinderEvaluation(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -590,7 +1041,7 @@ func TestFeatureFlagDefaultsDontHinderEvaluation(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -601,7 +1052,7 @@ func TestFeatureFlagDefaultsDontHinderEvaluation(t *testing.T) {
 		},
 	)
 
-	if isMatch == true {
+	if isMatch != nil && *isMatch {
 		t.Error("Should not match")
 	}
 
@@ -631,21 +1082,21 @@ func TestFeatureFlagNullComeIntoPlayOnlyWhenDecideErrorsOut(t *testing.T) {
 		t.Error("Should be nil")
 	}
 
-	isMatch, _ = client.IsFeatureEnabled(
+	isEnabled, _ := client.IsFeatureEnabled(
 		FeatureFlagPayload{
 			Key:        "test-get-feature",
 			DistinctId: "distinct_id",
 		},
 	)
 
-	if isMatch != nil {
+	if isEnabled != nil {
 		t.Error("Should be nil")
 	}
 }
 
 func TestExperienceContinuityOverride(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
@@ -674,7 +1125,7 @@ func TestExperienceContinuityOverride(t *testing.T) {
 
 func TestGetAllFlags(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-multiple-flags.json")))
@@ -700,7 +1151,7 @@ func TestGetAllFlags(t *testing.T) {
 
 func TestGetAllFlagsEmptyLocal(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte("{}"))
@@ -726,7 +1177,7 @@ func TestGetAllFlagsEmptyLocal(t *testing.T) {
 
 func TestGetAllFlagsNoDecide(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-multiple-flags-valid.json")))
@@ -752,7 +1203,7 @@ func TestGetAllFlagsNoDecide(t *testing.T) {
 
 func TestGetAllFlagsOnlyLocalEvaluationSet(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-get-all-flags-with-fallback-but-only-local-evaluation-set.json")))
@@ -779,7 +1230,7 @@ func TestGetAllFlagsOnlyLocalEvaluationSet(t *testing.T) {
 
 func TestComputeInactiveFlagsLocally(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-compute-inactive-flags-locally.json")))
@@ -803,7 +1254,7 @@ func TestComputeInactiveFlagsLocally(t *testing.T) {
 	}
 
 	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-compute-inactive-flags-locally-2.json")))
@@ -845,14 +1296,14 @@ func TestFeatureEnabledSimpleIsTrueWhenRolloutUndefined(t *testing.T) {
 			DistinctId: "distinct-id",
 		},
 	)
-	if isMatch != true {
+	if isMatch == nil || !*isMatch {
 		t.Error("Should be enabled")
 	}
 }
 
 func TestGetFeatureFlag(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
@@ -882,7 +1333,7 @@ func TestGetFeatureFlag(t *testing.T) {
 func TestFlagWithVariantOverrides(t *testing.T) {
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-variant-override.json")))
@@ -921,10 +1372,36 @@ func TestFlagWithVariantOverrides(t *testing.T) {
 	}
 }
 
+func TestGetAllFlagsWithVariantOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			t.Error("variant overrides should be evaluated locally")
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-variant-override.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	flags, err := client.GetAllFlags(FeatureFlagPayloadNoKey{
+		DistinctId:       "test_id",
+		PersonProperties: NewProperties().Set("email", "test@posthog.com"),
+	})
+
+	if err != nil || flags["beta-feature"] != "second-variant" {
+		t.Error("Expected the overridden variant, got", flags, err)
+	}
+}
+
 func TestFlagWithClashingVariantOverrides(t *testing.T) {
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-variant-override-clashing.json")))
@@ -967,7 +1444,7 @@ func TestFlagWithClashingVariantOverrides(t *testing.T) {
 func TestFlagWithInvalidVariantOverrides(t *testing.T) {
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-variant-override-invalid.json")))
@@ -1009,7 +1486,7 @@ func TestFlagWithInvalidVariantOverrides(t *testing.T) {
 func TestFlagWithMultipleVariantOverrides(t *testing.T) {
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-variant-override-multiple.json")))
@@ -1061,7 +1538,7 @@ func TestFlagWithMultipleVariantOverrides(t *testing.T) {
 
 func TestCaptureIsCalled(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
@@ -2112,7 +2589,7 @@ func TestSimpleFlagConsistency(t *testing.T) {
 				DistinctId: fmt.Sprintf("%s%d", "distinct_id_", i),
 			},
 		)
-		if results[i] != isMatch {
+		if isMatch == nil || results[i] != *isMatch {
 			t.Error("Match result is not consistent")
 		}
 	}
@@ -3146,3 +3623,1612 @@ func TestMultivariateFlagConsistency(t *testing.T) {
 		}
 	}
 }
+
+func TestFeatureFlagRequestErrorsAreLogged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var mutex sync.Mutex
+	statuses := map[string]interface{}{}
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger: testLeveledLogger{log: func(level LogLevel, msg string, fields ...LogField) {
+			if level != LogLevelError {
+				return
+			}
+			var endpoint, status interface{}
+			for _, f := range fields {
+				switch f.Key {
+				case "endpoint":
+					endpoint = f.Value
+				case "status":
+					status = f.Value
+				}
+			}
+			mutex.Lock()
+			statuses[fmt.Sprint(endpoint)] = status
+			mutex.Unlock()
+		}},
+	})
+	defer client.Close()
+
+	client.GetFeatureFlag(
+		FeatureFlagPayload{
+			Key:        "simple-flag",
+			DistinctId: "some-distinct-id",
+		},
+	)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if status := statuses[server.URL+"/api/feature_flag/local_evaluation"]; status != http.StatusInternalServerError {
+		t.Errorf("expected local evaluation failure to be logged with status 500, got %v", statuses)
+	}
+
+	if status := statuses[server.URL+"/flags/?v=2"]; status != http.StatusInternalServerError {
+		t.Errorf("expected decide failure to be logged with status 500, got %v", statuses)
+	}
+}
+
+func TestPollerShutdownIsIdempotent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+
+	poller := c.(*client).featureFlagsPoller
+	poller.GetFeatureFlags()
+	c.ReloadFeatureFlags()
+	c.Close()
+
+	poller.Shutdown()
+	if err := c.ReloadFeatureFlags(); err != nil {
+		t.Error("reloading flags after shutdown should not fail:", err)
+	}
+
+	if flags := poller.GetFeatureFlags(); len(flags) != 1 {
+		t.Errorf("expected flags fetched before shutdown to be kept, got %v", flags)
+	}
+}
+
+func TestPollerShutdownCancelsFetch(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		client.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("closing the client should cancel the in-flight flags request")
+	}
+
+	if _, err := client.GetFeatureFlags(); err != ErrFlagsNotLoaded {
+		t.Error("expected ErrFlagsNotLoaded once the poller is shut down, got", err)
+	}
+}
+
+func TestDecideRequestCarriesPropertyOverrides(t *testing.T) {
+	requests := make(chan DecideRequestData, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			var data DecideRequestData
+			json.NewDecoder(r.Body).Decode(&data)
+			requests <- data
+			w.Write([]byte(fixture("test-decide-v2.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	client.GetFeatureFlag(FeatureFlagPayload{
+		Key:                   "beta-feature",
+		DistinctId:            "some-distinct-id",
+		Groups:                Groups{"company": "amazon"},
+		PersonProperties:      NewProperties().Set("region", "USA"),
+		GroupProperties:       map[string]Properties{"company": NewProperties().Set("name", "Amazon")},
+		SendFeatureFlagEvents: new(bool),
+	})
+
+	data := <-requests
+	if data.PersonProperties["region"] != "USA" || data.GroupProperties["company"]["name"] != "Amazon" || data.Groups["company"] != "amazon" {
+		t.Errorf("expected the property overrides to be sent to /decide, got %+v", data)
+	}
+}
+
+func TestLocalEvaluationFetchesCohorts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			if _, ok := r.URL.Query()["send_cohorts"]; !ok {
+				t.Errorf("expected cohorts to be requested: %s", r.URL)
+			}
+			w.Write([]byte(fixture("feature_flag/test-flag-cohorts.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	if err := c.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if flags, err := c.GetFeatureFlags(); err != nil || len(flags) != 1 {
+		t.Fatalf("expected the flag to be loaded, got %v %v", flags, err)
+	}
+
+	snapshot := c.(*client).featureFlagsPoller.definitions()
+
+	cohort, ok := snapshot.cohorts["98"]
+	if !ok || cohort.Type != "OR" || len(cohort.Values) != 2 {
+		t.Fatalf("unexpected cohort: %+v", cohort)
+	}
+	if nested := cohort.Values[0].Values; len(nested) != 2 || nested[1].Key != "id" || !nested[1].Negation {
+		t.Errorf("unexpected nested cohort properties: %+v", nested)
+	}
+	if snapshot.groups["0"] != "company" {
+		t.Errorf("unexpected group type mapping: %v", snapshot.groups)
+	}
+}
+
+func TestGroupFlagIsRolledOutByGroup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			t.Error("group flags should be evaluated locally")
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-group-flag-rollout.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	evaluate := func(distinctId string, groups Groups) interface{} {
+		result, err := c.GetFeatureFlag(FeatureFlagPayload{
+			Key:                   "group-flag",
+			DistinctId:            distinctId,
+			Groups:                groups,
+			SendFeatureFlagEvents: new(bool),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	outcomes := map[interface{}]bool{}
+	for i := 0; i != 20; i++ {
+		groups := Groups{"company": fmt.Sprintf("company-%d", i)}
+		a, b := evaluate("a", groups), evaluate("b", groups)
+		if a != b {
+			t.Errorf("expected the same result for every member of %v, got %v and %v", groups, a, b)
+		}
+		outcomes[a] = true
+	}
+	if !outcomes[true] || !outcomes[false] {
+		t.Errorf("expected the rollout to split groups, got %v", outcomes)
+	}
+}
+
+func TestFlagCohortMatching(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			t.Error("cohort flags should be evaluated locally")
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-flag-cohorts.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	if err := c.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		properties   Properties
+		result       interface{}
+		inconclusive bool
+	}{
+		{properties: NewProperties().Set("region", "USA").Set("banned", "false"), result: true},
+		{properties: NewProperties().Set("region", "USA").Set("banned", "true").Set("other", "nope"), result: false},
+		{properties: NewProperties().Set("region", "Canada").Set("other", "thing"), result: true},
+		{properties: NewProperties().Set("region", "Canada").Set("banned", "false").Set("other", "nope"), result: false},
+		{properties: NewProperties().Set("region", "USA").Set("banned", "true"), inconclusive: true},
+	}
+
+	flags, _ := c.GetFeatureFlags()
+
+	for _, test := range tests {
+		result, err := c.(*client).featureFlagsPoller.computeFlagLocally(flags[0], "some-distinct-id", nil, test.properties, nil, nil)
+
+		var inconclusiveErr *InconclusiveMatchError
+		if test.inconclusive {
+			if !errors.As(err, &inconclusiveErr) {
+				t.Errorf("%v: expected an inconclusive match, got %v %v", test.properties, result, err)
+			}
+		} else if err != nil || result != test.result {
+			t.Errorf("%v: expected %v, got %v %v", test.properties, test.result, result, err)
+		}
+	}
+}
+
+func TestFlagSuperCondition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			t.Error("super conditions should be evaluated locally")
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-super-condition.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	tests := []struct {
+		properties Properties
+		enabled    bool
+	}{
+		{NewProperties().Set("$feature_enrollment/early-access-feature", "true").Set("region", "Canada"), true},
+		{NewProperties().Set("$feature_enrollment/early-access-feature", "false").Set("region", "USA"), false},
+		{NewProperties().Set("region", "USA"), true},
+		{NewProperties().Set("region", "Canada"), false},
+	}
+
+	for _, test := range tests {
+		value, err := client.GetFeatureFlag(FeatureFlagPayload{
+			Key:                   "early-access-feature",
+			DistinctId:            "some-distinct-id",
+			PersonProperties:      test.properties,
+			SendFeatureFlagEvents: new(bool),
+		})
+		if err != nil || value != test.enabled {
+			t.Errorf("%v: expected %t, got %v %v", test.properties, test.enabled, value, err)
+		}
+	}
+}
+
+func TestExperienceContinuityFlagIsEvaluatedRemotely(t *testing.T) {
+	var decides int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			atomic.AddInt32(&decides, 1)
+			w.Write([]byte(fixture("test-decide-v2.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": [{"key": "beta-feature", "active": true, "ensure_experience_continuity": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	payload := FeatureFlagPayload{
+		Key:                   "beta-feature",
+		DistinctId:            "some-distinct-id",
+		SendFeatureFlagEvents: new(bool),
+	}
+
+	if value, err := client.GetFeatureFlag(payload); err != nil || value != "decide-fallback-value" {
+		t.Error("Expected the flag to be evaluated by /decide, got", value, err)
+	}
+
+	payload.OnlyEvaluateLocally = true
+
+	var inconclusiveErr *InconclusiveMatchError
+	if value, err := client.GetFeatureFlag(payload); !errors.As(err, &inconclusiveErr) {
+		t.Error("Expected an inconclusive match when evaluating locally, got", value, err)
+	}
+	if n := atomic.LoadInt32(&decides); n != 1 {
+		t.Errorf("Expected a single /decide request, got %d", n)
+	}
+}
+
+func TestOnlyEvaluateLocallyNeverCallsDecide(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			t.Error("/decide should not be called when only evaluating locally")
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer client.Close()
+
+	payload := FeatureFlagPayload{
+		Key:                   "simple-flag",
+		DistinctId:            "some-distinct-id",
+		OnlyEvaluateLocally:   true,
+		SendFeatureFlagEvents: new(bool),
+	}
+
+	var inconclusiveErr *InconclusiveMatchError
+	if enabled, err := client.IsFeatureEnabled(payload); enabled != nil || !errors.As(err, &inconclusiveErr) {
+		t.Error("Expected an inconclusive match without the region property, got", enabled, err)
+	}
+
+	flags, err := client.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id", OnlyEvaluateLocally: true})
+	if _, ok := flags["simple-flag"]; ok || err != nil {
+		t.Error("Expected the inconclusive flag to be left out, got", flags, err)
+	}
+
+	payload.PersonProperties = NewProperties().Set("region", "USA")
+	if enabled, err := client.IsFeatureEnabled(payload); err != nil || enabled == nil || !*enabled {
+		t.Error("Expected the flag to be enabled, got", enabled, err)
+	}
+}
+
+func TestSendFeatureFlagEventsConfig(t *testing.T) {
+	events := make(chan Properties, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/batch") {
+			var batch struct {
+				Batch []struct {
+					Event      string
+					Properties Properties
+				}
+			}
+			json.NewDecoder(r.Body).Decode(&batch)
+			for _, m := range batch.Batch {
+				if m.Event == "$feature_flag_called" {
+					events <- m.Properties
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:        "some very secret key",
+		Endpoint:              server.URL,
+		Logger:                testLogger{t.Logf, t.Logf},
+		SendFeatureFlagEvents: new(bool),
+	})
+
+	payload := FeatureFlagPayload{
+		Key:              "simple-flag",
+		DistinctId:       "some-distinct-id",
+		PersonProperties: NewProperties().Set("region", "USA"),
+	}
+
+	// Disabled by the configuration.
+	client.GetFeatureFlag(payload)
+
+	// Enabled by the call, twice to check events are deduplicated.
+	enabled := true
+	payload.SendFeatureFlagEvents = &enabled
+	client.GetFeatureFlag(payload)
+	client.GetFeatureFlag(payload)
+
+	client.Close()
+	close(events)
+
+	var reported []Properties
+	for props := range events {
+		reported = append(reported, props)
+	}
+	if len(reported) != 1 || reported[0]["$feature_flag"] != "simple-flag" || reported[0]["$feature_flag_response"] != true {
+		t.Errorf("expected a single $feature_flag_called event, got %v", reported)
+	}
+}
+
+func TestSendFeatureFlagsEvaluatesLocally(t *testing.T) {
+	events := make(chan Properties, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case isFlagsRequest(r):
+			t.Error("flags attached to events should be evaluated locally")
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			w.Write([]byte(fixture("feature_flag/test-multiple-flags-valid.json")))
+		case strings.HasPrefix(r.URL.Path, "/batch"):
+			var batch struct{ Batch []struct{ Properties Properties } }
+			json.NewDecoder(r.Body).Decode(&batch)
+			for _, m := range batch.Batch {
+				events <- m.Properties
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:   "some very secret key",
+		Endpoint:         server.URL,
+		Logger:           testLogger{t.Logf, t.Logf},
+		SendFeatureFlags: true,
+		BatchSize:        1,
+	})
+	defer client.Close()
+
+	expected, _ := client.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id", OnlyEvaluateLocally: true})
+	if len(expected) == 0 {
+		t.Fatal("expected flags to be evaluated locally")
+	}
+
+	client.Enqueue(Capture{DistinctId: "some-distinct-id", Event: "A"})
+
+	props := <-events
+	var active []string
+	for key, value := range expected {
+		if props["$feature/"+key] != value {
+			t.Errorf("expected $feature/%s to be %v, got %v", key, value, props["$feature/"+key])
+		}
+		if value != false {
+			active = append(active, key)
+		}
+	}
+	sort.Strings(active)
+	if fmt.Sprint(props["$active_feature_flags"]) != fmt.Sprint(active) {
+		t.Errorf("expected the active flags to be %v, got %v", active, props["$active_feature_flags"])
+	}
+}
+
+func TestGetFeatureFlagCtxCancelsDecide(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			// Hang until the test returns.
+			<-release
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetFeatureFlagCtx(ctx, FeatureFlagPayload{
+		Key:                   "unknown-flag",
+		DistinctId:            "some-distinct-id",
+		SendFeatureFlagEvents: new(bool),
+	})
+	if !errors.Is(err, ErrRemoteEvaluationFailed) {
+		t.Error("Expected the remote evaluation to fail, got", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected the deadline of the context to be the cause, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Expected /decide to be canceled with the context, it took", elapsed)
+	}
+}
+
+func TestFlagsCtxHonorDeadlineBeforeDefinitionsLoad(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			// Hang until the test returns.
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+	})
+	defer c.Close()
+
+	flagConfig := FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id", SendFeatureFlagEvents: new(bool)}
+	calls := map[string]func(ctx context.Context) error{
+		"GetFeatureFlagCtx": func(ctx context.Context) error {
+			_, err := c.GetFeatureFlagCtx(ctx, flagConfig)
+			return err
+		},
+		"IsFeatureEnabledCtx": func(ctx context.Context) error {
+			_, err := c.IsFeatureEnabledCtx(ctx, flagConfig)
+			return err
+		},
+		"GetAllFlagsCtx": func(ctx context.Context) error {
+			_, err := c.GetAllFlagsCtx(ctx, FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id"})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := call(ctx)
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected the deadline to be exceeded, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: expected to give up with the context, it took %v", name, elapsed)
+		}
+	}
+}
+
+func TestEnqueueCtxGivesUpOnFeatureFlags(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			<-release
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			// Flags are never loaded so captures fall back to /decide.
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := c.EnqueueCtx(ctx, Capture{
+		DistinctId:       "some-distinct-id",
+		Event:            "test",
+		SendFeatureFlags: true,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected the context deadline to be returned, got", err)
+	}
+}
+
+func TestFeatureFlagRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			<-release
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:            "some very secret key",
+		Endpoint:                  server.URL,
+		FeatureFlagRequestTimeout: 50 * time.Millisecond,
+		Logger:                    testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	start := time.Now()
+	_, err := c.GetFeatureFlag(FeatureFlagPayload{
+		Key:                   "unknown-flag",
+		DistinctId:            "some-distinct-id",
+		SendFeatureFlagEvents: new(bool),
+	})
+	if !errors.Is(err, ErrRemoteEvaluationFailed) {
+		t.Error("Expected the remote evaluation to time out, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Expected /decide to time out after the flag request timeout, it took", elapsed)
+	}
+}
+
+func TestFlagDefinitionsAreNotReparsedWhenUnchanged(t *testing.T) {
+	var fetches, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			atomic.AddInt32(&fetches, 1)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		ManualPump:     true,
+	})
+	defer c.Close()
+
+	poller := c.(*client).featureFlagsPoller
+	for i := 0; i < 3; i++ {
+		if err := poller.PollOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 3 {
+		t.Errorf("Expected 3 fetches, got %d", n)
+	}
+	if n := atomic.LoadInt32(&notModified); n != 2 {
+		t.Errorf("Expected 2 not modified responses, got %d", n)
+	}
+	if flags, err := c.GetFeatureFlags(); err != nil || len(flags) != 1 {
+		t.Error("Expected the definitions to be kept, got", flags, err)
+	}
+}
+
+func TestFlagPollingBacksOffOnFailures(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			atomic.AddInt32(&fetches, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:                     "some very secret key",
+		Endpoint:                           server.URL,
+		DefaultFeatureFlagsPollingInterval: 10 * time.Millisecond,
+		FeatureFlagsBackoff:                func(int) time.Duration { return time.Hour },
+		Logger:                             testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected polling to back off after the first failure, got %d fetches", n)
+	}
+}
+
+func TestFlagPollingBackoffResetsOnSuccess(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			if atomic.AddInt32(&fetches, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	var attempts []int
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		ManualPump:     true,
+		FeatureFlagsBackoff: func(attempt int) time.Duration {
+			attempts = append(attempts, attempt)
+			return time.Hour
+		},
+		Logger: testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	poller := c.(*client).featureFlagsPoller
+	for i := 0; i < 3; i++ {
+		poller.PollOnce(context.Background())
+	}
+
+	if !reflect.DeepEqual(attempts, []int{0, 1}) {
+		t.Error("Expected the backoff to grow with consecutive failures, got", attempts)
+	}
+	if d := time.Until(poller.nextPoll); d > time.Minute {
+		t.Error("Expected the polling interval to resume after a success, next poll in", d)
+	}
+}
+
+func TestDecideQuotaLimiting(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"retry after": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+		"quota limited": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"featureFlags": {}, "quotaLimited": ["feature_flags"]}`))
+		},
+	}
+
+	for name, decide := range tests {
+		t.Run(name, func(t *testing.T) {
+			var decides int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if isFlagsRequest(r) {
+					atomic.AddInt32(&decides, 1)
+					decide(w, r)
+				} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+					w.Write([]byte(`{"flags": []}`))
+				}
+			}))
+			defer server.Close()
+
+			c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+				PersonalApiKey:                     "some very secret key",
+				Endpoint:                           server.URL,
+				DefaultFeatureFlagsPollingInterval: time.Minute,
+				Logger:                             testLogger{t.Logf, t.Logf},
+			})
+			defer c.Close()
+
+			payload := FeatureFlagPayload{
+				Key:                   "unknown-flag",
+				DistinctId:            "some-distinct-id",
+				SendFeatureFlagEvents: new(bool),
+			}
+			for i := 0; i < 2; i++ {
+				_, err := c.GetFeatureFlag(payload)
+				var quotaErr *QuotaLimitedError
+				if !errors.As(err, &quotaErr) || !errors.Is(err, ErrRemoteEvaluationFailed) {
+					t.Fatal("Expected a QuotaLimitedError, got", err)
+				}
+				if d := time.Until(quotaErr.Until); d < 50*time.Second || d > time.Minute {
+					t.Error("Expected requests to be paused for a minute, got", d)
+				}
+			}
+
+			if n := atomic.LoadInt32(&decides); n != 1 {
+				t.Errorf("Expected /decide to be called once, got %d", n)
+			}
+		})
+	}
+}
+
+func TestFlagPollingQuotaLimiting(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			atomic.AddInt32(&fetches, 1)
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		ManualPump:     true,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	poller := c.(*client).featureFlagsPoller
+	for i := 0; i < 2; i++ {
+		var quotaErr *QuotaLimitedError
+		if err := poller.PollOnce(context.Background()); !errors.As(err, &quotaErr) {
+			t.Fatal("Expected a QuotaLimitedError, got", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected definitions to be fetched once, got %d", n)
+	}
+	if d := time.Until(poller.nextPoll); d < 59*time.Minute {
+		t.Error("Expected polling to resume after the limit, next poll in", d)
+	}
+}
+
+func TestOnFeatureFlagsChanged(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			if atomic.AddInt32(&fetches, 1) <= 2 {
+				w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+			} else {
+				w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
+			}
+		}
+	}))
+	defer server.Close()
+
+	type change struct{ old, new []FeatureFlag }
+	var changes []change
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		ManualPump:     true,
+		OnFeatureFlagsChanged: func(old, new []FeatureFlag) {
+			changes = append(changes, change{old, new})
+		},
+	})
+	defer c.Close()
+
+	poller := c.(*client).featureFlagsPoller
+	for i := 0; i < 3; i++ {
+		if err := poller.PollOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(changes))
+	}
+	if changes[0].old != nil || len(changes[0].new) != 1 {
+		t.Error("Expected the first load to be reported, got", changes[0])
+	}
+	if !reflect.DeepEqual(changes[1].old, changes[0].new) || len(changes[1].new[0].Filters.Groups[0].Properties) != 1 {
+		t.Error("Expected the updated definitions to be reported, got", changes[1])
+	}
+}
+
+func TestFeatureFlagsStatus(t *testing.T) {
+	var fail int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			if atomic.LoadInt32(&fail) != 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:                     "some very secret key",
+		Endpoint:                           server.URL,
+		ManualPump:                         true,
+		DefaultFeatureFlagsPollingInterval: time.Minute,
+		FeatureFlagsBackoff:                func(int) time.Duration { return time.Hour },
+		Logger:                             testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	if status, err := c.FeatureFlagsStatus(); err != nil || status.Loaded || !status.LastFetchAt.IsZero() {
+		t.Error("Expected no definitions before the first poll, got", status, err)
+	}
+
+	before := time.Now()
+	c.Pump(context.Background())
+
+	status, _ := c.FeatureFlagsStatus()
+	if !status.Loaded || status.Flags != 1 || status.LastFetchAt.Before(before) || status.LastError != nil {
+		t.Error("Expected the definitions to be loaded, got", status)
+	}
+	if d := status.NextPollAt.Sub(status.LastFetchAt); d < 59*time.Second || d > time.Minute+time.Second {
+		t.Error("Expected the next poll after the polling interval, got", d)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	c.(*client).featureFlagsPoller.PollOnce(context.Background())
+
+	failed, _ := c.FeatureFlagsStatus()
+	if failed.LastError == nil || failed.LastFetchAt != status.LastFetchAt || failed.Flags != 1 {
+		t.Error("Expected the failed fetch to be reported, got", failed)
+	}
+	if d := time.Until(failed.NextPollAt); d < 59*time.Minute {
+		t.Error("Expected the next poll to back off, got", d)
+	}
+}
+
+func TestWaitForFeatureFlags(t *testing.T) {
+	var fail int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			if atomic.LoadInt32(&fail) != 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		ManualPump:     true,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+
+	c.Pump(context.Background())
+
+	if _, err := c.GetFeatureFlags(); err != ErrFlagsNotLoaded {
+		t.Error("Expected ErrFlagsNotLoaded after a failed fetch, got", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.WaitForFeatureFlags(ctx); err != context.DeadlineExceeded {
+		t.Error("Expected the deadline to be exceeded, got", err)
+	}
+
+	atomic.StoreInt32(&fail, 0)
+	c.ReloadFeatureFlags()
+	c.Pump(context.Background())
+
+	if err := c.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Error("Expected the flags to be loaded, got", err)
+	}
+
+	c.Close()
+
+	if err := c.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Error("Expected loaded flags to stay available once closed, got", err)
+	}
+}
+
+func TestReloadFeatureFlagsAndWait(t *testing.T) {
+	var fail int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			if atomic.LoadInt32(&fail) != 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:                     "some very secret key",
+		Endpoint:                           server.URL,
+		DefaultFeatureFlagsPollingInterval: time.Hour,
+		Logger:                             testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	if err := c.ReloadFeatureFlagsAndWait(context.Background()); err != nil {
+		t.Error("Expected the reload to succeed, got", err)
+	}
+	if flags, err := c.GetFeatureFlags(); err != nil || len(flags) != 1 {
+		t.Error("Expected the flags to be loaded once the reload returns, got", flags, err)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+
+	var apiErr *APIError
+	if err := c.ReloadFeatureFlagsAndWait(context.Background()); !errors.As(err, &apiErr) || apiErr.Status != http.StatusInternalServerError {
+		t.Error("Expected the error of the fetch, got", err)
+	}
+
+	c.Close()
+
+	if err := c.ReloadFeatureFlagsAndWait(context.Background()); err != ErrClosed {
+		t.Error("Expected ErrClosed once the client is closed, got", err)
+	}
+}
+
+func TestMaxFlagStaleness(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:   "some very secret key",
+		Endpoint:         server.URL,
+		ManualPump:       true,
+		MaxFlagStaleness: time.Hour,
+		Logger:           testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	c.Pump(context.Background())
+
+	payload := FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id", SendFeatureFlagEvents: new(bool)}
+	if _, err := c.GetFeatureFlag(payload); err != nil {
+		t.Fatal("Expected fresh definitions to be used, got", err)
+	}
+
+	// Pretend fetches have been failing for a while.
+	poller := c.(*client).featureFlagsPoller
+	stale := *poller.definitions()
+	stale.fetchedAt = time.Now().Add(-2 * time.Hour)
+	poller.snapshot.Store(&stale)
+
+	var staleErr *StaleFlagsError
+	if value, err := c.GetFeatureFlag(payload); value != nil || !errors.As(err, &staleErr) || staleErr.Age < 2*time.Hour {
+		t.Error("Expected a StaleFlagsError, got", value, err)
+	}
+	if flags, err := c.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id"}); len(flags) != 0 || !errors.As(err, &staleErr) {
+		t.Error("Expected a StaleFlagsError, got", flags, err)
+	}
+	if status, _ := c.FeatureFlagsStatus(); !status.Stale || status.Age < 2*time.Hour {
+		t.Error("Expected the status to report stale definitions, got", status)
+	}
+
+	c.ReloadFeatureFlagsAndWait(context.Background())
+
+	if _, err := c.GetFeatureFlag(payload); err != nil {
+		t.Error("Expected definitions to be used again once fetched, got", err)
+	}
+}
+
+func newBenchmarkClient(b *testing.B) Client {
+	c, err := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(fixture("feature_flag/test-simple-flag.json")),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{b.Logf, b.Logf},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+func BenchmarkGetFeatureFlag(b *testing.B) {
+	c := newBenchmarkClient(b)
+	defer c.Close()
+
+	payload := FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.GetFeatureFlag(payload)
+	}
+}
+
+func BenchmarkGetFeatureFlagParallel(b *testing.B) {
+	c := newBenchmarkClient(b)
+	defer c.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		payload := FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id"}
+		for pb.Next() {
+			c.GetFeatureFlag(payload)
+		}
+	})
+}
+
+// Reads contend with definitions being swapped by reloads in a loop.
+func BenchmarkGetFeatureFlagParallelReloads(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:        "some very secret key",
+		Endpoint:              server.URL,
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{b.Logf, b.Logf},
+	})
+	defer c.Close()
+	c.ReloadFeatureFlagsAndWait(context.Background())
+
+	stop := make(chan struct{})
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.ReloadFeatureFlagsAndWait(context.Background())
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		payload := FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id"}
+		for pb.Next() {
+			c.GetFeatureFlag(payload)
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	<-reloaded
+}
+
+// Definitions of n flags rolled out to everyone, except for the ones whose
+// index is in off.
+func manyFlagsDefinitions(n int, off ...int) string {
+	flags := make([]map[string]interface{}, n)
+	for i := range flags {
+		rollout := 100
+		for _, j := range off {
+			if i == j {
+				rollout = 0
+			}
+		}
+		flags[i] = map[string]interface{}{
+			"key":     fmt.Sprintf("flag-%d", i%(n-1)),
+			"active":  true,
+			"filters": map[string]interface{}{"groups": []interface{}{map[string]interface{}{"properties": []interface{}{}, "rollout_percentage": rollout}}},
+		}
+	}
+	b, _ := json.Marshal(map[string]interface{}{"flags": flags})
+	return string(b)
+}
+
+func TestGetFeatureFlagLooksUpFlagsByKey(t *testing.T) {
+	// The last flag has the same key as the first one.
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(manyFlagsDefinitions(500, 499)),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	for _, key := range []string{"flag-0", "flag-250", "flag-498"} {
+		if value, err := c.GetFeatureFlag(FeatureFlagPayload{Key: key, DistinctId: "some-distinct-id"}); err != nil || value != true {
+			t.Errorf("Expected %s to be enabled, got %v %v", key, value, err)
+		}
+	}
+
+	if _, err := c.GetFeatureFlag(FeatureFlagPayload{Key: "flag-499", DistinctId: "some-distinct-id"}); err != ErrFlagNotFound {
+		t.Error("Expected an unknown flag not to be found, got", err)
+	}
+}
+
+func BenchmarkGetFeatureFlagManyFlags(b *testing.B) {
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(manyFlagsDefinitions(1000)),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{b.Logf, b.Logf},
+	})
+	defer c.Close()
+
+	payload := FeatureFlagPayload{Key: "flag-998", DistinctId: "some-distinct-id"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.GetFeatureFlag(payload)
+	}
+}
+
+func TestHashMatchesHexDigest(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		key, distinctId := fmt.Sprintf("flag-%d", i%7), fmt.Sprintf("distinct-id-%d", i)
+
+		digest := sha1.Sum([]byte(key + "." + distinctId + "variant"))
+		prefix, _ := strconv.ParseUint(hex.EncodeToString(digest[:])[:15], 16, 64)
+
+		hash, err := _hash(key, distinctId, "variant")
+		if err != nil || hash != float64(prefix)/LONG_SCALE {
+			t.Fatalf("Expected the hash of %s to be %v, got %v %v", distinctId, float64(prefix)/LONG_SCALE, hash, err)
+		}
+	}
+}
+
+func TestFindVariantMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100; i++ {
+		// Variants with random rollouts, not always adding up to 100%, so some
+		// hashes match no variant.
+		flag := FeatureFlag{Key: "multivariate-flag"}
+		variants := []FlagVariant{}
+		count := 1 + rng.Intn(8)
+		for v, total := 0, 0; v < count; v++ {
+			rollout := uint8(rng.Intn(101 - total))
+			total += int(rollout)
+			variants = append(variants, FlagVariant{Key: fmt.Sprintf("variant-%d", v), RolloutPercentage: &rollout})
+		}
+		flag.Filters.Multivariate = &Variants{Variants: variants}
+		lookupTable := getVariantLookupTable(flag)
+
+		for j := 0; j < 100; j++ {
+			hash := rng.Float64()
+
+			var expected interface{}
+			for _, variant := range lookupTable {
+				if hash >= variant.ValueMin && hash < variant.ValueMax {
+					expected = variant.Key
+					break
+				}
+			}
+
+			var found interface{}
+			if variant, ok := findVariant(lookupTable, hash); ok {
+				found = variant.Key
+			}
+			if found != expected {
+				t.Fatalf("Expected %v for hash %v in %v, got %v", expected, hash, lookupTable, found)
+			}
+		}
+	}
+}
+
+func TestMultivariateFlagDistribution(t *testing.T) {
+	flag := FeatureFlag{Key: "multivariate-flag"}
+	flag.Filters.Multivariate = &Variants{}
+	for _, variant := range []struct {
+		key     string
+		rollout uint8
+	}{{"first-variant", 50}, {"second-variant", 20}, {"third-variant", 20}, {"fourth-variant", 5}, {"fifth-variant", 5}} {
+		rollout := variant.rollout
+		flag.Filters.Multivariate.Variants = append(flag.Filters.Multivariate.Variants, FlagVariant{Key: variant.key, RolloutPercentage: &rollout})
+	}
+
+	// The variants of the Python SDK consistency tests, see
+	// TestMultivariateFlagConsistency.
+	for distinctId, expected := range map[string]string{
+		"distinct_id_0":  "second-variant",
+		"distinct_id_2":  "first-variant",
+		"distinct_id_5":  "second-variant",
+		"distinct_id_6":  "first-variant",
+		"distinct_id_11": "third-variant",
+		"distinct_id_18": "fourth-variant",
+		"distinct_id_21": "third-variant",
+		"distinct_id_31": "third-variant",
+		"distinct_id_81": "fifth-variant",
+	} {
+		if variant, err := getMatchingVariant(flag, distinctId, nil); err != nil || variant != expected {
+			t.Errorf("Expected %s to get %s, got %v %v", distinctId, expected, variant, err)
+		}
+	}
+
+	const samples = 10000
+	counts := map[interface{}]int{}
+	for i := 0; i < samples; i++ {
+		variant, err := getMatchingVariant(flag, fmt.Sprintf("distinct-id-%d", i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[variant]++
+	}
+
+	for _, variant := range flag.Filters.Multivariate.Variants {
+		share := float64(counts[variant.Key]) / samples * 100
+		if math.Abs(share-float64(*variant.RolloutPercentage)) > 1.5 {
+			t.Errorf("Expected %s to be served to %d%% of users, got %.2f%%", variant.Key, *variant.RolloutPercentage, share)
+		}
+	}
+}
+
+func TestGetFeatureFlagResultFromDecide(t *testing.T) {
+	for _, version := range []string{"v3", "v4"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isFlagsRequest(r) {
+				w.Write([]byte(fixture("test-decide-" + version + ".json")))
+			} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+				w.Write([]byte(`{"flags": []}`))
+			}
+		}))
+		defer server.Close()
+
+		client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+			PersonalApiKey:        "some very secret key",
+			Endpoint:              server.URL,
+			SendFeatureFlagEvents: new(bool),
+			Logger:                testLogger{t.Logf, t.Logf},
+		})
+		defer client.Close()
+
+		result, err := client.GetFeatureFlagResult(FeatureFlagPayload{Key: "enabled-flag", DistinctId: "some-distinct-id"})
+		if err != nil || result.Value != "true" || result.EvaluatedLocally {
+			t.Errorf("%s: expected the flag to be enabled remotely, got %+v %v", version, result, err)
+		}
+		if string(result.Payload) != `{"color": "blue"}` {
+			t.Errorf("%s: expected the payload to be decoded, got %s", version, result.Payload)
+		}
+		if version == "v4" && (result.Reason == nil || result.Reason.Code != "condition_match" || result.Id != 1 || result.Version != 4) {
+			t.Errorf("%s: expected the evaluation details, got %+v", version, result)
+		}
+
+		result, err = client.GetFeatureFlagResult(FeatureFlagPayload{Key: "multi-variate-flag", DistinctId: "some-distinct-id"})
+		if err != nil || result.Value != "hello" {
+			t.Errorf("%s: expected the variant, got %+v %v", version, result, err)
+		}
+		if version == "v3" && string(result.Payload) != `"a string payload"` {
+			t.Errorf("%s: expected a string payload, got %s", version, result.Payload)
+		}
+
+		result, err = client.GetFeatureFlagResult(FeatureFlagPayload{Key: "disabled-flag", DistinctId: "some-distinct-id"})
+		if err != nil || result.Value != false || result.Payload != nil {
+			t.Errorf("%s: expected the flag to be disabled without payload, got %+v %v", version, result, err)
+		}
+
+		value, err := client.GetFeatureFlag(FeatureFlagPayload{Key: "multi-variate-flag", DistinctId: "some-distinct-id"})
+		if err != nil || value != "hello" {
+			t.Errorf("%s: expected GetFeatureFlag to return the variant, got %v %v", version, value, err)
+		}
+
+		flags, err := client.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id"})
+		if err != nil || !reflect.DeepEqual(flags, map[string]interface{}{"enabled-flag": true, "multi-variate-flag": "hello", "disabled-flag": false}) {
+			t.Errorf("%s: expected all flags, got %v %v", version, flags, err)
+		}
+
+		// The v4 fixture reports that some flags failed to be evaluated, a
+		// missing flag may exist.
+		_, err = client.GetFeatureFlagResult(FeatureFlagPayload{Key: "unknown-flag", DistinctId: "some-distinct-id"})
+		if version == "v3" && err != ErrFlagNotFound {
+			t.Errorf("%s: expected ErrFlagNotFound, got %v", version, err)
+		}
+		if version == "v4" && !errors.Is(err, ErrRemoteEvaluationFailed) {
+			t.Errorf("%s: expected ErrRemoteEvaluationFailed, got %v", version, err)
+		}
+	}
+}
+
+func TestGetFeatureFlagResultLocally(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(fixture("feature_flag/test-simple-flag-person-prop.json")),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	result, err := client.GetFeatureFlagResult(FeatureFlagPayload{
+		Key:              "simple-flag",
+		DistinctId:       "some-distinct-id",
+		PersonProperties: NewProperties().Set("region", "USA"),
+	})
+	if err != nil || result.Value != true || !result.EvaluatedLocally || result.Reason != nil {
+		t.Error("Expected the flag to be evaluated locally, got", result, err)
+	}
+}
+
+func TestOnFlagEvaluated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			w.Write([]byte(`{"featureFlags": {"remote-flag": "variant"}}`))
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": [
+				{"key": "local-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}},
+				{"key": "remote-flag", "active": true, "ensure_experience_continuity": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}
+			]}`))
+		}
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var records []FlagEvaluationRecord
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:        "some very secret key",
+		Endpoint:              server.URL,
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+		OnFlagEvaluated: func(record FlagEvaluationRecord) {
+			mu.Lock()
+			defer mu.Unlock()
+			records = append(records, record)
+		},
+	})
+	defer client.Close()
+
+	client.IsFeatureEnabled(FeatureFlagPayload{Key: "local-flag", DistinctId: "some-distinct-id"})
+	client.GetFeatureFlag(FeatureFlagPayload{Key: "remote-flag", DistinctId: "some-distinct-id", Groups: Groups{"company": "acme"}})
+	client.GetFeatureFlag(FeatureFlagPayload{Key: "unknown-flag", DistinctId: "some-distinct-id", OnlyEvaluateLocally: true})
+
+	mu.Lock()
+	if len(records) != 3 {
+		t.Fatalf("Expected a record per evaluation, got %+v", records)
+	}
+	if r := records[0]; r.Key != "local-flag" || r.DistinctId != "some-distinct-id" || r.Value != true || !r.EvaluatedLocally || r.Err != nil || r.Latency < 0 {
+		t.Errorf("Expected the local evaluation to be recorded, got %+v", r)
+	}
+	if r := records[1]; r.Key != "remote-flag" || r.Value != "variant" || r.EvaluatedLocally || r.Groups["company"] != "acme" {
+		t.Errorf("Expected the remote evaluation to be recorded, got %+v", r)
+	}
+	if r := records[2]; r.Value != nil || r.Err != ErrFlagNotFound {
+		t.Errorf("Expected the missing flag to be recorded, got %+v", r)
+	}
+	records = nil
+	mu.Unlock()
+
+	flags, err := client.GetAllFlags(FeatureFlagPayloadNoKey{DistinctId: "some-distinct-id"})
+	if err != nil || len(flags) != 2 {
+		t.Fatal("Expected all flags, got", flags, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	evaluatedLocally := map[string]bool{}
+	for _, r := range records {
+		evaluatedLocally[r.Key] = r.EvaluatedLocally
+	}
+	if !reflect.DeepEqual(evaluatedLocally, map[string]bool{"local-flag": true, "remote-flag": false}) {
+		t.Errorf("Expected a record per flag of GetAllFlags, got %+v", records)
+	}
+}
+
+func TestGetFeatureFlagResultLocalPayload(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader: strings.NewReader(`{"flags": [
+			{"key": "boolean-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}], "payloads": {"true": "{\"color\": \"blue\"}"}}},
+			{"key": "multivariate-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100, "variant": "second"}], "multivariate": {"variants": [{"key": "first", "rollout_percentage": 100}, {"key": "second", "rollout_percentage": 0}]}, "payloads": {"first": [1], "second": {"size": 2}}}},
+			{"key": "disabled-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 0}], "payloads": {"true": {"size": 3}}}},
+			{"key": "remote-config", "active": true, "is_remote_configuration": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}], "payloads": {"true": "ZW5jcnlwdGVk"}}}
+		]}`),
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	expected := map[string]string{
+		"boolean-flag":      `{"color": "blue"}`,
+		"multivariate-flag": `{"size": 2}`,
+		"disabled-flag":     ``,
+		"remote-config":     ``,
+	}
+	for key, payload := range expected {
+		result, err := client.GetFeatureFlagResult(FeatureFlagPayload{Key: key, DistinctId: "some-distinct-id"})
+		if err != nil || !result.EvaluatedLocally || string(result.Payload) != payload {
+			t.Errorf("%s: expected the payload %q, got %+v %v", key, payload, result, err)
+		}
+	}
+}
+
+func TestGetFeatureFlagsMetadata(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader: strings.NewReader(`{"flags": [
+			{"id": 12, "name": "New checkout flow", "key": "new-checkout", "active": true, "deleted": false, "ensure_experience_continuity": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}], "payloads": {"true": {"steps": 3}}}},
+			{"id": 13, "name": "Old banner", "key": "old-banner", "active": false, "deleted": false, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}
+		]}`),
+		Logger: testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	flags, err := client.GetFeatureFlags()
+	if err != nil || len(flags) != 2 {
+		t.Fatal("Expected inactive flags to be kept, got", flags, err)
+	}
+	flag := flags[0]
+	if flag.Id != 12 || flag.Name != "New checkout flow" || flag.Deleted || !*flag.EnsureExperienceContinuity || string(flag.Filters.Payloads["true"]) != `{"steps": 3}` {
+		t.Errorf("Expected the metadata of the flag, got %+v", flag)
+	}
+	if flags[1].Key != "old-banner" || flags[1].Active {
+		t.Errorf("Expected the inactive flag, got %+v", flags[1])
+	}
+}
+
+// Reports whether the request evaluates flags remotely, with /flags or with
+// /decide.
+func isFlagsRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/flags") || strings.HasPrefix(r.URL.Path, "/decide")
+}
+
+func TestFlagsEndpointFallsBackToDecide(t *testing.T) {
+	var flags, decides int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flags"):
+			atomic.AddInt32(&flags, 1)
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/decide"):
+			atomic.AddInt32(&decides, 1)
+			w.Write([]byte(fixture("test-decide-v2.json")))
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:        "some very secret key",
+		Endpoint:              server.URL,
+		SendFeatureFlagEvents: new(bool),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		value, err := client.GetFeatureFlag(FeatureFlagPayload{Key: "beta-feature2", DistinctId: "some-distinct-id"})
+		if err != nil || value != "variant-2" {
+			t.Error("Expected the flag to be evaluated by /decide, got", value, err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&flags); n != 1 {
+		t.Errorf("Expected /flags to be called once, got %d", n)
+	}
+	if n := atomic.LoadInt32(&decides); n != 3 {
+		t.Errorf("Expected /decide to be called for every evaluation, got %d", n)
+	}
+}
+
+func TestFlagsEndpointModes(t *testing.T) {
+	var paths []string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+			return
+		}
+		mutex.Lock()
+		paths = append(paths, r.URL.String())
+		mutex.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/flags") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(fixture("test-decide-v4.json")))
+	}))
+	defer server.Close()
+
+	for mode, expected := range map[FlagsEndpoint][]string{
+		FlagsEndpointFlags:  {"/flags/?v=2"},
+		FlagsEndpointDecide: {"/decide/?v=4"},
+	} {
+		paths = nil
+		client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+			PersonalApiKey:        "some very secret key",
+			Endpoint:              server.URL,
+			FlagsEndpoint:         mode,
+			SendFeatureFlagEvents: new(bool),
+			Logger:                testLogger{t.Logf, t.Logf},
+		})
+
+		_, err := client.GetFeatureFlag(FeatureFlagPayload{Key: "enabled-flag", DistinctId: "some-distinct-id"})
+		if mode == FlagsEndpointFlags && !errors.Is(err, ErrRemoteEvaluationFailed) {
+			t.Errorf("%s: expected the 404 of /flags to be returned, got %v", mode, err)
+		}
+		if mode == FlagsEndpointDecide && err != nil {
+			t.Errorf("%s: expected the flag to be evaluated, got %v", mode, err)
+		}
+
+		mutex.Lock()
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("%s: expected %v to be called, got %v", mode, expected, paths)
+		}
+		mutex.Unlock()
+		client.Close()
+	}
+}
@@ -1,53 +1,187 @@
 package posthog
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha1"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"hash/fnv"
+	"math"
 	"net/http"
 	"net/url"
-	"regexp"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const LONG_SCALE = 0xfffffffffffffff
 
+const (
+	decideEndpoint          = "decide/?v=4"
+	localEvaluationEndpoint = "api/feature_flag/local_evaluation"
+)
+
 type FeatureFlagsPoller struct {
-	ticker                       *time.Ticker // periodic ticker
-	loaded                       chan bool
-	shutdown                     chan bool
-	forceReload                  chan bool
-	featureFlags                 []FeatureFlag
-	groups                       map[string]string
-	personalApiKey               string
-	projectApiKey                string
-	Errorf                       func(format string, args ...interface{})
-	Endpoint                     string
-	http                         http.Client
-	mutex                        sync.RWMutex
-	fetchedFlagsSuccessfullyOnce bool
+	ticker     *time.Ticker // periodic ticker, nil in manual pump mode
+	loaded     chan struct{}
+	loadedOnce sync.Once
+
+	// Closed once definitions were loaded successfully, unlike loaded which
+	// is closed after the first fetch whatever its outcome.
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// The context is canceled to stop the poller, including in-flight
+	// requests, and done is closed once the run loop has returned.
+	ctx          context.Context
+	cancel       context.CancelFunc
+	done         chan struct{}
+	shutdownOnce sync.Once
+
+	// Reload requests are buffered and coalesced, the channel is never closed
+	// so senders can't panic.
+	forceReload chan struct{}
+
+	// Receives the reloads waiting for the fetch to complete, see Reload.
+	reloads chan chan error
+
+	// The state of the run loop, see Client.Subsystems.
+	state *subsystem
+
+	// The state of the flag stream listener, nil when streaming is disabled.
+	streamState *subsystem
+
+	// When the next fetch is due, pollIfDue relies on it in manual pump mode.
+	pollingInterval time.Duration
+	nextPoll        time.Time
+
+	// Flags aren't evaluated once definitions were last fetched longer than
+	// this ago, unless it is zero.
+	maxStaleness time.Duration
+
+	// How long to wait after consecutive failed fetches, see
+	// Config.FeatureFlagsBackoff.
+	backoff  func(int) time.Duration
+	failures int
+
+	// Flag requests aren't sent until then after PostHog limited them, see
+	// QuotaLimitedError.
+	quotaLimitedUntil time.Time
+
+	// Where definitions are loaded from when flags are evaluated offline,
+	// nil when they are fetched from PostHog.
+	offline *offlineDefinitions
+
+	// Called when definitions change, see Config.OnFeatureFlagsChanged.
+	onChange func(old, new []FeatureFlag)
+
+	// Caches the results of local evaluations when enabled, see
+	// Config.LocalEvaluationCacheSize.
+	evaluations *lruCache
+
+	// Caches the *DecideResponse of remote evaluations when enabled, see
+	// Config.RemoteEvaluationCacheSize.
+	remoteEvaluations *lruCache
+
+	// The endpoint flags are evaluated remotely with, decideFallback is set
+	// once the instance answered that it doesn't support /flags.
+	flagsEndpoint  FlagsEndpoint
+	decideFallback int32
+
+	// The number of pages of definitions fetched at once, see
+	// Config.FeatureFlagsPageConcurrency.
+	pageConcurrency int
+
+	// The *flagSnapshot of the definitions in use, nil until they are
+	// loaded. It is replaced while holding the mutex.
+	snapshot atomic.Value
+
+	// The apiKeys used for requests, they are replaced while holding the
+	// mutex when rotated.
+	keys atomic.Value
+
+	log      func(level LogLevel, msg string, fields ...LogField)
+	fail     func(error)
+	Endpoint string
+	http     http.Client
+	mutex    sync.RWMutex
+
+	// The validators of the last flag definitions, sent with the next fetch
+	// so the server may answer 304 instead of sending them again.
+	etag         string
+	lastModified string
+
+	// The group types last fetched by Client.GetGroupTypes, they are cached
+	// for the polling interval.
+	groupTypes        []GroupType
+	groupTypesFetched time.Time
 }
 
 type FeatureFlag struct {
+	// The ID and the name of the flag in the project, the name is its
+	// description in the PostHog UI.
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+
 	Key                        string `json:"key"`
 	IsSimpleFlag               bool   `json:"is_simple_flag"`
 	RolloutPercentage          *uint8 `json:"rollout_percentage"`
 	Active                     bool   `json:"active"`
 	Filters                    Filter `json:"filters"`
 	EnsureExperienceContinuity *bool  `json:"ensure_experience_continuity"`
+
+	// Reports whether the flag was deleted, deleted flags are usually not
+	// part of the definitions.
+	Deleted bool `json:"deleted"`
+
+	// Remote config flags are always enabled and only carry a payload, which
+	// is fetched with Client.GetRemoteConfigPayload.
+	IsRemoteConfiguration bool `json:"is_remote_configuration"`
 }
 
 type Filter struct {
 	AggregationGroupTypeIndex *uint8          `json:"aggregation_group_type_index"`
 	Groups                    []PropertyGroup `json:"groups"`
 	Multivariate              *Variants       `json:"multivariate"`
+
+	// Conditions evaluated before Groups, like the enrollment of a person
+	// in an early access feature. They decide the result on their own when
+	// the properties they reference are known.
+	SuperGroups []PropertyGroup `json:"super_groups"`
+
+	// The payloads of the flag by variant key, or by "true" for flags without
+	// variants. They may be JSON documents encoded as strings.
+	Payloads map[string]json.RawMessage `json:"payloads"`
+}
+
+// Returns the payload of the flag when it evaluated locally to value, nil
+// when the flag is disabled or has no payload for the value. The payloads of
+// remote config flags are encrypted in the definitions, see
+// Client.GetRemoteConfigPayload.
+func (flag FeatureFlag) payload(value interface{}) json.RawMessage {
+	if flag.IsRemoteConfiguration {
+		return nil
+	}
+
+	var key string
+	switch v := value.(type) {
+	case string:
+		key = v
+	case bool:
+		if !v {
+			return nil
+		}
+		key = "true"
+	default:
+		return nil
+	}
+	return decodePayload(flag.Filters.Payloads[key])
 }
 
 type Variants struct {
@@ -79,8 +213,28 @@ type FlagVariantMeta struct {
 }
 
 type FeatureFlagsResponse struct {
-	Flags            []FeatureFlag      `json:"flags"`
-	GroupTypeMapping *map[string]string `json:"group_type_mapping"`
+	Flags            []FeatureFlag               `json:"flags"`
+	GroupTypeMapping *map[string]string          `json:"group_type_mapping"`
+	Cohorts          map[string]CohortProperties `json:"cohorts"`
+
+	// The total number of flags and the link to the next page when the
+	// definitions are paginated, Next is empty on the last page.
+	Count int    `json:"count"`
+	Next  string `json:"next"`
+}
+
+// The definition of a cohort returned by the local evaluation endpoint, it is
+// either a group combining its Values with AND or OR, in which case Type is
+// "AND" or "OR", or a property filter when Values is empty.
+// Groups can be nested to any depth.
+type CohortProperties struct {
+	Type   string             `json:"type"`
+	Values []CohortProperties `json:"values"`
+
+	Key      string      `json:"key"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+	Negation bool        `json:"negation"`
 }
 
 type DecideRequestData struct {
@@ -93,211 +247,693 @@ type DecideRequestData struct {
 
 type DecideResponse struct {
 	FeatureFlags map[string]interface{} `json:"featureFlags"`
+
+	// The payloads of the enabled flags, returned from v3 on. A payload is
+	// the JSON document configured for the flag or its variant, which the
+	// API encodes as a string.
+	FeatureFlagPayloads map[string]json.RawMessage `json:"featureFlagPayloads"`
+
+	// Reports whether some flags couldn't be evaluated, they are then missing
+	// from the response.
+	ErrorsWhileComputingFlags bool `json:"errorsWhileComputingFlags"`
+
+	// The resources of the project that are limited because its quota is
+	// exceeded, flags weren't evaluated when it contains "feature_flags".
+	QuotaLimited []string `json:"quotaLimited"`
+
+	// The flags with the details of their evaluation, returned from v4 on
+	// instead of FeatureFlags and FeatureFlagPayloads.
+	Flags map[string]FlagDetail `json:"flags"`
+}
+
+// The evaluation of a flag by the API, with why it evaluated to its value.
+type FlagDetail struct {
+	Key      string       `json:"key"`
+	Enabled  bool         `json:"enabled"`
+	Variant  *string      `json:"variant"`
+	Reason   *FlagReason  `json:"reason"`
+	Metadata FlagMetadata `json:"metadata"`
+}
+
+// Returns the value of the flag as returned by GetFeatureFlag, the variant of
+// multivariate flags and whether the flag is enabled otherwise.
+func (d FlagDetail) value() interface{} {
+	if d.Enabled && d.Variant != nil {
+		return *d.Variant
+	}
+	return d.Enabled
+}
+
+// Why a flag evaluated to its value, like "condition_match" or
+// "out_of_rollout_bound". ConditionIndex is the index of the condition group
+// that decided the value, when one did.
+type FlagReason struct {
+	Code           string `json:"code"`
+	Description    string `json:"description"`
+	ConditionIndex *int   `json:"condition_index"`
+}
+
+type FlagMetadata struct {
+	Id          int             `json:"id"`
+	Version     int             `json:"version"`
+	Description string          `json:"description"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Fills FeatureFlags and FeatureFlagPayloads from Flags for v4 responses, so
+// all versions are read the same way.
+func (r *DecideResponse) normalize() {
+	if r.Flags == nil || r.FeatureFlags != nil {
+		return
+	}
+
+	r.FeatureFlags = make(map[string]interface{}, len(r.Flags))
+	r.FeatureFlagPayloads = make(map[string]json.RawMessage)
+	for key, detail := range r.Flags {
+		r.FeatureFlags[key] = detail.value()
+		if detail.Enabled && len(detail.Metadata.Payload) != 0 {
+			r.FeatureFlagPayloads[key] = detail.Metadata.Payload
+		}
+	}
+}
+
+// Returns the JSON document of a payload, the API encodes them as strings. A
+// string that isn't a JSON document is returned as a JSON string, and nil is
+// returned when there is no payload.
+func decodePayload(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return raw
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	return raw
 }
 
+// Returned when a flag can't be evaluated locally with the given properties,
+// the flag is then evaluated by the /decide endpoint unless only local
+// evaluation was requested.
 type InconclusiveMatchError struct {
 	msg string
+	err error
 }
 
 func (e *InconclusiveMatchError) Error() string {
+	if e.err != nil {
+		return e.msg + ": " + e.err.Error()
+	}
 	return e.msg
 }
 
-func newFeatureFlagsPoller(projectApiKey string, personalApiKey string, errorf func(format string, args ...interface{}), endpoint string, httpClient http.Client, pollingInterval time.Duration) *FeatureFlagsPoller {
+// Returns the error that made the match inconclusive, if any.
+func (e *InconclusiveMatchError) Unwrap() error {
+	return e.err
+}
+
+// Reports whether the server may be able to evaluate a flag that failed to be
+// evaluated locally. Only inconclusive evaluations are evaluated remotely,
+// other errors, like an invalid regex, would fail there too.
+func isInconclusive(err error) bool {
+	var inconclusiveErr *InconclusiveMatchError
+	return errors.As(err, &inconclusiveErr)
+}
+
+func newFeatureFlagsPoller(projectApiKey string, personalApiKey string, log func(level LogLevel, msg string, fields ...LogField), fail func(error), endpoint string, httpClient http.Client, pollingInterval time.Duration, backoff func(int) time.Duration, maxStaleness time.Duration, evaluations *lruCache, remoteEvaluations *lruCache, offline *offlineDefinitions, onChange func(old, new []FeatureFlag), flagsEndpoint FlagsEndpoint, pageConcurrency int, manual bool, streaming bool) *FeatureFlagsPoller {
+	ctx, cancel := context.WithCancel(context.Background())
 	poller := FeatureFlagsPoller{
-		ticker:                       time.NewTicker(pollingInterval),
-		loaded:                       make(chan bool),
-		shutdown:                     make(chan bool),
-		forceReload:                  make(chan bool),
-		personalApiKey:               personalApiKey,
-		projectApiKey:                projectApiKey,
-		Errorf:                       errorf,
-		Endpoint:                     endpoint,
-		http:                         httpClient,
-		mutex:                        sync.RWMutex{},
-		fetchedFlagsSuccessfullyOnce: false,
+		pollingInterval:   pollingInterval,
+		backoff:           backoff,
+		maxStaleness:      maxStaleness,
+		loaded:            make(chan struct{}),
+		ready:             make(chan struct{}),
+		ctx:               ctx,
+		cancel:            cancel,
+		done:              make(chan struct{}),
+		forceReload:       make(chan struct{}, 1),
+		reloads:           make(chan chan error),
+		log:               log,
+		state:             newSubsystem("poller", nil),
+		evaluations:       evaluations,
+		remoteEvaluations: remoteEvaluations,
+		offline:           offline,
+		onChange:          onChange,
+		flagsEndpoint:     flagsEndpoint,
+		pageConcurrency:   pageConcurrency,
+		Endpoint:          endpoint,
+		http:              httpClient,
+		mutex:             sync.RWMutex{},
+	}
+
+	poller.keys.Store(apiKeys{project: projectApiKey, personal: personalApiKey})
+	poller.fail = func(err error) {
+		poller.state.recordError(err)
+		fail(err)
+	}
+
+	poller.state.setRunning(true)
+
+	if offline != nil {
+		// Definitions are available as soon as the client is created and
+		// the file is only checked for changes when it is watched.
+		poller.fetchNewFeatureFlags(ctx)
+		if !offline.watch {
+			close(poller.done)
+			return &poller
+		}
+		streaming = false
 	}
 
+	if manual {
+		// Definitions are fetched by PollOnce, there is no run loop to wait
+		// for and flags are reported as not loaded until the first fetch.
+		close(poller.done)
+		poller.loadedOnce.Do(func() { close(poller.loaded) })
+		return &poller
+	}
+
+	if streaming {
+		poller.streamState = newSubsystem("stream", nil)
+	}
+
+	poller.ticker = time.NewTicker(pollingInterval)
 	go poller.run()
 	return &poller
 }
 
 func (poller *FeatureFlagsPoller) run() {
-	poller.fetchNewFeatureFlags()
+	defer close(poller.done)
+	defer poller.state.setRunning(false)
+	defer poller.ticker.Stop()
+	// Release callers waiting for flags if the poller is shut down before the
+	// first fetch.
+	defer poller.loadedOnce.Do(func() { close(poller.loaded) })
+
+	if poller.streamState != nil {
+		streamDone := make(chan struct{})
+		defer func() { <-streamDone }()
+		go func() {
+			defer close(streamDone)
+			poller.stream()
+		}()
+	}
+
+	poller.fetch()
 
 	for {
 		select {
-		case <-poller.shutdown:
-			close(poller.shutdown)
-			close(poller.forceReload)
-			close(poller.loaded)
-			poller.ticker.Stop()
+		case <-poller.ctx.Done():
 			return
 		case <-poller.forceReload:
-			poller.fetchNewFeatureFlags()
+			poller.fetch()
+		case reply := <-poller.reloads:
+			reply <- poller.fetch()
 		case <-poller.ticker.C:
-			poller.fetchNewFeatureFlags()
+			poller.fetch()
+		}
+	}
+}
+
+// Fetches flag definitions and schedules the next tick, a panic is reported
+// and the poller resumes with the next tick.
+func (poller *FeatureFlagsPoller) fetch() error {
+	var err error
+	poller.state.protect(func() { err = poller.fetchNewFeatureFlags(poller.ctx) }, func(panicErr error) {
+		poller.log(LogLevelError, "panic", LogField{"error", panicErr})
+		poller.fail(panicErr)
+		err = panicErr
+	})
+	delay := poller.nextPollDelay(err)
+	poller.mutex.Lock()
+	poller.nextPoll = time.Now().Add(delay)
+	poller.mutex.Unlock()
+	poller.ticker.Reset(delay)
+	return err
+}
+
+// Fetches flag definitions and waits for the fetch to complete, it returns the
+// error of the fetch or the context error when the context is done first. The
+// fetch is made by the run loop when there is one, so it never overlaps with
+// a scheduled fetch.
+func (poller *FeatureFlagsPoller) Reload(ctx context.Context) error {
+	poller.purgeRemoteEvaluations()
+	if poller.ticker == nil {
+		return poller.PollOnce(ctx)
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case poller.reloads <- reply:
+	case <-poller.ctx.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Records the outcome of a fetch and returns how long to wait before the next
+// one, consecutive failures back off.
+func (poller *FeatureFlagsPoller) nextPollDelay(err error) time.Duration {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if err == nil || errors.Is(err, context.Canceled) {
+		poller.failures = 0
+		return poller.pollingInterval
+	}
+	var quotaErr *QuotaLimitedError
+	if errors.As(err, &quotaErr) {
+		// Polling resumes when the limit is lifted.
+		if delay := time.Until(quotaErr.Until); delay > 0 {
+			return delay
+		}
+		return poller.pollingInterval
+	}
+	delay := poller.backoff(poller.failures)
+	poller.failures++
+	if delay > 0 {
+		poller.log(LogLevelWarn, "backing off fetching feature flags", LogField{"failures", poller.failures}, LogField{"delay", delay})
+	} else {
+		delay = poller.pollingInterval
+	}
+	return delay
+}
+
+// PollOnce fetches flag definitions on the calling goroutine and returns the
+// error of the fetch, if any. It returns ErrClosed once the poller is shut
+// down.
+func (poller *FeatureFlagsPoller) PollOnce(ctx context.Context) (err error) {
+	if poller.ctx.Err() != nil {
+		return ErrClosed
+	}
+
+	poller.mutex.Lock()
+	poller.nextPoll = time.Now().Add(poller.pollingInterval)
+	poller.mutex.Unlock()
+
+	poller.state.protect(func() { err = poller.fetchNewFeatureFlags(ctx) }, func(panicErr error) {
+		poller.log(LogLevelError, "panic", LogField{"error", panicErr})
+		poller.fail(panicErr)
+		err = panicErr
+	})
+
+	delay := poller.nextPollDelay(err)
+	poller.mutex.Lock()
+	poller.nextPoll = time.Now().Add(delay)
+	poller.mutex.Unlock()
+	return
+}
+
+// Polls when the polling interval elapsed since the last poll or a reload was
+// requested, this is how Pump drives the poller in manual pump mode.
+func (poller *FeatureFlagsPoller) pollIfDue(ctx context.Context) error {
+	select {
+	case <-poller.forceReload:
+	default:
+		poller.mutex.RLock()
+		due := !time.Now().Before(poller.nextPoll)
+		poller.mutex.RUnlock()
+		if !due {
+			return nil
 		}
 	}
+	return poller.PollOnce(ctx)
 }
 
-func (poller *FeatureFlagsPoller) fetchNewFeatureFlags() {
-	personalApiKey := poller.personalApiKey
+func (poller *FeatureFlagsPoller) fetchNewFeatureFlags(ctx context.Context) error {
+	// Callers waiting for the first fetch are released whatever its outcome,
+	// they get ErrFlagsNotLoaded if it failed.
+	defer poller.loadedOnce.Do(func() { close(poller.loaded) })
+
+	err := poller.fetchDefinitions(ctx)
+	if err == nil {
+		poller.mutex.Lock()
+		if snapshot := poller.definitions(); snapshot != nil {
+			// The definitions are still current.
+			fresh := *snapshot
+			fresh.fetchedAt = time.Now()
+			poller.snapshot.Store(&fresh)
+		}
+		poller.mutex.Unlock()
+	}
+	return err
+}
+
+func (poller *FeatureFlagsPoller) fetchDefinitions(ctx context.Context) error {
+	if poller.offline != nil {
+		return poller.loadOfflineDefinitions()
+	}
+
+	if err := poller.quotaLimited(); err != nil {
+		return err
+	}
+
+	personalApiKey := poller.apiKeys().personal
 	headers := [][2]string{{"Authorization", "Bearer " + personalApiKey + ""}}
-	res, err := poller.localEvaluationFlags(headers)
-	if err != nil || res.StatusCode != http.StatusOK {
-		poller.loaded <- false
-		poller.Errorf("Unable to fetch feature flags", err)
-		return
+	poller.mutex.RLock()
+	etag, lastModified := poller.etag, poller.lastModified
+	poller.mutex.RUnlock()
+	if etag != "" {
+		headers = append(headers, [2]string{"If-None-Match", etag})
 	}
-	defer res.Body.Close()
-	resBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		poller.loaded <- false
-		poller.Errorf("Unable to fetch feature flags", err)
-		return
+	if lastModified != "" {
+		headers = append(headers, [2]string{"If-Modified-Since", lastModified})
 	}
 	featureFlagsResponse := FeatureFlagsResponse{}
-	err = json.Unmarshal([]byte(resBody), &featureFlagsResponse)
+	status, header, err := poller.localEvaluationFlags(ctx, headers, &featureFlagsResponse)
+	if ctx.Err() != nil {
+		// The request was canceled, usually because the poller is shutting
+		// down.
+		return ctx.Err()
+	}
+	if status == http.StatusTooManyRequests {
+		var apiErr *APIError
+		errors.As(err, &apiErr)
+		err = poller.limitQuota(apiErr)
+		poller.fail(err)
+		return err
+	}
+	if err != nil && (status < 200 || status >= 300) {
+		poller.logRequestError("Unable to fetch feature flags", localEvaluationEndpoint, status, err)
+		err = fmt.Errorf("unable to fetch feature flags: %w", err)
+		poller.fail(err)
+		return err
+	}
 	if err != nil {
-		poller.loaded <- false
-		poller.Errorf("Unable to unmarshal response from api/feature_flag/local_evaluation", err)
-		return
+		poller.logRequestError("Unable to unmarshal feature flags response", localEvaluationEndpoint, 0, err)
+		err = fmt.Errorf("unable to unmarshal feature flags response: %w", err)
+		poller.fail(err)
+		return err
+	}
+	if status == http.StatusNotModified {
+		// The definitions we have are still current.
+		return nil
 	}
-	if !poller.fetchedFlagsSuccessfullyOnce {
-		poller.loaded <- true
+	if featureFlagsResponse.Next != "" {
+		// Only the first page is conditional, the validators apply to the
+		// whole definitions.
+		err := poller.fetchRemainingPages(ctx, [][2]string{{"Authorization", "Bearer " + personalApiKey}}, &featureFlagsResponse)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			poller.logRequestError("Unable to fetch feature flags", localEvaluationEndpoint, 0, err)
+			err = fmt.Errorf("unable to fetch feature flags: %w", err)
+			poller.fail(err)
+			return err
+		}
+	}
+	poller.setDefinitions(featureFlagsResponse, header)
+	return nil
+}
+
+// Replaces the flag definitions, header carries the validators of the
+// response they come from and is nil when they weren't fetched from PostHog.
+func (poller *FeatureFlagsPoller) setDefinitions(featureFlagsResponse FeatureFlagsResponse, header http.Header) {
+	snapshot := &flagSnapshot{
+		flags:     []FeatureFlag{},
+		cohorts:   featureFlagsResponse.Cohorts,
+		index:     make(map[string]int, len(featureFlagsResponse.Flags)),
+		fetchedAt: time.Now(),
 	}
-	newFlags := []FeatureFlag{}
 	for _, flag := range featureFlagsResponse.Flags {
-		newFlags = append(newFlags, flag)
+		// The first definition of a key wins.
+		if _, ok := snapshot.index[flag.Key]; !ok {
+			snapshot.index[flag.Key] = len(snapshot.flags)
+		}
+		snapshot.flags = append(snapshot.flags, flag)
 	}
+
 	poller.mutex.Lock()
-	poller.featureFlags = newFlags
+	var oldFlags []FeatureFlag
+	if old := poller.definitions(); old != nil {
+		oldFlags = old.flags
+		snapshot.groups = old.groups
+	}
 	if featureFlagsResponse.GroupTypeMapping != nil {
-		poller.groups = *featureFlagsResponse.GroupTypeMapping
+		snapshot.groups = *featureFlagsResponse.GroupTypeMapping
 	}
-	poller.fetchedFlagsSuccessfullyOnce = true
+	poller.snapshot.Store(snapshot)
+	poller.etag = header.Get("ETag")
+	poller.lastModified = header.Get("Last-Modified")
 	poller.mutex.Unlock()
-}
+	newFlags := snapshot.flags
+	poller.readyOnce.Do(func() { close(poller.ready) })
 
-func (poller *FeatureFlagsPoller) GetFeatureFlag(flagConfig FeatureFlagPayload) (interface{}, error) {
-	featureFlags := poller.GetFeatureFlags()
+	if poller.evaluations != nil {
+		poller.evaluations.purge()
+	}
 
-	featureFlag := FeatureFlag{Key: ""}
+	if poller.onChange != nil && !reflect.DeepEqual(oldFlags, newFlags) {
+		poller.onChange(oldFlags, newFlags)
+	}
+}
 
+func (poller *FeatureFlagsPoller) GetFeatureFlag(ctx context.Context, flagConfig FeatureFlagPayload) (interface{}, error) {
+	result, err := poller.GetFeatureFlagResult(ctx, flagConfig)
+	return result.Value, err
+}
+
+// Same as GetFeatureFlag but also returns how the flag was evaluated.
+func (poller *FeatureFlagsPoller) GetFeatureFlagResult(ctx context.Context, flagConfig FeatureFlagPayload) (FeatureFlagResult, error) {
+	result := FeatureFlagResult{Key: flagConfig.Key}
+	if poller.offline != nil {
+		flagConfig.OnlyEvaluateLocally = true
+	}
 	// avoid using flag for conflicts with Golang's stdlib `flag`
-	for _, storedFlag := range featureFlags {
-		if flagConfig.Key == storedFlag.Key {
-			featureFlag = storedFlag
-			break
-		}
+	featureFlag, _, err := poller.getFeatureFlag(ctx, flagConfig.Key)
+	if err != nil {
+		return result, err
+	}
+	if err := poller.staleness(); err != nil {
+		return result, err
 	}
-
-	var result interface{}
-	var err error
 
 	if featureFlag.Key != "" {
-		result, err = poller.computeFlagLocally(featureFlag, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
+		result.Value, err = poller.computeFlagLocallyCached(featureFlag, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
+		result.EvaluatedLocally = err == nil && result.Value != nil
+		if result.EvaluatedLocally {
+			result.Payload = featureFlag.payload(result.Value)
+		}
+	} else if flagConfig.OnlyEvaluateLocally {
+		if !poller.flagsLoaded() {
+			return result, ErrFlagsNotLoaded
+		}
+		return result, ErrFlagNotFound
 	}
 
 	if err != nil {
-		poller.Errorf("Unable to compute flag locally - %s", err)
+		poller.log(LogLevelWarn, "Unable to compute flag locally", LogField{"flag", flagConfig.Key}, LogField{"error", err})
+		if !isInconclusive(err) {
+			return FeatureFlagResult{Key: flagConfig.Key}, err
+		}
 	}
 
-	if (err != nil || result == nil) && !flagConfig.OnlyEvaluateLocally {
+	if (err != nil || result.Value == nil) && !flagConfig.OnlyEvaluateLocally {
+		localErr := err
 
-		result, err = poller.getFeatureFlagVariant(featureFlag, flagConfig.Key, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
+		result, err = poller.getFeatureFlagVariant(ctx, featureFlag, flagConfig.Key, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
+		if remoteErr, ok := err.(*remoteEvaluationError); ok {
+			// Keep the reason why the flag had to be evaluated remotely.
+			remoteErr.local = localErr
+		}
 		if err != nil {
-			return nil, nil
+			return FeatureFlagResult{Key: flagConfig.Key}, err
 		}
 	}
 
 	return result, err
 }
 
-func (poller *FeatureFlagsPoller) GetAllFlags(flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+// Same as computeFlagLocally but reuses the result of previous evaluations
+// with the same inputs when the cache is enabled. Inconclusive evaluations
+// aren't cached.
+func (poller *FeatureFlagsPoller) computeFlagLocallyCached(flag FeatureFlag, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (interface{}, error) {
+	if poller.evaluations == nil {
+		return poller.computeFlagLocally(flag, distinctId, groups, personProperties, groupProperties, nil)
+	}
+
+	key, ok := evaluationCacheKey(flag.Key, distinctId, groups, personProperties, groupProperties)
+	if ok {
+		if result, hit := poller.evaluations.get(key); hit {
+			return result, nil
+		}
+	}
+
+	result, err := poller.computeFlagLocally(flag, distinctId, groups, personProperties, groupProperties, nil)
+	if err == nil && ok {
+		poller.evaluations.add(key, result)
+	}
+	return result, err
+}
+
+// Returns the cache key of a local evaluation, the properties are hashed from
+// their JSON representation which has sorted keys. ok is false when the
+// properties can't be serialized.
+func evaluationCacheKey(flagKey string, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (key string, ok bool) {
+	b, err := json.Marshal([]interface{}{groups, personProperties, groupProperties})
+	if err != nil {
+		return "", false
+	}
+
+	h := fnv.New64a()
+	h.Write(b)
+	return fmt.Sprintf("%s\x00%s\x00%x", distinctId, flagKey, h.Sum64()), true
+}
+
+func (poller *FeatureFlagsPoller) GetAllFlags(ctx context.Context, flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	response, _, err := poller.getAllFlags(ctx, flagConfig)
+	return response, err
+}
+
+// Same as GetAllFlags but also returns the keys of the flags that were
+// evaluated locally.
+func (poller *FeatureFlagsPoller) getAllFlags(ctx context.Context, flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, map[string]bool, error) {
+	if poller.offline != nil {
+		flagConfig.OnlyEvaluateLocally = true
+	}
 	response := map[string]interface{}{}
-	featureFlags := poller.GetFeatureFlags()
+	evaluatedLocally := map[string]bool{}
+	featureFlags, err := poller.getFeatureFlags(ctx)
+	if err != nil {
+		return response, evaluatedLocally, err
+	}
+	if err := poller.staleness(); err != nil {
+		return response, evaluatedLocally, err
+	}
 	fallbackToDecide := false
 
 	if len(featureFlags) == 0 {
 		fallbackToDecide = true
 	} else {
 		for _, storedFlag := range featureFlags {
-			result, err := poller.computeFlagLocally(storedFlag, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
+			result, err := poller.computeFlagLocallyCached(storedFlag, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
 			if err != nil {
-				poller.Errorf("Unable to compute flag locally - %s", err)
-				fallbackToDecide = true
+				// Flags failing for other reasons are left out, like
+				// GetFeatureFlag returns their error.
+				poller.log(LogLevelWarn, "Unable to compute flag locally", LogField{"flag", storedFlag.Key}, LogField{"error", err})
+				fallbackToDecide = fallbackToDecide || isInconclusive(err)
 			} else {
 				response[storedFlag.Key] = result
+				evaluatedLocally[storedFlag.Key] = true
 			}
 		}
 	}
 
+	if flagConfig.OnlyEvaluateLocally && !poller.flagsLoaded() {
+		return response, evaluatedLocally, ErrFlagsNotLoaded
+	}
+
 	if fallbackToDecide && !flagConfig.OnlyEvaluateLocally {
-		result, err := poller.getFeatureFlagVariants(flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
+		result, err := poller.getFeatureFlagVariants(ctx, flagConfig.DistinctId, flagConfig.Groups, flagConfig.PersonProperties, flagConfig.GroupProperties)
 
 		if err != nil {
-			return response, err
+			return response, evaluatedLocally, err
 		} else {
 			for k, v := range result {
 				response[k] = v
+				delete(evaluatedLocally, k)
 			}
 		}
 	}
 
-	return response, nil
+	return response, evaluatedLocally, nil
 }
 
-func (poller *FeatureFlagsPoller) computeFlagLocally(flag FeatureFlag, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (interface{}, error) {
+// Evaluates the flag from its definition, the steps of the evaluation are
+// recorded in trace unless it is nil.
+func (poller *FeatureFlagsPoller) computeFlagLocally(flag FeatureFlag, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties, trace *FlagExplanation) (interface{}, error) {
+	return poller.definitions().computeFlag(flag, distinctId, groups, personProperties, groupProperties, trace)
+}
+
+// Same as computeFlagLocally with the cohorts and group types of the
+// snapshot, which is nil until definitions are loaded.
+func (snapshot *flagSnapshot) computeFlag(flag FeatureFlag, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties, trace *FlagExplanation) (interface{}, error) {
 	if flag.EnsureExperienceContinuity != nil && *flag.EnsureExperienceContinuity {
-		return nil, &InconclusiveMatchError{"Flag has experience continuity enabled"}
+		trace.explain("the flag has experience continuity enabled, it is only evaluated remotely")
+		return nil, &InconclusiveMatchError{msg: "Flag has experience continuity enabled"}
 	}
 
 	if !flag.Active {
+		trace.explain("the flag is inactive")
 		return false, nil
 	}
 
+	var cohorts map[string]CohortProperties
+	var groupTypes map[string]string
+	if snapshot != nil {
+		cohorts, groupTypes = snapshot.cohorts, snapshot.groups
+	}
+
 	if flag.Filters.AggregationGroupTypeIndex != nil {
 
-		groupName, exists := poller.groups[fmt.Sprintf("%d", *flag.Filters.AggregationGroupTypeIndex)]
+		groupName, exists := groupTypes[fmt.Sprintf("%d", *flag.Filters.AggregationGroupTypeIndex)]
 
 		if !exists {
-			errMessage := "Flag has unknown group type index"
-			return nil, errors.New(errMessage)
+			// The mapping may be stale, the server knows the group type.
+			trace.explain("the group type of the flag is unknown")
+			return nil, &InconclusiveMatchError{msg: "Flag has unknown group type index"}
 		}
 
-		_, exists = groups[groupName]
+		groupKey, exists := groups[groupName]
 
 		if !exists {
+			trace.explain(fmt.Sprintf("no %s group was given", groupName))
 			errMessage := fmt.Sprintf("FEATURE FLAGS] Can't compute group feature flag: %s without group names passed in", flag.Key)
-			return nil, errors.New(errMessage)
+			return nil, &InconclusiveMatchError{msg: errMessage}
 		}
 
+		// Group flags are rolled out by group, so the group key is hashed
+		// instead of the distinct ID.
 		focusedGroupProperties := groupProperties[groupName]
-		return matchFeatureFlagProperties(flag, groups[groupName].(string), focusedGroupProperties)
+		if trace != nil {
+			trace.GroupType = groupName
+		}
+		return matchFeatureFlagProperties(flag, propertyString(groupKey), focusedGroupProperties, cohorts, trace)
 	} else {
-		return matchFeatureFlagProperties(flag, distinctId, personProperties)
+		return matchFeatureFlagProperties(flag, distinctId, personProperties, cohorts, trace)
 	}
 }
 
-func getMatchingVariant(flag FeatureFlag, distinctId string) (interface{}, error) {
+func getMatchingVariant(flag FeatureFlag, distinctId string, trace *FlagExplanation) (interface{}, error) {
 	lookupTable := getVariantLookupTable(flag)
 
 	hashValue, err := _hash(flag.Key, distinctId, "variant")
 	if err != nil {
 		return nil, err
 	}
-
-	for _, variant := range lookupTable {
-		if hashValue >= float64(variant.ValueMin) && hashValue < float64(variant.ValueMax) {
-			return variant.Key, nil
-		}
+	if trace != nil && len(lookupTable) > 0 {
+		trace.VariantHash = &hashValue
 	}
 
+	if variant, ok := findVariant(lookupTable, hashValue); ok {
+		return variant.Key, nil
+	}
 	return true, nil
 }
 
+// Returns the variant whose range contains the hash value, the ranges of the
+// lookup table are contiguous and sorted so it is found by binary search.
+func findVariant(lookupTable []FlagVariantMeta, hashValue float64) (FlagVariantMeta, bool) {
+	i := sort.Search(len(lookupTable), func(i int) bool {
+		return hashValue < lookupTable[i].ValueMax
+	})
+	if i == len(lookupTable) || hashValue < lookupTable[i].ValueMin {
+		return FlagVariantMeta{}, false
+	}
+	return lookupTable[i], true
+}
+
 func getVariantLookupTable(flag FeatureFlag) []FlagVariantMeta {
 	lookupTable := []FlagVariantMeta{}
 	valueMin := 0.00
@@ -318,35 +954,58 @@ func getVariantLookupTable(flag FeatureFlag) []FlagVariantMeta {
 	return lookupTable
 }
 
-func matchFeatureFlagProperties(flag FeatureFlag, distinctId string, properties Properties) (interface{}, error) {
+func matchFeatureFlagProperties(flag FeatureFlag, distinctId string, properties Properties, cohorts map[string]CohortProperties, trace *FlagExplanation) (interface{}, error) {
 	conditions := flag.Filters.Groups
-	isInconclusive := false
+	var inconclusiveErr error
+
+	if trace != nil {
+		trace.HashedId = distinctId
+	}
+
+	// Only the first super condition is evaluated, as in the reference SDK.
+	if len(flag.Filters.SuperGroups) > 0 {
+		if isMatch, ok, err := matchSuperCondition(flag, distinctId, flag.Filters.SuperGroups[0], properties, cohorts, trace); err != nil {
+			return nil, err
+		} else if ok {
+			if isMatch {
+				return getMatchingVariant(flag, distinctId, trace)
+			}
+			return false, nil
+		}
+	}
 
 	// # Stable sort conditions with variant overrides to the top. This ensures that if overrides are present, they are
 	// # evaluated first, and the variant override is applied to the first matching condition.
 	// conditionsCopy := make([]PropertyGroup, len(conditions))
-	sortedConditions := append([]PropertyGroup{}, conditions...)
+	//
+	// The indexes of the conditions are sorted so traces refer to the
+	// conditions as they are defined.
+	sortedConditions := make([]int, len(conditions))
+	for i := range sortedConditions {
+		sortedConditions[i] = i
+	}
 
 	sort.SliceStable(sortedConditions, func(i, j int) bool {
 		iValue := 1
 		jValue := 1
-		if sortedConditions[i].Variant != nil {
+		if conditions[sortedConditions[i]].Variant != nil {
 			iValue = -1
 		}
 
-		if sortedConditions[j].Variant != nil {
+		if conditions[sortedConditions[j]].Variant != nil {
 			jValue = -1
 		}
 
 		return iValue < jValue
 	})
 
-	for _, condition := range sortedConditions {
+	for _, index := range sortedConditions {
+		condition := conditions[index]
 
-		isMatch, err := isConditionMatch(flag, distinctId, condition, properties)
+		isMatch, err := isConditionMatch(flag, distinctId, condition, properties, cohorts, trace.condition(index, false, condition))
 		if err != nil {
 			if _, ok := err.(*InconclusiveMatchError); ok {
-				isInconclusive = true
+				inconclusiveErr = err
 			} else {
 				return nil, err
 			}
@@ -359,23 +1018,44 @@ func matchFeatureFlagProperties(flag FeatureFlag, distinctId string, properties
 			if variantOverride != nil && multivariates != nil && multivariates.Variants != nil && containsVariant(multivariates.Variants, *variantOverride) {
 				return *variantOverride, nil
 			} else {
-				return getMatchingVariant(flag, distinctId)
+				return getMatchingVariant(flag, distinctId, trace)
 			}
 		}
 	}
 
-	if isInconclusive {
-		return false, &InconclusiveMatchError{"Can't determine if feature flag is enabled or not with given properties"}
+	if inconclusiveErr != nil {
+		return false, &InconclusiveMatchError{msg: "Can't determine if feature flag is enabled or not with given properties", err: errors.Unwrap(inconclusiveErr)}
 	}
 
 	return false, nil
 }
 
-func isConditionMatch(flag FeatureFlag, distinctId string, condition PropertyGroup, properties Properties) (bool, error) {
+// Evaluates a super condition, ok is false when the properties it references
+// weren't given, in which case the regular conditions apply.
+func matchSuperCondition(flag FeatureFlag, distinctId string, condition PropertyGroup, properties Properties, cohorts map[string]CohortProperties, trace *FlagExplanation) (isMatch bool, ok bool, err error) {
+	for _, prop := range condition.Properties {
+		if _, set := properties[prop.Key]; !set {
+			return false, false, nil
+		}
+	}
+
+	isMatch, err = isConditionMatch(flag, distinctId, condition, properties, cohorts, trace.condition(0, true, condition))
+	return isMatch, err == nil, err
+}
+
+func isConditionMatch(flag FeatureFlag, distinctId string, condition PropertyGroup, properties Properties, cohorts map[string]CohortProperties, trace *ConditionExplanation) (isMatch bool, err error) {
+	if trace != nil {
+		defer func() { trace.result(isMatch, err) }()
+	}
+
 	if len(condition.Properties) > 0 {
 		for _, prop := range condition.Properties {
-
-			isMatch, err := matchProperty(prop, properties)
+			if prop.Type == "cohort" {
+				isMatch, err = matchCohort(prop, properties, cohorts, 0)
+			} else {
+				isMatch, err = matchProperty(prop, properties)
+			}
+			trace.property(prop, properties, isMatch, err)
 			if err != nil {
 				return false, err
 			}
@@ -391,22 +1071,39 @@ func isConditionMatch(flag FeatureFlag, distinctId string, condition PropertyGro
 	}
 
 	if condition.RolloutPercentage != nil {
+		trace.rollout(flag.Key, distinctId)
 		return checkIfSimpleFlagEnabled(flag.Key, distinctId, *condition.RolloutPercentage)
 	}
 
 	return true, nil
 }
 
-func matchProperty(property Property, properties Properties) (bool, error) {
+func matchProperty(property Property, properties Properties) (isMatch bool, err error) {
+	defer func() {
+		// Property values are provided by callers and flag definitions by the
+		// server, a value of an unexpected type must never crash the
+		// application.
+		if r := recover(); r != nil {
+			isMatch, err = false, fmt.Errorf("unable to match property %q: %v", property.Key, r)
+		}
+	}()
+
 	key := property.Key
 	operator := property.Operator
 	value := property.Value
-	if _, ok := properties[key]; !ok {
-		return false, &InconclusiveMatchError{"Can't match properties without a given property value"}
+	_, isSet := properties[key]
+
+	// The supplied properties are taken as the full set of properties of the
+	// person or group.
+	switch operator {
+	case "is_not_set":
+		return !isSet, nil
+	case "is_set":
+		return isSet, nil
 	}
 
-	if operator == "is_not_set" {
-		return false, &InconclusiveMatchError{"Can't match properties with operator is_not_set"}
+	if !isSet {
+		return false, &InconclusiveMatchError{msg: "Can't match properties without a given property value", err: &MissingPropertyError{Property: key}}
 	}
 
 	override_value, _ := properties[key]
@@ -416,7 +1113,7 @@ func matchProperty(property Property, properties Properties) (bool, error) {
 		case []interface{}:
 			return contains(t, override_value), nil
 		default:
-			return value == override_value, nil
+			return propertyEquals(value, override_value), nil
 		}
 	}
 
@@ -425,126 +1122,74 @@ func matchProperty(property Property, properties Properties) (bool, error) {
 		case []interface{}:
 			return !contains(t, override_value), nil
 		default:
-			return value != override_value, nil
+			return !propertyEquals(value, override_value), nil
 		}
 	}
 
-	if operator == "is_set" {
-		return true, nil
-	}
-
 	if operator == "icontains" {
-		return strings.Contains(strings.ToLower(fmt.Sprintf("%v", override_value)), strings.ToLower(fmt.Sprintf("%v", value))), nil
+		return strings.Contains(strings.ToLower(propertyString(override_value)), strings.ToLower(propertyString(value))), nil
 	}
 
 	if operator == "not_icontains" {
-		return !strings.Contains(strings.ToLower(fmt.Sprintf("%v", override_value)), strings.ToLower(fmt.Sprintf("%v", value))), nil
+		return !strings.Contains(strings.ToLower(propertyString(override_value)), strings.ToLower(propertyString(value))), nil
 	}
 
-	if operator == "regex" {
-
-		r, err := regexp.Compile(fmt.Sprintf("%v", value))
-		// invalid regex
+	if operator == "regex" || operator == "not_regex" {
+		pattern := propertyString(value)
+		r, err := compileRegex(pattern)
 		if err != nil {
-			return false, nil
+			return false, &InvalidRegexError{Property: key, Pattern: pattern, Err: err}
 		}
 
-		match := r.MatchString(fmt.Sprintf("%v", override_value))
+		match := r.MatchString(propertyString(override_value))
 
-		if match {
-			return true, nil
-		} else {
-			return false, nil
+		if operator == "regex" {
+			return match, nil
 		}
+		return !match, nil
 	}
 
-	if operator == "not_regex" {
-		var r *regexp.Regexp
-		var err error
-
-		if valueString, ok := value.(string); ok {
-			r, err = regexp.Compile(valueString)
-		} else if valueInt, ok := value.(int); ok {
-			valueString = strconv.Itoa(valueInt)
-			r, err = regexp.Compile(valueString)
-		} else {
-			errMessage := "Regex expression not allowed"
-			return false, errors.New(errMessage)
-		}
-
-		// invalid regex
-		if err != nil {
-			return false, nil
-		}
-
-		var match bool
-		if valueString, ok := override_value.(string); ok {
-			match = r.MatchString(valueString)
-		} else if valueInt, ok := override_value.(int); ok {
-			valueString = strconv.Itoa(valueInt)
-			match = r.MatchString(valueString)
-		} else {
-			errMessage := "Value type not supported"
-			return false, errors.New(errMessage)
-		}
-
-		if !match {
-			return true, nil
-		} else {
-			return false, nil
-		}
-	}
-
-	if operator == "gt" {
-		valueOrderable, overrideValueOrderable, err := validateOrderable(value, override_value)
+	if operator == "gt" || operator == "lt" || operator == "gte" || operator == "lte" {
+		c, err := compareOrderable(key, value, override_value)
 		if err != nil {
 			return false, err
 		}
 
-		return overrideValueOrderable > valueOrderable, nil
-	}
-
-	if operator == "lt" {
-		valueOrderable, overrideValueOrderable, err := validateOrderable(value, override_value)
-		if err != nil {
-			return false, err
+		switch operator {
+		case "gt":
+			return c > 0, nil
+		case "lt":
+			return c < 0, nil
+		case "gte":
+			return c >= 0, nil
+		default:
+			return c <= 0, nil
 		}
-
-		return overrideValueOrderable < valueOrderable, nil
 	}
 
-	if operator == "gte" {
-		valueOrderable, overrideValueOrderable, err := validateOrderable(value, override_value)
-		if err != nil {
-			return false, err
+	if strings.HasPrefix(operator, "semver_") {
+		switch operator {
+		case "semver_eq", "semver_neq", "semver_gt", "semver_gte", "semver_lt", "semver_lte":
+			return matchSemver(property, override_value)
 		}
-
-		return overrideValueOrderable >= valueOrderable, nil
 	}
 
-	if operator == "lte" {
-		valueOrderable, overrideValueOrderable, err := validateOrderable(value, override_value)
-		if err != nil {
-			return false, err
-		}
-
-		return overrideValueOrderable <= valueOrderable, nil
+	if operator == "is_date_before" || operator == "is_date_after" {
+		return matchDate(property, override_value, time.Now())
 	}
 
-	return false, &InconclusiveMatchError{"Unknown operator: " + operator}
+	return false, &InconclusiveMatchError{msg: "Unknown operator: " + operator}
 
 }
 
-func validateOrderable(firstValue interface{}, secondValue interface{}) (float64, float64, error) {
+func validateOrderable(key string, firstValue interface{}, secondValue interface{}) (float64, float64, error) {
 	convertedFirstValue, err := interfaceToFloat(firstValue)
 	if err != nil {
-		errMessage := "Value 1 is not orderable"
-		return 0, 0, errors.New(errMessage)
+		return 0, 0, &NotOrderableError{Property: key, Value: firstValue}
 	}
 	convertedSecondValue, err := interfaceToFloat(secondValue)
 	if err != nil {
-		errMessage := "Value 2 is not orderable"
-		return 0, 0, errors.New(errMessage)
+		return 0, 0, &NotOrderableError{Property: key, Value: secondValue}
 	}
 
 	return convertedFirstValue, convertedSecondValue, nil
@@ -575,6 +1220,19 @@ func interfaceToFloat(val interface{}) (float64, error) {
 		i = float64(t)
 	case uint64:
 		i = float64(t)
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return 0.0, err
+		}
+		i = f
+	case string:
+		// Numbers are often sent as strings, the API parses them too.
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return 0.0, err
+		}
+		i = f
 	default:
 		errMessage := "Argument not orderable"
 		return 0.0, errors.New(errMessage)
@@ -585,13 +1243,133 @@ func interfaceToFloat(val interface{}) (float64, error) {
 
 func contains(s []interface{}, e interface{}) bool {
 	for _, a := range s {
-		if a == e {
+		if propertyEquals(a, e) {
 			return true
 		}
 	}
 	return false
 }
 
+// Compares two property values without panicking on values of the same
+// uncomparable type (slices, maps) which are compared deeply instead.
+func propertyEquals(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if isNumber(a) && isNumber(b) {
+		return numbersEqual(a, b)
+	}
+
+	if s, ok := a.(string); ok {
+		if equal, coerced := coercedEquals(s, b); coerced {
+			return equal
+		}
+	}
+	if s, ok := b.(string); ok {
+		if equal, coerced := coercedEquals(s, a); coerced {
+			return equal
+		}
+	}
+
+	if reflect.TypeOf(a).Comparable() && reflect.TypeOf(b).Comparable() {
+		return a == b
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// Compares a string with a number or a boolean the way the API does, so "300"
+// equals 300 and "true" equals true. It reports false when the other value is
+// of another type.
+func coercedEquals(s string, other interface{}) (equal bool, coerced bool) {
+	if b, ok := other.(bool); ok {
+		return strings.EqualFold(strings.TrimSpace(s), strconv.FormatBool(b)), true
+	}
+
+	if isNumber(other) {
+		n := strings.TrimSpace(s)
+		if _, err := strconv.ParseFloat(n, 64); err != nil {
+			return false, true
+		}
+		return numbersEqual(json.Number(n), other), true
+	}
+
+	return false, false
+}
+
+// Reports whether the value is a number of any Go type or a JSON number.
+func isNumber(value interface{}) bool {
+	if _, ok := value.(json.Number); ok {
+		return true
+	}
+
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// Compares numbers regardless of their types, integers are compared exactly so
+// large IDs don't lose precision in a float conversion.
+func numbersEqual(a interface{}, b interface{}) bool {
+	if aInt, ok := interfaceToInt(a); ok {
+		if bInt, ok := interfaceToInt(b); ok {
+			return aInt == bInt
+		}
+	}
+
+	aFloat, errA := interfaceToFloat(a)
+	bFloat, errB := interfaceToFloat(b)
+	return errA == nil && errB == nil && aFloat == bFloat
+}
+
+// Converts integer values to int64, json.Number values are converted when they
+// hold an integer.
+func interfaceToInt(value interface{}) (int64, bool) {
+	if n, ok := value.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := v.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+	}
+
+	return 0, false
+}
+
+// Formats a property value as a string so it can be used with the string
+// operators whatever its type.
+func propertyString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func containsVariant(variantList []FlagVariant, key string) bool {
 	for _, variant := range variantList {
 		if variant.Key == key {
@@ -605,7 +1383,7 @@ func (poller *FeatureFlagsPoller) isSimpleFlagEnabled(key string, distinctId str
 	isEnabled, err := checkIfSimpleFlagEnabled(key, distinctId, rolloutPercentage)
 	if err != nil {
 		errMessage := "Error converting string to int"
-		poller.Errorf(errMessage)
+		poller.log(LogLevelError, errMessage, LogField{"flag", key}, LogField{"error", err})
 		return false, errors.New(errMessage)
 	}
 	return isEnabled, nil
@@ -622,127 +1400,332 @@ func checkIfSimpleFlagEnabled(key string, distinctId string, rolloutPercentage u
 }
 
 func _hash(key string, distinctId string, salt string) (float64, error) {
-	hash := sha1.New()
-	hash.Write([]byte("" + key + "." + distinctId + "" + salt))
-	digest := hash.Sum(nil)
-	hexString := fmt.Sprintf("%x\n", digest)[:15]
-
-	value, err := strconv.ParseInt(hexString, 16, 64)
-	if err != nil {
-		return 0, err
-	}
+	// The input is built on the stack when it is short enough, hashing is
+	// on the path of every evaluation.
+	var buf [128]byte
+	input := append(buf[:0], key...)
+	input = append(input, '.')
+	input = append(input, distinctId...)
+	input = append(input, salt...)
+	digest := sha1.Sum(input)
+
+	// The value of the first 15 hexadecimal digits of the digest, which is
+	// what the other SDKs hash to.
+	value := binary.BigEndian.Uint64(digest[:8]) >> 4
 
 	return float64(value) / LONG_SCALE, nil
 }
 
 func (poller *FeatureFlagsPoller) GetFeatureFlags() []FeatureFlag {
-	// ensure flags are loaded on the first call
+	flags, _ := poller.getFeatureFlags(poller.ctx)
+	return flags
+}
 
-	if !poller.fetchedFlagsSuccessfullyOnce {
-		<-poller.loaded
+// Returns the flag definitions once the first fetch completed, or the error
+// of ctx if it is done before.
+func (poller *FeatureFlagsPoller) getFeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	if err := poller.waitForFirstFetch(ctx); err != nil {
+		return nil, err
 	}
 
-	return poller.featureFlags
+	if snapshot := poller.definitions(); snapshot != nil {
+		return snapshot.flags, nil
+	}
+	return nil, nil
 }
 
-func (poller *FeatureFlagsPoller) decide(requestData []byte, headers [][2]string) (*http.Response, error) {
-	localEvaluationEndpoint := "decide/?v=2"
+// Waits for the first fetch of definitions to complete, whatever its outcome,
+// or for ctx to be done. It doesn't fail once the fetch completed, even after
+// the poller was shut down.
+func (poller *FeatureFlagsPoller) waitForFirstFetch(ctx context.Context) error {
+	select {
+	case <-poller.loaded:
+		return nil
+	default:
+	}
 
-	url, err := url.Parse(poller.Endpoint + "/" + localEvaluationEndpoint + "")
-	if err != nil {
-		poller.Errorf("creating url - %s", err)
+	select {
+	case <-poller.loaded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	return poller.request("POST", url, requestData, headers)
+// The flag definitions in use, they are never modified and replaced as a whole
+// when definitions are loaded so evaluations read them without locking.
+type flagSnapshot struct {
+	flags   []FeatureFlag
+	groups  map[string]string
+	cohorts map[string]CohortProperties
+
+	// The position of each flag in flags by key, so looking up a flag
+	// doesn't depend on how many are defined.
+	index map[string]int
+
+	// When definitions were last fetched successfully, even if they didn't
+	// change.
+	fetchedAt time.Time
 }
 
-func (poller *FeatureFlagsPoller) localEvaluationFlags(headers [][2]string) (*http.Response, error) {
-	localEvaluationEndpoint := "api/feature_flag/local_evaluation"
+// Returns the definition of the flag with the given key, it waits for the
+// first fetch to complete like getFeatureFlags.
+func (poller *FeatureFlagsPoller) getFeatureFlag(ctx context.Context, key string) (FeatureFlag, bool, error) {
+	if err := poller.waitForFirstFetch(ctx); err != nil {
+		return FeatureFlag{}, false, err
+	}
 
-	url, err := url.Parse(poller.Endpoint + "/" + localEvaluationEndpoint + "")
-	if err != nil {
-		poller.Errorf("creating url - %s", err)
+	snapshot := poller.definitions()
+	if snapshot == nil {
+		return FeatureFlag{}, false, nil
 	}
-	searchParams := url.Query()
-	searchParams.Add("token", poller.projectApiKey)
-	url.RawQuery = searchParams.Encode()
+	i, ok := snapshot.index[key]
+	if !ok {
+		return FeatureFlag{}, false, nil
+	}
+	return snapshot.flags[i], true, nil
+}
 
-	return poller.request("GET", url, []byte{}, headers)
+// The API keys of the poller, the project API key identifies the project of
+// flags evaluated remotely and the personal API key authorizes fetching flag
+// definitions.
+type apiKeys struct {
+	project  string
+	personal string
 }
 
-func (poller *FeatureFlagsPoller) request(method string, url *url.URL, requestData []byte, headers [][2]string) (*http.Response, error) {
-	req, err := http.NewRequest(method, url.String(), bytes.NewReader(requestData))
-	if err != nil {
-		poller.Errorf("creating request - %s", err)
+func (poller *FeatureFlagsPoller) apiKeys() apiKeys {
+	return poller.keys.Load().(apiKeys)
+}
+
+// Replaces the API keys with the result of update, requests made afterwards
+// use the new keys.
+func (poller *FeatureFlagsPoller) rotateApiKeys(update func(keys *apiKeys)) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	keys := poller.apiKeys()
+	update(&keys)
+	poller.keys.Store(keys)
+}
+
+// Returns the definitions in use, nil until they are loaded.
+func (poller *FeatureFlagsPoller) definitions() *flagSnapshot {
+	snapshot, _ := poller.snapshot.Load().(*flagSnapshot)
+	return snapshot
+}
+
+// Returns a *StaleFlagsError when definitions weren't fetched successfully for
+// longer than the maximum staleness, if any.
+func (poller *FeatureFlagsPoller) staleness() error {
+	if poller.maxStaleness == 0 || poller.offline != nil {
+		return nil
 	}
 
-	version := getVersion()
+	// Definitions that were never loaded aren't stale, they are missing.
+	snapshot := poller.definitions()
+	if snapshot == nil {
+		return nil
+	}
+	if age := time.Since(snapshot.fetchedAt); age > poller.maxStaleness {
+		return &StaleFlagsError{Age: age, MaxStaleness: poller.maxStaleness}
+	}
+	return nil
+}
 
-	req.Header.Add("User-Agent", "posthog-go (version: "+version+")")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Content-Length", fmt.Sprintf("%d", len(requestData)))
+// Blocks until flag definitions were loaded successfully, it returns the
+// context error when the context is done first and ErrClosed when the poller
+// is shut down.
+func (poller *FeatureFlagsPoller) waitForDefinitions(ctx context.Context) error {
+	select {
+	case <-poller.ready:
+		return nil
+	default:
+	}
 
-	for _, header := range headers {
-		req.Header.Add(header[0], header[1])
+	select {
+	case <-poller.ready:
+		return nil
+	case <-poller.ctx.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	res, err := poller.http.Do(req)
+// Reports whether flag definitions were fetched successfully at least once.
+func (poller *FeatureFlagsPoller) flagsLoaded() bool {
+	return poller.definitions() != nil
+}
+
+// Fetches flag definitions and decodes them into v, the response is streamed
+// since projects with many flags produce large payloads.
+func (poller *FeatureFlagsPoller) localEvaluationFlags(ctx context.Context, headers [][2]string, v interface{}) (int, http.Header, error) {
+	url, err := url.Parse(poller.Endpoint + "/" + localEvaluationEndpoint)
 	if err != nil {
-		poller.Errorf("sending request - %s", err)
+		return 0, nil, err
 	}
+	searchParams := url.Query()
+	searchParams.Add("token", poller.apiKeys().project)
+	// Cohorts are only included when requested.
+	searchParams.Add("send_cohorts", "")
+	url.RawQuery = searchParams.Encode()
+
+	return doStreamRequest(ctx, &poller.http, "GET", url.String(), []byte{}, headers, v)
+}
 
-	return res, err
+// Sends a request to the flags API, errors are returned to the caller which is
+// responsible for logging them.
+func (poller *FeatureFlagsPoller) request(ctx context.Context, method string, url *url.URL, requestData []byte, headers [][2]string) (int, []byte, error) {
+	return doRequest(ctx, &poller.http, method, url.String(), requestData, headers)
 }
 
+// Logs a failed request to the flags API, the status is omitted when no
+// response was received.
+func (poller *FeatureFlagsPoller) logRequestError(msg string, endpoint string, status int, err error) {
+	fields := []LogField{{"endpoint", poller.Endpoint + "/" + endpoint}}
+	if status != 0 {
+		fields = append(fields, LogField{"status", status})
+	}
+	fields = append(fields, LogField{"error", err})
+	poller.log(LogLevelError, msg, fields...)
+}
+
+// Requests flags to be fetched again, requests made while a fetch is pending
+// are coalesced. It does nothing once the poller is shut down. Cached remote
+// evaluations are dropped right away.
 func (poller *FeatureFlagsPoller) ForceReload() {
-	poller.forceReload <- true
+	poller.purgeRemoteEvaluations()
+	select {
+	case poller.forceReload <- struct{}{}:
+	default:
+	}
 }
 
-func (poller *FeatureFlagsPoller) shutdownPoller() {
-	poller.shutdown <- true
+// Stops the poller and waits for the run loop to return, in-flight requests
+// are canceled. It is safe to call it more than once.
+func (poller *FeatureFlagsPoller) Shutdown() {
+	poller.shutdownOnce.Do(poller.cancel)
+	<-poller.done
+	poller.state.setRunning(false)
 }
 
-func (poller *FeatureFlagsPoller) getFeatureFlagVariants(distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (map[string]interface{}, error) {
+func (poller *FeatureFlagsPoller) getFeatureFlagVariants(ctx context.Context, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (map[string]interface{}, error) {
+	decideResponse, err := poller.decideFlags(ctx, distinctId, groups, personProperties, groupProperties)
+	if err != nil {
+		return nil, err
+	}
+	return decideResponse.FeatureFlags, nil
+}
+
+// Evaluates all flags with /flags or /decide, whatever the version of the
+// response it is returned normalized.
+func (poller *FeatureFlagsPoller) decideFlags(ctx context.Context, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (*DecideResponse, error) {
 	errorMessage := "Failed when getting flag variants"
+	keys := poller.apiKeys()
 	requestDataBytes, err := json.Marshal(DecideRequestData{
-		ApiKey:           poller.projectApiKey,
+		ApiKey:           keys.project,
 		DistinctId:       distinctId,
 		Groups:           groups,
 		PersonProperties: personProperties,
 		GroupProperties:  groupProperties,
 	})
-	headers := [][2]string{{"Authorization", "Bearer " + poller.personalApiKey + ""}}
+	headers := [][2]string{{"Authorization", "Bearer " + keys.personal + ""}}
 	if err != nil {
 		errorMessage = "unable to marshal decide endpoint request data"
-		poller.Errorf(errorMessage)
-		return nil, errors.New(errorMessage)
+		poller.log(LogLevelError, errorMessage, LogField{"error", err})
+		return nil, &remoteEvaluationError{msg: errorMessage, cause: err}
+	}
+	if poller.offline != nil {
+		return nil, &remoteEvaluationError{msg: "flags are evaluated offline"}
 	}
-	res, err := poller.decide(requestDataBytes, headers)
-	if err != nil || res.StatusCode != http.StatusOK {
-		errorMessage = "Error calling /decide/"
-		poller.Errorf(errorMessage)
-		return nil, errors.New(errorMessage)
+
+	// All flags are evaluated at once, so a cached response serves any flag.
+	cacheKey, cacheable := "", false
+	if poller.remoteEvaluations != nil {
+		cacheKey, cacheable = evaluationCacheKey("", distinctId, groups, personProperties, groupProperties)
+	}
+	if cacheable {
+		if cached, hit := poller.remoteEvaluations.get(cacheKey); hit {
+			return cached.(*DecideResponse), nil
+		}
+	}
+
+	if err := poller.quotaLimited(); err != nil {
+		return nil, &remoteEvaluationError{msg: "flag evaluation is quota limited", cause: err}
+	}
+	endpoint, status, resBody, err := poller.evaluateRemotely(ctx, requestDataBytes, headers)
+	name := endpointName(endpoint)
+	if status == http.StatusTooManyRequests {
+		var apiErr *APIError
+		errors.As(err, &apiErr)
+		return nil, &remoteEvaluationError{msg: name + " is quota limited", cause: poller.limitQuota(apiErr)}
 	}
-	resBody, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		errorMessage = "Error reading response from /decide/"
-		poller.Errorf(errorMessage)
-		return nil, errors.New(errorMessage)
+		errorMessage = "Error calling " + name
+		poller.logRequestError(errorMessage, endpoint, status, err)
+		return nil, &remoteEvaluationError{msg: errorMessage, cause: err}
 	}
-	defer res.Body.Close()
 	decideResponse := DecideResponse{}
-	err = json.Unmarshal([]byte(resBody), &decideResponse)
+	err = unmarshalJSON(resBody, &decideResponse)
 	if err != nil {
-		errorMessage = "Error parsing response from /decide/"
-		poller.Errorf(errorMessage)
-		return nil, errors.New(errorMessage)
+		errorMessage = "Error parsing response from " + name
+		poller.logRequestError(errorMessage, endpoint, 0, err)
+		return nil, &remoteEvaluationError{msg: errorMessage, cause: err}
+	}
+	for _, resource := range decideResponse.QuotaLimited {
+		if resource == "feature_flags" {
+			return nil, &remoteEvaluationError{msg: name + " is quota limited", cause: poller.limitQuota(nil)}
+		}
+	}
+	if decideResponse.ErrorsWhileComputingFlags {
+		poller.log(LogLevelWarn, name+" failed to evaluate some flags", LogField{"endpoint", poller.Endpoint + "/" + endpoint})
 	}
 
-	return decideResponse.FeatureFlags, nil
+	decideResponse.normalize()
+	if cacheable {
+		poller.remoteEvaluations.add(cacheKey, &decideResponse)
+	}
+	return &decideResponse, nil
+}
+
+// Drops the cached remote evaluations, so the next evaluations reflect the
+// latest flags.
+func (poller *FeatureFlagsPoller) purgeRemoteEvaluations() {
+	if poller.remoteEvaluations != nil {
+		poller.remoteEvaluations.purge()
+	}
+}
+
+// Returns a *QuotaLimitedError while flag requests are paused.
+func (poller *FeatureFlagsPoller) quotaLimited() error {
+	poller.mutex.RLock()
+	until := poller.quotaLimitedUntil
+	poller.mutex.RUnlock()
+	if time.Now().Before(until) {
+		return &QuotaLimitedError{Until: until}
+	}
+	return nil
 }
 
-func (poller *FeatureFlagsPoller) getFeatureFlagVariant(featureFlag FeatureFlag, key string, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (interface{}, error) {
-	var result interface{} = false
+// Pauses flag requests after PostHog limited them, for as long as the response
+// asked or a polling interval when it didn't say.
+func (poller *FeatureFlagsPoller) limitQuota(apiErr *APIError) *QuotaLimitedError {
+	delay := poller.pollingInterval
+	if apiErr != nil && apiErr.RetryAfter > 0 {
+		delay = apiErr.RetryAfter
+	}
+	until := time.Now().Add(delay)
+
+	poller.mutex.Lock()
+	poller.quotaLimitedUntil = until
+	poller.mutex.Unlock()
+
+	poller.log(LogLevelWarn, "feature flag requests are quota limited", LogField{"until", until})
+	return &QuotaLimitedError{Until: until}
+}
+
+func (poller *FeatureFlagsPoller) getFeatureFlagVariant(ctx context.Context, featureFlag FeatureFlag, key string, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (FeatureFlagResult, error) {
+	result := FeatureFlagResult{Key: key, Value: false}
 
 	if featureFlag.IsSimpleFlag {
 
@@ -756,25 +1739,35 @@ func (poller *FeatureFlagsPoller) getFeatureFlagVariant(featureFlag FeatureFlag,
 			rolloutPercentage = *featureFlag.RolloutPercentage
 		}
 		var err error
-		result, err = poller.isSimpleFlagEnabled(key, distinctId, rolloutPercentage)
+		result.Value, err = poller.isSimpleFlagEnabled(key, distinctId, rolloutPercentage)
 		if err != nil {
-			return false, err
+			return FeatureFlagResult{Key: key, Value: false}, err
 		}
+		result.EvaluatedLocally = true
 	} else {
-		featureFlagVariants, variantErr := poller.getFeatureFlagVariants(distinctId, groups, personProperties, groupProperties)
+		decideResponse, variantErr := poller.decideFlags(ctx, distinctId, groups, personProperties, groupProperties)
 
 		if variantErr != nil {
-			return false, variantErr
+			return result, variantErr
 		}
 
-		for flagKey, flagValue := range featureFlagVariants {
-			flagValueString := fmt.Sprintf("%v", flagValue)
-			if key == flagKey && flagValueString != "false" {
-				result = flagValueString
-				break
+		flagValue, ok := decideResponse.FeatureFlags[key]
+		if !ok {
+			if decideResponse.ErrorsWhileComputingFlags {
+				// The flag may exist but failed to be evaluated.
+				return FeatureFlagResult{Key: key}, &remoteEvaluationError{msg: "the flag failed to be evaluated"}
 			}
+			return FeatureFlagResult{Key: key}, ErrFlagNotFound
+		}
+		if flagValueString := fmt.Sprintf("%v", flagValue); flagValueString != "false" {
+			result.Value = flagValueString
+		}
+		result.Payload = decodePayload(decideResponse.FeatureFlagPayloads[key])
+		if detail, ok := decideResponse.Flags[key]; ok {
+			result.Reason = detail.Reason
+			result.Id = detail.Metadata.Id
+			result.Version = detail.Metadata.Version
 		}
-		return result, nil
 	}
 	return result, nil
 }
@@ -0,0 +1,96 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+const featureFlagsApiEndpoint = "feature_flags/"
+
+func (c *client) CreateFeatureFlag(ctx context.Context, flag FeatureFlag) (FeatureFlag, error) {
+	if flag.Key == "" {
+		return FeatureFlag{}, ConfigError{
+			Reason: "Feature Flag Key required",
+			Field:  "Key",
+			Value:  flag.Key,
+		}
+	}
+	return c.saveFeatureFlag(ctx, "POST", featureFlagsApiEndpoint, flag)
+}
+
+func (c *client) UpdateFeatureFlag(ctx context.Context, flag FeatureFlag) (FeatureFlag, error) {
+	if flag.Id == 0 {
+		return FeatureFlag{}, ConfigError{
+			Reason: "Feature Flag Id required",
+			Field:  "Id",
+			Value:  flag.Id,
+		}
+	}
+	return c.saveFeatureFlag(ctx, "PATCH", featureFlagEndpoint(flag.Id), flag)
+}
+
+func (c *client) DeleteFeatureFlag(ctx context.Context, id int) error {
+	if id == 0 {
+		return ConfigError{
+			Reason: "Feature Flag Id required",
+			Field:  "id",
+			Value:  id,
+		}
+	}
+
+	// Flags can't be deleted for good, they are marked as deleted instead.
+	err := c.projectRequest(ctx, "PATCH", featureFlagEndpoint(id), map[string]interface{}{"deleted": true}, nil)
+	if err == nil {
+		c.featureFlagsPoller.ForceReload()
+	}
+	return err
+}
+
+func featureFlagEndpoint(id int) string {
+	return featureFlagsApiEndpoint + strconv.Itoa(id) + "/"
+}
+
+// Sends the editable fields of the flag and reloads the definitions so the
+// change is reflected by local evaluation.
+func (c *client) saveFeatureFlag(ctx context.Context, method string, endpoint string, flag FeatureFlag) (FeatureFlag, error) {
+	filters, err := omitNulls(flag.Filters)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	body := map[string]interface{}{
+		"key":     flag.Key,
+		"name":    flag.Name,
+		"active":  flag.Active,
+		"filters": filters,
+	}
+	if flag.EnsureExperienceContinuity != nil {
+		body["ensure_experience_continuity"] = *flag.EnsureExperienceContinuity
+	}
+
+	var saved FeatureFlag
+	if err := c.projectRequest(ctx, method, endpoint, body, &saved); err != nil {
+		return FeatureFlag{}, err
+	}
+	c.featureFlagsPoller.ForceReload()
+	return saved, nil
+}
+
+// Returns the JSON object of v without its null fields, which the API rejects
+// for some fields of the filters.
+func omitNulls(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for key, value := range m {
+		if value == nil {
+			delete(m, key)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,118 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFeatureFlagManagement(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var bodies []map[string]interface{}
+	fetches := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			fetches++
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer some very secret key" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, body)
+
+		body["id"] = 7
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	flag, err := client.CreateFeatureFlag(ctx, FeatureFlag{
+		Key:     "kill-switch-billing",
+		Name:    "Kill switch of the billing service",
+		Active:  true,
+		Filters: Filter{Groups: []PropertyGroup{{Properties: []Property{}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flag.Id != 7 || flag.Key != "kill-switch-billing" || !flag.Active {
+		t.Errorf("expected the created flag, got %+v", flag)
+	}
+
+	flag.Active = false
+	if _, err := client.UpdateFeatureFlag(ctx, flag); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteFeatureFlag(ctx, flag.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	expected := []string{
+		"POST /api/projects/@current/feature_flags/",
+		"PATCH /api/projects/@current/feature_flags/7/",
+		"PATCH /api/projects/@current/feature_flags/7/",
+	}
+	if strings.Join(requests, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, requests)
+	}
+	if _, ok := bodies[0]["filters"].(map[string]interface{})["multivariate"]; ok {
+		t.Errorf("expected null filters to be omitted, got %v", bodies[0]["filters"])
+	}
+	if bodies[1]["active"] != false || bodies[2]["deleted"] != true {
+		t.Errorf("unexpected bodies %v", bodies)
+	}
+	mu.Unlock()
+
+	// The definitions are reloaded after each change.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := fetches
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the definitions to be reloaded, got %d fetches", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFeatureFlagManagementInvalid(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{Transport: offlineTransport(t)})
+	defer client.Close()
+
+	ctx := context.Background()
+	if _, err := client.CreateFeatureFlag(ctx, FeatureFlag{}); err == nil {
+		t.Error("expected flags without key to be invalid")
+	}
+	if _, err := client.UpdateFeatureFlag(ctx, FeatureFlag{Key: "flag"}); err == nil {
+		t.Error("expected flags without id to be invalid")
+	}
+	if err := client.DeleteFeatureFlag(ctx, 0); err == nil {
+		t.Error("expected an id to be required")
+	}
+}
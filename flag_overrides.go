@@ -0,0 +1,129 @@
+package posthog
+
+import (
+	"context"
+)
+
+// Forces the values of flags evaluated by the child client, by key. They take
+// precedence over local and remote evaluation, which makes integration tests
+// and canary environments deterministic. A nil value makes the flag
+// undefined. Overrides of nested children are added to the ones of their
+// parent. The flags sent with captures aren't overridden.
+//
+//	canary := client.With(posthog.WithFlagOverrides(map[string]interface{}{
+//		"new-checkout": "variant-b",
+//	}))
+func WithFlagOverrides(overrides map[string]interface{}) Option {
+	return func(c *childClient) {
+		merged := make(map[string]interface{}, len(c.flagOverrides)+len(overrides))
+		for key, value := range c.flagOverrides {
+			merged[key] = value
+		}
+		for key, value := range overrides {
+			merged[key] = value
+		}
+		c.flagOverrides = merged
+	}
+}
+
+// Returns the overridden value of the flag, ok is false when it isn't
+// overridden. OnFlagEvaluated is called for overridden flags too.
+func (c *childClient) flagOverride(flagConfig FeatureFlagPayload) (value interface{}, ok bool) {
+	value, ok = c.flagOverrides[flagConfig.Key]
+	if ok && c.OnFlagEvaluated != nil {
+		c.OnFlagEvaluated(FlagEvaluationRecord{
+			Key:              flagConfig.Key,
+			DistinctId:       flagConfig.DistinctId,
+			Groups:           flagConfig.Groups,
+			Value:            value,
+			EvaluatedLocally: true,
+			Overridden:       true,
+		})
+	}
+	return value, ok
+}
+
+func (c *childClient) IsFeatureEnabled(flagConfig FeatureFlagPayload) (*bool, error) {
+	return c.IsFeatureEnabledCtx(c.flagsContext(), flagConfig)
+}
+
+func (c *childClient) IsFeatureEnabledCtx(ctx context.Context, flagConfig FeatureFlagPayload) (*bool, error) {
+	if err := flagConfig.validate(); err != nil {
+		return nil, err
+	}
+	if value, ok := c.flagOverride(flagConfig); ok {
+		return flagEnabled(value), nil
+	}
+	return c.client.IsFeatureEnabledCtx(ctx, flagConfig)
+}
+
+func (c *childClient) GetFeatureFlag(flagConfig FeatureFlagPayload) (interface{}, error) {
+	return c.GetFeatureFlagCtx(c.flagsContext(), flagConfig)
+}
+
+func (c *childClient) GetFeatureFlagCtx(ctx context.Context, flagConfig FeatureFlagPayload) (interface{}, error) {
+	if err := flagConfig.validate(); err != nil {
+		return false, err
+	}
+	if value, ok := c.flagOverride(flagConfig); ok {
+		return value, nil
+	}
+	return c.client.GetFeatureFlagCtx(ctx, flagConfig)
+}
+
+func (c *childClient) GetFeatureFlagResult(flagConfig FeatureFlagPayload) (FeatureFlagResult, error) {
+	return c.GetFeatureFlagResultCtx(c.flagsContext(), flagConfig)
+}
+
+// Overridden flags are reported as evaluated locally, without payload.
+func (c *childClient) GetFeatureFlagResultCtx(ctx context.Context, flagConfig FeatureFlagPayload) (FeatureFlagResult, error) {
+	if err := flagConfig.validate(); err != nil {
+		return FeatureFlagResult{Key: flagConfig.Key}, err
+	}
+	if value, ok := c.flagOverride(flagConfig); ok {
+		return FeatureFlagResult{Key: flagConfig.Key, Value: value, EvaluatedLocally: true}, nil
+	}
+	return c.client.GetFeatureFlagResultCtx(ctx, flagConfig)
+}
+
+func (c *childClient) GetAllFlags(flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	return c.GetAllFlagsCtx(c.flagsContext(), flagConfig)
+}
+
+// Overrides are applied to the flags returned by the parent even when it
+// returns an error, like the parent does with the flags evaluated locally.
+func (c *childClient) GetAllFlagsCtx(ctx context.Context, flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	flags, err := c.client.GetAllFlagsCtx(ctx, flagConfig)
+	if len(c.flagOverrides) == 0 || flags == nil {
+		return flags, err
+	}
+
+	for key := range c.flagOverrides {
+		value, _ := c.flagOverride(FeatureFlagPayload{
+			Key:        key,
+			DistinctId: flagConfig.DistinctId,
+			Groups:     flagConfig.Groups,
+		})
+		if value == nil {
+			delete(flags, key)
+		} else {
+			flags[key] = value
+		}
+	}
+	return flags, err
+}
+
+func (c *childClient) EvaluateFlagForMany(key string, distinctIds []string, propsFor func(id string) Properties) (map[string]interface{}, error) {
+	value, ok := c.flagOverrides[key]
+	if !ok {
+		return c.client.EvaluateFlagForMany(key, distinctIds, propsFor)
+	}
+
+	results := make(map[string]interface{}, len(distinctIds))
+	if value != nil {
+		for _, distinctId := range distinctIds {
+			results[distinctId] = value
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,154 @@
+package posthog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// The maximum number of pages of flag definitions fetched, so next links
+// that loop don't keep the poller busy forever.
+const maxFeatureFlagsPages = 1000
+
+// Fetches the pages of flag definitions following the first one and adds
+// their flags and cohorts to it. Pages are fetched concurrently when the next
+// link is based on an offset, which gives the URL of every page, and one after
+// the other otherwise.
+func (poller *FeatureFlagsPoller) fetchRemainingPages(ctx context.Context, headers [][2]string, first *FeatureFlagsResponse) error {
+	base, err := url.Parse(poller.Endpoint + "/")
+	if err != nil {
+		return err
+	}
+	next, err := base.Parse(first.Next)
+	if err != nil {
+		return err
+	}
+
+	if pages, ok := offsetPages(next, first.Count); ok {
+		return poller.fetchPages(ctx, headers, pages, first)
+	}
+
+	for n := 1; next != nil; n++ {
+		if n == maxFeatureFlagsPages {
+			return fmt.Errorf("flag definitions span more than %d pages", maxFeatureFlagsPages)
+		}
+
+		page, err := poller.fetchPage(ctx, next.String(), headers)
+		if err != nil {
+			return err
+		}
+		first.addPage(page)
+
+		next = nil
+		if page.Next != "" {
+			if next, err = base.Parse(page.Next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the URLs of the pages from the next link to the last one, ok is
+// false when the link isn't based on an offset and a limit.
+func offsetPages(next *url.URL, count int) (pages []string, ok bool) {
+	query := next.Query()
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil || offset < 0 {
+		return nil, false
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 || count <= offset || (count-offset)/limit >= maxFeatureFlagsPages {
+		return nil, false
+	}
+
+	for ; offset < count; offset += limit {
+		query.Set("offset", strconv.Itoa(offset))
+		page := *next
+		page.RawQuery = query.Encode()
+		pages = append(pages, page.String())
+	}
+	return pages, true
+}
+
+// Fetches the pages with up to Config.FeatureFlagsPageConcurrency requests at
+// once and adds them to first in order. The other requests are canceled when
+// one fails.
+func (poller *FeatureFlagsPoller) fetchPages(ctx context.Context, headers [][2]string, pages []string, first *FeatureFlagsResponse) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := poller.pageConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	responses := make([]FeatureFlagsResponse, len(pages))
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i, page := range pages {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, page string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			response, err := poller.fetchPage(ctx, page, headers)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			responses[i] = response
+		}(i, page)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, response := range responses {
+		first.addPage(response)
+	}
+	return nil
+}
+
+func (poller *FeatureFlagsPoller) fetchPage(ctx context.Context, pageURL string, headers [][2]string) (FeatureFlagsResponse, error) {
+	page := FeatureFlagsResponse{}
+	if _, _, err := doStreamRequest(ctx, &poller.http, "GET", pageURL, []byte{}, headers, &page); err != nil {
+		return FeatureFlagsResponse{}, fmt.Errorf("fetching %s: %w", pageURL, err)
+	}
+	return page, nil
+}
+
+// Adds the flags and cohorts of another page of definitions.
+func (r *FeatureFlagsResponse) addPage(page FeatureFlagsResponse) {
+	r.Flags = append(r.Flags, page.Flags...)
+
+	if r.GroupTypeMapping == nil {
+		r.GroupTypeMapping = page.GroupTypeMapping
+	}
+
+	if len(page.Cohorts) != 0 && r.Cohorts == nil {
+		r.Cohorts = make(map[string]CohortProperties, len(page.Cohorts))
+	}
+	for id, cohort := range page.Cohorts {
+		r.Cohorts[id] = cohort
+	}
+}
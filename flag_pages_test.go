@@ -0,0 +1,137 @@
+package posthog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Serves count flags by pages of limit flags, next links are built by next
+// from the offset of the following page.
+func paginatedFlagsHandler(count int, limit int, next func(r *http.Request, offset int) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			return
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+			offset, _ = strconv.Atoi(cursor)
+		}
+
+		flags := []string{}
+		for i := offset; i < count && i < offset+limit; i++ {
+			flags = append(flags, fmt.Sprintf(`{"key": "flag-%d", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}`, i))
+		}
+		nextLink := "null"
+		if offset+limit < count {
+			nextLink = strconv.Quote(next(r, offset+limit))
+		}
+		fmt.Fprintf(w, `{"count": %d, "next": %s, "flags": [%s], "cohorts": {"%d": {"type": "AND", "values": []}}}`, count, nextLink, strings.Join(flags, ","), offset)
+	}
+}
+
+func TestFeatureFlagsPagesAreFetchedConcurrently(t *testing.T) {
+	var inflight, maxInflight int32
+	handler := paginatedFlagsHandler(9, 2, func(r *http.Request, offset int) string {
+		return fmt.Sprintf("http://%s/api/feature_flag/local_evaluation?token=key&limit=2&offset=%d", r.Host, offset)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("offset") != "" {
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInflight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:              "some very secret key",
+		Endpoint:                    server.URL,
+		FeatureFlagsPageConcurrency: 2,
+		Logger:                      testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+
+	if err := c.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	flags, _ := c.GetFeatureFlags()
+	if len(flags) != 9 {
+		t.Fatalf("Expected the flags of all pages, got %d", len(flags))
+	}
+	for i, flag := range flags {
+		if flag.Key != fmt.Sprintf("flag-%d", i) {
+			t.Errorf("Expected the flags in the order of the pages, got %s at %d", flag.Key, i)
+		}
+	}
+	if cohorts := c.(*client).featureFlagsPoller.definitions().cohorts; len(cohorts) != 5 {
+		t.Errorf("Expected the cohorts of all pages, got %v", cohorts)
+	}
+	if n := atomic.LoadInt32(&maxInflight); n > 2 {
+		t.Errorf("Expected at most 2 pages to be fetched at once, got %d", n)
+	}
+}
+
+func TestFeatureFlagsPagesAreFollowed(t *testing.T) {
+	server := httptest.NewServer(paginatedFlagsHandler(5, 2, func(r *http.Request, offset int) string {
+		return fmt.Sprintf("/api/feature_flag/local_evaluation?cursor=%d", offset)
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	if err := client.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if flags, _ := client.GetFeatureFlags(); len(flags) != 5 {
+		t.Errorf("Expected the flags of all pages, got %v", flags)
+	}
+}
+
+func TestFeatureFlagsPageFailure(t *testing.T) {
+	handler := paginatedFlagsHandler(5, 2, func(r *http.Request, offset int) string {
+		return fmt.Sprintf("/api/feature_flag/local_evaluation?limit=2&offset=%d", offset)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("offset") == "4" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		ManualPump:     true,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	if err := client.ReloadFeatureFlagsAndWait(context.Background()); err == nil || !strings.Contains(err.Error(), "offset=4") {
+		t.Error("Expected the failure of the last page to be returned, got", err)
+	}
+	if _, err := client.GetFeatureFlags(); err != ErrFlagsNotLoaded {
+		t.Error("Expected partial definitions not to be used, got", err)
+	}
+}
@@ -0,0 +1,111 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// The value of a feature flag with how it was evaluated, returned by
+// Client.GetFeatureFlagResult.
+type FeatureFlagResult struct {
+	Key string
+
+	// The value of the flag, as returned by GetFeatureFlag.
+	Value interface{}
+
+	// The JSON document configured as payload of the flag, or of its variant
+	// for multivariate flags. It is nil when the flag has no payload.
+	Payload json.RawMessage
+
+	// Why the flag evaluated to its value and the ID and version of its
+	// definition, as reported by the API. They are only known for flags
+	// evaluated remotely by instances supporting /decide v4.
+	Reason  *FlagReason
+	Id      int
+	Version int
+
+	// Reports whether the flag was evaluated locally from the flag
+	// definitions, without calling the API.
+	EvaluatedLocally bool
+}
+
+// A flag evaluation reported to Config.OnFlagEvaluated.
+type FlagEvaluationRecord struct {
+	Key        string
+	DistinctId string
+	Groups     Groups
+
+	// The value of the flag and the error returned with it, if any.
+	Value interface{}
+	Err   error
+
+	// Reports whether the flag was evaluated locally from the flag
+	// definitions, without calling the API.
+	EvaluatedLocally bool
+
+	// Reports whether the value was forced by WithFlagOverrides.
+	Overridden bool
+
+	// How long the evaluation took, including requests to the API. Flags
+	// returned by GetAllFlags share the latency of the whole call.
+	Latency time.Duration
+}
+
+func (c *client) GetFeatureFlagResult(flagConfig FeatureFlagPayload) (FeatureFlagResult, error) {
+	return c.GetFeatureFlagResultCtx(c.flagsContext(), flagConfig)
+}
+
+func (c *client) GetFeatureFlagResultCtx(ctx context.Context, flagConfig FeatureFlagPayload) (FeatureFlagResult, error) {
+	flagConfig.fromContext(ctx)
+	if err := flagConfig.validate(); err != nil {
+		return FeatureFlagResult{Key: flagConfig.Key}, err
+	}
+
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return FeatureFlagResult{Key: flagConfig.Key}, errors.New(errorMessage)
+	}
+	return c.evaluateFeatureFlag(ctx, flagConfig)
+}
+
+// Evaluates the flag and reports a $feature_flag_called event the first time
+// the flag is evaluated for the distinct ID.
+func (c *client) evaluateFeatureFlag(ctx context.Context, flagConfig FeatureFlagPayload) (FeatureFlagResult, error) {
+	start := c.now()
+	result, err := c.featureFlagsPoller.GetFeatureFlagResult(ctx, flagConfig)
+	if c.OnFlagEvaluated != nil {
+		c.OnFlagEvaluated(FlagEvaluationRecord{
+			Key:              flagConfig.Key,
+			DistinctId:       flagConfig.DistinctId,
+			Groups:           flagConfig.Groups,
+			Value:            result.Value,
+			Err:              err,
+			EvaluatedLocally: result.EvaluatedLocally,
+			Latency:          c.now().Sub(start),
+		})
+	}
+	if c.sendFeatureFlagEvents(flagConfig.SendFeatureFlagEvents) && !c.featureFlagCalledReported(flagConfig.DistinctId, flagConfig.Key) {
+		properties := NewProperties().
+			Set("$feature_flag", flagConfig.Key).
+			Set("$feature_flag_response", result.Value).
+			Set("$feature_flag_errored", err != nil && err != ErrFlagNotFound)
+		if result.Id != 0 {
+			properties.Set("$feature_flag_id", result.Id).Set("$feature_flag_version", result.Version)
+		}
+		if result.Reason != nil {
+			properties.Set("$feature_flag_reason", result.Reason.Description)
+		}
+
+		c.Enqueue(Capture{
+			DistinctId: flagConfig.DistinctId,
+			Event:      "$feature_flag_called",
+			Properties: properties,
+			Groups:     flagConfig.Groups,
+		})
+		c.reportFeatureFlagCalled(flagConfig.DistinctId, flagConfig.Key)
+	}
+	return result, err
+}
@@ -0,0 +1,71 @@
+package posthog
+
+import (
+	"errors"
+	"time"
+)
+
+// The state of the feature flag definitions of a client, returned by
+// Client.FeatureFlagsStatus so operators can wire readiness probes and alert
+// when flag data goes stale.
+type FeatureFlagsStatus struct {
+
+	// Reports whether definitions were loaded at least once, flags can't be
+	// evaluated locally until then.
+	Loaded bool
+
+	// The number of flags currently defined.
+	Flags int
+
+	// When definitions were last fetched successfully, even if they didn't
+	// change. It is the zero time until the first successful fetch.
+	LastFetchAt time.Time
+
+	// How long ago definitions were last fetched, zero until the first
+	// successful fetch. Stale reports whether it exceeds
+	// Config.MaxFlagStaleness, flags aren't evaluated while it does.
+	Age   time.Duration
+	Stale bool
+
+	// The last error that occurred while fetching definitions and when it
+	// happened, an error older than LastFetchAt was resolved since.
+	LastError   error
+	LastErrorAt time.Time
+
+	// When definitions are fetched next, it is the zero time when they are
+	// never fetched again, like for offline definitions that aren't watched.
+	NextPollAt time.Time
+}
+
+// Returns the state of the flag definitions.
+func (poller *FeatureFlagsPoller) Status() FeatureFlagsStatus {
+	state := poller.state.state()
+
+	status := FeatureFlagsStatus{
+		LastError:   state.LastError,
+		LastErrorAt: state.LastErrorAt,
+	}
+	if snapshot := poller.definitions(); snapshot != nil {
+		status.Loaded = true
+		status.Flags = len(snapshot.flags)
+		status.LastFetchAt = snapshot.fetchedAt
+		status.Age = time.Since(snapshot.fetchedAt)
+		status.Stale = poller.maxStaleness != 0 && poller.offline == nil && status.Age > poller.maxStaleness
+	}
+
+	poller.mutex.RLock()
+	defer poller.mutex.RUnlock()
+	if state.Running && (poller.offline == nil || poller.offline.watch) {
+		status.NextPollAt = poller.nextPoll
+	}
+	return status
+}
+
+func (c *client) FeatureFlagsStatus() (FeatureFlagsStatus, error) {
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return FeatureFlagsStatus{}, errors.New(errorMessage)
+	}
+	return c.featureFlagsPoller.Status(), nil
+}
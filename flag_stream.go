@@ -0,0 +1,108 @@
+package posthog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const flagStreamEndpoint = "api/feature_flag/local_evaluation/stream"
+
+// Listens to the server-sent events of the flag stream endpoint and reloads
+// definitions whenever one is received, so changes like a killed flag reach
+// the poller within seconds. The stream only carries notifications, the
+// definitions are still downloaded from the local evaluation endpoint.
+// The connection is reestablished with a backoff until the poller is shut
+// down, periodic polling keeps going in the meantime.
+func (poller *FeatureFlagsPoller) stream() {
+	poller.streamState.setRunning(true)
+	defer poller.streamState.setRunning(false)
+
+	backo := DefaultBacko()
+
+	for attempt := 0; ; attempt++ {
+		connected, err := poller.listen(poller.ctx)
+		if poller.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			attempt = 0
+		}
+		if err != nil {
+			poller.log(LogLevelWarn, "flag stream disconnected", LogField{"endpoint", poller.Endpoint + "/" + flagStreamEndpoint}, LogField{"error", err})
+			poller.streamState.recordError(err)
+		}
+
+		select {
+		case <-time.After(backo.Duration(attempt)):
+		case <-poller.ctx.Done():
+			return
+		}
+	}
+}
+
+// Reads events from one connection to the stream, it reports whether the
+// connection was established and why it ended.
+func (poller *FeatureFlagsPoller) listen(ctx context.Context) (connected bool, err error) {
+	u, err := url.Parse(poller.Endpoint + "/" + flagStreamEndpoint)
+	if err != nil {
+		return false, err
+	}
+	searchParams := u.Query()
+	keys := poller.apiKeys()
+	searchParams.Add("token", keys.project)
+	u.RawQuery = searchParams.Encode()
+
+	headers := [][2]string{
+		{"Authorization", "Bearer " + keys.personal},
+		{"Accept", "text/event-stream"},
+	}
+
+	// The stream stays open indefinitely, the timeout of the client would
+	// cut it.
+	httpClient := poller.http
+	httpClient.Timeout = 0
+
+	res, err := sendRequest(ctx, &httpClient, "GET", u.String(), nil, headers)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return false, &APIError{Status: res.StatusCode, Body: string(body)}
+	}
+
+	// Changes may have been missed while disconnected.
+	poller.ForceReload()
+
+	scanner := bufio.NewScanner(res.Body)
+	data := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// A blank line dispatches the event, if it carried data.
+			if data {
+				poller.log(LogLevelDebug, "flag definitions changed")
+				poller.ForceReload()
+			}
+			data = false
+		case strings.HasPrefix(line, "data:"):
+			data = true
+		}
+		// Other fields, like comments used as keep-alives, are ignored.
+	}
+
+	if err = scanner.Err(); err == nil {
+		err = errors.New("the stream was closed by the server")
+	}
+	return true, err
+}
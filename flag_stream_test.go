@@ -0,0 +1,113 @@
+package posthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFeatureFlagsStreaming(t *testing.T) {
+	var fetches int32
+	notify := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/feature_flag/local_evaluation/stream":
+			if r.Header.Get("Accept") != "text/event-stream" {
+				t.Errorf("unexpected Accept header: %q", r.Header.Get("Accept"))
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(": keep-alive\n\n"))
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-notify:
+				w.Write([]byte("event: flags\ndata: {}\n\n"))
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+			<-r.Context().Done()
+
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			atomic.AddInt32(&fetches, 1)
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:              server.URL,
+		PersonalApiKey:        "some very secret key",
+		Logger:                testLogger{t.Logf, t.Logf},
+		FeatureFlagsStreaming: true,
+	})
+
+	waitForFetches := func(n int32) {
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&fetches) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d fetches, got %d", n, atomic.LoadInt32(&fetches))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The initial fetch, then the reload once the stream is connected.
+	waitForFetches(2)
+
+	close(notify)
+	waitForFetches(3)
+
+	states := client.Subsystems()
+	if len(states) != 3 || states[2].Name != "stream" || !states[2].Running {
+		t.Errorf("expected the stream to be running: %+v", states)
+	}
+
+	client.Close()
+
+	for _, state := range client.Subsystems() {
+		if state.Running {
+			t.Errorf("expected %s to be stopped", state.Name)
+		}
+	}
+}
+
+func TestFeatureFlagsStreamingFallsBackToPolling(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/feature_flag/local_evaluation/stream":
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			atomic.AddInt32(&fetches, 1)
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:                           server.URL,
+		PersonalApiKey:                     "some very secret key",
+		DefaultFeatureFlagsPollingInterval: 20 * time.Millisecond,
+		Logger:                             testLogger{t.Logf, t.Logf},
+		FeatureFlagsStreaming:              true,
+	})
+	defer client.Close()
+
+	// Definitions keep being polled while the stream is unavailable.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		states := client.Subsystems()
+		if atomic.LoadInt32(&fetches) >= 3 && len(states) == 3 && states[2].Running && states[2].LastError != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected definitions to be polled while the stream retries, got %d fetches: %+v", atomic.LoadInt32(&fetches), states)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
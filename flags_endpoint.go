@@ -0,0 +1,71 @@
+package posthog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+const flagsEndpoint = "flags/?v=2"
+
+// The endpoint used to evaluate flags remotely, see Config.FlagsEndpoint.
+// /flags replaces /decide, both take the same requests and /flags responds
+// like /decide v4.
+type FlagsEndpoint int
+
+const (
+	// /flags is called, and /decide from then on when the instance answers
+	// 404 because it doesn't support /flags yet. This is the default.
+	FlagsEndpointAuto FlagsEndpoint = iota
+
+	// Only /flags is called.
+	FlagsEndpointFlags
+
+	// Only /decide is called, for self-hosted instances that predate /flags.
+	FlagsEndpointDecide
+)
+
+func (e FlagsEndpoint) String() string {
+	switch e {
+	case FlagsEndpointAuto:
+		return "auto"
+	case FlagsEndpointFlags:
+		return "flags"
+	case FlagsEndpointDecide:
+		return "decide"
+	}
+	return fmt.Sprintf("FlagsEndpoint(%d)", int(e))
+}
+
+// Evaluates flags remotely and returns the endpoint that answered.
+func (poller *FeatureFlagsPoller) evaluateRemotely(ctx context.Context, requestData []byte, headers [][2]string) (string, int, []byte, error) {
+	if poller.flagsEndpoint != FlagsEndpointDecide && atomic.LoadInt32(&poller.decideFallback) == 0 {
+		status, body, err := poller.post(ctx, flagsEndpoint, requestData, headers)
+		if status != http.StatusNotFound || poller.flagsEndpoint == FlagsEndpointFlags {
+			return flagsEndpoint, status, body, err
+		}
+
+		poller.log(LogLevelInfo, "/flags/ is not supported, falling back to /decide/", LogField{"endpoint", poller.Endpoint + "/" + flagsEndpoint})
+		atomic.StoreInt32(&poller.decideFallback, 1)
+	}
+
+	status, body, err := poller.post(ctx, decideEndpoint, requestData, headers)
+	return decideEndpoint, status, body, err
+}
+
+func (poller *FeatureFlagsPoller) post(ctx context.Context, endpoint string, requestData []byte, headers [][2]string) (int, []byte, error) {
+	url, err := url.Parse(poller.Endpoint + "/" + endpoint)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return poller.request(ctx, "POST", url, requestData, headers)
+}
+
+// Returns the path of an endpoint for messages, like "/flags/".
+func endpointName(endpoint string) string {
+	return "/" + strings.SplitN(endpoint, "?", 2)[0]
+}
@@ -0,0 +1,18 @@
+module github.com/posthog/posthog-go/gqlgen
+
+go 1.20
+
+require (
+	github.com/99designs/gqlgen v0.17.49
+	github.com/posthog/posthog-go v0.0.0
+)
+
+require (
+	github.com/agnivade/levenshtein v1.1.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/sosodev/duration v1.3.1 // indirect
+	github.com/vektah/gqlparser/v2 v2.5.16 // indirect
+)
+
+replace github.com/posthog/posthog-go => ../
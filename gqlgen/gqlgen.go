@@ -0,0 +1,169 @@
+// Package posthoggqlgen provides a gqlgen extension capturing an event for
+// every GraphQL operation and giving resolvers access to feature flags.
+//
+//	srv := handler.NewDefaultServer(generated.NewExecutableSchema(cfg))
+//	srv.Use(posthoggqlgen.New(client, posthoggqlgen.Options{
+//		DistinctId: func(ctx context.Context) string { return userFromContext(ctx) },
+//	}))
+//
+// Resolvers then evaluate flags for the user of the request with:
+//
+//	enabled, err := posthoggqlgen.IsFeatureEnabled(ctx, "new-search")
+package posthoggqlgen
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/posthog/posthog-go"
+)
+
+// DefaultEvent is the name of the events captured when Options.Event is not
+// set.
+const DefaultEvent = "graphql_operation"
+
+// ErrNoDistinctId is returned by the flag helpers when the context wasn't
+// created by the extension or has no distinct ID.
+var ErrNoDistinctId = errors.New("posthoggqlgen: no distinct id in context")
+
+// Options configures the extension.
+type Options struct {
+	// Returns the distinct ID of the user making the request. Operations for
+	// which it returns an empty string are not captured.
+	DistinctId func(ctx context.Context) string
+
+	// Name of the captured events, DefaultEvent is used if empty.
+	Event string
+
+	// When set, operations are captured only if the function returns true.
+	// This can be used to skip introspection queries or to sample traffic.
+	Filter func(ctx context.Context, rc *graphql.OperationContext) bool
+}
+
+// Tracer is the gqlgen extension returned by New.
+type Tracer struct {
+	client posthog.Client
+	opts   Options
+	now    func() time.Time
+}
+
+var (
+	_ graphql.HandlerExtension     = Tracer{}
+	_ graphql.OperationInterceptor = Tracer{}
+	_ graphql.ResponseInterceptor  = Tracer{}
+)
+
+// New returns an extension capturing operations to client.
+func New(client posthog.Client, opts Options) Tracer {
+	if opts.Event == "" {
+		opts.Event = DefaultEvent
+	}
+	return Tracer{client: client, opts: opts, now: time.Now}
+}
+
+func (t Tracer) ExtensionName() string {
+	return "PostHog"
+}
+
+func (t Tracer) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+type contextKey struct{}
+
+type requestScope struct {
+	client     posthog.Client
+	distinctId string
+}
+
+// InterceptOperation makes the client and distinct ID of the request
+// available to the flag helpers of this package.
+func (t Tracer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	scope := &requestScope{client: t.client}
+	if t.opts.DistinctId != nil {
+		scope.distinctId = t.opts.DistinctId(ctx)
+	}
+	return next(context.WithValue(ctx, contextKey{}, scope))
+}
+
+// InterceptResponse captures an event with the name, type, complexity,
+// duration and errors of the operation once its response was produced.
+func (t Tracer) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+
+	if !graphql.HasOperationContext(ctx) {
+		return resp
+	}
+	rc := graphql.GetOperationContext(ctx)
+
+	scope, _ := ctx.Value(contextKey{}).(*requestScope)
+	if scope == nil || scope.distinctId == "" {
+		return resp
+	}
+
+	if t.opts.Filter != nil && !t.opts.Filter(ctx, rc) {
+		return resp
+	}
+
+	properties := posthog.NewProperties().
+		Set("operation_name", rc.OperationName).
+		Set("duration_ms", t.now().Sub(rc.Stats.OperationStart).Milliseconds())
+
+	if rc.Operation != nil {
+		properties.Set("operation_type", string(rc.Operation.Operation))
+	}
+
+	if stats := extension.GetComplexityStats(ctx); stats != nil {
+		properties.Set("complexity", stats.Complexity)
+	}
+
+	var messages []string
+	if resp != nil {
+		for _, err := range resp.Errors {
+			messages = append(messages, err.Message)
+		}
+	}
+	properties.Set("error_count", len(messages))
+	if len(messages) != 0 {
+		properties.Set("errors", messages)
+	}
+
+	t.client.Enqueue(posthog.Capture{
+		DistinctId: scope.distinctId,
+		Event:      t.opts.Event,
+		Properties: properties,
+	})
+
+	return resp
+}
+
+func scopeFromContext(ctx context.Context) (*requestScope, error) {
+	scope, _ := ctx.Value(contextKey{}).(*requestScope)
+	if scope == nil || scope.distinctId == "" {
+		return nil, ErrNoDistinctId
+	}
+	return scope, nil
+}
+
+// IsFeatureEnabled evaluates the flag for the distinct ID of the request
+// being resolved.
+func IsFeatureEnabled(ctx context.Context, key string) (*bool, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scope.client.IsFeatureEnabled(posthog.FeatureFlagPayload{Key: key, DistinctId: scope.distinctId})
+}
+
+// GetFeatureFlag returns the value of the flag for the distinct ID of the
+// request being resolved.
+func GetFeatureFlag(ctx context.Context, key string) (interface{}, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scope.client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: key, DistinctId: scope.distinctId})
+}
@@ -0,0 +1,74 @@
+package posthoggqlgen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor/testexecutor"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/posthog/posthog-go"
+)
+
+type testClient struct {
+	posthog.Client
+	msgs  []posthog.Message
+	flags []posthog.FeatureFlagPayload
+}
+
+func (c *testClient) Enqueue(msg posthog.Message) error {
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+func (c *testClient) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	c.flags = append(c.flags, payload)
+	return "variant-b", nil
+}
+
+type userKey struct{}
+
+func TestOperationsAreCaptured(t *testing.T) {
+	client := &testClient{}
+
+	exec := testexecutor.New()
+	exec.SetCalculatedComplexity(3)
+	exec.Use(extension.FixedComplexityLimit(100))
+	exec.Use(New(client, Options{
+		DistinctId: func(ctx context.Context) string {
+			id, _ := ctx.Value(userKey{}).(string)
+			return id
+		},
+	}))
+
+	ctx := graphql.StartOperationTrace(context.WithValue(context.Background(), userKey{}, "user-1"))
+	rc, errs := exec.CreateOperationContext(ctx, &graphql.RawParams{Query: "query Viewer { name }", OperationName: "Viewer"})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	responses, ctx := exec.DispatchOperation(ctx, rc)
+	if resp := responses(ctx); resp == nil || len(resp.Errors) != 0 {
+		t.Fatalf("invalid response: %+v", resp)
+	}
+
+	if len(client.msgs) != 1 {
+		t.Fatalf("expected 1 captured event, got %d", len(client.msgs))
+	}
+
+	capture := client.msgs[0].(posthog.Capture)
+	p := capture.Properties
+	if capture.DistinctId != "user-1" || capture.Event != DefaultEvent || p["operation_name"] != "Viewer" || p["operation_type"] != "query" || p["complexity"] != 3 || p["error_count"] != 0 {
+		t.Errorf("invalid capture: %+v", capture)
+	}
+
+	if value, err := GetFeatureFlag(ctx, "search"); err != nil || value != "variant-b" || client.flags[0].DistinctId != "user-1" {
+		t.Errorf("invalid flag evaluation: %v %v %+v", value, err, client.flags)
+	}
+}
+
+func TestFlagHelpersWithoutDistinctId(t *testing.T) {
+	if _, err := GetFeatureFlag(context.Background(), "search"); err != ErrNoDistinctId {
+		t.Error("expected ErrNoDistinctId, got", err)
+	}
+}
@@ -0,0 +1,107 @@
+package posthog
+
+import (
+	"sync"
+)
+
+// A Group is a handle on a client scoped to a group, like the account of a
+// B2B service, returned by Client.ForGroup. Events captured through the
+// handle are attached to the group and feature flags are evaluated with it,
+// along with the group properties set through the handle.
+// Handles are safe to use concurrently.
+type Group struct {
+	client    Client
+	groupType string
+	key       string
+
+	mutex      sync.Mutex
+	properties Properties
+}
+
+func newGroup(client Client, groupType string, key string) *Group {
+	return &Group{
+		client:     client,
+		groupType:  groupType,
+		key:        key,
+		properties: NewProperties(),
+	}
+}
+
+func (c *client) ForGroup(groupType string, key string) *Group {
+	return newGroup(c, groupType, key)
+}
+
+func (c *childClient) ForGroup(groupType string, key string) *Group {
+	return newGroup(c, groupType, key)
+}
+
+func (g *Group) groups() Groups {
+	return NewGroups().Set(g.groupType, g.key)
+}
+
+func (g *Group) groupProperties() map[string]Properties {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return map[string]Properties{g.groupType: NewProperties().Merge(g.properties)}
+}
+
+// Captures an event of a user attached to the group.
+func (g *Group) Capture(distinctId string, event string, properties Properties) error {
+	return g.client.Enqueue(Capture{
+		DistinctId: distinctId,
+		Event:      event,
+		Properties: properties,
+		Groups:     g.groups(),
+	})
+}
+
+// Sets properties of the group, they are remembered by the handle and used to
+// evaluate feature flags.
+func (g *Group) Identify(properties Properties) error {
+	g.mutex.Lock()
+	g.properties.Merge(properties)
+	g.mutex.Unlock()
+
+	return g.client.Enqueue(GroupIdentify{
+		Type:       g.groupType,
+		Key:        g.key,
+		Properties: properties,
+	})
+}
+
+// Returns the value of a feature flag for a user of the group.
+func (g *Group) GetFeatureFlag(key string, distinctId string) (interface{}, error) {
+	return g.client.GetFeatureFlag(FeatureFlagPayload{
+		Key:             key,
+		DistinctId:      distinctId,
+		Groups:          g.groups(),
+		GroupProperties: g.groupProperties(),
+	})
+}
+
+// Reports whether a feature flag is enabled for a user of the group, nil
+// means the flag is undefined (see Client.IsFeatureEnabled).
+func (g *Group) IsFeatureEnabled(key string, distinctId string) (*bool, error) {
+	value, err := g.GetFeatureFlag(key, distinctId)
+	if err != nil {
+		return nil, err
+	}
+	return flagEnabled(value), nil
+}
+
+// Returns the values of all feature flags for a user of the group.
+func (g *Group) GetAllFlags(distinctId string) (map[string]interface{}, error) {
+	return g.client.GetAllFlags(FeatureFlagPayloadNoKey{
+		DistinctId:      distinctId,
+		Groups:          g.groups(),
+		GroupProperties: g.groupProperties(),
+	})
+}
+
+// Returns a handle on a user of the group, its events are attached to the
+// group and its flags evaluated with it.
+func (g *Group) ForUser(distinctId string) *User {
+	u := newUser(g.client, distinctId)
+	u.group = g
+	return u
+}
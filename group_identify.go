@@ -10,6 +10,9 @@ type GroupIdentify struct {
 	Key  string
 
 	DistinctId string
+
+	// The unique identifier of the message, generated by Enqueue when empty.
+	Uuid       string
 	Timestamp  time.Time
 	Properties Properties
 }
@@ -42,6 +45,7 @@ type GroupIdentifyInApi struct {
 	Library        string    `json:"library"`
 	LibraryVersion string    `json:"library_version"`
 	Timestamp      time.Time `json:"timestamp"`
+	Uuid           string    `json:"uuid,omitempty"`
 
 	Event      string     `json:"event"`
 	DistinctId string     `json:"distinct_id"`
@@ -61,6 +65,7 @@ func (msg GroupIdentify) APIfy() APIMessage {
 		Properties:     myProperties,
 		DistinctId:     distinctId,
 		Timestamp:      msg.Timestamp,
+		Uuid:           msg.Uuid,
 		Library:        library,
 		LibraryVersion: getVersion(),
 	}
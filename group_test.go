@@ -0,0 +1,64 @@
+package posthog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientForGroup(t *testing.T) {
+	captures := make(chan CaptureInApi, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-flag-group-properties.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/batch") {
+			var b struct{ Batch []CaptureInApi }
+			json.NewDecoder(r.Body).Decode(&b)
+			for _, m := range b.Batch {
+				if m.Event == "report_exported" {
+					captures <- m
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+
+	group := client.ForGroup("company", "amazon_without_rollout")
+
+	if err := group.Identify(NewProperties().Set("name", "Project Name 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled, err := group.IsFeatureEnabled("group-flag", "some-distinct-id")
+	if err != nil || enabled == nil || !*enabled {
+		t.Errorf("expected the flag to match the group properties, got %v %v", enabled, err)
+	}
+
+	user := group.ForUser("some-distinct-id")
+
+	enabled, err = user.IsFeatureEnabled("group-flag")
+	if err != nil || enabled == nil || !*enabled {
+		t.Errorf("expected the flag to match for users of the group, got %v %v", enabled, err)
+	}
+
+	group.Capture("some-distinct-id", "report_exported", nil)
+	user.Capture("report_exported", nil)
+	client.Close()
+
+	for i := 0; i != 2; i++ {
+		m := <-captures
+		groups, _ := m.Properties["$groups"].(map[string]interface{})
+		if groups["company"] != "amazon_without_rollout" {
+			t.Errorf("expected the capture to be attached to the group, got %+v", m.Properties)
+		}
+	}
+}
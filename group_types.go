@@ -0,0 +1,46 @@
+package posthog
+
+import (
+	"context"
+)
+
+// A GroupType of the project, returned by Client.GetGroupTypes.
+type GroupType struct {
+	// The name of the type used in Groups and GroupIdentify, like "company".
+	Type string `json:"group_type"`
+
+	// The index of the type, flags rolled out by group reference their type
+	// by index.
+	Index int `json:"group_type_index"`
+
+	// The names of the type shown in the PostHog UI, empty unless set.
+	NameSingular string `json:"name_singular"`
+	NamePlural   string `json:"name_plural"`
+}
+
+func (c *client) GetGroupTypes(ctx context.Context) ([]GroupType, error) {
+	if c.featureFlagsPoller != nil {
+		poller := c.featureFlagsPoller
+		poller.mutex.RLock()
+		groupTypes, fetched := poller.groupTypes, poller.groupTypesFetched
+		poller.mutex.RUnlock()
+
+		if groupTypes != nil && c.now().Sub(fetched) < poller.pollingInterval {
+			return groupTypes, nil
+		}
+	}
+
+	var groupTypes []GroupType
+	if err := c.projectRequest(ctx, "GET", "groups_types/", nil, &groupTypes); err != nil {
+		return nil, err
+	}
+	if groupTypes == nil {
+		groupTypes = []GroupType{}
+	}
+
+	poller := c.featureFlagsPoller
+	poller.mutex.Lock()
+	poller.groupTypes, poller.groupTypesFetched = groupTypes, c.now()
+	poller.mutex.Unlock()
+	return groupTypes, nil
+}
@@ -0,0 +1,48 @@
+package posthog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetGroupTypes(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/projects/@current/groups_types/":
+			atomic.AddInt32(&requests, 1)
+			w.Write([]byte(`[{"group_type": "company", "group_type_index": 0, "name_singular": "Company", "name_plural": "Companies"}, {"group_type": "project", "group_type_index": 1, "name_singular": null, "name_plural": null}]`))
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+	})
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		groupTypes, err := client.GetGroupTypes(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []GroupType{
+			{Type: "company", Index: 0, NameSingular: "Company", NamePlural: "Companies"},
+			{Type: "project", Index: 1},
+		}
+		if len(groupTypes) != 2 || groupTypes[0] != expected[0] || groupTypes[1] != expected[1] {
+			t.Errorf("expected %v, got %v", expected, groupTypes)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected the group types to be cached, got %d requests", n)
+	}
+}
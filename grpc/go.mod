@@ -0,0 +1,19 @@
+module github.com/posthog/posthog-go/grpc
+
+go 1.21
+
+require (
+	github.com/posthog/posthog-go v0.0.0
+	google.golang.org/grpc v1.63.2
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/net v0.24.0 // indirect
+	golang.org/x/sys v0.19.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240401170217-c3f982113cda // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+replace github.com/posthog/posthog-go => ../
@@ -0,0 +1,181 @@
+// Package posthoggrpc provides gRPC server interceptors reading the identity
+// of the caller from the metadata of the RPCs, so handlers evaluate flags and
+// capture events through the context like HTTP handlers do.
+//
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(posthoggrpc.UnaryServerInterceptor(client, posthoggrpc.Options{CaptureRPCs: true})),
+//		grpc.ChainStreamInterceptor(posthoggrpc.StreamServerInterceptor(client, posthoggrpc.Options{CaptureRPCs: true})),
+//	)
+//
+// Handlers then use the Ctx methods of the client, which fall back to the
+// identity of the context (see posthog.NewContext):
+//
+//	enabled, err := client.IsFeatureEnabledCtx(ctx, posthog.FeatureFlagPayload{Key: "new-checkout"})
+//
+// By default the identity is read from the metadata of the RPCs, see
+// DistinctIdKey and GroupKeyPrefix. The metadata is set by the caller and
+// isn't authenticated, so any caller can impersonate any user and group: it is
+// only suitable for RPCs between trusted services. Servers with untrusted
+// callers must set Options.Identity to derive the identity from authenticated
+// credentials, like the claims of a verified token:
+//
+//	posthoggrpc.Options{
+//		Identity: func(ctx context.Context) (string, posthog.Groups) {
+//			claims := auth.ClaimsFromContext(ctx)
+//			return claims.Subject, posthog.NewGroups().Set("company", claims.Organization)
+//		},
+//	}
+package posthoggrpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/posthog/posthog-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DistinctIdKey is the metadata key the distinct ID of the caller is read
+// from when Options.Identity is not set.
+const DistinctIdKey = "x-posthog-distinct-id"
+
+// GroupKeyPrefix is the prefix of the metadata keys the groups of the caller
+// are read from when Options.Identity is not set, followed by the group type:
+// `x-posthog-group-company: acme`.
+const GroupKeyPrefix = "x-posthog-group-"
+
+// DefaultEvent is the name of the events captured when Options.Event is not
+// set.
+const DefaultEvent = "grpc_request"
+
+// Options configures the interceptors.
+type Options struct {
+	// Returns the identity of the caller of an RPC, it is read from the
+	// metadata of the RPC if nil, which trusts the caller to tell who they
+	// are (see the package documentation). RPCs without distinct ID are
+	// handled without identity in their context.
+	Identity func(ctx context.Context) (distinctId string, groups posthog.Groups)
+
+	// When set, an event is captured per RPC with its method, status code
+	// and duration. RPCs without distinct ID are not captured. RPCs are
+	// sampled with a child client, see posthog.WithSampleRate.
+	CaptureRPCs bool
+
+	// Name of the captured events, DefaultEvent is used if empty.
+	Event string
+
+	// Properties added to every captured event, like the name of the service.
+	Properties posthog.Properties
+}
+
+type interceptor struct {
+	client posthog.Client
+	opts   Options
+}
+
+func newInterceptor(client posthog.Client, opts Options) *interceptor {
+	if opts.Event == "" {
+		opts.Event = DefaultEvent
+	}
+	if opts.Identity == nil {
+		opts.Identity = identityFromMetadata
+	}
+	return &interceptor{client: client, opts: opts}
+}
+
+// UnaryServerInterceptor returns an interceptor adding the identity of the
+// caller to the context of unary RPCs.
+func UnaryServerInterceptor(client posthog.Client, opts Options) grpc.UnaryServerInterceptor {
+	i := newInterceptor(client, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = i.withIdentity(ctx)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		i.capture(ctx, info.FullMethod, false, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor adding the identity of the
+// caller to the context of streaming RPCs.
+func StreamServerInterceptor(client posthog.Client, opts Options) grpc.StreamServerInterceptor {
+	i := newInterceptor(client, opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := i.withIdentity(ss.Context())
+		start := time.Now()
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		i.capture(ctx, info.FullMethod, true, start, err)
+		return err
+	}
+}
+
+func (i *interceptor) withIdentity(ctx context.Context) context.Context {
+	distinctId, groups := i.opts.Identity(ctx)
+	if distinctId == "" {
+		return ctx
+	}
+	return posthog.NewContext(ctx, distinctId, groups)
+}
+
+func (i *interceptor) capture(ctx context.Context, method string, stream bool, start time.Time, err error) {
+	if !i.opts.CaptureRPCs {
+		return
+	}
+	distinctId, groups, ok := posthog.FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	properties := posthog.NewProperties().
+		Merge(i.opts.Properties).
+		Set("grpc_method", method).
+		Set("grpc_code", status.Code(err).String()).
+		Set("grpc_stream", stream).
+		Set("duration_ms", time.Since(start).Milliseconds())
+
+	i.client.Enqueue(posthog.Capture{
+		DistinctId: distinctId,
+		Event:      i.opts.Event,
+		Properties: properties,
+		Groups:     groups,
+	})
+}
+
+// Reads the identity of the caller from the incoming metadata, see
+// DistinctIdKey and GroupKeyPrefix.
+func identityFromMetadata(ctx context.Context) (string, posthog.Groups) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+
+	distinctId := ""
+	if values := md.Get(DistinctIdKey); len(values) != 0 {
+		distinctId = values[0]
+	}
+
+	var groups posthog.Groups
+	for key, values := range md {
+		if !strings.HasPrefix(key, GroupKeyPrefix) || len(values) == 0 {
+			continue
+		}
+		if groups == nil {
+			groups = posthog.NewGroups()
+		}
+		groups.Set(strings.TrimPrefix(key, GroupKeyPrefix), values[0])
+	}
+	return distinctId, groups
+}
+
+// A server stream whose context carries the identity of the caller.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
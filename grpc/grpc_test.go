@@ -0,0 +1,110 @@
+package posthoggrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testClient struct {
+	posthog.Client
+	mutex sync.Mutex
+	msgs  []posthog.Capture
+}
+
+func (c *testClient) Enqueue(msg posthog.Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.msgs = append(c.msgs, msg.(posthog.Capture))
+	return nil
+}
+
+func incomingContext(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	client := &testClient{}
+	interceptor := UnaryServerInterceptor(client, Options{CaptureRPCs: true, Properties: posthog.Properties{"service": "billing"}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/billing.Invoices/Get"}
+
+	ctx := incomingContext(DistinctIdKey, "user", GroupKeyPrefix+"company", "acme")
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		distinctId, groups, ok := posthog.FromContext(ctx)
+		if !ok || distinctId != "user" || groups["company"] != "acme" {
+			t.Errorf("expected the identity in the context, got %q %v %v", distinctId, groups, ok)
+		}
+		return nil, status.Error(codes.NotFound, "no such invoice")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected the error of the handler, got %v", err)
+	}
+
+	if len(client.msgs) != 1 {
+		t.Fatalf("expected the RPC to be captured, got %v", client.msgs)
+	}
+	msg := client.msgs[0]
+	p := msg.Properties
+	if msg.Event != DefaultEvent || msg.DistinctId != "user" || msg.Groups["company"] != "acme" {
+		t.Errorf("unexpected event: %#v", msg)
+	}
+	if p["grpc_method"] != "/billing.Invoices/Get" || p["grpc_code"] != "NotFound" || p["grpc_stream"] != false || p["service"] != "billing" {
+		t.Errorf("unexpected properties: %v", p)
+	}
+}
+
+func TestUnaryServerInterceptorAnonymous(t *testing.T) {
+	client := &testClient{}
+	interceptor := UnaryServerInterceptor(client, Options{CaptureRPCs: true})
+
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if _, _, ok := posthog.FromContext(ctx); ok {
+			t.Error("expected no identity without metadata")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.msgs) != 0 {
+		t.Errorf("expected RPCs without distinct ID not to be captured, got %v", client.msgs)
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	client := &testClient{}
+	interceptor := StreamServerInterceptor(client, Options{
+		Identity: func(ctx context.Context) (string, posthog.Groups) {
+			return "service-account", nil
+		},
+	})
+
+	stream := &testServerStream{ctx: context.Background()}
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/billing.Invoices/Watch"}, func(srv interface{}, ss grpc.ServerStream) error {
+		if distinctId, _, _ := posthog.FromContext(ss.Context()); distinctId != "service-account" {
+			t.Errorf("expected the identity in the context of the stream, got %q", distinctId)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.msgs) != 0 {
+		t.Errorf("expected RPCs not to be captured by default, got %v", client.msgs)
+	}
+}
@@ -0,0 +1,188 @@
+package posthog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The maximum number of redirects followed by the client before giving up.
+const maxRedirects = 5
+
+// Returned when the PostHog API responds with a status outside of the 2xx
+// range.
+type APIError struct {
+
+	// The HTTP status code of the response.
+	Status int
+
+	// The body of the response, it usually contains the reason why the
+	// request was rejected.
+	Body string
+
+	// How long the server asked to wait before sending requests again, from
+	// the Retry-After header. Zero when the header is missing.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Body)
+}
+
+// Retryable reports whether sending the same request again may succeed, which
+// is the case for timeouts, rate limiting and server errors. Other statuses
+// mean the request itself is invalid and must not be retried.
+func (e *APIError) Retryable() bool {
+	return isRetryableStatus(e.Status)
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// Reports whether an error returned by doRequest may be resolved by retrying
+// the request, transport errors are always considered transient.
+func isRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	return true
+}
+
+func newAPIError(res *http.Response, body string) *APIError {
+	return &APIError{
+		Status:     res.StatusCode,
+		Body:       body,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// Parses the value of a Retry-After header, either a number of seconds or an
+// HTTP date. Zero is returned for missing, invalid or past values.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func makeHttpClient(transport http.RoundTripper) http.Client {
+	httpClient := http.Client{
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+	if supportsTimeout(transport) {
+		httpClient.Timeout = 10 * time.Second
+	}
+	return httpClient
+}
+
+// Limits the number of redirects and refuses to downgrade from HTTPS to HTTP,
+// which would send API keys in clear text.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing to follow redirect from %s to %s", via[0].URL, req.URL)
+	}
+	return nil
+}
+
+// Sends a request to the PostHog API and reads the whole response body, the
+// response is always closed when the function returns.
+// The error is nil only for 2xx responses, responses with other statuses
+// return an *APIError carrying the body. The status is 0 when no response was
+// received.
+func doRequest(ctx context.Context, httpClient *http.Client, method string, url string, body []byte, headers [][2]string) (status int, resBody []byte, err error) {
+	res, err := sendRequest(ctx, httpClient, method, url, body, headers)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	if resBody, err = ioutil.ReadAll(res.Body); err != nil {
+		return res.StatusCode, nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, resBody, newAPIError(res, string(resBody))
+	}
+
+	return res.StatusCode, resBody, nil
+}
+
+// Sends a request to the PostHog API and decodes the JSON response into v as
+// it is read, instead of buffering the whole body first. A gzip encoded
+// response is requested and decompressed on the fly, which matters for large
+// downloads like flag definitions. The response headers are returned for
+// caching, a 304 response isn't an error and leaves v untouched.
+// Errors are reported like doRequest does, an error returned along with a 2xx
+// status means the response body couldn't be read or decoded.
+func doStreamRequest(ctx context.Context, httpClient *http.Client, method string, url string, body []byte, headers [][2]string, v interface{}) (status int, header http.Header, err error) {
+	// Setting the header explicitly disables the transparent decompression of
+	// the transport, the response is decompressed below instead so it works
+	// the same way with custom transports.
+	headers = append([][2]string{{"Accept-Encoding", "gzip"}}, headers...)
+
+	res, err := sendRequest(ctx, httpClient, method, url, body, headers)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return res.StatusCode, res.Header, nil
+	}
+
+	var r io.Reader = res.Body
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return res.StatusCode, res.Header, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := ioutil.ReadAll(r)
+		return res.StatusCode, res.Header, newAPIError(res, string(resBody))
+	}
+
+	return res.StatusCode, res.Header, decodeJSON(r, v)
+}
+
+func sendRequest(ctx context.Context, httpClient *http.Client, method string, url string, body []byte, headers [][2]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("User-Agent", "posthog-go (version: "+getVersion()+")")
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Content-Length", fmt.Sprintf("%d", len(body)))
+
+	for _, header := range headers {
+		req.Header.Add(header[0], header[1])
+	}
+
+	return httpClient.Do(req)
+}
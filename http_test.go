@@ -0,0 +1,168 @@
+package posthog
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusTemporaryRedirect)
+		case "/ok":
+			w.Write([]byte("ok"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid payload"))
+		}
+	}))
+	defer server.Close()
+
+	httpClient := makeHttpClient(http.DefaultTransport)
+
+	status, body, err := doRequest(context.Background(), &httpClient, "POST", server.URL+"/moved", []byte("{}"), nil)
+	if err != nil || status != http.StatusOK || string(body) != "ok" {
+		t.Errorf("expected redirect to be followed, got %d %q %v", status, body, err)
+	}
+
+	status, body, err = doRequest(context.Background(), &httpClient, "POST", server.URL+"/invalid", []byte("{}"), nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Body != "invalid payload" {
+		t.Errorf("expected an APIError, got %d %q %v", status, body, err)
+	}
+
+	if isRetryable(err) {
+		t.Error("400 responses must not be retried")
+	}
+}
+
+func TestDoRequestTransportError(t *testing.T) {
+	httpClient := makeHttpClient(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, testError
+	}))
+
+	status, body, err := doRequest(context.Background(), &httpClient, "GET", "http://localhost/", nil, nil)
+	if !errors.Is(err, testError) || status != 0 || body != nil {
+		t.Errorf("expected the transport error to be returned, got %d %q %v", status, body, err)
+	}
+
+	if !isRetryable(err) {
+		t.Error("transport errors should be retried")
+	}
+}
+
+func TestDoStreamRequestGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("expected a gzip encoded response to be requested, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		if r.URL.Path == "/ok" {
+			gz.Write([]byte(`{"count": 12345678901234567890}`))
+		} else {
+			gz.Write([]byte("try again later"))
+		}
+	}))
+	defer server.Close()
+
+	httpClient := makeHttpClient(http.DefaultTransport)
+
+	var v map[string]interface{}
+	status, _, err := doStreamRequest(context.Background(), &httpClient, "GET", server.URL+"/ok", nil, nil, &v)
+	if err != nil || status != http.StatusOK || v["count"] != json.Number("12345678901234567890") {
+		t.Errorf("expected the response to be decompressed and decoded, got %d %v %v", status, v, err)
+	}
+
+	status, _, err = doStreamRequest(context.Background(), &httpClient, "GET", server.URL+"/unavailable", nil, nil, &v)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable || apiErr.Body != "try again later" {
+		t.Errorf("expected an APIError, got %d %v", status, err)
+	}
+}
+
+func TestCheckRedirectRefusesDowngrade(t *testing.T) {
+	from, _ := http.NewRequest("GET", "https://app.posthog.com/decide/", nil)
+	to, _ := http.NewRequest("GET", "http://app.posthog.com/decide/", nil)
+
+	if err := checkRedirect(to, []*http.Request{from}); err == nil {
+		t.Error("expected redirects from https to http to be refused")
+	}
+}
+
+func TestRetryableStatuses(t *testing.T) {
+	for status, retryable := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		if isRetryableStatus(status) != retryable {
+			t.Errorf("expected status %d retryable to be %v", status, retryable)
+		}
+	}
+}
+
+func TestClientDoesNotRetryRejectedBatches(t *testing.T) {
+	var requests int32
+	errchan := make(chan error, 1)
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Logger: testLogger{t.Logf, t.Logf},
+		Callback: testCallback{
+			nil,
+			func(m APIMessage, e error) { errchan <- e },
+		},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&requests, 1)
+			return testTransportBadRequest(r)
+		}),
+		BatchSize:  1,
+		RetryAfter: func(i int) time.Duration { return time.Millisecond },
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "A", Event: "B"})
+
+	var apiErr *APIError
+	if err := <-errchan; !errors.As(err, &apiErr) {
+		t.Errorf("expected an APIError, got %v", err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected rejected batch to be sent once, got %d requests", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Tue, 02 Jan 2024 03:05:05 GMT": time.Minute,
+		"Tue, 02 Jan 2024 03:00:00 GMT": 0,
+	}
+
+	for value, expected := range tests {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Errorf("parseRetryAfter(%q) = %s, expected %s", value, d, expected)
+		}
+	}
+}
@@ -11,6 +11,9 @@ type Identify struct {
 	Type string
 
 	DistinctId string
+
+	// The unique identifier of the message, generated by Enqueue when empty.
+	Uuid       string
 	Timestamp  time.Time
 	Properties Properties
 }
@@ -20,12 +23,8 @@ func (msg Identify) internal() {
 }
 
 func (msg Identify) Validate() error {
-	if len(msg.DistinctId) == 0 {
-		return FieldError{
-			Type:  "posthog.Identify",
-			Name:  "DistinctId",
-			Value: msg.DistinctId,
-		}
+	if err := validateDistinctId("posthog.Identify", "DistinctId", msg.DistinctId); err != nil {
+		return err
 	}
 
 	return nil
@@ -36,6 +35,7 @@ type IdentifyInApi struct {
 	Library        string    `json:"library"`
 	LibraryVersion string    `json:"library_version"`
 	Timestamp      time.Time `json:"timestamp"`
+	Uuid           string    `json:"uuid,omitempty"`
 
 	Event      string     `json:"event"`
 	DistinctId string     `json:"distinct_id"`
@@ -54,6 +54,7 @@ func (msg Identify) APIfy() APIMessage {
 		Library:        library,
 		LibraryVersion: getVersion(),
 		Timestamp:      msg.Timestamp,
+		Uuid:           msg.Uuid,
 		DistinctId:     msg.DistinctId,
 
 		Properties: myProperties,
@@ -0,0 +1,83 @@
+package posthog
+
+import (
+	"context"
+)
+
+type identityContextKey struct{}
+
+// The identity carried by a context, see NewContext.
+type contextIdentity struct {
+	distinctId string
+	groups     Groups
+}
+
+// NewContext returns a copy of ctx carrying the distinct ID and the groups of
+// the user it is handled for, replacing the ones of ctx. Middlewares set it
+// once per request so deeper code doesn't have to pass the identity around:
+// the messages enqueued with Client.EnqueueCtx and the flags evaluated with
+// the Ctx methods of the client use it when they have no distinct ID of their
+// own. The groups of the context are only used along with its distinct ID.
+func NewContext(ctx context.Context, distinctId string, groups Groups) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, contextIdentity{distinctId: distinctId, groups: groups})
+}
+
+// FromContext returns the distinct ID and the groups carried by ctx, ok is
+// false when ctx was not created by NewContext.
+func FromContext(ctx context.Context) (distinctId string, groups Groups, ok bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(contextIdentity)
+	return identity.distinctId, identity.groups, ok
+}
+
+// Fills the distinct ID and the groups missing from the payload with the ones
+// of the context. The groups of the context belong to its user, they are only
+// used when the distinct ID is taken from the context too.
+func (c *FeatureFlagPayload) fromContext(ctx context.Context) {
+	if distinctId, groups, ok := FromContext(ctx); ok && c.DistinctId == "" {
+		c.DistinctId = distinctId
+		if c.Groups == nil {
+			c.Groups = groups
+		}
+	}
+}
+
+func (c *FeatureFlagPayloadNoKey) fromContext(ctx context.Context) {
+	if distinctId, groups, ok := FromContext(ctx); ok && c.DistinctId == "" {
+		c.DistinctId = distinctId
+		if c.Groups == nil {
+			c.Groups = groups
+		}
+	}
+}
+
+// Fills the distinct ID and the groups missing from captures, and the
+// distinct ID missing from identifies, with the ones of the context. Like for
+// payloads, groups are only filled along with the distinct ID.
+func messageFromContext(ctx context.Context, msg Message) Message {
+	distinctId, groups, ok := FromContext(ctx)
+	if !ok {
+		return msg
+	}
+
+	switch m := msg.(type) {
+	case Capture:
+		if m.DistinctId == "" {
+			m.DistinctId = distinctId
+			if m.Groups == nil {
+				m.Groups = groups
+			}
+		}
+		return m
+	case Identify:
+		m.DistinctId = orDefault(m.DistinctId, distinctId)
+		return m
+	}
+	return msg
+}
+
+func orDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,82 @@
+package posthog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewContext(t *testing.T) {
+	if _, _, ok := FromContext(context.Background()); ok {
+		t.Error("expected no identity in a background context")
+	}
+
+	ctx := NewContext(context.Background(), "user", Groups{"company": "acme"})
+	distinctId, groups, ok := FromContext(ctx)
+	if !ok || distinctId != "user" || !reflect.DeepEqual(groups, Groups{"company": "acme"}) {
+		t.Errorf("unexpected identity: %q %v %v", distinctId, groups, ok)
+	}
+
+	msg := messageFromContext(ctx, Capture{Event: "signed_up"}).(Capture)
+	if msg.DistinctId != "user" || msg.Groups["company"] != "acme" {
+		t.Errorf("expected the identity of the context, got %#v", msg)
+	}
+
+	msg = messageFromContext(ctx, Capture{Event: "signed_up", DistinctId: "other", Groups: Groups{}}).(Capture)
+	if msg.DistinctId != "other" || len(msg.Groups) != 0 {
+		t.Errorf("expected the identity of the message to win, got %#v", msg)
+	}
+
+	msg = messageFromContext(ctx, Capture{Event: "signed_up", DistinctId: "other"}).(Capture)
+	if msg.DistinctId != "other" || msg.Groups != nil {
+		t.Errorf("expected the groups of the context not to be used for another user, got %#v", msg)
+	}
+
+	payload := FeatureFlagPayload{Key: "flag", DistinctId: "other"}
+	payload.fromContext(ctx)
+	if payload.DistinctId != "other" || payload.Groups != nil {
+		t.Errorf("expected the groups of the context not to be used for another user, got %#v", payload)
+	}
+}
+
+func TestFlagsEvaluatedWithContextIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:              server.URL,
+		PersonalApiKey:        "some very secret key",
+		SendFeatureFlagEvents: new(bool),
+	})
+	defer client.Close()
+
+	if err := client.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext(context.Background(), "some-distinct-id", nil)
+	for _, distinctId := range []string{"some-distinct-id", "another-distinct-id"} {
+		expected, _ := client.GetFeatureFlag(FeatureFlagPayload{Key: "simple-flag", DistinctId: distinctId, OnlyEvaluateLocally: true})
+		flagConfig := FeatureFlagPayload{Key: "simple-flag", OnlyEvaluateLocally: true}
+		if distinctId != "some-distinct-id" {
+			flagConfig.DistinctId = distinctId
+		}
+		if value, err := client.GetFeatureFlagCtx(ctx, flagConfig); err != nil || value != expected {
+			t.Errorf("%s: expected %v, got %v %v", distinctId, expected, value, err)
+		}
+	}
+
+	if _, err := client.GetAllFlagsCtx(ctx, FeatureFlagPayloadNoKey{OnlyEvaluateLocally: true}); err != nil {
+		t.Errorf("expected the distinct ID of the context to be used, got %v", err)
+	}
+	if _, err := client.GetFeatureFlagCtx(context.Background(), FeatureFlagPayload{Key: "simple-flag"}); err == nil {
+		t.Error("expected a distinct ID to be required without identity in the context")
+	}
+}
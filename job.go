@@ -0,0 +1,84 @@
+package posthog
+
+import (
+	"fmt"
+	"time"
+)
+
+// JobRecorder captures the lifecycle events of one run of a background job,
+// it is returned by InstrumentJob.
+//
+//	job := posthog.InstrumentJob(client, "send_invoices", "system")
+//	job.Start(nil)
+//	if err := sendInvoices(); err != nil {
+//		job.Fail(err, nil)
+//		return
+//	}
+//	job.Finish(posthog.NewProperties().Set("invoices", n))
+//
+// All events of a run share a `job_run_id` property so they can be joined in
+// PostHog.
+type JobRecorder struct {
+	client     Client
+	name       string
+	distinctId string
+	runId      string
+	started    time.Time
+	now        func() time.Time
+}
+
+// InstrumentJob returns a recorder for a run of the job called name, events
+// are captured with distinctId.
+func InstrumentJob(client Client, name string, distinctId string) *JobRecorder {
+	job := &JobRecorder{
+		client:     client,
+		name:       name,
+		distinctId: distinctId,
+		runId:      uid(),
+		now:        time.Now,
+	}
+	job.started = job.now()
+	return job
+}
+
+// Start captures a `job_started` event and resets the start time used to
+// compute the duration of the run.
+func (j *JobRecorder) Start(properties Properties) error {
+	j.started = j.now()
+	return j.capture("job_started", properties, nil)
+}
+
+// Finish captures a `job_completed` event with the duration of the run.
+func (j *JobRecorder) Finish(properties Properties) error {
+	return j.capture("job_completed", properties, func(p Properties) {
+		p.Set("duration_ms", j.now().Sub(j.started).Milliseconds())
+	})
+}
+
+// Fail captures a `job_failed` event with the duration of the run and the
+// message and type of err.
+func (j *JobRecorder) Fail(err error, properties Properties) error {
+	return j.capture("job_failed", properties, func(p Properties) {
+		p.Set("duration_ms", j.now().Sub(j.started).Milliseconds())
+		if err != nil {
+			p.Set("error", err.Error()).Set("error_type", fmt.Sprintf("%T", err))
+		}
+	})
+}
+
+func (j *JobRecorder) capture(event string, properties Properties, set func(Properties)) error {
+	p := NewProperties()
+	for k, v := range properties {
+		p[k] = v
+	}
+	p.Set("job_name", j.name).Set("job_run_id", j.runId)
+	if set != nil {
+		set(p)
+	}
+
+	return j.client.Enqueue(Capture{
+		DistinctId: j.distinctId,
+		Event:      event,
+		Properties: p,
+	})
+}
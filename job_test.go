@@ -0,0 +1,60 @@
+package posthog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testEnqueueClient struct {
+	Client
+	msgs []Message
+}
+
+func (c *testEnqueueClient) Enqueue(msg Message) error {
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+func (c *testEnqueueClient) Flush() error {
+	return nil
+}
+
+func TestInstrumentJob(t *testing.T) {
+	client := &testEnqueueClient{}
+
+	clock := mockTime()
+	job := InstrumentJob(client, "send_invoices", "system")
+	job.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	job.Start(nil)
+	job.Fail(errors.New("smtp unavailable"), NewProperties().Set("attempt", 2))
+	job.Finish(nil)
+
+	if len(client.msgs) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(client.msgs))
+	}
+
+	started := client.msgs[0].(Capture)
+	failed := client.msgs[1].(Capture)
+	completed := client.msgs[2].(Capture)
+
+	if started.Event != "job_started" || failed.Event != "job_failed" || completed.Event != "job_completed" {
+		t.Errorf("invalid event names: %s %s %s", started.Event, failed.Event, completed.Event)
+	}
+
+	if started.Properties["job_run_id"] != failed.Properties["job_run_id"] || started.Properties["job_name"] != "send_invoices" {
+		t.Errorf("invalid job properties: %v", started.Properties)
+	}
+
+	if failed.Properties["duration_ms"] != int64(1000) || failed.Properties["error"] != "smtp unavailable" || failed.Properties["error_type"] != "*errors.errorString" || failed.Properties["attempt"] != 2 {
+		t.Errorf("invalid job_failed properties: %v", failed.Properties)
+	}
+
+	if completed.Properties["duration_ms"] != int64(2000) || completed.DistinctId != "system" {
+		t.Errorf("invalid job_completed event: %+v", completed)
+	}
+}
@@ -1,10 +1,27 @@
 package posthog
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"reflect"
 	"strings"
 )
 
+// Decodes API responses keeping numbers as json.Number instead of float64, so
+// large integers don't lose precision and property values can be compared
+// with the exact representation sent by the server.
+func unmarshalJSON(data []byte, v interface{}) error {
+	return decodeJSON(bytes.NewReader(data), v)
+}
+
+// Same as unmarshalJSON but reads the value from r as it is decoded.
+func decodeJSON(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
 // Imitate what what the JSON package would do when serializing a struct value,
 // the only difference is we we don't serialize zero-value struct fields as well.
 // Note that this function doesn't recursively convert structures to maps, only
@@ -0,0 +1,12 @@
+module github.com/posthog/posthog-go/lambda
+
+go 1.19
+
+require (
+	github.com/aws/aws-lambda-go v1.47.0
+	github.com/posthog/posthog-go v0.0.0
+)
+
+require github.com/google/uuid v1.3.0 // indirect
+
+replace github.com/posthog/posthog-go => ../
@@ -0,0 +1,89 @@
+// Package posthoglambda wraps AWS Lambda handlers so events captured during an
+// invocation are delivered before the execution environment is frozen.
+//
+//	func main() {
+//		client, _ := posthoglambda.Shared(apiKey, posthog.Config{})
+//		lambda.Start(posthoglambda.Wrap(client, handle))
+//	}
+//
+// Lambda freezes the environment as soon as the handler returns, so batches
+// flushed in the background are either delayed until the next invocation or
+// lost when the environment is recycled. The wrapped handler flushes the
+// client synchronously before returning instead.
+package posthoglambda
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/posthog/posthog-go"
+)
+
+var shared struct {
+	once   sync.Once
+	client posthog.Client
+	err    error
+}
+
+// Shared returns the client shared by all invocations served by the current
+// execution environment, it is created on first call and later calls return
+// the same client regardless of their arguments.
+//
+// The client is closed when the runtime receives SIGTERM, which Lambda sends
+// before shutting down environments that have extensions registered.
+func Shared(apiKey string, config posthog.Config) (posthog.Client, error) {
+	shared.once.Do(func() {
+		shared.client, shared.err = posthog.NewWithConfig(apiKey, config)
+		if shared.err != nil {
+			return
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM)
+		go func() {
+			<-sig
+			shared.client.Close()
+		}()
+	})
+	return shared.client, shared.err
+}
+
+type handler struct {
+	client posthog.Client
+	next   lambda.Handler
+}
+
+// Wrap returns a lambda.Handler invoking h, which may be any value accepted by
+// lambda.Start, and flushing client before returning, even if h panics.
+//
+// If the invocation deadline expires before the flush completes the handler
+// returns anyway and the remaining messages are sent in a later invocation.
+func Wrap(client posthog.Client, h interface{}) lambda.Handler {
+	next, ok := h.(lambda.Handler)
+	if !ok {
+		next = lambda.NewHandler(h)
+	}
+	return &handler{client: client, next: next}
+}
+
+func (h *handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	defer h.flush(ctx)
+	return h.next.Invoke(ctx, payload)
+}
+
+func (h *handler) flush(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.client.Flush()
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,88 @@
+package posthoglambda
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/posthog/posthog-go"
+)
+
+type testClient struct {
+	posthog.Client
+	msgs    []posthog.Message
+	flushed []posthog.Message
+	block   chan struct{}
+}
+
+func (c *testClient) Enqueue(msg posthog.Message) error {
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+func (c *testClient) Flush() error {
+	if c.block != nil {
+		<-c.block
+	}
+	c.flushed = append(c.flushed, c.msgs...)
+	c.msgs = nil
+	return nil
+}
+
+func TestWrapFlushesBeforeReturning(t *testing.T) {
+	client := &testClient{}
+	h := Wrap(client, func(ctx context.Context, ev map[string]string) (string, error) {
+		client.Enqueue(posthog.Capture{DistinctId: ev["user"], Event: "invoked"})
+		return "ok", nil
+	})
+
+	res, err := h.Invoke(context.Background(), []byte(`{"user":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != `"ok"` {
+		t.Errorf("unexpected response: %s", res)
+	}
+	if len(client.flushed) != 1 || len(client.msgs) != 0 {
+		t.Errorf("expected the event to be flushed before returning, flushed %d pending %d", len(client.flushed), len(client.msgs))
+	}
+}
+
+func TestWrapFlushesOnError(t *testing.T) {
+	client := &testClient{}
+	failure := errors.New("failure")
+	h := Wrap(client, func(ctx context.Context) error {
+		client.Enqueue(posthog.Capture{DistinctId: "1", Event: "invoked"})
+		return failure
+	})
+
+	if _, err := h.Invoke(context.Background(), []byte(`{}`)); err == nil {
+		t.Fatal("expected the handler error to be returned")
+	}
+	if len(client.flushed) != 1 {
+		t.Errorf("expected the event to be flushed when the handler fails, flushed %d", len(client.flushed))
+	}
+}
+
+func TestWrapStopsFlushingAtDeadline(t *testing.T) {
+	client := &testClient{block: make(chan struct{})}
+	defer close(client.block)
+
+	h := Wrap(client, func(ctx context.Context) error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		h.Invoke(ctx, []byte(`{}`))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the handler to return once the deadline expired")
+	}
+}
@@ -1,8 +1,10 @@
 package posthog
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 // Instances of types implementing this interface can be used to define where
@@ -22,6 +24,50 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 }
 
+// Severity of a log entry passed to loggers implementing the LeveledLogger
+// interface.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// A key/value pair attached to a log entry, like the endpoint a request was
+// sent to or the key of the feature flag being evaluated.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Loggers that also implement this interface receive every log entry of the
+// client through the Log method, with an explicit level and structured fields
+// instead of a preformatted message. This is what adapters for structured
+// logging libraries are expected to implement.
+//
+// Debug entries are only emitted when the client is configured as Verbose.
+type LeveledLogger interface {
+	Logger
+
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
 // This function instantiate an object that statisfies the posthog.Logger
 // interface and send logs to standard logger passed as argument.
 func StdLogger(logger *log.Logger) Logger {
@@ -45,3 +91,33 @@ func (l stdLogger) Errorf(format string, args ...interface{}) {
 func newDefaultLogger() Logger {
 	return StdLogger(log.New(os.Stderr, "posthog ", log.LstdFlags))
 }
+
+// Writes a log entry to the logger, passing the level and fields through if
+// the logger is a LeveledLogger and falling back to a `msg key=value` line on
+// Logf or Errorf otherwise.
+func writeLog(logger Logger, level LogLevel, msg string, fields ...LogField) {
+	if l, ok := logger.(LeveledLogger); ok {
+		l.Log(level, msg, fields...)
+		return
+	}
+
+	line := formatLogFields(msg, fields)
+	if level >= LogLevelError {
+		logger.Errorf("%s", line)
+	} else {
+		logger.Logf("%s", line)
+	}
+}
+
+func formatLogFields(msg string, fields []LogField) string {
+	if len(fields) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	return b.String()
+}
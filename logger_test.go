@@ -34,3 +34,38 @@ test ERROR: something went wrong!
 		t.Errorf("invalid logs from standard logger:\n- expected: %s\n- found: %s", ref, res)
 	}
 }
+
+type testLeveledLogger struct {
+	testLogger
+	log func(LogLevel, string, ...LogField)
+}
+
+func (l testLeveledLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.log(level, msg, fields...)
+}
+
+// This test ensures structured entries are passed through to leveled loggers
+// untouched and flattened into a single line for plain loggers.
+func TestWriteLog(t *testing.T) {
+	var buffer bytes.Buffer
+	writeLog(StdLogger(log.New(&buffer, "test ", 0)), LogLevelWarn, "request rejected", LogField{"endpoint", "/batch/"}, LogField{"status", 400})
+	writeLog(StdLogger(log.New(&buffer, "test ", 0)), LogLevelError, "sending request failed")
+
+	const ref = `test INFO: request rejected endpoint=/batch/ status=400
+test ERROR: sending request failed
+`
+
+	if res := buffer.String(); ref != res {
+		t.Errorf("invalid logs from standard logger:\n- expected: %s\n- found: %s", ref, res)
+	}
+
+	var level LogLevel
+	var fields []LogField
+	writeLog(testLeveledLogger{log: func(l LogLevel, msg string, f ...LogField) {
+		level, fields = l, f
+	}}, LogLevelWarn, "request rejected", LogField{"status", 400})
+
+	if level != LogLevelWarn || len(fields) != 1 || fields[0] != (LogField{"status", 400}) {
+		t.Errorf("invalid entry passed to leveled logger: %s %v", level, fields)
+	}
+}
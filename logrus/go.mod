@@ -0,0 +1,15 @@
+module github.com/posthog/posthog-go/logrus
+
+go 1.19
+
+require (
+	github.com/posthog/posthog-go v0.0.0
+	github.com/sirupsen/logrus v1.9.3
+)
+
+require (
+	github.com/google/uuid v1.3.0 // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+)
+
+replace github.com/posthog/posthog-go => ../
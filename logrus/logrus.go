@@ -0,0 +1,60 @@
+// Package posthoglogrus provides a posthog.Logger backed by logrus.
+//
+//	client, _ := posthog.NewWithConfig(apiKey, posthog.Config{
+//		Logger: posthoglogrus.New(logrus.StandardLogger()),
+//	})
+package posthoglogrus
+
+import (
+	"github.com/posthog/posthog-go"
+	"github.com/sirupsen/logrus"
+)
+
+var _ posthog.LeveledLogger = Logger{}
+
+// Logger adapts a logrus.FieldLogger (a *logrus.Logger or *logrus.Entry) to
+// the posthog.LeveledLogger interface. Fields attached by the client, like
+// the endpoint, response status or flag key, become logrus fields.
+type Logger struct {
+	logger logrus.FieldLogger
+}
+
+// New returns a Logger writing to logger. Entries are tagged with a
+// `component` field set to "posthog".
+func New(logger logrus.FieldLogger) Logger {
+	return Logger{logger: logger.WithField("component", "posthog")}
+}
+
+func (l Logger) Logf(format string, args ...interface{}) {
+	l.logger.Infof(format, args...)
+}
+
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(format, args...)
+}
+
+func (l Logger) Log(level posthog.LogLevel, msg string, fields ...posthog.LogField) {
+	entry := l.logger
+	if len(fields) != 0 {
+		lf := make(logrus.Fields, len(fields))
+		for _, f := range fields {
+			if err, ok := f.Value.(error); ok {
+				lf[f.Key] = err.Error()
+			} else {
+				lf[f.Key] = f.Value
+			}
+		}
+		entry = entry.WithFields(lf)
+	}
+
+	switch level {
+	case posthog.LogLevelDebug:
+		entry.Debug(msg)
+	case posthog.LogLevelInfo:
+		entry.Info(msg)
+	case posthog.LogLevelWarn:
+		entry.Warn(msg)
+	default:
+		entry.Error(msg)
+	}
+}
@@ -0,0 +1,42 @@
+package posthoglogrus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLoggerLevelsAndFields(t *testing.T) {
+	base, hook := test.NewNullLogger()
+	base.SetLevel(logrus.DebugLevel)
+	logger := New(base)
+
+	logger.Logf("flushing %d messages", 3)
+	logger.Log(posthog.LogLevelDebug, "flushing messages", posthog.LogField{Key: "count", Value: 3})
+	logger.Log(posthog.LogLevelError, "Unable to fetch feature flags",
+		posthog.LogField{Key: "endpoint", Value: "https://app.posthog.com/api/feature_flag/local_evaluation"},
+		posthog.LogField{Key: "status", Value: 401},
+		posthog.LogField{Key: "error", Value: errors.New("unauthorized")},
+	)
+
+	entries := hook.AllEntries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	if entries[0].Level != logrus.InfoLevel || entries[0].Message != "flushing 3 messages" {
+		t.Errorf("invalid info entry: %+v", entries[0])
+	}
+
+	if entries[1].Level != logrus.DebugLevel || entries[1].Data["count"] != 3 {
+		t.Errorf("invalid debug entry: %+v", entries[1])
+	}
+
+	e := entries[2]
+	if e.Level != logrus.ErrorLevel || e.Data["status"] != 401 || e.Data["error"] != "unauthorized" || e.Data["component"] != "posthog" {
+		t.Errorf("invalid error entry: %+v", e)
+	}
+}
@@ -0,0 +1,148 @@
+package posthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	now := mockTime()
+	cache := newLRUCache(2, time.Minute, func() time.Time { return now })
+
+	cache.add("a", 1)
+	cache.add("b", 2)
+	cache.get("a")
+	cache.add("c", 3)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if v, ok := cache.get("a"); !ok || v != 1 {
+		t.Errorf("expected a recently used entry to be kept, got %v %v", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("c"); ok {
+		t.Error("expected the entry to expire")
+	}
+
+	cache.purge()
+	if cache.len() != 0 {
+		t.Error("expected the cache to be empty after a purge")
+	}
+}
+
+func TestLocalEvaluationCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:           "some very secret key",
+		Endpoint:                 server.URL,
+		Logger:                   testLogger{t.Logf, t.Logf},
+		LocalEvaluationCacheSize: 10,
+	})
+	defer c.Close()
+
+	evaluations := c.(*client).featureFlagsPoller.evaluations
+
+	for _, region := range []string{"USA", "USA", "Canada"} {
+		payload := FeatureFlagPayload{
+			Key:                   "simple-flag",
+			DistinctId:            "some-distinct-id",
+			PersonProperties:      NewProperties().Set("region", region),
+			SendFeatureFlagEvents: new(bool),
+		}
+
+		enabled, err := c.IsFeatureEnabled(payload)
+		if err != nil || enabled == nil || *enabled != (region == "USA") {
+			t.Errorf("%s: unexpected evaluation %v %v", region, enabled, err)
+		}
+	}
+
+	if n := evaluations.len(); n != 2 {
+		t.Errorf("expected one cached evaluation per set of properties, got %d", n)
+	}
+
+	// Inconclusive evaluations are never cached.
+	c.IsFeatureEnabled(FeatureFlagPayload{Key: "simple-flag", DistinctId: "other-id", OnlyEvaluateLocally: true})
+	if n := evaluations.len(); n != 2 {
+		t.Errorf("expected inconclusive evaluations not to be cached, got %d", n)
+	}
+}
+
+func TestRemoteEvaluationCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFlagsRequest(r) {
+			atomic.AddInt32(&requests, 1)
+			w.Write([]byte(fixture("test-decide-v2.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(`{"flags": []}`))
+		}
+	}))
+	defer server.Close()
+
+	var mutex sync.Mutex
+	now := time.Now()
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey:            "some very secret key",
+		Endpoint:                  server.URL,
+		Logger:                    testLogger{t.Logf, t.Logf},
+		SendFeatureFlagEvents:     new(bool),
+		RemoteEvaluationCacheSize: 10,
+		RemoteEvaluationCacheTTL:  time.Minute,
+		now: func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return now
+		},
+	})
+	defer c.Close()
+
+	evaluate := func(key string, region string) {
+		value, err := c.GetFeatureFlag(FeatureFlagPayload{
+			Key:              key,
+			DistinctId:       "some-distinct-id",
+			PersonProperties: NewProperties().Set("region", region),
+		})
+		if err != nil || value == nil {
+			t.Errorf("%s: unexpected evaluation %v %v", key, value, err)
+		}
+	}
+
+	// A single request evaluates all flags for the same inputs.
+	evaluate("beta-feature", "USA")
+	evaluate("beta-feature2", "USA")
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected a single request for the same inputs, got %d", n)
+	}
+
+	evaluate("beta-feature", "Canada")
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected a request for other properties, got %d", n)
+	}
+
+	c.ReloadFeatureFlags()
+	evaluate("beta-feature", "USA")
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected reloading flags to drop cached evaluations, got %d", n)
+	}
+
+	mutex.Lock()
+	now = now.Add(time.Minute)
+	mutex.Unlock()
+	evaluate("beta-feature", "USA")
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Errorf("expected cached evaluations to expire, got %d", n)
+	}
+}
@@ -2,6 +2,7 @@ package posthog
 
 import (
 	"encoding/json"
+	"sort"
 	"time"
 )
 
@@ -43,12 +44,13 @@ type Message interface {
 }
 
 // Returns the time value passed as first argument, unless it's the zero-value,
-// in that case the default value passed as second argument is returned.
+// in that case the default value passed as second argument is returned. The
+// time is always converted to UTC so all messages are sent in the same zone.
 func makeTimestamp(t time.Time, def time.Time) time.Time {
 	if t == (time.Time{}) {
-		return def
+		return def.UTC()
 	}
-	return t
+	return t.UTC()
 }
 
 // This structure represents objects sent to the /batch/ endpoint. We don't
@@ -87,6 +89,7 @@ func (m message) size() int {
 }
 
 type messageQueue struct {
+	key           string
 	pending       []message
 	bytes         int
 	maxBatchSize  int
@@ -105,7 +108,7 @@ func (q *messageQueue) push(m message) (b []message) {
 	q.pending = append(q.pending, m)
 	q.bytes += len(m.json)
 
-	if b == nil && len(q.pending) == q.maxBatchSize {
+	if b == nil && len(q.pending) >= q.maxBatchSize {
 		b = q.flush()
 	}
 
@@ -117,6 +120,58 @@ func (q *messageQueue) flush() (msgs []message) {
 	return
 }
 
+// A batch is sent to a single project, so messages are queued by the API key
+// of their destination project.
+type messageQueues struct {
+	queues        map[string]*messageQueue
+	maxBatchSize  int
+	maxBatchBytes int
+
+	// The number of messages pushed since the last call to takeReceived.
+	received int
+}
+
+// Changes the batch size of all queues, a queue holding more messages than
+// the new size is flushed by its next push.
+func (qs *messageQueues) setBatchSize(n int) {
+	qs.maxBatchSize = n
+	for _, q := range qs.queues {
+		q.maxBatchSize = n
+	}
+}
+
+func (qs *messageQueues) takeReceived() (n int) {
+	n, qs.received = qs.received, 0
+	return
+}
+
+func (qs *messageQueues) get(key string) *messageQueue {
+	if qs.queues == nil {
+		qs.queues = map[string]*messageQueue{}
+	}
+	q, ok := qs.queues[key]
+	if !ok {
+		q = &messageQueue{key: key, maxBatchSize: qs.maxBatchSize, maxBatchBytes: qs.maxBatchBytes}
+		qs.queues[key] = q
+	}
+	return q
+}
+
+// Returns the queues ordered by key.
+func (qs *messageQueues) all() []*messageQueue {
+	keys := make([]string, 0, len(qs.queues))
+	for key := range qs.queues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	all := make([]*messageQueue, len(keys))
+	for i, key := range keys {
+		all[i] = qs.queues[key]
+	}
+	return all
+}
+
 const (
 	maxBatchBytes   = 500000
 	maxMessageBytes = 32000
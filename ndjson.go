@@ -0,0 +1,68 @@
+package posthog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// An NDJSONSink writes messages to a stream as newline-delimited JSON, one
+// message per line in the format sent to the /batch endpoint. It is meant to
+// be used as Config.Tee or Config.Fallback, the lines can be replayed later on
+// by sending them in a batch.
+// Sinks are safe to use concurrently.
+type NDJSONSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// Returns a sink writing to w.
+func NewNDJSONSink(w io.Writer) *NDJSONSink {
+	return &NDJSONSink{w: w}
+}
+
+// Returns a sink appending to the file at path, the file is created if it
+// doesn't exist.
+func OpenNDJSONSink(path string) (*NDJSONSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewNDJSONSink(f), nil
+}
+
+// Closes the underlying stream if it implements io.Closer.
+func (s *NDJSONSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *NDJSONSink) write(msgs []message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return writeNDJSON(s.w, msgs)
+}
+
+// Writes the messages with a single call so lines of concurrent writers are
+// never interleaved.
+func writeNDJSON(w io.Writer, msgs []message) error {
+	var b bytes.Buffer
+	for _, m := range msgs {
+		if m.json == nil {
+			continue
+		}
+		b.Write(m.json)
+		b.WriteByte('\n')
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,110 @@
+package posthog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readNDJSON(t *testing.T, b []byte) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid line %q: %s", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestClientDumpQueue(t *testing.T) {
+	client, _ := NewWithConfig("0123456789", Config{
+		Logger:    testLogger{t.Logf, t.Logf},
+		Transport: testTransportOK,
+		BatchSize: 100,
+		Interval:  time.Hour,
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A"})
+	client.Enqueue(Capture{DistinctId: "1", Event: "B"})
+
+	var b bytes.Buffer
+	if err := client.DumpQueue(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readNDJSON(t, b.Bytes())
+	if len(lines) != 2 || lines[0]["event"] != "A" || lines[1]["event"] != "B" {
+		t.Errorf("unexpected dump: %s", b.String())
+	}
+
+	// Dumping doesn't remove messages from the queue.
+	b.Reset()
+	client.DumpQueue(&b)
+	if n := len(readNDJSON(t, b.Bytes())); n != 2 {
+		t.Errorf("expected messages to stay queued, got %d", n)
+	}
+
+	client.Close()
+	if err := client.DumpQueue(&b); err != ErrClosed {
+		t.Error("expected ErrClosed, got", err)
+	}
+}
+
+func TestClientTeeAndFallback(t *testing.T) {
+	var tee, fallback bytes.Buffer
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Logger:    testLogger{t.Logf, t.Logf},
+		Transport: testTransportBadRequest,
+		BatchSize: 1,
+		Tee:       NewNDJSONSink(&tee),
+		Fallback:  NewNDJSONSink(&fallback),
+	})
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A"})
+	client.Close()
+
+	if lines := readNDJSON(t, tee.Bytes()); len(lines) != 1 || lines[0]["event"] != "A" {
+		t.Errorf("expected the batch to be written to the tee, got %q", tee.String())
+	}
+
+	if lines := readNDJSON(t, fallback.Bytes()); len(lines) != 1 || lines[0]["event"] != "A" {
+		t.Errorf("expected the dropped batch to be written to the fallback, got %q", fallback.String())
+	}
+}
+
+func TestOpenNDJSONSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "posthog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.ndjson")
+
+	for _, event := range []string{"A", "B"} {
+		sink, err := OpenNDJSONSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, _ := makeMessage(CaptureInApi{Event: event}, maxMessageBytes)
+		if err := sink.write([]message{msg}); err != nil {
+			t.Fatal(err)
+		}
+		sink.Close()
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	if strings.Count(string(b), "\n") != 2 {
+		t.Errorf("expected the file to be appended to, got %q", b)
+	}
+}
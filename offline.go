@@ -0,0 +1,88 @@
+package posthog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Where flag definitions are loaded from when flags are evaluated offline, see
+// Config.FeatureFlagsFile and Config.FeatureFlagsReader.
+type offlineDefinitions struct {
+	file   string
+	reader io.Reader
+	watch  bool
+
+	// The modification time and size of the file when it was last loaded,
+	// it is only read again when they change.
+	modTime time.Time
+	size    int64
+	loaded  bool
+}
+
+func newOfflineDefinitions(c Config) *offlineDefinitions {
+	if c.FeatureFlagsFile == "" && c.FeatureFlagsReader == nil {
+		return nil
+	}
+	return &offlineDefinitions{
+		file:   c.FeatureFlagsFile,
+		reader: c.FeatureFlagsReader,
+		watch:  c.WatchFeatureFlagsFile,
+	}
+}
+
+// Loads the offline flag definitions, the reader is consumed by the first call
+// and the file is only read again when it is watched and changed. It is only
+// called by the goroutine fetching definitions.
+func (poller *FeatureFlagsPoller) loadOfflineDefinitions() error {
+	offline := poller.offline
+	if offline.loaded && !offline.watch {
+		return nil
+	}
+
+	var r io.Reader
+	if offline.reader != nil {
+		r, offline.reader = offline.reader, nil
+	} else if offline.file != "" {
+		info, err := os.Stat(offline.file)
+		if err != nil {
+			return poller.offlineDefinitionsFailed(err)
+		}
+		if info.ModTime().Equal(offline.modTime) && info.Size() == offline.size {
+			return nil
+		}
+
+		f, err := os.Open(offline.file)
+		if err != nil {
+			return poller.offlineDefinitionsFailed(err)
+		}
+		defer f.Close()
+		r = f
+		offline.modTime, offline.size = info.ModTime(), info.Size()
+	} else {
+		return nil
+	}
+
+	featureFlagsResponse := FeatureFlagsResponse{}
+	if err := decodeJSON(r, &featureFlagsResponse); err != nil {
+		// Try again on the next poll even if the file doesn't change, it may
+		// have been read while being written.
+		offline.modTime, offline.size = time.Time{}, 0
+		return poller.offlineDefinitionsFailed(err)
+	}
+
+	poller.setDefinitions(featureFlagsResponse, nil)
+	offline.loaded = true
+	if offline.file != "" {
+		poller.log(LogLevelInfo, "loaded feature flag definitions", LogField{"file", offline.file}, LogField{"flags", len(featureFlagsResponse.Flags)})
+	}
+	return nil
+}
+
+func (poller *FeatureFlagsPoller) offlineDefinitionsFailed(err error) error {
+	poller.log(LogLevelError, "Unable to load feature flag definitions", LogField{"file", poller.offline.file}, LogField{"error", err})
+	err = fmt.Errorf("unable to load feature flag definitions: %w", err)
+	poller.fail(err)
+	return err
+}
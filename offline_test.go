@@ -0,0 +1,116 @@
+package posthog
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A transport failing the test on any request, offline clients must not
+// reach the network.
+func offlineTransport(t *testing.T) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		t.Error("unexpected request to", r.URL)
+		return nil, errors.New("offline")
+	})
+}
+
+func TestOfflineFlagDefinitionsFromReader(t *testing.T) {
+	c, err := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader:    strings.NewReader(fixture("feature_flag/test-simple-flag-person-prop.json")),
+		SendFeatureFlagEvents: new(bool),
+		Transport:             offlineTransport(t),
+		Logger:                testLogger{t.Logf, t.Logf},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	value, err := c.GetFeatureFlag(FeatureFlagPayload{
+		Key:              "simple-flag",
+		DistinctId:       "some-distinct-id",
+		PersonProperties: NewProperties().Set("region", "USA"),
+	})
+	if err != nil || value != true {
+		t.Error("Expected the flag to be evaluated offline, got", value, err)
+	}
+
+	// Without the property the flag would be sent to /decide.
+	var inconclusiveErr *InconclusiveMatchError
+	if value, err := c.GetFeatureFlag(FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id"}); !errors.As(err, &inconclusiveErr) {
+		t.Error("Expected an inconclusive match, got", value, err)
+	}
+}
+
+func TestOfflineFlagDefinitionsFileIsWatched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "posthog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "flags.json")
+	initial := []byte(`{"flags": [{"key": "simple-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 0}]}}]}`)
+	if err := ioutil.WriteFile(path, initial, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsFile:                   path,
+		WatchFeatureFlagsFile:              true,
+		DefaultFeatureFlagsPollingInterval: 10 * time.Millisecond,
+		SendFeatureFlagEvents:              new(bool),
+		Transport:                          offlineTransport(t),
+		Logger:                             testLogger{t.Logf, t.Logf},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	payload := FeatureFlagPayload{Key: "simple-flag", DistinctId: "some-distinct-id"}
+	if value, err := c.GetFeatureFlag(payload); err != nil || value != false {
+		t.Fatal("Expected the flag to be off, got", value, err)
+	}
+
+	// A rollout of 100% with a different size so the change is seen even when
+	// the modification time has a coarse resolution.
+	updated := []byte(`{"flags": [{"key": "simple-flag", "active": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}]}`)
+	if err := ioutil.WriteFile(path, updated, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		value, err := c.GetFeatureFlag(payload)
+		if err == nil && value == true {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the flag to be reloaded from the file, got", value, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigOfflineFlagDefinitions(t *testing.T) {
+	configs := map[string]Config{
+		"FeatureFlagsReader":    {FeatureFlagsFile: "flags.json", FeatureFlagsReader: strings.NewReader("{}")},
+		"WatchFeatureFlagsFile": {WatchFeatureFlagsFile: true},
+	}
+
+	for field, config := range configs {
+		if err := config.validate(); err == nil {
+			t.Error("no error returned when validating a malformed config")
+
+		} else if e, ok := err.(ConfigError); !ok || e.Field != field {
+			t.Error("invalid error returned when checking a malformed config:", err)
+		}
+	}
+}
@@ -1,14 +1,15 @@
 package posthog
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,31 +38,210 @@ type Client interface {
 	// called or if the message was malformed.
 	Enqueue(Message) error
 	//
-	// Method returns if a feature flag is on for a given user based on their distinct ID
-	IsFeatureEnabled(FeatureFlagPayload) (interface{}, error)
+	// Same as Enqueue but returns the UUID and the normalized timestamp
+	// assigned to the message, which lets applications store the ID to
+	// reconcile events with PostHog exports.
+	EnqueueWithResult(Message) (EnqueueResult, error)
+	//
+	// Same as Enqueue but gives up with the context's error when the context
+	// is done before the message was queued, for example while the queue is
+	// full or while the feature flags of a capture are fetched.
+	EnqueueCtx(ctx context.Context, msg Message) error
+	//
+	// Returns a lightweight child client sharing the queue, transport and
+	// feature flags of this client but overriding how its messages are
+	// enqueued, like default properties or the destination project.
+	With(...Option) Client
+	//
+	// Returns the state of the background subsystems of the client, like
+	// whether they are running and their last error.
+	Subsystems() []SubsystemState
+	//
+	// Returns the state of the feature flag definitions, like when they were
+	// last fetched and when they are fetched next.
+	FeatureFlagsStatus() (FeatureFlagsStatus, error)
+	//
+	// Returns a handle scoped to a distinct ID, which avoids passing the ID and
+	// known person properties to every call.
+	ForUser(distinctId string) *User
+	//
+	// Returns a handle scoped to a group, its events are attached to the group
+	// and its flags evaluated with it.
+	ForGroup(groupType string, key string) *Group
+	//
+	// Sends every queued message and blocks until all in-flight batches have
+	// been delivered or dropped. Unlike Close the client can still be used
+	// afterwards, which makes it suitable for environments that may be frozen
+	// between requests, like AWS Lambda.
+	Flush() error
+	//
+	// Writes the messages buffered by the client as newline-delimited JSON,
+	// without sending nor removing them. Batches that are being uploaded
+	// aren't included.
+	DumpQueue(w io.Writer) error
+	//
+	// Sends the batches that are due and fetches feature flag definitions
+	// when the polling interval elapsed, on the calling goroutine. It must be
+	// called periodically by clients configured with ManualPump and returns
+	// ErrNotManualPump otherwise.
+	Pump(ctx context.Context) error
+	//
+	// Method returns if a feature flag is on for a given user based on their distinct ID.
+	// The result is nil when the flag is undefined, either because it doesn't
+	// exist or because it couldn't be evaluated, which lets callers apply their
+	// own default instead of treating the flag as off.
+	IsFeatureEnabled(FeatureFlagPayload) (*bool, error)
+	//
+	// Same as IsFeatureEnabled but requests made to evaluate the flag are
+	// canceled when the context is done.
+	IsFeatureEnabledCtx(ctx context.Context, flagConfig FeatureFlagPayload) (*bool, error)
 	//
 	// Method returns variant value if multivariantflag or otherwise a boolean indicating
 	// if the given flag is on or off for the user
 	GetFeatureFlag(FeatureFlagPayload) (interface{}, error)
 	//
-	// Method forces a reload of feature flags
+	// Same as GetFeatureFlag but requests made to evaluate the flag are
+	// canceled when the context is done.
+	GetFeatureFlagCtx(ctx context.Context, flagConfig FeatureFlagPayload) (interface{}, error)
+	//
+	// Same as GetFeatureFlag but also returns the payload of the flag and why
+	// it evaluated to its value, when the API reports it.
+	GetFeatureFlagResult(FeatureFlagPayload) (FeatureFlagResult, error)
+	//
+	// Same as GetFeatureFlagResult but requests made to evaluate the flag are
+	// canceled when the context is done.
+	GetFeatureFlagResultCtx(ctx context.Context, flagConfig FeatureFlagPayload) (FeatureFlagResult, error)
+	//
+	// Evaluates the flag locally and returns a trace of the evaluation: the
+	// conditions that were checked, the property comparisons that passed or
+	// failed, the rollout hash values and the chosen variant. The flag is
+	// never evaluated remotely and no $feature_flag_called event is sent.
+	ExplainFeatureFlag(FeatureFlagPayload) (FlagExplanation, error)
+	//
+	// Evaluates the flag locally for every distinct ID, with the person
+	// properties returned by propsFor, which may be nil. It is meant for batch
+	// jobs and makes no requests: the distinct IDs for which the flag can't be
+	// evaluated locally are missing from the results. No $feature_flag_called
+	// events are sent and OnFlagEvaluated isn't called. Group flags aren't
+	// supported.
+	EvaluateFlagForMany(key string, distinctIds []string, propsFor func(id string) Properties) (map[string]interface{}, error)
+	//
+	// Method forces a reload of feature flags, in manual pump mode the flags
+	// are reloaded by the next call to Pump.
 	ReloadFeatureFlags() error
 	//
-	// Get feature flags - for testing only
+	// Same as ReloadFeatureFlags but blocks until the definitions were
+	// fetched and returns the error of the fetch, or the context error when
+	// the context is done first. This is meant for deploy hooks and tests
+	// that need the latest definitions before going on.
+	ReloadFeatureFlagsAndWait(ctx context.Context) error
+	//
+	// Get feature flags - for testing only. It returns ErrFlagsNotLoaded
+	// until definitions are loaded, see WaitForFeatureFlags.
 	GetFeatureFlags() ([]FeatureFlag, error)
 	//
+	// Blocks until feature flag definitions are loaded, so flags can be
+	// evaluated locally, or the context is done. It lets services wait for
+	// flags during startup with a deadline instead of evaluating them
+	// remotely.
+	WaitForFeatureFlags(ctx context.Context) error
+	//
 	// Get all flags - returns all flags for a user
 	GetAllFlags(FeatureFlagPayloadNoKey) (map[string]interface{}, error)
+	//
+	// Same as GetAllFlags but requests made to evaluate the flags are
+	// canceled when the context is done.
+	GetAllFlagsCtx(ctx context.Context, flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error)
+	//
+	// Returns the payload of a remote config flag, fetched from the remote
+	// config endpoint with the PersonalApiKey. The payloads of these flags
+	// aren't part of the flag definitions since they may hold secrets. It is
+	// nil when the flag has no payload and ErrFlagNotFound is returned when
+	// the flag doesn't exist.
+	GetRemoteConfigPayload(flagKey string) (json.RawMessage, error)
+	//
+	// Same as GetRemoteConfigPayload but the request is canceled when the
+	// context is done.
+	GetRemoteConfigPayloadCtx(ctx context.Context, flagKey string) (json.RawMessage, error)
+	//
+	// Replaces the project API key of the client without restarting it. The
+	// messages enqueued afterwards and the flags evaluated remotely use the
+	// new key, messages already queued are sent with the key they were
+	// enqueued with. Children created by With use the new key unless they
+	// have their own, see WithApiKey.
+	SetProjectApiKey(apiKey string) error
+	//
+	// Replaces the personal API key used to fetch flag definitions and remote
+	// config payloads without restarting the client, definitions are fetched
+	// again with the new key. It fails when the client was created without
+	// feature flags.
+	SetPersonalApiKey(personalApiKey string) error
+	//
+	// Captures err as an exception of the user for error tracking, see
+	// NewException.
+	CaptureException(err error, distinctId string, properties Properties) error
+	//
+	// Returns the early access features of the project, users opt in to them
+	// with User.SetFeatureEnrollment. Only the project API key is required.
+	GetEarlyAccessFeatures() ([]EarlyAccessFeature, error)
+	//
+	// Same as GetEarlyAccessFeatures but the request is canceled when the
+	// context is done.
+	GetEarlyAccessFeaturesCtx(ctx context.Context) ([]EarlyAccessFeature, error)
+	//
+	// Creates an annotation marking timestamp on the charts of the project,
+	// like a deploy, with the PersonalApiKey. The current time is used when
+	// timestamp is zero and the project scope when scope is empty.
+	CreateAnnotation(content string, timestamp time.Time, scope AnnotationScope) (Annotation, error)
+	//
+	// Same as CreateAnnotation but the request is canceled when the context
+	// is done.
+	CreateAnnotationCtx(ctx context.Context, content string, timestamp time.Time, scope AnnotationScope) (Annotation, error)
+	//
+	// Runs a HogQL query on the project with the PersonalApiKey and returns
+	// the first page of rows, see QueryResult.Next.
+	Query(ctx context.Context, hogql string) (*QueryResult, error)
+	//
+	// Creates a feature flag in the project with the PersonalApiKey, from the
+	// key, name, active state, filters and experience continuity of flag.
+	// The created flag is returned and the definitions are reloaded.
+	CreateFeatureFlag(ctx context.Context, flag FeatureFlag) (FeatureFlag, error)
+	//
+	// Updates the feature flag with the Id of flag, like CreateFeatureFlag.
+	UpdateFeatureFlag(ctx context.Context, flag FeatureFlag) (FeatureFlag, error)
+	//
+	// Marks the feature flag with id as deleted, it is no longer evaluated.
+	DeleteFeatureFlag(ctx context.Context, id int) error
+	//
+	// Returns the cohorts of the project, fetched with the PersonalApiKey.
+	GetCohorts(ctx context.Context) ([]Cohort, error)
+	//
+	// Reports whether the person of distinctId is a member of the cohort,
+	// fetched with the PersonalApiKey. It is false when the person doesn't
+	// exist. See CohortMembershipProperty to use it in local evaluation.
+	IsInCohort(ctx context.Context, cohortId int, distinctId string) (bool, error)
+	//
+	// Returns the group types of the project, fetched with the PersonalApiKey
+	// and cached for the feature flags polling interval. Group identifies and
+	// events attached to a type that doesn't exist create it.
+	GetGroupTypes(ctx context.Context) ([]GroupType, error)
 }
 
 type client struct {
+	// Time of the last inline flush in nanoseconds, accessed atomically and
+	// kept first to guarantee 64 bits alignment on 32 bits platforms.
+	lastFlush int64
+
 	Config
-	key string
+
+	// The project API key of the messages, a string replaced by
+	// SetProjectApiKey.
+	key atomic.Value
 
 	// This channel is where the `Enqueue` method writes messages so they can be
 	// picked up and pushed by the backend goroutine taking care of applying the
 	// batching rules.
-	msgs chan APIMessage
+	msgs chan queuedMessage
 
 	// These two channels are used to synchronize the client shutting down when
 	// `Close` is called.
@@ -71,6 +251,21 @@ type client struct {
 	quit     chan struct{}
 	shutdown chan struct{}
 
+	// Flush requests are sent to the backend goroutine on this channel, the
+	// channel carried by each request is closed once the flush completed.
+	flushes chan chan struct{}
+
+	// Dump requests are sent to the backend goroutine on this channel, see
+	// DumpQueue.
+	dumps chan dumpRequest
+
+	// The state of the backend goroutine, see Subsystems.
+	flusher *subsystem
+
+	// Replaces the backend goroutine when the client is configured with
+	// ManualPump, nil otherwise.
+	pump *pump
+
 	// This HTTP client is used to send requests to the backend, it uses the
 	// HTTP transport provided in the configuration.
 	http http.Client
@@ -102,34 +297,52 @@ func NewWithConfig(apiKey string, config Config) (cli Client, err error) {
 
 	c := &client{
 		Config:                          makeConfig(config),
-		key:                             apiKey,
-		msgs:                            make(chan APIMessage, 100),
+		msgs:                            make(chan queuedMessage, 100),
 		quit:                            make(chan struct{}),
 		shutdown:                        make(chan struct{}),
+		flushes:                         make(chan chan struct{}),
+		dumps:                           make(chan dumpRequest),
 		http:                            makeHttpClient(config.Transport),
 		distinctIdsFeatureFlagsReported: newSizeLimitedMap(SIZE_DEFAULT),
 	}
 
-	if len(c.PersonalApiKey) > 0 {
-		c.featureFlagsPoller = newFeatureFlagsPoller(c.key, c.Config.PersonalApiKey, c.Errorf, c.Endpoint, c.http, c.DefaultFeatureFlagsPollingInterval)
+	c.key.Store(apiKey)
+	c.lastFlush = c.now().UnixNano()
+	c.flusher = newSubsystem("flusher", c.now)
+
+	offline := newOfflineDefinitions(c.Config)
+	if len(c.PersonalApiKey) > 0 || offline != nil {
+		var evaluations *lruCache
+		if c.LocalEvaluationCacheSize > 0 {
+			evaluations = newLRUCache(c.LocalEvaluationCacheSize, c.LocalEvaluationCacheTTL, c.now)
+		}
+		var remoteEvaluations *lruCache
+		if c.RemoteEvaluationCacheSize > 0 {
+			remoteEvaluations = newLRUCache(c.RemoteEvaluationCacheSize, c.RemoteEvaluationCacheTTL, c.now)
+		}
+		// Flag requests get their own timeout so a slow flags endpoint doesn't
+		// hold up callers for as long as a batch upload may take.
+		flagsHttp := c.http
+		if flagsHttp.Timeout != 0 {
+			flagsHttp.Timeout = c.FeatureFlagRequestTimeout
+		}
+		c.featureFlagsPoller = newFeatureFlagsPoller(apiKey, c.Config.PersonalApiKey, c.log, c.fail, c.Endpoint, flagsHttp, c.DefaultFeatureFlagsPollingInterval, c.FeatureFlagsBackoff, c.MaxFlagStaleness, evaluations, remoteEvaluations, offline, c.OnFeatureFlagsChanged, c.FlagsEndpoint, c.FeatureFlagsPageConcurrency, c.ManualPump, c.FeatureFlagsStreaming)
 	}
 
-	go c.loop()
+	if c.ManualPump {
+		c.pump = &pump{queues: messageQueues{
+			maxBatchSize:  c.BatchSize,
+			maxBatchBytes: c.maxBatchBytes(),
+		}}
+		c.flusher.setRunning(true)
+	} else {
+		go c.loop()
+	}
 
 	cli = c
 	return
 }
 
-func makeHttpClient(transport http.RoundTripper) http.Client {
-	httpClient := http.Client{
-		Transport: transport,
-	}
-	if supportsTimeout(transport) {
-		httpClient.Timeout = 10 * time.Second
-	}
-	return httpClient
-}
-
 func dereferenceMessage(msg Message) Message {
 	switch m := msg.(type) {
 	case *Alias:
@@ -157,8 +370,42 @@ func dereferenceMessage(msg Message) Message {
 	return msg
 }
 
-func (c *client) Enqueue(msg Message) (err error) {
-	msg = dereferenceMessage(msg)
+// The identifiers assigned to a message by EnqueueWithResult.
+type EnqueueResult struct {
+
+	// The UUID of the message, either set by the application or generated.
+	Uuid string
+
+	// The timestamp of the message, in UTC.
+	Timestamp time.Time
+}
+
+func (c *client) Enqueue(msg Message) error {
+	_, err := c.EnqueueWithResult(msg)
+	return err
+}
+
+func (c *client) EnqueueWithResult(msg Message) (EnqueueResult, error) {
+	return c.enqueue(context.Background(), msg, c.apiKey())
+}
+
+func (c *client) EnqueueCtx(ctx context.Context, msg Message) error {
+	_, err := c.enqueue(ctx, msg, c.apiKey())
+	return err
+}
+
+// A message waiting to be batched, with the API key of the project it is sent
+// to.
+type queuedMessage struct {
+	key string
+	msg APIMessage
+}
+
+func (c *client) enqueue(ctx context.Context, msg Message, key string) (result EnqueueResult, err error) {
+	msg = messageFromContext(ctx, dereferenceMessage(msg))
+	if c.AnonymizeInvalidDistinctIds {
+		msg = c.anonymizeDistinctIds(msg)
+	}
 	if err = msg.Validate(); err != nil {
 		return
 	}
@@ -168,39 +415,67 @@ func (c *client) Enqueue(msg Message) (err error) {
 	switch m := msg.(type) {
 	case Alias:
 		m.Type = "alias"
-		m.Timestamp = makeTimestamp(m.Timestamp, ts)
+		m.Timestamp = c.makeTimestamp(m.Timestamp, ts)
+		m.Uuid = c.makeUuid(m.Uuid)
+		result = EnqueueResult{Uuid: m.Uuid, Timestamp: m.Timestamp}
 		msg = m
 
 	case Identify:
 		m.Type = "identify"
-		m.Timestamp = makeTimestamp(m.Timestamp, ts)
+		m.Timestamp = c.makeTimestamp(m.Timestamp, ts)
+		m.Uuid = c.makeUuid(m.Uuid)
+		result = EnqueueResult{Uuid: m.Uuid, Timestamp: m.Timestamp}
 		msg = m
 
 	case GroupIdentify:
-		m.Timestamp = makeTimestamp(m.Timestamp, ts)
+		m.Timestamp = c.makeTimestamp(m.Timestamp, ts)
+		m.Uuid = c.makeUuid(m.Uuid)
+		result = EnqueueResult{Uuid: m.Uuid, Timestamp: m.Timestamp}
 		msg = m
 
 	case Capture:
+		if c.EventNaming != nil && !sdkEventNames[m.Event] {
+			if err := c.EventNaming.Validate(m.Event); err != nil {
+				if c.RejectEventNameViolations {
+					return EnqueueResult{}, err
+				}
+				c.log(LogLevelWarn, "capture does not follow the event naming convention", LogField{"error", err})
+			}
+		}
+		if c.Schemas != nil {
+			if err := c.Schemas.Validate(m); err != nil {
+				if c.RejectSchemaViolations {
+					return EnqueueResult{}, err
+				}
+				c.log(LogLevelWarn, "capture does not match its schema", LogField{"error", err})
+			}
+		}
 		m.Type = "capture"
-		m.Timestamp = makeTimestamp(m.Timestamp, ts)
-		if m.SendFeatureFlags {
+		m.Timestamp = c.makeTimestamp(m.Timestamp, ts)
+		m.Uuid = c.makeUuid(m.Uuid)
+		result = EnqueueResult{Uuid: m.Uuid, Timestamp: m.Timestamp}
+		if m.SendFeatureFlags || c.SendFeatureFlags {
 			// Add all feature variants to event
-			featureVariants, err := c.getFeatureVariants(m.DistinctId, m.Groups, NewProperties(), map[string]Properties{})
+			featureVariants, err := c.captureFeatureVariants(ctx, m.DistinctId, m.Groups)
 			if err != nil {
-				c.Errorf("unable to get feature variants - %s", err)
+				if c.Strict {
+					return EnqueueResult{}, fmt.Errorf("unable to get feature variants: %w", err)
+				}
+				c.log(LogLevelError, "unable to get feature variants", LogField{"error", err})
 			}
+			// Copy the properties, the map belongs to the caller.
+			m.Properties = NewProperties().Merge(m.Properties)
+			activeFeatures := []string{}
 			for feature, variant := range featureVariants {
 				propKey := fmt.Sprintf("$feature/%s", feature)
 				m.Properties[propKey] = variant
+				if variant != false {
+					activeFeatures = append(activeFeatures, feature)
+				}
 			}
-			// Add all feature flag keys to $active_feature_flags key
-			featureKeys := make([]string, len(featureVariants))
-			i := 0
-			for k := range featureVariants {
-				featureKeys[i] = k
-				i++
-			}
-			m.Properties["$active_feature_flags"] = featureKeys
+			// Add the keys of enabled feature flags to $active_feature_flags
+			sort.Strings(activeFeatures)
+			m.Properties["$active_feature_flags"] = activeFeatures
 		}
 		msg = m
 
@@ -209,103 +484,257 @@ func (c *client) Enqueue(msg Message) (err error) {
 		return
 	}
 
-	defer func() {
-		// When the `msgs` channel is closed writing to it will trigger a panic.
-		// To avoid letting the panic propagate to the caller we recover from it
-		// and instead report that the client has been closed and shouldn't be
-		// used anymore.
-		if recover() != nil {
-			err = ErrClosed
+	// The feature flags of a capture may have taken until the deadline.
+	if err = ctx.Err(); err != nil {
+		return EnqueueResult{}, err
+	}
+
+	qm := queuedMessage{key: key, msg: msg.APIfy()}
+
+	if c.pump != nil {
+		if err = c.pumpEnqueue(qm); err != nil {
+			return EnqueueResult{}, err
 		}
-	}()
+	} else {
+		defer func() {
+			// When the `msgs` channel is closed writing to it will trigger a
+			// panic. To avoid letting the panic propagate to the caller we
+			// recover from it and instead report that the client has been
+			// closed and shouldn't be used anymore.
+			if recover() != nil {
+				result, err = EnqueueResult{}, ErrClosed
+			}
+		}()
 
-	c.msgs <- msg.APIfy()
+		select {
+		case c.msgs <- qm:
+		case <-ctx.Done():
+			return EnqueueResult{}, ctx.Err()
+		}
+	}
+
+	if c.InlineFlush {
+		c.flushInline()
+	}
 
 	return
 }
 
-func (c *client) IsFeatureEnabled(flagConfig FeatureFlagPayload) (interface{}, error) {
+// Returns the UUID of a message, generating one when the application didn't
+// set it.
+func (c *client) makeUuid(id string) string {
+	if id == "" {
+		return c.uid()
+	}
+	return id
+}
+
+// Normalizes a message timestamp to UTC, warning when a local-zone timestamp
+// is too far from the current time.
+func (c *client) makeTimestamp(t time.Time, now time.Time) time.Time {
+	if t != (time.Time{}) && t.Location() != time.UTC {
+		if skew := t.Sub(now); skew > c.TimestampSkewThreshold || skew < -c.TimestampSkewThreshold {
+			c.log(LogLevelWarn, "message timestamp is skewed from the current time", LogField{"timestamp", t}, LogField{"skew", skew})
+		}
+	}
+	return makeTimestamp(t, now)
+}
+
+// Flushes queued messages if the flush interval elapsed since the last inline
+// flush. Only one of the concurrent callers observing the elapsed interval
+// pays for the flush.
+func (c *client) flushInline() {
+	now := c.now().UnixNano()
+	last := atomic.LoadInt64(&c.lastFlush)
+
+	if now-last < int64(c.Interval) || !atomic.CompareAndSwapInt64(&c.lastFlush, last, now) {
+		return
+	}
+
+	c.Flush()
+}
+
+func (c *client) IsFeatureEnabled(flagConfig FeatureFlagPayload) (*bool, error) {
+	return c.IsFeatureEnabledCtx(c.flagsContext(), flagConfig)
+}
+
+func (c *client) IsFeatureEnabledCtx(ctx context.Context, flagConfig FeatureFlagPayload) (*bool, error) {
+	flagConfig.fromContext(ctx)
 	if err := flagConfig.validate(); err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if c.featureFlagsPoller == nil {
 		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
-		c.Errorf(errorMessage)
-		return false, errors.New(errorMessage)
+		c.log(LogLevelError, errorMessage)
+		return nil, errors.New(errorMessage)
 	}
 
-	result, err := c.GetFeatureFlag(flagConfig)
+	result, err := c.GetFeatureFlagCtx(ctx, flagConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	if result == "false" {
-		result = false
-	} else if result == "true" {
-		result = true
+	return flagEnabled(result), nil
+}
+
+// Converts a flag value into whether the flag is enabled, nil is returned when
+// the flag is undefined. Multivariate flags are enabled for any variant.
+func flagEnabled(value interface{}) *bool {
+	var enabled bool
+
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		enabled = v
+	case string:
+		enabled = v != "false"
+	default:
+		enabled = true
 	}
 
-	return result, nil
+	return &enabled
 }
 
 func (c *client) ReloadFeatureFlags() error {
 	if c.featureFlagsPoller == nil {
 		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
-		c.Errorf(errorMessage)
+		c.log(LogLevelError, errorMessage)
 		return errors.New(errorMessage)
 	}
 	c.featureFlagsPoller.ForceReload()
 	return nil
 }
 
+func (c *client) ReloadFeatureFlagsAndWait(ctx context.Context) error {
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return errors.New(errorMessage)
+	}
+	return c.featureFlagsPoller.Reload(ctx)
+}
+
 func (c *client) GetFeatureFlag(flagConfig FeatureFlagPayload) (interface{}, error) {
+	return c.GetFeatureFlagCtx(c.flagsContext(), flagConfig)
+}
+
+func (c *client) GetFeatureFlagCtx(ctx context.Context, flagConfig FeatureFlagPayload) (interface{}, error) {
+	flagConfig.fromContext(ctx)
 	if err := flagConfig.validate(); err != nil {
 		return false, err
 	}
 
 	if c.featureFlagsPoller == nil {
 		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
-		c.Errorf(errorMessage)
+		c.log(LogLevelError, errorMessage)
 		return "false", errors.New(errorMessage)
 	}
-	flagValue, err := c.featureFlagsPoller.GetFeatureFlag(flagConfig)
-	if *flagConfig.SendFeatureFlagEvents && !c.distinctIdsFeatureFlagsReported.contains(flagConfig.DistinctId, flagConfig.Key) {
-		c.Enqueue(Capture{
-			DistinctId: flagConfig.DistinctId,
-			Event:      "$feature_flag_called",
-			Properties: NewProperties().
-				Set("$feature_flag", flagConfig.Key).
-				Set("$feature_flag_response", flagValue).
-				Set("$feature_flag_errored", err != nil),
-			Groups: flagConfig.Groups,
-		})
-		c.distinctIdsFeatureFlagsReported.add(flagConfig.DistinctId, flagConfig.Key)
+	result, err := c.evaluateFeatureFlag(ctx, flagConfig)
+	return result.Value, err
+}
+
+// Reports whether $feature_flag_called events are sent, the option of the call
+// takes precedence over the configuration.
+func (c *client) sendFeatureFlagEvents(option *bool) bool {
+	if option != nil {
+		return *option
+	}
+	if c.SendFeatureFlagEvents != nil {
+		return *c.SendFeatureFlagEvents
+	}
+	return true
+}
+
+// How long a $feature_flag_called event is remembered as reported when the
+// state is kept in Config.Store.
+const featureFlagCalledTTL = 24 * time.Hour
+
+func featureFlagCalledKey(distinctId string, key string) string {
+	return "feature_flag_called:" + distinctId + ":" + key
+}
+
+func (c *client) featureFlagCalledReported(distinctId string, key string) bool {
+	if c.Store == nil {
+		return c.distinctIdsFeatureFlagsReported.contains(distinctId, key)
+	}
+
+	_, ok, err := c.Store.Get(featureFlagCalledKey(distinctId, key))
+	if err != nil {
+		c.log(LogLevelError, "reading from store failed", LogField{"error", err})
+		c.fail(fmt.Errorf("reading from store: %w", err))
+	}
+	return ok
+}
+
+func (c *client) reportFeatureFlagCalled(distinctId string, key string) {
+	if c.Store == nil {
+		c.distinctIdsFeatureFlagsReported.add(distinctId, key)
+		return
+	}
+
+	if err := c.Store.Set(featureFlagCalledKey(distinctId, key), []byte{1}, featureFlagCalledTTL); err != nil {
+		c.log(LogLevelError, "writing to store failed", LogField{"error", err})
+		c.fail(fmt.Errorf("writing to store: %w", err))
 	}
-	return flagValue, err
 }
 
 func (c *client) GetFeatureFlags() ([]FeatureFlag, error) {
 	if c.featureFlagsPoller == nil {
 		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
-		c.Errorf(errorMessage)
+		c.log(LogLevelError, errorMessage)
 		return nil, errors.New(errorMessage)
 	}
+	if !c.featureFlagsPoller.flagsLoaded() {
+		return nil, ErrFlagsNotLoaded
+	}
 	return c.featureFlagsPoller.GetFeatureFlags(), nil
 }
 
+func (c *client) WaitForFeatureFlags(ctx context.Context) error {
+	if c.featureFlagsPoller == nil {
+		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
+		c.log(LogLevelError, errorMessage)
+		return errors.New(errorMessage)
+	}
+	return c.featureFlagsPoller.waitForDefinitions(ctx)
+}
+
 func (c *client) GetAllFlags(flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	return c.GetAllFlagsCtx(c.flagsContext(), flagConfig)
+}
 
+func (c *client) GetAllFlagsCtx(ctx context.Context, flagConfig FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	flagConfig.fromContext(ctx)
 	if err := flagConfig.validate(); err != nil {
 		return nil, err
 	}
 
 	if c.featureFlagsPoller == nil {
 		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
-		c.Errorf(errorMessage)
+		c.log(LogLevelError, errorMessage)
 		return nil, errors.New(errorMessage)
 	}
-	return c.featureFlagsPoller.GetAllFlags(flagConfig)
+	if c.OnFlagEvaluated == nil {
+		return c.featureFlagsPoller.GetAllFlags(ctx, flagConfig)
+	}
+
+	start := c.now()
+	flags, evaluatedLocally, err := c.featureFlagsPoller.getAllFlags(ctx, flagConfig)
+	latency := c.now().Sub(start)
+	for key, value := range flags {
+		c.OnFlagEvaluated(FlagEvaluationRecord{
+			Key:              key,
+			DistinctId:       flagConfig.DistinctId,
+			Groups:           flagConfig.Groups,
+			Value:            value,
+			Err:              err,
+			EvaluatedLocally: evaluatedLocally[key],
+			Latency:          latency,
+		})
+	}
+	return flags, err
 }
 
 // Close and flush metrics.
@@ -318,50 +747,126 @@ func (c *client) Close() (err error) {
 		}
 	}()
 	close(c.quit)
+	if c.pump != nil {
+		c.closePump()
+	}
 	<-c.shutdown
 	return
 }
 
+// A request to the loop to write the queued messages to w, the outcome is
+// sent to err.
+type dumpRequest struct {
+	w   io.Writer
+	err chan error
+}
+
+func (c *client) DumpQueue(w io.Writer) error {
+	if c.pump != nil {
+		return c.pumpDump(w)
+	}
+
+	req := dumpRequest{w: w, err: make(chan error, 1)}
+	select {
+	case c.dumps <- req:
+	case <-c.shutdown:
+		return ErrClosed
+	}
+	return <-req.err
+}
+
+// Flush queued messages and wait for them to be sent.
+func (c *client) Flush() error {
+	if c.pump != nil {
+		select {
+		case <-c.shutdown:
+			return ErrClosed
+		default:
+		}
+		return c.pumpMessages(context.Background(), true)
+	}
+
+	done := make(chan struct{})
+	select {
+	case c.flushes <- done:
+	case <-c.shutdown:
+		return ErrClosed
+	}
+	<-done
+	return nil
+}
+
 // Asychronously send a batched requests.
-func (c *client) sendAsync(msgs []message, wg *sync.WaitGroup, ex *executor) {
+func (c *client) sendAsync(key string, msgs []message, wg *sync.WaitGroup, ex *executor) {
 	wg.Add(1)
 
 	if !ex.do(func() {
 		defer wg.Done()
-		defer func() {
-			// In case a bug is introduced in the send function that triggers
-			// a panic, we don't want this to ever crash the application so we
-			// catch it here and log it instead.
-			if err := recover(); err != nil {
-				c.Errorf("panic - %s", err)
-			}
-		}()
-		c.send(msgs)
+		c.sendSafely(context.Background(), key, msgs)
 	}) {
 		wg.Done()
-		c.Errorf("sending messages failed - %s", ErrTooManyRequests)
+		c.log(LogLevelError, "sending messages failed", LogField{"count", len(msgs)}, LogField{"error", ErrTooManyRequests})
 		c.notifyFailure(msgs, ErrTooManyRequests)
 	}
 }
 
-// Send batch request.
-func (c *client) send(msgs []message) {
+func (c *client) sendSafely(ctx context.Context, key string, msgs []message) {
+	defer func() {
+		// In case a bug is introduced in the send function that triggers a
+		// panic, we don't want this to ever crash the application so we catch
+		// it here and log it instead.
+		if err := recover(); err != nil {
+			c.log(LogLevelError, "panic", LogField{"error", err})
+			err := fmt.Errorf("panic while sending messages: %v", err)
+			c.flusher.recordError(err)
+			c.fail(err)
+		}
+	}()
+	c.send(ctx, key, msgs)
+}
+
+// Send batch request, retries are abandoned when ctx is canceled.
+func (c *client) send(ctx context.Context, key string, msgs []message) {
 	const attempts = 10
 
 	b, err := json.Marshal(batch{
-		ApiKey:   c.key,
+		ApiKey:   key,
 		Messages: msgs,
 	})
 
 	if err != nil {
-		c.Errorf("marshalling messages - %s", err)
+		c.log(LogLevelError, "marshalling messages failed", LogField{"count", len(msgs)}, LogField{"error", err})
 		c.notifyFailure(msgs, err)
 		return
 	}
 
+	var headers [][2]string
+	if c.Compression != nil {
+		if b, err = c.Compression.Compress(b); err != nil {
+			c.log(LogLevelError, "compressing messages failed", LogField{"count", len(msgs)}, LogField{"error", err})
+			c.notifyFailure(msgs, err)
+			return
+		}
+		headers = append(headers, [2]string{"Content-Encoding", c.Compression.Encoding()})
+	}
+
+	if c.Tee != nil {
+		if err := c.Tee.write(msgs); err != nil {
+			c.log(LogLevelError, "writing messages to tee failed", LogField{"count", len(msgs)}, LogField{"error", err})
+			c.fail(fmt.Errorf("writing messages to tee: %w", err))
+		}
+	}
+
 	for i := 0; i != attempts; i++ {
-		if err = c.upload(b); err == nil {
-			c.notifySuccess(msgs)
+		var body []byte
+		if body, err = c.upload(ctx, b, headers); err == nil {
+			c.notifyOutcomes(msgs, body, nil)
+			return
+		}
+
+		if !isRetryable(err) {
+			c.log(LogLevelError, "messages dropped because they were rejected", LogField{"count", len(msgs)}, LogField{"error", err})
+			c.notifyOutcomes(msgs, body, err)
 			return
 		}
 
@@ -369,143 +874,206 @@ func (c *client) send(msgs []message) {
 		select {
 		case <-time.After(c.RetryAfter(i)):
 		case <-c.quit:
-			c.Errorf("%d messages dropped because they failed to be sent and the client was closed", len(msgs))
+			c.log(LogLevelError, "messages dropped because they failed to be sent and the client was closed", LogField{"count", len(msgs)}, LogField{"error", err})
+			c.notifyFailure(msgs, err)
+			return
+		case <-ctx.Done():
+			c.log(LogLevelError, "messages dropped because they failed to be sent and the context was canceled", LogField{"count", len(msgs)}, LogField{"error", err})
 			c.notifyFailure(msgs, err)
 			return
 		}
 	}
 
-	c.Errorf("%d messages dropped because they failed to be sent after %d attempts", len(msgs), attempts)
+	c.log(LogLevelError, "messages dropped because they failed to be sent after all attempts", LogField{"count", len(msgs)}, LogField{"attempts", attempts}, LogField{"error", err})
 	c.notifyFailure(msgs, err)
 }
 
-// Upload serialized batch message.
-func (c *client) upload(b []byte) error {
+// Upload serialized batch message, the response body is returned so the
+// outcome of each message can be reported.
+func (c *client) upload(ctx context.Context, b []byte, headers [][2]string) ([]byte, error) {
 	url := c.Endpoint + "/batch/"
-	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
-	if err != nil {
-		c.Errorf("creating request - %s", err)
-		return err
-	}
-
-	version := getVersion()
-
-	req.Header.Add("User-Agent", "posthog-go (version: "+version+")")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Content-Length", fmt.Sprintf("%d", len(b)))
-
-	res, err := c.http.Do(req)
-
-	if err != nil {
-		c.Errorf("sending request - %s", err)
-		return err
-	}
-
-	defer res.Body.Close()
-	return c.report(res)
+	status, body, err := doRequest(ctx, &c.http, "POST", url, b, headers)
+	c.report(url, status, body, err)
+	return body, err
 }
 
-// Report on response body.
-func (c *client) report(res *http.Response) (err error) {
-	var body []byte
-
-	if res.StatusCode < 300 {
-		c.debugf("response %s", res.Status)
-		return
-	}
-
-	if body, err = ioutil.ReadAll(res.Body); err != nil {
-		c.Errorf("response %d %s - %s", res.StatusCode, res.Status, err)
-		return
+// Report on response.
+func (c *client) report(url string, status int, body []byte, err error) {
+	var apiErr *APIError
+
+	switch {
+	case err == nil:
+		c.log(LogLevelDebug, "response", LogField{"endpoint", url}, LogField{"status", status})
+	case errors.As(err, &apiErr):
+		c.log(LogLevelWarn, "request rejected", LogField{"endpoint", url}, LogField{"status", status}, LogField{"body", string(body)})
+	case status != 0:
+		c.log(LogLevelError, "reading response failed", LogField{"endpoint", url}, LogField{"status", status}, LogField{"error", err})
+	default:
+		c.log(LogLevelError, "sending request failed", LogField{"endpoint", url}, LogField{"error", err})
 	}
-
-	c.logf("response %d %s – %s", res.StatusCode, res.Status, string(body))
-	return fmt.Errorf("%d %s", res.StatusCode, res.Status)
 }
 
 // Batch loop.
 func (c *client) loop() {
 	defer close(c.shutdown)
 	if c.featureFlagsPoller != nil {
-		defer c.featureFlagsPoller.shutdownPoller()
+		defer c.featureFlagsPoller.Shutdown()
 	}
 
 	wg := &sync.WaitGroup{}
 	defer wg.Wait()
 
-	tick := time.NewTicker(c.Interval)
-	defer tick.Stop()
+	// Inline flushing replaces the timer, a nil channel never fires.
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if !c.InlineFlush {
+		ticker = time.NewTicker(c.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 
 	ex := newExecutor(c.maxConcurrentRequests)
 	defer ex.close()
 
-	mq := messageQueue{
+	mq := messageQueues{
 		maxBatchSize:  c.BatchSize,
 		maxBatchBytes: c.maxBatchBytes(),
 	}
 
-	for {
-		select {
-		case msg := <-c.msgs:
-			c.push(&mq, msg, wg, ex)
+	c.flusher.setRunning(true)
+	defer c.flusher.setRunning(false)
 
-		case <-tick.C:
-			c.flush(&mq, wg, ex)
+	send := func(key string, msgs []message) { c.sendAsync(key, msgs, wg, ex) }
 
-		case <-c.quit:
-			c.debugf("exit requested – draining messages")
+	// Called after the timer flushed the queues.
+	adapt := func() {}
+	if c.AdaptiveBatching != nil && ticker != nil {
+		b := newBatchingController(*c.AdaptiveBatching, c.BatchSize, c.Interval)
+		mq.setBatchSize(b.batchSize)
+		ticker.Reset(b.interval)
 
-			// Drain the msg channel, we have to close it first so no more
-			// messages can be pushed and otherwise the loop would never end.
-			close(c.msgs)
-			for msg := range c.msgs {
-				c.push(&mq, msg, wg, ex)
+		adapt = func() {
+			if b.adjust(mq.takeReceived()) {
+				c.log(LogLevelDebug, "adapting batching", LogField{"batch_size", b.batchSize}, LogField{"interval", b.interval})
+				mq.setBatchSize(b.batchSize)
+				ticker.Reset(b.interval)
 			}
+		}
+	}
 
-			c.flush(&mq, wg, ex)
-			c.debugf("exit")
-			return
+	for stop := false; !stop; {
+		c.flusher.protect(func() { stop = c.step(tick, &mq, wg, send, adapt) }, func(err error) {
+			c.log(LogLevelError, "panic", LogField{"error", err})
+			c.fail(err)
+		})
+	}
+}
+
+// Handles one event of the loop and reports whether the loop must stop. It is
+// supervised by the flusher subsystem, so a panic only loses the event being
+// handled.
+func (c *client) step(tick <-chan time.Time, mq *messageQueues, wg *sync.WaitGroup, send func(string, []message), adapt func()) (stop bool) {
+	select {
+	case msg := <-c.msgs:
+		c.push(mq, msg, send)
+
+	case <-tick:
+		c.flush(mq, send)
+		adapt()
+
+	case done := <-c.flushes:
+		defer close(done)
+		c.drain(mq, send)
+		c.flush(mq, send)
+		wg.Wait()
+
+	case req := <-c.dumps:
+		err := errors.New("dumping the queue was interrupted")
+		defer func() { req.err <- err }()
+		c.drain(mq, send)
+		err = c.dump(mq, req.w)
+
+	case <-c.quit:
+		// The channel can only be closed once, so the loop stops even if
+		// draining panics.
+		stop = true
+		c.log(LogLevelDebug, "exit requested – draining messages")
+
+		// Drain the msg channel, we have to close it first so no more
+		// messages can be pushed and otherwise the loop would never end.
+		close(c.msgs)
+		for msg := range c.msgs {
+			c.push(mq, msg, send)
 		}
+
+		c.flush(mq, send)
+		c.log(LogLevelDebug, "exit")
 	}
+	return
 }
 
-func (c *client) push(q *messageQueue, m APIMessage, wg *sync.WaitGroup, ex *executor) {
+// Adds a message to the queue of its project, send is called with the batch
+// when the queue is full.
+func (c *client) push(qs *messageQueues, qm queuedMessage, send func(string, []message)) {
 	var msg message
 	var err error
+	var m = qm.msg
 
 	if msg, err = makeMessage(m, maxMessageBytes); err != nil {
-		c.Errorf("%s - %v", err, m)
+		c.log(LogLevelError, "invalid message", LogField{"error", err}, LogField{"message", m})
 		c.notifyFailure([]message{{m, nil}}, err)
 		return
 	}
 
-	c.debugf("buffer (%d/%d) %v", len(q.pending), c.BatchSize, m)
+	q := qs.get(qm.key)
+	qs.received++
+	c.log(LogLevelDebug, "buffer", LogField{"count", len(q.pending)}, LogField{"batch_size", q.maxBatchSize}, LogField{"message", m})
 
 	if msgs := q.push(msg); msgs != nil {
-		c.debugf("exceeded messages batch limit with batch of %d messages – flushing", len(msgs))
-		c.sendAsync(msgs, wg, ex)
+		c.log(LogLevelDebug, "exceeded messages batch limit – flushing", LogField{"count", len(msgs)})
+		send(q.key, msgs)
 	}
 }
 
-func (c *client) flush(q *messageQueue, wg *sync.WaitGroup, ex *executor) {
-	if msgs := q.flush(); msgs != nil {
-		c.debugf("flushing %d messages", len(msgs))
-		c.sendAsync(msgs, wg, ex)
+// Messages enqueued before a flush or dump was requested may still be sitting
+// in the channel buffer, this picks them up without blocking.
+func (c *client) drain(q *messageQueues, send func(string, []message)) {
+	for {
+		select {
+		case msg := <-c.msgs:
+			c.push(q, msg, send)
+		default:
+			return
+		}
 	}
 }
 
-func (c *client) debugf(format string, args ...interface{}) {
-	if c.Verbose {
-		c.logf(format, args...)
+func (c *client) flush(qs *messageQueues, send func(string, []message)) {
+	for _, q := range qs.all() {
+		if msgs := q.flush(); msgs != nil {
+			c.log(LogLevelDebug, "flushing messages", LogField{"count", len(msgs)})
+			send(q.key, msgs)
+		}
 	}
 }
 
-func (c *client) logf(format string, args ...interface{}) {
-	c.Logger.Logf(format, args...)
+// Writes the messages of all queues as newline-delimited JSON.
+func (c *client) dump(qs *messageQueues, w io.Writer) error {
+	for _, q := range qs.all() {
+		if err := writeNDJSON(w, q.pending); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (c *client) Errorf(format string, args ...interface{}) {
-	c.Logger.Errorf(format, args...)
+// Logs a message with structured fields, debug entries are dropped unless the
+// client is verbose.
+func (c *client) log(level LogLevel, msg string, fields ...LogField) {
+	if level == LogLevelDebug && !c.Verbose {
+		return
+	}
+	writeLog(c.Logger, level, msg, fields...)
 }
 
 func (c *client) maxBatchBytes() int {
@@ -524,21 +1092,61 @@ func (c *client) notifySuccess(msgs []message) {
 }
 
 func (c *client) notifyFailure(msgs []message, err error) {
+	c.flusher.recordError(err)
+	if c.Fallback != nil {
+		if err := c.Fallback.write(msgs); err != nil {
+			c.log(LogLevelError, "writing messages to fallback failed", LogField{"count", len(msgs)}, LogField{"error", err})
+			c.fail(fmt.Errorf("writing messages to fallback: %w", err))
+		}
+	}
 	if c.Callback != nil {
 		for _, m := range msgs {
 			c.Callback.Failure(m.msg, err)
 		}
 	}
+	c.fail(fmt.Errorf("%d messages dropped: %w", len(msgs), err))
+}
+
+// Passes a background error to the error handler in strict mode.
+func (c *client) fail(err error) {
+	if c.Strict {
+		c.ErrorHandler(err)
+	}
+}
+
+// The context of flag requests made by the methods without a context
+// argument, they are canceled when the client is closed.
+func (c *client) flagsContext() context.Context {
+	if c.featureFlagsPoller != nil {
+		return c.featureFlagsPoller.ctx
+	}
+	return context.Background()
+}
+
+// Returns the flags attached to a captured event, they are evaluated locally
+// once definitions are loaded, flags that can't be evaluated locally are left
+// out. /decide is called until then.
+func (c *client) captureFeatureVariants(ctx context.Context, distinctId string, groups Groups) (map[string]interface{}, error) {
+	if c.featureFlagsPoller != nil && c.featureFlagsPoller.flagsLoaded() {
+		return c.featureFlagsPoller.GetAllFlags(ctx, FeatureFlagPayloadNoKey{
+			DistinctId:          distinctId,
+			Groups:              groups,
+			PersonProperties:    NewProperties(),
+			GroupProperties:     map[string]Properties{},
+			OnlyEvaluateLocally: true,
+		})
+	}
+	return c.getFeatureVariants(ctx, distinctId, groups, NewProperties(), map[string]Properties{})
 }
 
-func (c *client) getFeatureVariants(distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (map[string]interface{}, error) {
+func (c *client) getFeatureVariants(ctx context.Context, distinctId string, groups Groups, personProperties Properties, groupProperties map[string]Properties) (map[string]interface{}, error) {
 	if c.featureFlagsPoller == nil {
 		errorMessage := "specifying a PersonalApiKey is required for using feature flags"
-		c.Errorf(errorMessage)
+		c.log(LogLevelError, errorMessage)
 		return nil, errors.New(errorMessage)
 	}
 
-	featureVariants, err := c.featureFlagsPoller.getFeatureFlagVariants(distinctId, groups, personProperties, groupProperties)
+	featureVariants, err := c.featureFlagsPoller.getFeatureFlagVariants(ctx, distinctId, groups, personProperties, groupProperties)
 	if err != nil {
 		return nil, err
 	}
@@ -13,8 +13,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Helper type used to implement the io.Reader interface on function values.
@@ -224,7 +227,8 @@ func ExampleCapture() {
 	//       },
 	//       "send_feature_flags": false,
 	//       "timestamp": "2009-11-10T23:00:00Z",
-	//       "type": "capture"
+	//       "type": "capture",
+	//       "uuid": "I'm unique"
 	//     }
 	//   ]
 	// }
@@ -435,6 +439,52 @@ func TestCaptureWithTimestamp(t *testing.T) {
 	}
 }
 
+func TestCaptureWithLocalTimestamp(t *testing.T) {
+	var ref = strings.TrimSpace(fixture("test-timestamp-capture.json"))
+
+	body, server := mockServer()
+	defer server.Close()
+
+	warnings := make(chan []LogField, 1)
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:  server.URL,
+		BatchSize: 1,
+		now:       mockTime,
+		uid:       mockId,
+		Logger: testLeveledLogger{log: func(level LogLevel, msg string, fields ...LogField) {
+			if level == LogLevelWarn {
+				warnings <- fields
+			}
+		}},
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{
+		Event:      "Download",
+		DistinctId: "123456",
+		Properties: Properties{
+			"application": "PostHog Go",
+			"version":     "1.0.0",
+			"platform":    "macos", // :)
+		},
+		SendFeatureFlags: false,
+		Timestamp:        time.Date(2015, time.July, 11, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	})
+
+	if res := string(<-body); ref != res {
+		t.Errorf("invalid response:\n- expected %s\n- received: %s", ref, res)
+	}
+
+	select {
+	case fields := <-warnings:
+		if fields[0].Key != "timestamp" || fields[1].Key != "skew" {
+			t.Errorf("invalid warning fields: %v", fields)
+		}
+	default:
+		t.Error("expected a warning for a skewed local-zone timestamp")
+	}
+}
+
 func TestCaptureMany(t *testing.T) {
 	var ref = strings.TrimSpace(fixture("test-many-capture.json"))
 
@@ -785,7 +835,7 @@ func TestSimpleFlagOld(t *testing.T) {
 		},
 	)
 
-	if checkErr != nil || isEnabled != true {
+	if checkErr != nil || isEnabled == nil || !*isEnabled {
 		t.Errorf("simple flag with null rollout percentage should be on for everyone")
 	}
 
@@ -809,7 +859,7 @@ func TestSimpleFlagCalculation(t *testing.T) {
 
 func TestComplexFlag(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte(fixture("test-api-feature-flag.json")))
@@ -832,7 +882,7 @@ func TestComplexFlag(t *testing.T) {
 		},
 	)
 
-	if checkErr != nil || isEnabled != true {
+	if checkErr != nil || isEnabled == nil || !*isEnabled {
 		t.Errorf("flag listed in /decide/ response should be marked as enabled")
 	}
 
@@ -850,7 +900,7 @@ func TestComplexFlag(t *testing.T) {
 
 func TestMultiVariateFlag(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte("{}"))
@@ -873,7 +923,7 @@ func TestMultiVariateFlag(t *testing.T) {
 		},
 	)
 
-	if checkErr != nil || isEnabled == false {
+	if checkErr != nil || isEnabled == nil || !*isEnabled {
 		t.Errorf("flag listed in /decide/ response should be marked as enabled")
 	}
 
@@ -891,7 +941,7 @@ func TestMultiVariateFlag(t *testing.T) {
 
 func TestDisabledFlag(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/decide") {
+		if isFlagsRequest(r) {
 			w.Write([]byte(fixture("test-decide-v2.json")))
 		} else if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
 			w.Write([]byte("{}"))
@@ -914,7 +964,7 @@ func TestDisabledFlag(t *testing.T) {
 		},
 	)
 
-	if checkErr != nil || isEnabled == true {
+	if checkErr != nil || isEnabled == nil || *isEnabled {
 		t.Errorf("flag listed in /decide/ response should be marked as disabled")
 	}
 
@@ -929,3 +979,156 @@ func TestDisabledFlag(t *testing.T) {
 		t.Errorf("flag listed in /decide/ response should have value 'false'")
 	}
 }
+
+func TestClientFlush(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:  server.URL,
+		Interval:  time.Hour,
+		BatchSize: 100,
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A"})
+	client.Enqueue(Capture{DistinctId: "1", Event: "B"})
+
+	if err := client.Flush(); err != nil {
+		t.Fatal("flushing should not return an error:", err)
+	}
+
+	if n := atomic.LoadInt32(&count); n != 1 {
+		t.Errorf("expected 1 batch to be sent before Flush returned, got %d", n)
+	}
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "C"})
+	client.Flush()
+
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Errorf("expected the client to remain usable after Flush, got %d batches", n)
+	}
+}
+
+func TestClientFlushAfterClose(t *testing.T) {
+	client := New("0123456789")
+	client.Close()
+
+	if err := client.Flush(); err != ErrClosed {
+		t.Error("flushing a closed client should return ErrClosed:", err)
+	}
+}
+
+func TestClientInlineFlush(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	defer server.Close()
+
+	var now int64
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:    server.URL,
+		Interval:    time.Minute,
+		InlineFlush: true,
+		now:         func() time.Time { return mockTime().Add(time.Duration(atomic.LoadInt64(&now))) },
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A"})
+
+	if n := atomic.LoadInt32(&count); n != 0 {
+		t.Errorf("expected no batch to be sent before the interval elapsed, got %d", n)
+	}
+
+	atomic.StoreInt64(&now, int64(time.Minute))
+	client.Enqueue(Capture{DistinctId: "1", Event: "B"})
+
+	if n := atomic.LoadInt32(&count); n != 1 {
+		t.Errorf("expected the batch to be sent by Enqueue once the interval elapsed, got %d", n)
+	}
+}
+
+func TestClientStrictMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	errs := make(chan error, 10)
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+		Logger:         testLogger{t.Logf, t.Logf},
+		Strict:         true,
+		ErrorHandler:   func(err error) { errs <- err },
+		BatchSize:      1,
+		RetryAfter:     func(i int) time.Duration { return time.Millisecond },
+	})
+	defer client.Close()
+
+	var apiErr *APIError
+	if err := <-errs; !errors.As(err, &apiErr) || !strings.Contains(err.Error(), "feature flags") {
+		t.Error("expected the flags fetch failure to be reported, got", err)
+	}
+
+	err := client.Enqueue(Capture{DistinctId: "1", Event: "A", Properties: NewProperties(), SendFeatureFlags: true})
+	if !errors.Is(err, ErrRemoteEvaluationFailed) {
+		t.Error("expected Enqueue to fail when feature flags can't be attached, got", err)
+	}
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A", Properties: NewProperties().Set("blob", strings.Repeat("a", maxMessageBytes))})
+
+	if err := <-errs; !errors.Is(err, ErrMessageTooBig) {
+		t.Error("expected the dropped message to be reported, got", err)
+	}
+}
+
+func TestClientEnqueueWithResult(t *testing.T) {
+	body := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body <- b
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:  server.URL,
+		Logger:    testLogger{t.Logf, t.Logf},
+		BatchSize: 2,
+	})
+	defer client.Close()
+
+	local := time.Date(2022, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	generated, err := client.EnqueueWithResult(Capture{DistinctId: "1", Event: "A", Timestamp: local})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uuid.Parse(generated.Uuid); err != nil {
+		t.Errorf("expected a generated UUID, got %q", generated.Uuid)
+	}
+	if !generated.Timestamp.Equal(local) || generated.Timestamp.Location() != time.UTC {
+		t.Errorf("expected the timestamp to be normalized to UTC, got %v", generated.Timestamp)
+	}
+
+	provided, _ := client.EnqueueWithResult(Identify{DistinctId: "1", Uuid: "0184e1d4-0000-0000-0000-000000000000"})
+	if provided.Uuid != "0184e1d4-0000-0000-0000-000000000000" {
+		t.Errorf("expected the provided UUID to be kept, got %q", provided.Uuid)
+	}
+
+	var batch struct {
+		Batch []struct{ Uuid string }
+	}
+	json.Unmarshal(<-body, &batch)
+	if len(batch.Batch) != 2 || batch.Batch[0].Uuid != generated.Uuid || batch.Batch[1].Uuid != provided.Uuid {
+		t.Errorf("expected the UUIDs to be sent, got %+v", batch)
+	}
+
+	client.Close()
+	if result, err := client.EnqueueWithResult(Capture{DistinctId: "1", Event: "A"}); err != ErrClosed || result.Uuid != "" {
+		t.Errorf("expected ErrClosed and an empty result, got %+v %v", result, err)
+	}
+}
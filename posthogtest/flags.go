@@ -0,0 +1,225 @@
+// Package posthogtest helps testing code that uses PostHog feature flags.
+// Flag definitions are built in Go and loaded into a client without any HTTP
+// server, flags are evaluated locally from them like in production.
+//
+//	definitions := posthogtest.NewDefinitions(
+//		posthogtest.Flag("new-checkout").
+//			When(posthogtest.Condition().Where("plan", "exact", []string{"pro"})),
+//		posthogtest.Flag("pricing-page").
+//			Variant("control", 50).
+//			Variant("test", 50).
+//			Payload("test", map[string]interface{}{"price": 9}),
+//	)
+//	client, err := definitions.NewClient()
+package posthogtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/posthog/posthog-go"
+)
+
+// FlagBuilder builds the definition of a feature flag, returned by Flag.
+type FlagBuilder struct {
+	flag posthog.FeatureFlag
+}
+
+// Flag starts the definition of an active flag. Flags without conditions are
+// enabled for everyone.
+func Flag(key string) *FlagBuilder {
+	return &FlagBuilder{flag: posthog.FeatureFlag{Key: key, Active: true}}
+}
+
+// Disabled makes the flag inactive, it is disabled for everyone whatever its
+// conditions.
+func (b *FlagBuilder) Disabled() *FlagBuilder {
+	b.flag.Active = false
+	return b
+}
+
+// When adds a condition group, the flag is enabled when any of its condition
+// groups matches.
+func (b *FlagBuilder) When(condition *ConditionBuilder) *FlagBuilder {
+	b.flag.Filters.Groups = append(b.flag.Filters.Groups, condition.group)
+	return b
+}
+
+// Rollout adds a condition group enabling the flag for a percentage of
+// everyone.
+func (b *FlagBuilder) Rollout(percentage uint8) *FlagBuilder {
+	return b.When(Condition().Rollout(percentage))
+}
+
+// Variant adds a variant rolled out to a percentage of the persons for which
+// the flag is enabled. The percentages of the variants must add up to 100.
+func (b *FlagBuilder) Variant(key string, percentage uint8) *FlagBuilder {
+	if b.flag.Filters.Multivariate == nil {
+		b.flag.Filters.Multivariate = &posthog.Variants{}
+	}
+	b.flag.Filters.Multivariate.Variants = append(b.flag.Filters.Multivariate.Variants, posthog.FlagVariant{
+		Key:               key,
+		RolloutPercentage: &percentage,
+	})
+	return b
+}
+
+// Payload sets the payload of a variant, or of the flag when value is "true"
+// for flags without variants. The payload is marshaled to JSON and panics
+// when it can't be.
+func (b *FlagBuilder) Payload(value string, payload interface{}) *FlagBuilder {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	if b.flag.Filters.Payloads == nil {
+		b.flag.Filters.Payloads = map[string]json.RawMessage{}
+	}
+	b.flag.Filters.Payloads[value] = raw
+	return b
+}
+
+// GroupType makes the flag roll out by the groups of the type with the given
+// index instead of by person, see Definitions.GroupType.
+func (b *FlagBuilder) GroupType(index uint8) *FlagBuilder {
+	b.flag.Filters.AggregationGroupTypeIndex = &index
+	return b
+}
+
+// Build returns the definition of the flag.
+func (b *FlagBuilder) Build() posthog.FeatureFlag {
+	flag := b.flag
+	if len(flag.Filters.Groups) == 0 {
+		flag.Filters.Groups = []posthog.PropertyGroup{{Properties: []posthog.Property{}}}
+	}
+	return flag
+}
+
+// ConditionBuilder builds a condition group of a flag, returned by Condition.
+type ConditionBuilder struct {
+	group posthog.PropertyGroup
+}
+
+// Condition starts a condition group, which matches everyone until
+// properties or a rollout percentage are added.
+func Condition() *ConditionBuilder {
+	return &ConditionBuilder{group: posthog.PropertyGroup{Properties: []posthog.Property{}}}
+}
+
+// Where adds a comparison of a property of the person, or of the group for
+// group flags, with an operator of the flag filters like "exact", "icontains"
+// or "gt". All the properties of a condition group must match.
+func (c *ConditionBuilder) Where(key string, operator string, value interface{}) *ConditionBuilder {
+	c.group.Properties = append(c.group.Properties, posthog.Property{
+		Key:      key,
+		Operator: operator,
+		Value:    value,
+		Type:     "person",
+	})
+	return c
+}
+
+// InCohort adds a condition on the membership of a cohort, see
+// Definitions.Cohort.
+func (c *ConditionBuilder) InCohort(id int) *ConditionBuilder {
+	c.group.Properties = append(c.group.Properties, posthog.Property{
+		Key:   "id",
+		Value: id,
+		Type:  "cohort",
+	})
+	return c
+}
+
+// Rollout limits the condition group to a percentage of the persons matching
+// its properties.
+func (c *ConditionBuilder) Rollout(percentage uint8) *ConditionBuilder {
+	c.group.RolloutPercentage = &percentage
+	return c
+}
+
+// Variant forces the variant of the flag when the condition group matches.
+func (c *ConditionBuilder) Variant(key string) *ConditionBuilder {
+	c.group.Variant = &key
+	return c
+}
+
+// Definitions are the flag definitions of a project, in the format of the
+// local evaluation endpoint.
+type Definitions struct {
+	response posthog.FeatureFlagsResponse
+}
+
+// NewDefinitions returns the definitions of the given flags.
+func NewDefinitions(flags ...*FlagBuilder) *Definitions {
+	return (&Definitions{}).Add(flags...)
+}
+
+// Add adds flags to the definitions.
+func (d *Definitions) Add(flags ...*FlagBuilder) *Definitions {
+	for _, flag := range flags {
+		d.response.Flags = append(d.response.Flags, flag.Build())
+	}
+	return d
+}
+
+// GroupType maps the index of a group type, as used by FlagBuilder.GroupType,
+// to its name, as used in posthog.Groups.
+func (d *Definitions) GroupType(index uint8, name string) *Definitions {
+	if d.response.GroupTypeMapping == nil {
+		d.response.GroupTypeMapping = &map[string]string{}
+	}
+	(*d.response.GroupTypeMapping)[strconv.Itoa(int(index))] = name
+	return d
+}
+
+// Cohort adds the definition of a cohort, referenced by
+// ConditionBuilder.InCohort.
+func (d *Definitions) Cohort(id int, cohort posthog.CohortProperties) *Definitions {
+	if d.response.Cohorts == nil {
+		d.response.Cohorts = map[string]posthog.CohortProperties{}
+	}
+	d.response.Cohorts[strconv.Itoa(id)] = cohort
+	return d
+}
+
+// JSON returns the definitions as served by the local evaluation endpoint,
+// the format of posthog.Config.FeatureFlagsFile.
+func (d *Definitions) JSON() []byte {
+	body, err := json.Marshal(d.response)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+// Config returns config with the definitions as FeatureFlagsReader, flags are
+// evaluated offline from them. Requests sending events are discarded unless
+// config has a Transport.
+func (d *Definitions) Config(config posthog.Config) posthog.Config {
+	config.FeatureFlagsReader = bytes.NewReader(d.JSON())
+	if config.Transport == nil {
+		config.Transport = discardTransport{}
+	}
+	return config
+}
+
+// NewClient returns a client evaluating flags from the definitions, which
+// never makes requests.
+func (d *Definitions) NewClient() (posthog.Client, error) {
+	return posthog.NewWithConfig("posthogtest", d.Config(posthog.Config{}))
+}
+
+// Accepts every request without sending it.
+type discardTransport struct{}
+
+func (discardTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		io.Copy(ioutil.Discard, r.Body)
+		r.Body.Close()
+	}
+	return response(r, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, "{}"), nil
+}
@@ -0,0 +1,76 @@
+package posthogtest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+)
+
+func TestDefinitions(t *testing.T) {
+	definitions := NewDefinitions(
+		Flag("everyone"),
+		Flag("off").Disabled(),
+		Flag("nobody").Rollout(0),
+		Flag("pro-plan").When(Condition().Where("plan", "exact", []string{"pro"})),
+		Flag("pricing-page").
+			When(Condition().Where("email", "icontains", "@example.com").Variant("test")).
+			Rollout(100).
+			Variant("control", 100).
+			Variant("test", 0).
+			Payload("test", map[string]interface{}{"price": 9}),
+		Flag("beta-testers").When(Condition().InCohort(7)),
+		Flag("company-flag").GroupType(0).When(Condition().Where("seats", "gt", 10)),
+	).
+		GroupType(0, "company").
+		Cohort(7, posthog.CohortProperties{Type: "AND", Values: []posthog.CohortProperties{{Key: "beta", Operator: "exact", Value: []interface{}{true}}}})
+
+	client, err := definitions.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		payload  posthog.FeatureFlagPayload
+		expected interface{}
+	}{
+		{posthog.FeatureFlagPayload{Key: "everyone"}, true},
+		{posthog.FeatureFlagPayload{Key: "off"}, false},
+		{posthog.FeatureFlagPayload{Key: "nobody"}, false},
+		{posthog.FeatureFlagPayload{Key: "pro-plan", PersonProperties: posthog.NewProperties().Set("plan", "pro")}, true},
+		{posthog.FeatureFlagPayload{Key: "pro-plan", PersonProperties: posthog.NewProperties().Set("plan", "free")}, false},
+		{posthog.FeatureFlagPayload{Key: "pricing-page", PersonProperties: posthog.NewProperties().Set("email", "someone@example.com")}, "test"},
+		{posthog.FeatureFlagPayload{Key: "pricing-page", PersonProperties: posthog.NewProperties().Set("email", "someone@example.org")}, "control"},
+		{posthog.FeatureFlagPayload{Key: "beta-testers", PersonProperties: posthog.NewProperties().Set("beta", true)}, true},
+		{posthog.FeatureFlagPayload{Key: "company-flag", Groups: posthog.NewGroups().Set("company", "acme"), GroupProperties: map[string]posthog.Properties{"company": posthog.NewProperties().Set("seats", 12)}}, true},
+	}
+	for _, test := range tests {
+		test.payload.DistinctId = "some-distinct-id"
+		test.payload.OnlyEvaluateLocally = true
+		if value, err := client.GetFeatureFlag(test.payload); err != nil || value != test.expected {
+			t.Errorf("%s: expected %v, got %v %v", test.payload.Key, test.expected, value, err)
+		}
+	}
+
+	result, err := client.GetFeatureFlagResult(posthog.FeatureFlagPayload{
+		Key:              "pricing-page",
+		DistinctId:       "some-distinct-id",
+		PersonProperties: posthog.NewProperties().Set("email", "someone@example.com"),
+	})
+	if err != nil || string(result.Payload) != `{"price":9}` {
+		t.Errorf("Expected the payload of the variant, got %+v %v", result, err)
+	}
+}
+
+func TestFlagBuild(t *testing.T) {
+	flag := Flag("some-flag").Build()
+	if !flag.Active || len(flag.Filters.Groups) != 1 || flag.Filters.Groups[0].RolloutPercentage != nil {
+		t.Errorf("Expected a flag enabled for everyone, got %+v", flag)
+	}
+
+	definitions := posthog.FeatureFlagsResponse{}
+	if err := json.Unmarshal(NewDefinitions(Flag("some-flag")).JSON(), &definitions); err != nil || len(definitions.Flags) != 1 {
+		t.Errorf("Expected the definitions to be valid JSON, got %+v %v", definitions, err)
+	}
+}
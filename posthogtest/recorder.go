@@ -0,0 +1,187 @@
+package posthogtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode is whether a Recorder records or replays responses.
+type Mode int
+
+const (
+	// Responses are fetched with the underlying transport and written to
+	// the directory of the recorder.
+	ModeRecord Mode = iota
+
+	// Responses are read from the directory of the recorder, no request is
+	// made.
+	ModeReplay
+)
+
+// Recorder is an http.RoundTripper recording the responses of remote flag
+// evaluations and flag definitions to a directory, to replay them later. It
+// makes CI runs deterministic and lets production flag behavior be
+// reproduced offline. It is set as posthog.Config.Transport.
+//
+//	mode := posthogtest.ModeReplay
+//	if os.Getenv("RECORD") != "" {
+//		mode = posthogtest.ModeRecord
+//	}
+//	client, _ := posthog.NewWithConfig(apiKey, posthog.Config{
+//		PersonalApiKey: personalApiKey,
+//		Transport:      posthogtest.NewRecorder("testdata/posthog", mode, nil),
+//	})
+//
+// Responses are matched by method, path, query and body, so a request is
+// replayed only if the same one was recorded. Batches of events aren't
+// recorded, they are sent when recording and accepted without being sent
+// when replaying. Authorization headers aren't recorded.
+type Recorder struct {
+	dir       string
+	mode      Mode
+	transport http.RoundTripper
+}
+
+// The recording of a response, stored as JSON.
+type recording struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// NewRecorder returns a recorder storing responses in dir, requests are made
+// with transport when recording, http.DefaultTransport when it is nil.
+func NewRecorder(dir string, mode Mode, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, mode: mode, transport: transport}
+}
+
+func (rec *Recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	recorded := isRecorded(r)
+	if rec.mode == ModeReplay {
+		if !recorded {
+			return response(r, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, "{}"), nil
+		}
+		return rec.replay(r, body)
+	}
+
+	res, err := rec.transport.RoundTrip(r)
+	if err != nil || !recorded {
+		return res, err
+	}
+	return rec.record(r, body, res)
+}
+
+// Reports whether the responses of the request are recorded, batches aren't.
+func isRecorded(r *http.Request) bool {
+	return !strings.HasPrefix(r.URL.Path, "/batch")
+}
+
+func (rec *Recorder) replay(r *http.Request, body []byte) (*http.Response, error) {
+	path := rec.path(r, body)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("posthogtest: no recording of %s %s in %s", r.Method, r.URL.Path, path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var recording recording
+	if err := json.Unmarshal(b, &recording); err != nil {
+		return nil, fmt.Errorf("posthogtest: invalid recording %s: %w", path, err)
+	}
+	return response(r, recording.Status, recording.Header, recording.Body), nil
+}
+
+// Writes the response to the directory and returns a copy of it. The body is
+// stored decompressed so recordings can be read and edited. Responses to
+// conditional requests that didn't change aren't recorded, they would
+// replace the full response.
+func (rec *Recorder) record(r *http.Request, body []byte, res *http.Response) (*http.Response, error) {
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := res.Header.Clone()
+	if header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(bytes.NewReader(resBody))
+		if err != nil {
+			return nil, err
+		}
+		if resBody, err = ioutil.ReadAll(gz); err != nil {
+			return nil, err
+		}
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+	}
+
+	if res.StatusCode != http.StatusNotModified {
+		b, err := json.MarshalIndent(recording{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Status: res.StatusCode,
+			Header: header,
+			Body:   string(resBody),
+		}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(rec.dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(rec.path(r, body), b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return response(r, res.StatusCode, header, string(resBody)), nil
+}
+
+// Returns the path of the recording of the request, named after the endpoint
+// and a hash of the request.
+func (rec *Recorder) path(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.Query().Encode())
+	h.Write(body)
+
+	name := strings.Trim(strings.Replace(r.URL.Path, "/", "_", -1), "_")
+	return filepath.Join(rec.dir, fmt.Sprintf("%s-%s.json", name, hex.EncodeToString(h.Sum(nil))[:16]))
+}
+
+func response(r *http.Request, status int, header http.Header, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
@@ -0,0 +1,66 @@
+package posthogtest
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	server := NewServer()
+	server.SetDefinitions(NewDefinitions(Flag("local-flag").Variant("recorded", 100)))
+	server.HandleFlags(func(request posthog.DecideRequestData) posthog.DecideResponse {
+		return posthog.DecideResponse{FeatureFlags: map[string]interface{}{"remote-flag": "variant-" + request.DistinctId}}
+	})
+
+	evaluate := func(config posthog.Config) (local interface{}, remote interface{}) {
+		client, err := posthog.NewWithConfig("some-api-key", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if err := client.WaitForFeatureFlags(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		local, _ = client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "local-flag", DistinctId: "some-distinct-id"})
+		remote, err = client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "remote-flag", DistinctId: "some-distinct-id"})
+		if err != nil {
+			t.Error(err)
+		}
+		return local, remote
+	}
+
+	config := server.Config(posthog.Config{Transport: NewRecorder(dir, ModeRecord, nil)})
+	if local, remote := evaluate(config); local != "recorded" || remote != "variant-some-distinct-id" {
+		t.Fatal("Expected the flags of the server, got", local, remote)
+	}
+	server.Close()
+
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(recordings) != 2 {
+		t.Fatalf("Expected the definitions and the remote evaluation to be recorded, got %v", recordings)
+	}
+	for _, recording := range recordings {
+		b, _ := ioutil.ReadFile(recording)
+		if strings.Contains(string(b), "posthogtest") {
+			t.Errorf("Expected the personal API key not to be recorded, got %s", b)
+		}
+	}
+
+	config.Transport = NewRecorder(dir, ModeReplay, nil)
+	if local, remote := evaluate(config); local != "recorded" || remote != "variant-some-distinct-id" {
+		t.Error("Expected the recorded flags to be replayed, got", local, remote)
+	}
+
+	client, _ := posthog.NewWithConfig("some-api-key", config)
+	defer client.Close()
+	if _, err := client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "remote-flag", DistinctId: "other-distinct-id"}); err == nil || !strings.Contains(err.Error(), "no recording") {
+		t.Error("Expected requests that weren't recorded to fail, got", err)
+	}
+}
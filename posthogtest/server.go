@@ -0,0 +1,249 @@
+package posthogtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/posthog/posthog-go"
+)
+
+// Server is a fake PostHog instance for end-to-end tests of an integration,
+// it serves batches, flag evaluations and flag definitions and records the
+// requests it receives. Clients are pointed to it with Server.Config.
+//
+//	server := posthogtest.NewServer()
+//	defer server.Close()
+//	server.SetFlags(map[string]interface{}{"new-checkout": true})
+//
+//	client, _ := posthog.NewWithConfig("api-key", server.Config(posthog.Config{}))
+//	...
+//	client.Close()
+//	events := server.Messages()
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    []Request
+	messages    []Message
+	definitions *Definitions
+	flags       func(posthog.DecideRequestData) posthog.DecideResponse
+	statuses    map[string]int
+}
+
+// A request received by the server, its body is decompressed.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// A message of a batch received by the server.
+type Message struct {
+	ApiKey     string
+	Type       string
+	Event      string
+	DistinctId string
+	Properties map[string]interface{}
+
+	// The message as sent by the client.
+	Raw json.RawMessage
+}
+
+// NewServer starts a server without flags, it must be closed when the test
+// completes.
+func NewServer() *Server {
+	s := &Server{statuses: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns config pointed to the server. A PersonalApiKey is set when
+// config has none so flag definitions are fetched from the server.
+func (s *Server) Config(config posthog.Config) posthog.Config {
+	config.Endpoint = s.URL
+	if config.PersonalApiKey == "" {
+		config.PersonalApiKey = "posthogtest"
+	}
+	return config
+}
+
+// SetDefinitions sets the flag definitions served to clients evaluating
+// flags locally.
+func (s *Server) SetDefinitions(definitions *Definitions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.definitions = definitions
+}
+
+// SetFlags sets the flags returned to every remote evaluation, by key.
+func (s *Server) SetFlags(flags map[string]interface{}) {
+	s.HandleFlags(func(posthog.DecideRequestData) posthog.DecideResponse {
+		return posthog.DecideResponse{FeatureFlags: flags}
+	})
+}
+
+// HandleFlags sets the function responding to remote evaluations, it is
+// called with the person and groups for which flags are evaluated.
+func (s *Server) HandleFlags(handler func(posthog.DecideRequestData) posthog.DecideResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags = handler
+}
+
+// RespondWith makes the server fail the requests whose path starts with
+// prefix with status, like "/batch/" or "/flags/". A status of 0 restores the
+// regular responses.
+func (s *Server) RespondWith(prefix string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.statuses, prefix)
+	} else {
+		s.statuses[prefix] = status
+	}
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Messages returns the messages of the batches received so far. Clients send
+// batches in the background, they must be flushed or closed first.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the requests and messages received so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.messages = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	status := 0
+	for prefix, prefixStatus := range s.statuses {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			status = prefixStatus
+		}
+	}
+	definitions, flags := s.definitions, s.flags
+	s.mu.Unlock()
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/batch"):
+		s.serveBatch(w, body)
+	case strings.HasPrefix(r.URL.Path, "/flags"), strings.HasPrefix(r.URL.Path, "/decide"):
+		serveFlags(w, body, flags)
+	case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+		if definitions == nil {
+			definitions = NewDefinitions()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(definitions.JSON())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveBatch(w http.ResponseWriter, body []byte) {
+	var batch struct {
+		ApiKey   string            `json:"api_key"`
+		Messages []json.RawMessage `json:"batch"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, raw := range batch.Messages {
+		var m struct {
+			Type       string                 `json:"type"`
+			Event      string                 `json:"event"`
+			DistinctId string                 `json:"distinct_id"`
+			Properties map[string]interface{} `json:"properties"`
+		}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.messages = append(s.messages, Message{
+			ApiKey:     batch.ApiKey,
+			Type:       m.Type,
+			Event:      m.Event,
+			DistinctId: m.DistinctId,
+			Properties: m.Properties,
+			Raw:        raw,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{}`))
+}
+
+func serveFlags(w http.ResponseWriter, body []byte, flags func(posthog.DecideRequestData) posthog.DecideResponse) {
+	var request posthog.DecideRequestData
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := posthog.DecideResponse{FeatureFlags: map[string]interface{}{}}
+	if flags != nil {
+		response = flags(request)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Reads the body of the request, decompressed when it is gzip encoded.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(gz)
+}
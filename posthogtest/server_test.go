@@ -0,0 +1,84 @@
+package posthogtest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.SetDefinitions(NewDefinitions(Flag("local-flag")))
+	server.HandleFlags(func(request posthog.DecideRequestData) posthog.DecideResponse {
+		return posthog.DecideResponse{FeatureFlags: map[string]interface{}{"remote-flag": "variant-" + request.DistinctId}}
+	})
+
+	client, err := posthog.NewWithConfig("some-api-key", server.Config(posthog.Config{
+		Compression: posthog.GzipCompressor{},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.WaitForFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, err := client.IsFeatureEnabled(posthog.FeatureFlagPayload{Key: "local-flag", DistinctId: "some-distinct-id"}); err != nil || enabled == nil || !*enabled {
+		t.Error("Expected the flag to be evaluated from the definitions, got", enabled, err)
+	}
+	if value, err := client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "remote-flag", DistinctId: "some-distinct-id"}); err != nil || value != "variant-some-distinct-id" {
+		t.Error("Expected the flag to be evaluated by the handler, got", value, err)
+	}
+
+	client.Enqueue(posthog.Capture{DistinctId: "some-distinct-id", Event: "purchase", Properties: posthog.NewProperties().Set("amount", 42)})
+	client.Close()
+
+	var purchase *Message
+	for _, m := range server.Messages() {
+		if m.Event == "purchase" {
+			m := m
+			purchase = &m
+		}
+	}
+	if purchase == nil || purchase.ApiKey != "some-api-key" || purchase.DistinctId != "some-distinct-id" || purchase.Properties["amount"] != float64(42) {
+		t.Fatalf("Expected the capture to be recorded, got %+v", server.Messages())
+	}
+
+	var flagRequests int
+	for _, r := range server.Requests() {
+		if r.Path == "/flags/" || r.Path == "/decide/" {
+			flagRequests++
+		}
+	}
+	if flagRequests != 1 {
+		t.Errorf("Expected a single remote evaluation, got %d", flagRequests)
+	}
+
+	server.Reset()
+	if len(server.Requests()) != 0 || len(server.Messages()) != 0 {
+		t.Error("Expected Reset to forget requests and messages")
+	}
+}
+
+func TestServerRespondWith(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.RespondWith("/flags/", http.StatusInternalServerError)
+
+	client, _ := posthog.NewWithConfig("some-api-key", server.Config(posthog.Config{FlagsEndpoint: posthog.FlagsEndpointFlags}))
+	defer client.Close()
+
+	if _, err := client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "remote-flag", DistinctId: "some-distinct-id"}); err == nil {
+		t.Error("Expected the evaluation to fail")
+	}
+
+	server.RespondWith("/flags/", 0)
+	server.SetFlags(map[string]interface{}{"remote-flag": "variant"})
+	if value, err := client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "remote-flag", DistinctId: "some-distinct-id"}); err != nil || value != "variant" {
+		t.Error("Expected the regular response to be restored, got", value, err)
+	}
+}
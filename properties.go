@@ -1,5 +1,7 @@
 package posthog
 
+import "fmt"
+
 // This type is used to represent properties in messages that support it.
 // It is a free-form object so the application can set any value it sees fit but
 // a few helper method are defined to make it easier to instantiate properties with
@@ -22,3 +24,95 @@ func (p Properties) Set(name string, value interface{}) Properties {
 	p[name] = value
 	return p
 }
+
+// Merge sets all the properties of other, overwriting existing ones.
+func (p Properties) Merge(other Properties) Properties {
+	for name, value := range other {
+		p[name] = value
+	}
+	return p
+}
+
+// How properties are merged when default properties, like the ones of a child
+// client created with Client.With, collide with the properties of a message.
+type MergeStrategy int
+
+const (
+	// The properties of the message overwrite the defaults, nested objects
+	// are replaced as a whole. This is the default.
+	MergeCallerWins MergeStrategy = iota
+
+	// The defaults overwrite the properties of the message.
+	MergeDefaultsWin
+
+	// Nested objects are merged recursively, the properties of the message
+	// win when values other than objects collide.
+	MergeDeep
+)
+
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeCallerWins:
+		return "caller-wins"
+	case MergeDefaultsWin:
+		return "defaults-win"
+	case MergeDeep:
+		return "deep"
+	}
+	return fmt.Sprintf("MergeStrategy(%d)", int(s))
+}
+
+// MergeWith merges the properties of other, the caller, into p, the defaults,
+// following the strategy. Nested objects of other are never modified.
+func (p Properties) MergeWith(other Properties, strategy MergeStrategy) Properties {
+	for name, value := range other {
+		existing, ok := p[name]
+
+		switch {
+		case !ok:
+			p[name] = value
+		case strategy == MergeDefaultsWin:
+		case strategy == MergeDeep:
+			p[name] = deepMerge(existing, value)
+		default:
+			p[name] = value
+		}
+	}
+	return p
+}
+
+// Returns the merge of two property values, objects are merged recursively
+// and other values are replaced by value.
+func deepMerge(existing interface{}, value interface{}) interface{} {
+	a, ok := asObject(existing)
+	if !ok {
+		return value
+	}
+	b, ok := asObject(value)
+	if !ok {
+		return value
+	}
+
+	merged := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		if e, ok := merged[k]; ok {
+			merged[k] = deepMerge(e, v)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func asObject(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case Properties:
+		return m, true
+	}
+	return nil, false
+}
@@ -36,3 +36,37 @@ func TestPropertiesMulti(t *testing.T) {
 	}
 
 }
+
+func TestPropertiesMergeWith(t *testing.T) {
+	tests := map[MergeStrategy]Properties{
+		MergeCallerWins: {
+			"plan":    "pro",
+			"tenant":  "acme",
+			"context": map[string]interface{}{"page": "/pricing"},
+		},
+		MergeDefaultsWin: {
+			"plan":    "free",
+			"tenant":  "acme",
+			"context": Properties{"app": "web", "version": 1},
+		},
+		MergeDeep: {
+			"plan":    "pro",
+			"tenant":  "acme",
+			"context": map[string]interface{}{"app": "web", "version": 1, "page": "/pricing"},
+		},
+	}
+
+	for strategy, expected := range tests {
+		defaults := Properties{"plan": "free", "tenant": "acme", "context": Properties{"app": "web", "version": 1}}
+		caller := map[string]interface{}{"page": "/pricing"}
+
+		merged := defaults.MergeWith(Properties{"plan": "pro", "context": caller}, strategy)
+
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("%s: invalid properties produced: %#v", strategy, merged)
+		}
+		if len(caller) != 1 {
+			t.Errorf("%s: the caller properties were modified: %#v", strategy, caller)
+		}
+	}
+}
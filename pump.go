@@ -0,0 +1,122 @@
+package posthog
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// The state of a client configured with ManualPump. Enqueue and Pump are
+// called from application goroutines, so the queues are guarded by a mutex
+// instead of being owned by the backend goroutine.
+type pump struct {
+	mutex  sync.Mutex
+	queues messageQueues
+	ready  []pendingBatch
+	closed bool
+}
+
+// A batch waiting for the next call to Pump.
+type pendingBatch struct {
+	key  string
+	msgs []message
+}
+
+// Schedules a batch to be sent, the mutex must be held.
+func (p *pump) schedule(key string, msgs []message) {
+	p.ready = append(p.ready, pendingBatch{key: key, msgs: msgs})
+}
+
+func (c *client) Pump(ctx context.Context) error {
+	if c.pump == nil {
+		return ErrNotManualPump
+	}
+
+	now := c.now().UnixNano()
+	last := atomic.LoadInt64(&c.lastFlush)
+	due := now-last >= int64(c.Interval) && atomic.CompareAndSwapInt64(&c.lastFlush, last, now)
+
+	err := c.pumpMessages(ctx, due)
+
+	if c.featureFlagsPoller != nil {
+		if pollErr := c.featureFlagsPoller.pollIfDue(ctx); err == nil {
+			err = pollErr
+		}
+	}
+
+	return err
+}
+
+func (c *client) pumpEnqueue(qm queuedMessage) error {
+	p := c.pump
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	c.push(&p.queues, qm, p.schedule)
+	return nil
+}
+
+// Sends the full batches on the calling goroutine, and every queued message
+// when flush is true. Batches that weren't sent when ctx is canceled are kept
+// for the next call.
+func (c *client) pumpMessages(ctx context.Context, flush bool) error {
+	p := c.pump
+	p.mutex.Lock()
+	if flush {
+		c.flush(&p.queues, p.schedule)
+	}
+	ready := p.ready
+	p.ready = nil
+	p.mutex.Unlock()
+
+	for i, b := range ready {
+		if err := ctx.Err(); err != nil {
+			p.mutex.Lock()
+			p.ready = append(ready[i:], p.ready...)
+			p.mutex.Unlock()
+			return err
+		}
+		c.sendSafely(ctx, b.key, b.msgs)
+	}
+
+	return nil
+}
+
+func (c *client) pumpDump(w io.Writer) error {
+	p := c.pump
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	for _, b := range p.ready {
+		if err := writeNDJSON(w, b.msgs); err != nil {
+			return err
+		}
+	}
+	return c.dump(&p.queues, w)
+}
+
+// Sends every queued message and stops the poller, it plays the part of the
+// backend goroutine exiting.
+func (c *client) closePump() {
+	defer close(c.shutdown)
+	defer c.flusher.setRunning(false)
+
+	c.pump.mutex.Lock()
+	c.pump.closed = true
+	c.pump.mutex.Unlock()
+
+	c.pumpMessages(context.Background(), true)
+
+	if c.featureFlagsPoller != nil {
+		c.featureFlagsPoller.Shutdown()
+	}
+}
@@ -0,0 +1,107 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientManualPump(t *testing.T) {
+	var batches, polls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation"):
+			atomic.AddInt32(&polls, 1)
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+		case r.URL.Path == "/batch/":
+			var b struct{ Batch []json.RawMessage }
+			json.NewDecoder(r.Body).Decode(&b)
+			atomic.AddInt32(&batches, int32(len(b.Batch)))
+		}
+	}))
+	defer server.Close()
+
+	now := mockTime()
+	goroutines := runtime.NumGoroutine()
+
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+		Logger:         testLogger{t.Logf, t.Logf},
+		ManualPump:     true,
+		Interval:       time.Minute,
+		now:            func() time.Time { return now },
+	})
+
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("expected no goroutines to be started, got %d more", n-goroutines)
+	}
+
+	c.Enqueue(Capture{DistinctId: "1", Event: "A"})
+
+	// Flags are due right away but the first batch only once the interval
+	// elapsed.
+	if err := c.Pump(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if b, p := atomic.LoadInt32(&batches), atomic.LoadInt32(&polls); b != 0 || p != 1 {
+		t.Errorf("expected flags to be fetched and the message to stay queued, got %d messages and %d polls", b, p)
+	}
+	if enabled, err := c.IsFeatureEnabled(FeatureFlagPayload{
+		Key:                   "simple-flag",
+		DistinctId:            "1",
+		OnlyEvaluateLocally:   true,
+		SendFeatureFlagEvents: new(bool),
+	}); err != nil || enabled == nil {
+		t.Errorf("expected the flag to be evaluated locally, got %v %v", enabled, err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := c.Pump(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if b, p := atomic.LoadInt32(&batches), atomic.LoadInt32(&polls); b != 1 || p != 1 {
+		t.Errorf("expected the message to be sent, got %d messages and %d polls", b, p)
+	}
+
+	c.ReloadFeatureFlags()
+	c.Enqueue(Capture{DistinctId: "1", Event: "B"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Pump(ctx)
+	if b := atomic.LoadInt32(&batches); b != 1 {
+		t.Errorf("expected nothing to be sent with a canceled context, got %d messages", b)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b := atomic.LoadInt32(&batches); b != 2 {
+		t.Errorf("expected queued messages to be sent on close, got %d messages", b)
+	}
+	if err := c.Enqueue(Capture{DistinctId: "1", Event: "C"}); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	for _, state := range c.Subsystems() {
+		if state.Running {
+			t.Errorf("expected %s to be stopped", state.Name)
+		}
+	}
+}
+
+func TestClientPumpRequiresManualMode(t *testing.T) {
+	c := New("0123456789")
+	defer c.Close()
+
+	if err := c.Pump(context.Background()); err != ErrNotManualPump {
+		t.Errorf("expected ErrNotManualPump, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package posthog
+
+import (
+	"context"
+)
+
+// The result of a HogQL query, returned by Client.Query. Queries return a
+// page of rows, the next ones are fetched with Next.
+type QueryResult struct {
+	Columns []string        `json:"columns"`
+	Results [][]interface{} `json:"results"`
+
+	// Reports whether more rows match the query.
+	HasMore bool `json:"hasMore"`
+
+	// The number of rows per page and the offset of the first row of the
+	// page.
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+
+	client *client
+	query  string
+}
+
+type hogQLQuery struct {
+	Kind  string `json:"kind"`
+	Query string `json:"query"`
+
+	// The page of rows to return, the server picks the limit when zero.
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+func (c *client) Query(ctx context.Context, hogql string) (*QueryResult, error) {
+	if hogql == "" {
+		return nil, ConfigError{
+			Reason: "HogQL query required",
+			Field:  "hogql",
+			Value:  hogql,
+		}
+	}
+	return c.query(ctx, hogQLQuery{Kind: "HogQLQuery", Query: hogql})
+}
+
+func (c *client) query(ctx context.Context, query hogQLQuery) (*QueryResult, error) {
+	request := struct {
+		Query hogQLQuery `json:"query"`
+	}{query}
+
+	result := &QueryResult{}
+	if err := c.projectRequest(ctx, "POST", "query/", request, result); err != nil {
+		return nil, err
+	}
+	// The offset isn't reported back by all versions of the query API.
+	if result.Offset == 0 {
+		result.Offset = query.Offset
+	}
+	result.client = c
+	result.query = query.Query
+	return result, nil
+}
+
+// Next returns the next page of the query, or nil when there are no more
+// rows. Pages are fetched by running the query again with the limit and offset
+// of the query API, so the query needs an ORDER BY clause for the pages to be
+// consistent.
+func (r *QueryResult) Next(ctx context.Context) (*QueryResult, error) {
+	// An empty page ends the query even if the server reports more rows.
+	if !r.HasMore || len(r.Results) == 0 {
+		return nil, nil
+	}
+
+	limit := r.Limit
+	if limit == 0 {
+		limit = len(r.Results)
+	}
+	return r.client.query(ctx, hogQLQuery{
+		Kind:   "HogQLQuery",
+		Query:  r.query,
+		Limit:  limit,
+		Offset: r.Offset + len(r.Results),
+	})
+}
@@ -0,0 +1,103 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	var queries []hogQLQuery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/projects/@current/query/" {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+			return
+		}
+		if r.Method != "POST" || r.Header.Get("Authorization") != "Bearer some very secret key" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Authorization"))
+		}
+
+		var request struct {
+			Query hogQLQuery `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Query.Kind != "HogQLQuery" {
+			t.Errorf("unexpected kind %q", request.Query.Kind)
+		}
+		queries = append(queries, request.Query)
+
+		switch len(queries) {
+		case 1:
+			w.Write([]byte(`{"columns": ["event", "count()"], "results": [["$pageview", 10], ["signed_up", 3]], "hasMore": true, "limit": 2, "offset": 0}`))
+		case 2:
+			w.Write([]byte(`{"columns": ["event", "count()"], "results": [["logged_in", 1]], "hasMore": true, "limit": 2, "offset": 2}`))
+		default:
+			w.Write([]byte(`{"columns": ["event", "count()"], "results": [], "hasMore": true, "limit": 2, "offset": 3}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+	})
+	defer client.Close()
+
+	query := "SELECT event, count() FROM events GROUP BY event ORDER BY count() DESC"
+	result, err := client.Query(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Columns, []string{"event", "count()"}) || len(result.Results) != 2 || result.Results[0][0] != "$pageview" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	next, err := result.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Results) != 1 || next.Results[0][0] != "logged_in" || next.Offset != 2 {
+		t.Errorf("unexpected next page: %+v", next)
+	}
+	if expected := (hogQLQuery{Kind: "HogQLQuery", Query: query, Limit: 2, Offset: 2}); queries[1] != expected {
+		t.Errorf("expected %+v, got %+v", expected, queries[1])
+	}
+
+	last, err := next.Next(context.Background())
+	if err != nil || len(last.Results) != 0 || queries[2].Offset != 3 {
+		t.Errorf("unexpected last page: %+v %v", last, err)
+	}
+	// The empty page ends the query although the server reports more rows.
+	if end, err := last.Next(context.Background()); end != nil || err != nil || len(queries) != 3 {
+		t.Errorf("expected no more pages, got %v %v", end, err)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/projects/@current/query/" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type": "validation_error", "detail": "Unable to resolve field: nope"}`))
+			return
+		}
+		w.Write([]byte(fixture("feature_flag/test-simple-flag.json")))
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	_, err := client.Query(context.Background(), "SELECT nope FROM events")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Errorf("expected an APIError, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package posthog
+
+import (
+	"net/http"
+)
+
+// Options of RecoveryMiddleware.
+type RecoveryOptions struct {
+	// Returns the distinct ID of the user of the request, the one of the
+	// context of the request is used when it is nil or returns an empty
+	// string (see NewContext). Exceptions of requests without distinct ID
+	// are captured without creating a person.
+	DistinctId func(r *http.Request) string
+
+	// When set to true the panic is propagated once the exception is
+	// captured, instead of responding with 500 Internal Server Error.
+	Repanic bool
+
+	// Properties added to every captured exception, like the name of the
+	// service.
+	Properties Properties
+}
+
+// RecoveryMiddleware returns a net/http middleware recovering the panics of
+// handlers and capturing them as exceptions, along with the method and path
+// of the request.
+//
+//	handler = posthog.RecoveryMiddleware(client, posthog.RecoveryOptions{
+//		DistinctId: func(r *http.Request) string { return userFromRequest(r) },
+//	})(handler)
+//
+// Panics with http.ErrAbortHandler, which abort the response on purpose,
+// are propagated without being captured.
+func RecoveryMiddleware(client Client, opts RecoveryOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				value := recover()
+				if value == nil {
+					return
+				}
+				if value == http.ErrAbortHandler {
+					panic(value)
+				}
+
+				distinctId := ""
+				if opts.DistinctId != nil {
+					distinctId = opts.DistinctId(r)
+				}
+				// The groups of the context belong to its user, they aren't
+				// used for another distinct ID.
+				var groups Groups
+				if contextId, contextGroups, ok := FromContext(r.Context()); ok && distinctId == "" {
+					distinctId = contextId
+					groups = contextGroups
+				}
+				properties := requestProperties(r, opts)
+				distinctId = personlessDistinctId(distinctId, properties)
+
+				msg := panicException(value, distinctId, properties, 1)
+				msg.Groups = groups
+				client.Enqueue(msg)
+
+				if opts.Repanic {
+					panic(value)
+				}
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestProperties(r *http.Request, opts RecoveryOptions) Properties {
+	return NewProperties().
+		Merge(opts.Properties).
+		Set("$request_method", r.Method).
+		Set("$request_path", r.URL.Path).
+		Set("$current_url", r.URL.String())
+}
@@ -0,0 +1,129 @@
+package posthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RecoveryMiddleware(client, RecoveryOptions{
+		DistinctId: func(r *http.Request) string { return r.Header.Get("X-User") },
+		Properties: Properties{"service": "billing"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	r := httptest.NewRequest("POST", "/invoices?id=42", nil)
+	r.Header.Set("X-User", "user")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected a 500 response, got %d", w.Code)
+	}
+	if len(client.msgs) != 1 {
+		t.Fatalf("expected the panic to be captured, got %v", client.msgs)
+	}
+
+	msg := client.msgs[0].(Capture)
+	if msg.Event != "$exception" || msg.DistinctId != "user" {
+		t.Errorf("invalid exception: %#v", msg)
+	}
+	if msg.Properties["$request_method"] != "POST" || msg.Properties["$request_path"] != "/invoices" || msg.Properties["service"] != "billing" {
+		t.Errorf("expected the request properties, got %v", msg.Properties)
+	}
+	if _, ok := msg.Properties["$process_person_profile"]; ok {
+		t.Error("expected a person profile to be processed for identified users")
+	}
+
+	list := msg.Properties["$exception_list"].([]Exception)
+	if list[0].Value != "boom" || list[0].Mechanism.Handled {
+		t.Errorf("invalid exception: %#v", list[0])
+	}
+	frames := list[0].Stacktrace.Frames
+	if caller := frames[len(frames)-2]; !strings.HasPrefix(caller.Function, "github.com/posthog/posthog-go.TestRecoveryMiddleware") {
+		t.Errorf("expected the panicking handler in the stack, got %#v", caller)
+	}
+}
+
+func TestRecoveryMiddlewareAnonymous(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RecoveryMiddleware(client, RecoveryOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	msg := client.msgs[0].(Capture)
+	if msg.DistinctId == "" || msg.Properties["$process_person_profile"] != false {
+		t.Errorf("expected an anonymous exception, got %#v", msg)
+	}
+}
+
+func TestRecoveryMiddlewareRepanic(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RecoveryMiddleware(client, RecoveryOptions{Repanic: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if value := recover(); value != "boom" {
+				t.Errorf("expected the panic to be propagated, got %v", value)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if len(client.msgs) != 1 {
+		t.Errorf("expected the panic to be captured, got %v", client.msgs)
+	}
+
+	aborting := RecoveryMiddleware(client, RecoveryOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	func() {
+		defer func() {
+			if value := recover(); value != http.ErrAbortHandler {
+				t.Errorf("expected the abort to be propagated, got %v", value)
+			}
+		}()
+		aborting.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if len(client.msgs) != 1 {
+		t.Error("expected aborted requests not to be captured")
+	}
+}
+
+func TestRecoveryMiddlewareContextIdentity(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RecoveryMiddleware(client, RecoveryOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(NewContext(r.Context(), "user", Groups{"company": "acme"})))
+
+	msg := client.msgs[0].(Capture)
+	if msg.DistinctId != "user" || msg.Groups["company"] != "acme" || msg.Properties["$process_person_profile"] != nil {
+		t.Errorf("expected the identity of the context, got %#v", msg)
+	}
+}
+
+func TestRecoveryMiddlewareIgnoresContextGroupsOfAnotherUser(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RecoveryMiddleware(client, RecoveryOptions{
+		DistinctId: func(r *http.Request) string { return "other" },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(NewContext(r.Context(), "user", Groups{"company": "acme"})))
+
+	msg := client.msgs[0].(Capture)
+	if msg.DistinctId != "other" || msg.Groups != nil {
+		t.Errorf("expected the groups of the context not to be used for another user, got %#v", msg)
+	}
+}
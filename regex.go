@@ -0,0 +1,31 @@
+package posthog
+
+import "regexp"
+
+// The maximum number of compiled regular expressions of flag conditions kept in
+// memory.
+const regexCacheSize = 1000
+
+// Compiled regular expressions of the regex and not_regex operators by
+// pattern, or the compilation error of invalid patterns. It is shared by all
+// clients since a pattern compiles the same whatever the project.
+var regexCache = newLRUCache(regexCacheSize, 0, nil)
+
+// Same as regexp.Compile but patterns are only compiled once while they are
+// cached, conditions are matched against every evaluated event.
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := regexCache.get(pattern); ok {
+		if err, ok := cached.(error); ok {
+			return nil, err
+		}
+		return cached.(*regexp.Regexp), nil
+	}
+
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		regexCache.add(pattern, err)
+		return nil, err
+	}
+	regexCache.add(pattern, r)
+	return r, nil
+}
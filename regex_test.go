@@ -0,0 +1,32 @@
+package posthog
+
+import "testing"
+
+func TestCompileRegexIsCached(t *testing.T) {
+	r1, err := compileRegex(`^[a-z]+@example\.com$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, _ := compileRegex(`^[a-z]+@example\.com$`)
+	if r1 != r2 {
+		t.Error("expected the compiled pattern to be reused")
+	}
+	if !r1.MatchString("max@example.com") {
+		t.Error("expected the pattern to match")
+	}
+
+	_, err1 := compileRegex(`(unclosed`)
+	_, err2 := compileRegex(`(unclosed`)
+	if err1 == nil || err1 != err2 {
+		t.Errorf("expected the compilation error to be cached, got %v and %v", err1, err2)
+	}
+}
+
+func BenchmarkMatchPropertyRegex(b *testing.B) {
+	property := Property{Key: "email", Operator: "regex", Value: `^[a-z]+@(example|posthog)\.com$`}
+	properties := NewProperties().Set("email", "max@posthog.com")
+
+	for i := 0; i < b.N; i++ {
+		matchProperty(property, properties)
+	}
+}
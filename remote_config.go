@@ -0,0 +1,76 @@
+package posthog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const remoteConfigEndpoint = "api/projects/@current/feature_flags/%s/remote_config"
+
+func (c *client) GetRemoteConfigPayload(flagKey string) (json.RawMessage, error) {
+	return c.GetRemoteConfigPayloadCtx(c.flagsContext(), flagKey)
+}
+
+func (c *client) GetRemoteConfigPayloadCtx(ctx context.Context, flagKey string) (json.RawMessage, error) {
+	if flagKey == "" {
+		return nil, ConfigError{
+			Reason: "Feature Flag Key required",
+			Field:  "Key",
+			Value:  flagKey,
+		}
+	}
+
+	if c.featureFlagsPoller == nil || c.PersonalApiKey == "" {
+		errorMessage := "specifying a PersonalApiKey is required for fetching remote config payloads"
+		c.log(LogLevelError, errorMessage)
+		return nil, errors.New(errorMessage)
+	}
+	return c.featureFlagsPoller.remoteConfigPayload(ctx, flagKey)
+}
+
+// Fetches the payload of a remote config flag. Their payloads may hold
+// secrets so they are encrypted in the flag definitions and only served by the
+// remote config endpoint, which requires the personal API key.
+func (poller *FeatureFlagsPoller) remoteConfigPayload(ctx context.Context, flagKey string) (json.RawMessage, error) {
+	if poller.offline != nil {
+		return nil, errors.New("remote config payloads can't be fetched when flags are evaluated offline")
+	}
+	if err := poller.quotaLimited(); err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf(remoteConfigEndpoint, url.PathEscape(flagKey))
+	u, err := url.Parse(poller.Endpoint + "/" + endpoint)
+	if err != nil {
+		return nil, err
+	}
+	searchParams := u.Query()
+	keys := poller.apiKeys()
+	searchParams.Add("token", keys.project)
+	u.RawQuery = searchParams.Encode()
+
+	headers := [][2]string{{"Authorization", "Bearer " + keys.personal}}
+	status, resBody, err := poller.request(ctx, "GET", u, []byte{}, headers)
+	switch {
+	case status == http.StatusNotFound:
+		return nil, ErrFlagNotFound
+	case status == http.StatusTooManyRequests:
+		var apiErr *APIError
+		errors.As(err, &apiErr)
+		return nil, poller.limitQuota(apiErr)
+	case err != nil:
+		poller.logRequestError("Unable to fetch remote config payload", endpoint, status, err)
+		return nil, fmt.Errorf("unable to fetch remote config payload: %w", err)
+	}
+
+	if len(resBody) != 0 && !json.Valid(resBody) {
+		err := errors.New("the response is not valid JSON")
+		poller.logRequestError("Unable to parse remote config payload", endpoint, 0, err)
+		return nil, fmt.Errorf("unable to parse remote config payload: %w", err)
+	}
+	return decodePayload(resBody), nil
+}
@@ -0,0 +1,64 @@
+package posthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetRemoteConfigPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/projects/@current/feature_flags/secret-config/remote_config":
+			if r.Header.Get("Authorization") != "Bearer some very secret key" || r.URL.Query().Get("token") != "Csyjlnlun3OzyNJAafdlv" {
+				t.Error("Expected the personal API key and the project token, got", r.Header.Get("Authorization"), r.URL.RawQuery)
+			}
+			w.Write([]byte(`"{\"api_key\": \"s3cr3t\"}"`))
+		case "/api/projects/@current/feature_flags/empty-config/remote_config":
+			w.Write([]byte(`null`))
+		case "/api/feature_flag/local_evaluation":
+			w.Write([]byte(`{"flags": [{"key": "secret-config", "active": true, "is_remote_configuration": true, "filters": {"groups": [{"properties": [], "rollout_percentage": 100}]}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	payload, err := client.GetRemoteConfigPayload("secret-config")
+	if err != nil || string(payload) != `{"api_key": "s3cr3t"}` {
+		t.Errorf("Expected the decoded payload, got %s %v", payload, err)
+	}
+
+	if payload, err := client.GetRemoteConfigPayload("empty-config"); err != nil || payload != nil {
+		t.Errorf("Expected no payload, got %s %v", payload, err)
+	}
+
+	if _, err := client.GetRemoteConfigPayload("unknown-config"); err != ErrFlagNotFound {
+		t.Error("Expected ErrFlagNotFound, got", err)
+	}
+
+	if _, err := client.GetRemoteConfigPayload(""); err == nil {
+		t.Error("Expected an error without a flag key")
+	}
+}
+
+func TestGetRemoteConfigPayloadRequiresPersonalApiKey(t *testing.T) {
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader: strings.NewReader(`{"flags": []}`),
+		Transport:          offlineTransport(t),
+		Logger:             testLogger{t.Logf, t.Logf},
+	})
+	defer client.Close()
+
+	if _, err := client.GetRemoteConfigPayload("secret-config"); err == nil {
+		t.Error("Expected an error without a personal API key")
+	}
+}
@@ -0,0 +1,165 @@
+package posthog
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultRequestEvent is the name of the events captured by RequestMiddleware
+// when RequestOptions.Event is not set.
+const DefaultRequestEvent = "http_request"
+
+// Options of RequestMiddleware.
+type RequestOptions struct {
+	// Name of the captured events, DefaultRequestEvent is used if empty.
+	Event string
+
+	// Returns the route of the request, like "/invoices/{id}", so requests
+	// are grouped by route rather than by path. The path is used when it is
+	// nil or returns an empty string.
+	Route func(r *http.Request) string
+
+	// Returns the distinct ID of the user of the request, the one of the
+	// context of the request is used when it is nil or returns an empty
+	// string (see NewContext). Requests without distinct ID are captured
+	// without creating a person.
+	DistinctId func(r *http.Request) string
+
+	// Requests for which it returns true aren't captured, like health
+	// checks.
+	Skip func(r *http.Request) bool
+
+	// Properties added to every captured event, like the name of the service.
+	Properties Properties
+}
+
+// RequestMiddleware returns a net/http middleware capturing an event per
+// request, with its route, method, status, duration and user agent.
+//
+//	handler = posthog.RequestMiddleware(client, posthog.RequestOptions{
+//		Route: func(r *http.Request) string { return mux.CurrentRoute(r).GetPathTemplate() },
+//	})(handler)
+//
+// Requests are sampled with a child client:
+//
+//	posthog.RequestMiddleware(client.With(posthog.WithSampleRate(0.1)), opts)
+//
+// Requests whose handler panics aren't captured, see RecoveryMiddleware.
+func RequestMiddleware(client Client, opts RequestOptions) func(http.Handler) http.Handler {
+	if opts.Event == "" {
+		opts.Event = DefaultRequestEvent
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Skip != nil && opts.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			duration := time.Since(start)
+
+			route := ""
+			if opts.Route != nil {
+				route = opts.Route(r)
+			}
+			distinctId := ""
+			if opts.DistinctId != nil {
+				distinctId = opts.DistinctId(r)
+			}
+			// The groups of the context belong to its user, they aren't
+			// used for another distinct ID.
+			var groups Groups
+			if contextId, contextGroups, ok := FromContext(r.Context()); ok && distinctId == "" {
+				distinctId = contextId
+				groups = contextGroups
+			}
+
+			properties := NewProperties().
+				Merge(opts.Properties).
+				Set("$request_method", r.Method).
+				Set("$request_path", r.URL.Path).
+				Set("route", orDefault(route, r.URL.Path)).
+				Set("status_code", sw.status()).
+				Set("duration_ms", duration.Milliseconds()).
+				Set("$raw_user_agent", r.UserAgent())
+
+			client.Enqueue(Capture{
+				DistinctId: personlessDistinctId(distinctId, properties),
+				Event:      opts.Event,
+				Properties: properties,
+				Groups:     groups,
+			})
+		})
+	}
+}
+
+// Records the status of the response written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hands the connection over to the handler, like for WebSocket upgrades. The
+// request is recorded as switching protocols unless a status was written.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("posthog: the response writer doesn't support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *statusWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Returns the underlying writer to http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Returns the status of the response, handlers that write nothing respond
+// with 200.
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
@@ -0,0 +1,123 @@
+package posthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestMiddleware(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RequestMiddleware(client, RequestOptions{
+		Route:      func(r *http.Request) string { return "/invoices/{id}" },
+		DistinctId: func(r *http.Request) string { return r.Header.Get("X-User") },
+		Skip:       func(r *http.Request) bool { return r.URL.Path == "/healthz" },
+		Properties: Properties{"service": "billing"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invoices/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	r := httptest.NewRequest("GET", "/invoices/42", nil)
+	r.Header.Set("X-User", "user")
+	r.Header.Set("User-Agent", "curl/8.0")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/invoices/missing", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+
+	if len(client.msgs) != 2 {
+		t.Fatalf("expected 2 requests to be captured, got %v", client.msgs)
+	}
+
+	msg := client.msgs[0].(Capture)
+	if msg.Event != "http_request" || msg.DistinctId != "user" {
+		t.Errorf("invalid event: %#v", msg)
+	}
+	p := msg.Properties
+	if p["route"] != "/invoices/{id}" || p["$request_path"] != "/invoices/42" || p["$request_method"] != "GET" || p["status_code"] != 200 || p["$raw_user_agent"] != "curl/8.0" || p["service"] != "billing" {
+		t.Errorf("unexpected properties: %v", p)
+	}
+	if _, ok := p["duration_ms"].(int64); !ok {
+		t.Errorf("expected the duration, got %v", p["duration_ms"])
+	}
+
+	msg = client.msgs[1].(Capture)
+	if msg.Properties["status_code"] != 404 || msg.Properties["$process_person_profile"] != false {
+		t.Errorf("expected an anonymous 404, got %v", msg.Properties)
+	}
+}
+
+func TestRequestMiddlewareContextIdentity(t *testing.T) {
+	client := &testEnqueueClient{}
+	handler := RequestMiddleware(client, RequestOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	r := httptest.NewRequest("POST", "/invoices", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(NewContext(r.Context(), "user", Groups{"company": "acme"})))
+
+	msg := client.msgs[0].(Capture)
+	if msg.DistinctId != "user" || msg.Groups["company"] != "acme" || msg.Properties["route"] != "/invoices" || msg.Properties["status_code"] != 201 {
+		t.Errorf("unexpected event: %#v", msg)
+	}
+
+	handler = RequestMiddleware(client, RequestOptions{
+		DistinctId: func(r *http.Request) string { return "other" },
+	})(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(NewContext(r.Context(), "user", Groups{"company": "acme"})))
+
+	msg = client.msgs[1].(Capture)
+	if msg.DistinctId != "other" || msg.Groups != nil {
+		t.Errorf("expected the groups of the context not to be used for another user, got %#v", msg)
+	}
+}
+
+func TestRequestMiddlewareHijack(t *testing.T) {
+	client := &testEnqueueClient{}
+	done := make(chan struct{})
+	handler := RequestMiddleware(client, RequestOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error("expected the connection to be hijacked, got", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+	}))
+	// Hijacked requests aren't waited for when the server is closed.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	r, _ := http.NewRequest("GET", server.URL+"/ws", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	res, err := server.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("expected the handler to switch protocols, got", res.Status)
+	}
+	<-done
+
+	if len(client.msgs) != 1 || client.msgs[0].(Capture).Properties["status_code"] != 101 {
+		t.Errorf("expected the upgrade to be captured, got %v", client.msgs)
+	}
+}
+
+func TestRequestMiddlewareWithoutHijacker(t *testing.T) {
+	handler := RequestMiddleware(&testEnqueueClient{}, RequestOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Error("expected hijacking a recorder to fail")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
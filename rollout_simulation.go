@@ -0,0 +1,88 @@
+package posthog
+
+import (
+	"errors"
+)
+
+// The predicted outcome of a flag definition for a sample of distinct IDs,
+// returned by SimulateRollout.
+type RolloutSimulation struct {
+	// The number of distinct IDs of the sample.
+	Sampled int
+
+	// The number of distinct IDs for which the flag is enabled, with any
+	// variant for multivariate flags.
+	Matched int
+
+	// The number of distinct IDs for which the flag can't be evaluated
+	// locally, like with conditions on cohorts or missing properties.
+	Inconclusive int
+
+	// The number of distinct IDs per variant, empty for flags without
+	// variants.
+	Variants map[string]int
+}
+
+// Returns the share of the distinct IDs evaluated conclusively for which the
+// flag is enabled, between 0 and 1.
+func (s RolloutSimulation) MatchRate() float64 {
+	if evaluated := s.Sampled - s.Inconclusive; evaluated > 0 {
+		return float64(s.Matched) / float64(evaluated)
+	}
+	return 0
+}
+
+// Returns the share of each variant among the distinct IDs for which the flag
+// is enabled, between 0 and 1.
+func (s RolloutSimulation) Distribution() map[string]float64 {
+	distribution := make(map[string]float64, len(s.Variants))
+	for variant, count := range s.Variants {
+		distribution[variant] = float64(count) / float64(s.Matched)
+	}
+	return distribution
+}
+
+// Evaluates the flag definition for every distinct ID of the sample with the
+// properties returned by propsFor, which may be nil, and returns the predicted
+// match rate and variant distribution. The evaluation is the same as the
+// local evaluation of the client, so changes to a definition, like a higher
+// rollout percentage, can be previewed before they are saved. For group flags
+// the sample is made of group keys. Conditions on cohorts are inconclusive
+// since the definitions of cohorts aren't known.
+func SimulateRollout(flag FeatureFlag, distinctIds []string, propsFor func(id string) Properties) (RolloutSimulation, error) {
+	simulation := RolloutSimulation{
+		Sampled:  len(distinctIds),
+		Variants: map[string]int{},
+	}
+	if !flag.Active {
+		return simulation, nil
+	}
+
+	for _, distinctId := range distinctIds {
+		var properties Properties
+		if propsFor != nil {
+			properties = propsFor(distinctId)
+		}
+
+		value, err := matchFeatureFlagProperties(flag, distinctId, properties, nil, nil)
+		if err != nil {
+			var inconclusiveErr *InconclusiveMatchError
+			if !errors.As(err, &inconclusiveErr) {
+				return simulation, err
+			}
+			simulation.Inconclusive++
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			simulation.Matched++
+			simulation.Variants[v]++
+		case bool:
+			if v {
+				simulation.Matched++
+			}
+		}
+	}
+	return simulation, nil
+}
@@ -0,0 +1,95 @@
+package posthog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func sampleDistinctIds(n int) []string {
+	distinctIds := make([]string, n)
+	for i := range distinctIds {
+		distinctIds[i] = fmt.Sprintf("distinct-id-%d", i)
+	}
+	return distinctIds
+}
+
+func TestSimulateRollout(t *testing.T) {
+	definitions := FeatureFlagsResponse{}
+	if err := json.Unmarshal([]byte(fixture("feature_flag/test-simple-flag.json")), &definitions); err != nil {
+		t.Fatal(err)
+	}
+	flag := definitions.Flags[0]
+	distinctIds := sampleDistinctIds(10000)
+
+	simulation, err := SimulateRollout(flag, distinctIds, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Sampled != 10000 || simulation.Inconclusive != 0 || math.Abs(simulation.MatchRate()-0.45) > 0.02 {
+		t.Errorf("Expected about 45%% of the sample to match, got %+v", simulation)
+	}
+
+	// The simulation predicts the exact evaluations of the client.
+	c, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		FeatureFlagsReader: strings.NewReader(fixture("feature_flag/test-simple-flag.json")),
+		Logger:             testLogger{t.Logf, t.Logf},
+	})
+	defer c.Close()
+	results, _ := c.EvaluateFlagForMany("simple-flag", distinctIds, nil)
+	matched := 0
+	for _, value := range results {
+		if value == true {
+			matched++
+		}
+	}
+	if simulation.Matched != matched {
+		t.Errorf("Expected %d distinct IDs to match like the client, got %d", matched, simulation.Matched)
+	}
+
+	// Raising the rollout only adds distinct IDs.
+	rollout := uint8(90)
+	flag.Filters.Groups[0].RolloutPercentage = &rollout
+	raised, _ := SimulateRollout(flag, distinctIds, nil)
+	if raised.Matched <= simulation.Matched || math.Abs(raised.MatchRate()-0.9) > 0.02 {
+		t.Errorf("Expected about 90%% of the sample to match, got %+v", raised)
+	}
+
+	flag.Active = false
+	if inactive, _ := SimulateRollout(flag, distinctIds, nil); inactive.Matched != 0 {
+		t.Errorf("Expected no match for an inactive flag, got %+v", inactive)
+	}
+}
+
+func TestSimulateRolloutVariants(t *testing.T) {
+	flag := FeatureFlag{}
+	if err := json.Unmarshal([]byte(`{
+		"key": "multivariate-flag",
+		"active": true,
+		"filters": {
+			"groups": [{"properties": [{"key": "plan", "operator": "exact", "value": ["pro"], "type": "person"}], "rollout_percentage": null}],
+			"multivariate": {"variants": [{"key": "control", "rollout_percentage": 25}, {"key": "test", "rollout_percentage": 75}]}
+		}
+	}`), &flag); err != nil {
+		t.Fatal(err)
+	}
+
+	simulation, err := SimulateRollout(flag, sampleDistinctIds(10000), func(id string) Properties {
+		if strings.HasSuffix(id, "0") {
+			return nil
+		}
+		return NewProperties().Set("plan", "pro")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Inconclusive != 1000 || simulation.Matched != 9000 || simulation.MatchRate() != 1 {
+		t.Errorf("Expected the distinct IDs without properties to be inconclusive, got %+v", simulation)
+	}
+	distribution := simulation.Distribution()
+	if math.Abs(distribution["control"]-0.25) > 0.02 || math.Abs(distribution["test"]-0.75) > 0.02 {
+		t.Errorf("Expected the variants to follow their rollout percentages, got %v", distribution)
+	}
+}
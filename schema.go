@@ -0,0 +1,249 @@
+package posthog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The type of an event property declared in an EventSchema.
+type PropertyType string
+
+const (
+	PropertyString   PropertyType = "string"
+	PropertyNumber   PropertyType = "number"
+	PropertyBoolean  PropertyType = "boolean"
+	PropertyObject   PropertyType = "object"
+	PropertyArray    PropertyType = "array"
+	PropertyDateTime PropertyType = "date-time"
+)
+
+// PropertySchema declares the expected type of an event property.
+type PropertySchema struct {
+	Type PropertyType
+
+	// When set to true captures without the property are rejected.
+	Required bool
+
+	// An optional human-readable description, exported in the JSON Schema.
+	Description string
+}
+
+// EventSchema declares the properties expected on captures of an event.
+type EventSchema struct {
+
+	// The name of the event the schema applies to.
+	Event string
+
+	// An optional human-readable description, exported in the JSON Schema.
+	Description string
+
+	// The declared properties, indexed by name.
+	Properties map[string]PropertySchema
+
+	// When set to true captures may carry properties that aren't declared.
+	// Properties starting with `$` are set by PostHog and always allowed.
+	AdditionalProperties bool
+}
+
+// A SchemaRegistry holds the schemas of events so captures can be checked
+// against them at enqueue time, see Config.Schemas. Events without a schema
+// are not checked.
+// Registries are safe to use concurrently.
+type SchemaRegistry struct {
+	mutex   sync.RWMutex
+	schemas map[string]EventSchema
+}
+
+// Returns an empty schema registry.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: map[string]EventSchema{}}
+}
+
+// Register adds the schema of an event to the registry, an error is returned
+// if the schema is invalid or if the event already has one.
+func (r *SchemaRegistry) Register(schema EventSchema) error {
+	if len(schema.Event) == 0 {
+		return FieldError{
+			Type:  "posthog.EventSchema",
+			Name:  "Event",
+			Value: schema.Event,
+		}
+	}
+
+	for name, property := range schema.Properties {
+		if !property.Type.valid() {
+			return FieldError{
+				Type:  "posthog.EventSchema",
+				Name:  "Properties[" + name + "].Type",
+				Value: property.Type,
+			}
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.schemas[schema.Event]; ok {
+		return fmt.Errorf("posthog.SchemaRegistry: event %q is already registered", schema.Event)
+	}
+	r.schemas[schema.Event] = schema
+	return nil
+}
+
+// Validate checks a capture against the schema of its event. It returns nil
+// when the event has no schema and a *SchemaViolationError otherwise.
+func (r *SchemaRegistry) Validate(msg Capture) error {
+	r.mutex.RLock()
+	schema, ok := r.schemas[msg.Event]
+	r.mutex.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	// Properties are checked in order so the reported violation is stable.
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property := schema.Properties[name]
+		value, ok := msg.Properties[name]
+
+		if !ok || value == nil {
+			if property.Required {
+				return &SchemaViolationError{Event: msg.Event, Property: name, Reason: "required property is missing"}
+			}
+			continue
+		}
+
+		if !property.Type.matches(value) {
+			return &SchemaViolationError{
+				Event:    msg.Event,
+				Property: name,
+				Reason:   fmt.Sprintf("expected a %s, got %T", property.Type, value),
+			}
+		}
+	}
+
+	if !schema.AdditionalProperties {
+		extra := []string{}
+		for name := range msg.Properties {
+			if _, ok := schema.Properties[name]; !ok && !strings.HasPrefix(name, "$") {
+				extra = append(extra, name)
+			}
+		}
+		if len(extra) != 0 {
+			sort.Strings(extra)
+			return &SchemaViolationError{Event: msg.Event, Property: extra[0], Reason: "property is not declared"}
+		}
+	}
+
+	return nil
+}
+
+// WriteJSONSchema writes the registered schemas as a JSON Schema (draft
+// 2020-12) document, each event is defined under `$defs` by its name and
+// describes the properties of the event.
+func (r *SchemaRegistry) WriteJSONSchema(w io.Writer) error {
+	r.mutex.RLock()
+	defs := make(map[string]interface{}, len(r.schemas))
+	for event, schema := range r.schemas {
+		defs[event] = schema.jsonSchema()
+	}
+	r.mutex.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$defs":   defs,
+	})
+}
+
+func (s EventSchema) jsonSchema() map[string]interface{} {
+	properties := make(map[string]interface{}, len(s.Properties))
+	required := []string{}
+
+	for name, property := range s.Properties {
+		p := map[string]interface{}{}
+		if property.Type == PropertyDateTime {
+			p["type"] = "string"
+			p["format"] = "date-time"
+		} else {
+			p["type"] = string(property.Type)
+		}
+		if property.Description != "" {
+			p["description"] = property.Description
+		}
+		properties[name] = p
+
+		if property.Required {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	schema := map[string]interface{}{
+		"title":      s.Event,
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+	if s.Description != "" {
+		schema["description"] = s.Description
+	}
+	if !s.AdditionalProperties {
+		schema["patternProperties"] = map[string]interface{}{"^\\$": true}
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
+
+func (t PropertyType) valid() bool {
+	switch t {
+	case PropertyString, PropertyNumber, PropertyBoolean, PropertyObject, PropertyArray, PropertyDateTime:
+		return true
+	}
+	return false
+}
+
+// Reports whether a property value would be serialized to the JSON type.
+func (t PropertyType) matches(value interface{}) bool {
+	switch v := value.(type) {
+	case json.Number:
+		return t == PropertyNumber
+	case time.Time, *time.Time:
+		return t == PropertyDateTime
+	case string:
+		if t == PropertyDateTime {
+			_, err := time.Parse(time.RFC3339, v)
+			return err == nil
+		}
+		return t == PropertyString
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(value)).Kind() {
+	case reflect.Bool:
+		return t == PropertyBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t == PropertyNumber
+	case reflect.String:
+		return t == PropertyString
+	case reflect.Map, reflect.Struct:
+		return t == PropertyObject
+	case reflect.Slice, reflect.Array:
+		return t == PropertyArray
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package posthog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestSchemaRegistry(t *testing.T) *SchemaRegistry {
+	r := NewSchemaRegistry()
+	err := r.Register(EventSchema{
+		Event: "order_completed",
+		Properties: map[string]PropertySchema{
+			"order_id":   {Type: PropertyString, Required: true},
+			"total":      {Type: PropertyNumber, Required: true, Description: "Total in cents"},
+			"gift":       {Type: PropertyBoolean},
+			"items":      {Type: PropertyArray},
+			"shipped_at": {Type: PropertyDateTime},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSchemaRegistryValidate(t *testing.T) {
+	r := newTestSchemaRegistry(t)
+
+	tests := map[string]struct {
+		properties Properties
+		property   string
+	}{
+		"valid": {
+			properties: NewProperties().Set("order_id", "o1").Set("total", 1200).Set("items", []string{"a"}).Set("$lib", "web"),
+		},
+		"json number and date-time string": {
+			properties: NewProperties().Set("order_id", "o1").Set("total", json.Number("12")).Set("shipped_at", "2022-01-02T03:04:05Z"),
+		},
+		"date-time value": {
+			properties: NewProperties().Set("order_id", "o1").Set("total", 1.5).Set("shipped_at", time.Now()),
+		},
+		"missing required": {
+			properties: NewProperties().Set("order_id", "o1"),
+			property:   "total",
+		},
+		"wrong type": {
+			properties: NewProperties().Set("order_id", 1).Set("total", 1),
+			property:   "order_id",
+		},
+		"invalid date-time": {
+			properties: NewProperties().Set("order_id", "o1").Set("total", 1).Set("shipped_at", "yesterday"),
+			property:   "shipped_at",
+		},
+		"undeclared property": {
+			properties: NewProperties().Set("order_id", "o1").Set("total", 1).Set("coupon", "X"),
+			property:   "coupon",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := r.Validate(Capture{Event: "order_completed", Properties: test.properties})
+
+			if test.property == "" {
+				if err != nil {
+					t.Error("expected capture to be valid, got", err)
+				}
+				return
+			}
+
+			var schemaErr *SchemaViolationError
+			if !errors.As(err, &schemaErr) || schemaErr.Property != test.property {
+				t.Errorf("expected a violation on %q, got %v", test.property, err)
+			}
+		})
+	}
+
+	if err := r.Validate(Capture{Event: "unknown", Properties: NewProperties().Set("a", 1)}); err != nil {
+		t.Error("expected events without schema not to be checked, got", err)
+	}
+}
+
+func TestSchemaRegistryRegister(t *testing.T) {
+	r := newTestSchemaRegistry(t)
+
+	if err := r.Register(EventSchema{Event: "order_completed"}); err == nil {
+		t.Error("expected duplicate schemas to be rejected")
+	}
+
+	if err := r.Register(EventSchema{}); err == nil {
+		t.Error("expected schemas without event to be rejected")
+	}
+
+	err := r.Register(EventSchema{Event: "A", Properties: map[string]PropertySchema{"a": {Type: "int"}}})
+	if _, ok := err.(FieldError); !ok {
+		t.Error("expected unknown property types to be rejected, got", err)
+	}
+}
+
+func TestSchemaRegistryWriteJSONSchema(t *testing.T) {
+	r := newTestSchemaRegistry(t)
+
+	b := &bytes.Buffer{}
+	if err := r.WriteJSONSchema(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Defs map[string]struct {
+			Title                string
+			Required             []string
+			AdditionalProperties bool
+			Properties           map[string]struct {
+				Type        string
+				Format      string
+				Description string
+			}
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	def := doc.Defs["order_completed"]
+	if def.Title != "order_completed" || len(def.Required) != 2 || def.AdditionalProperties {
+		t.Errorf("unexpected schema: %s", b)
+	}
+	if p := def.Properties["shipped_at"]; p.Type != "string" || p.Format != "date-time" {
+		t.Errorf("unexpected date-time property: %+v", p)
+	}
+	if p := def.Properties["total"]; p.Type != "number" || p.Description != "Total in cents" {
+		t.Errorf("unexpected number property: %+v", p)
+	}
+}
+
+func TestClientRejectSchemaViolations(t *testing.T) {
+	client, _ := NewWithConfig("0123456789", Config{
+		Logger:                 testLogger{t.Logf, t.Logf},
+		Transport:              testTransportOK,
+		Schemas:                newTestSchemaRegistry(t),
+		RejectSchemaViolations: true,
+	})
+	defer client.Close()
+
+	var schemaErr *SchemaViolationError
+	err := client.Enqueue(Capture{DistinctId: "1", Event: "order_completed", Properties: NewProperties()})
+	if !errors.As(err, &schemaErr) {
+		t.Error("expected the capture to be rejected, got", err)
+	}
+
+	err = client.Enqueue(Capture{DistinctId: "1", Event: "order_completed", Properties: NewProperties().Set("order_id", "o1").Set("total", 1)})
+	if err != nil {
+		t.Error("expected a valid capture to be enqueued, got", err)
+	}
+}
@@ -0,0 +1,179 @@
+package posthog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Versions like "1.10.2", "v2" or "2.0.0-beta.1+build.5", the minor and patch
+// numbers default to 0 and build metadata is ignored.
+var semverPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// A semantic version, compared following the precedence rules of
+// https://semver.org.
+type semver struct {
+	core       [3]uint64
+	prerelease []string
+}
+
+func parseSemver(value interface{}) (semver, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		// Whole numbers are major versions.
+		if value == nil || !isNumber(value) {
+			return semver{}, false
+		}
+		i, ok := interfaceToInt(value)
+		if !ok || i < 0 {
+			return semver{}, false
+		}
+		s = strconv.FormatInt(i, 10)
+	}
+
+	m := semverPattern.FindStringSubmatch(s)
+	if m == nil {
+		return semver{}, false
+	}
+
+	var version semver
+	for i, part := range m[1:4] {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semver{}, false
+		}
+		version.core[i] = n
+	}
+	if m[4] != "" {
+		version.prerelease = strings.Split(m[4], ".")
+	}
+	return version, true
+}
+
+// Returns -1, 0 or 1 when the version is lower, equal or greater than the
+// other one.
+func (v semver) compare(other semver) int {
+	for i := range v.core {
+		if v.core[i] != other.core[i] {
+			return compareUint(v.core[i], other.core[i])
+		}
+	}
+
+	// A pre-release has a lower precedence than the release.
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		if c := comparePrerelease(v.prerelease[i], other.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(v.prerelease)), uint64(len(other.prerelease)))
+}
+
+// Numeric identifiers are compared numerically and have a lower precedence
+// than alphanumeric ones, which are compared lexically.
+func comparePrerelease(a string, b string) int {
+	aNumber, aErr := strconv.ParseUint(a, 10, 64)
+	bNumber, bErr := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareUint(aNumber, bNumber)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compares the values of gt, gte, lt and lte conditions. They are compared as
+// versions when either is a dotted version string, so "1.10" is greater than
+// "1.9", as numbers when they both are, and as versions otherwise.
+func compareOrderable(key string, value interface{}, overrideValue interface{}) (int, error) {
+	if isDotted(value) || isDotted(overrideValue) {
+		version, ok := parseSemver(value)
+		overrideVersion, overrideOk := parseSemver(overrideValue)
+		if ok && overrideOk {
+			return overrideVersion.compare(version), nil
+		}
+	}
+
+	if valueOrderable, overrideValueOrderable, err := validateOrderable(key, value, overrideValue); err == nil {
+		switch {
+		case overrideValueOrderable < valueOrderable:
+			return -1, nil
+		case overrideValueOrderable > valueOrderable:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	version, ok := parseSemver(value)
+	if !ok {
+		return 0, &NotOrderableError{Property: key, Value: value}
+	}
+	overrideVersion, ok := parseSemver(overrideValue)
+	if !ok {
+		return 0, &NotOrderableError{Property: key, Value: overrideValue}
+	}
+	return overrideVersion.compare(version), nil
+}
+
+// Reports whether the value is a string like "1.10" or "v2.0.1".
+func isDotted(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.Contains(s, ".") && semverPattern.MatchString(strings.TrimSpace(s))
+}
+
+// Matches the semver_eq, semver_neq, semver_gt, semver_gte, semver_lt and
+// semver_lte operators, which always compare values as versions.
+func matchSemver(property Property, overrideValue interface{}) (bool, error) {
+	version, ok := parseSemver(property.Value)
+	if !ok {
+		return false, &NotOrderableError{Property: property.Key, Value: property.Value}
+	}
+	overrideVersion, ok := parseSemver(overrideValue)
+	if !ok {
+		return false, &NotOrderableError{Property: property.Key, Value: overrideValue}
+	}
+
+	c := overrideVersion.compare(version)
+	switch property.Operator {
+	case "semver_eq":
+		return c == 0, nil
+	case "semver_neq":
+		return c != 0, nil
+	case "semver_gt":
+		return c > 0, nil
+	case "semver_gte":
+		return c >= 0, nil
+	case "semver_lt":
+		return c < 0, nil
+	default:
+		return c <= 0, nil
+	}
+}
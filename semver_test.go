@@ -0,0 +1,93 @@
+package posthog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.2", "1.9.0", 1},
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2", "1.2.0", 0},
+		{"2", "1.99.99", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"1.0.0+build.1", "1.0.0+build.2", 0},
+	}
+
+	for _, test := range tests {
+		a, okA := parseSemver(test.a)
+		b, okB := parseSemver(test.b)
+		if !okA || !okB {
+			t.Errorf("%s %s: expected valid versions", test.a, test.b)
+			continue
+		}
+		if got := a.compare(b); got != test.want {
+			t.Errorf("%s %s: expected %d, got %d", test.a, test.b, test.want, got)
+		}
+	}
+
+	for _, value := range []interface{}{"", "1.2.3.4", "one", "1.2.x", -1, 1.5, nil} {
+		if _, ok := parseSemver(value); ok {
+			t.Errorf("expected %#v not to be a valid version", value)
+		}
+	}
+}
+
+func TestMatchPropertyVersions(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    interface{}
+		override interface{}
+		match    bool
+	}{
+		{"gt", "1.9.0", "1.10.2", true},
+		{"lt", "1.9.0", "1.10.2", false},
+		{"gte", "1.10.2", "1.10.2", true},
+		{"lte", "2.0.0", "2.0.0-beta.1", true},
+		{"gt", "1.9.9", 2, true},
+		{"semver_eq", "1.2", "v1.2.0", true},
+		{"semver_neq", "1.2.0", "1.2.1", true},
+		{"semver_gt", "1.10", "1.9", false},
+		{"semver_gte", "1.9", "1.10", true},
+		{"semver_lt", "1.10.0", "1.9.5", true},
+		{"semver_lte", "1.0.0", "1.0.1", false},
+	}
+
+	for _, test := range tests {
+		property := Property{Key: "app_version", Operator: test.operator, Value: test.value}
+		match, err := matchProperty(property, NewProperties().Set("app_version", test.override))
+		if err != nil || match != test.match {
+			t.Errorf("%s %v %v: expected %t, got %t %v", test.operator, test.value, test.override, test.match, match, err)
+		}
+	}
+
+	// Dotted strings are compared as versions even when they are numbers too.
+	property := Property{Key: "app_version", Operator: "gt", Value: "1.9"}
+	if match, err := matchProperty(property, NewProperties().Set("app_version", "1.10")); err != nil || !match {
+		t.Errorf("expected 1.10 to be greater than 1.9 as versions, got %t %v", match, err)
+	}
+
+	// Numbers that aren't versions are still compared as numbers.
+	property = Property{Key: "price", Operator: "gt", Value: 9.5}
+	if match, err := matchProperty(property, NewProperties().Set("price", "9.75")); err != nil || !match {
+		t.Errorf("expected 9.75 to be greater than 9.5 as numbers, got %t %v", match, err)
+	}
+
+	for _, operator := range []string{"gt", "semver_gt"} {
+		property := Property{Key: "app_version", Operator: operator, Value: "1.2.3"}
+		_, err := matchProperty(property, NewProperties().Set("app_version", "latest"))
+
+		var orderErr *NotOrderableError
+		if !errors.As(err, &orderErr) || orderErr.Value != "latest" {
+			t.Errorf("%s: expected a NotOrderableError, got %v", operator, err)
+		}
+	}
+}
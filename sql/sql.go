@@ -0,0 +1,117 @@
+// Package posthogsql wraps database/sql drivers to capture slow queries as
+// PostHog events.
+//
+//	posthogsql.Register("postgres+posthog", &pq.Driver{}, client, posthogsql.Options{
+//		Threshold:  200 * time.Millisecond,
+//		DistinctId: func(ctx context.Context) string { return userFromContext(ctx) },
+//	})
+//	db, err := sql.Open("postgres+posthog", dsn)
+//
+// Statements are normalized before being sent, literal values are replaced
+// with `?` so query arguments never leave the application.
+package posthogsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/posthog/posthog-go"
+)
+
+// DefaultThreshold is the duration above which queries are captured when
+// Options.Threshold is not set.
+const DefaultThreshold = 500 * time.Millisecond
+
+// DefaultEvent is the name of the events captured when Options.Event is not
+// set.
+const DefaultEvent = "db_slow_query"
+
+// Options configures which queries are captured and how.
+type Options struct {
+	// Queries taking longer than this are captured, DefaultThreshold is used
+	// if zero.
+	Threshold time.Duration
+
+	// Name of the captured events, DefaultEvent is used if empty.
+	Event string
+
+	// Returns the distinct ID the query is attributed to. Queries for which it
+	// is nil or returns an empty string are not captured.
+	DistinctId func(ctx context.Context) string
+
+	// Properties added to every captured event, like the database name.
+	Properties posthog.Properties
+}
+
+// Register wraps d and registers it with database/sql under name.
+func Register(name string, d driver.Driver, client posthog.Client, opts Options) {
+	sql.Register(name, Wrap(d, client, opts))
+}
+
+// Wrap returns a driver forwarding every call to d and capturing the
+// statements that take longer than the configured threshold.
+func Wrap(d driver.Driver, client posthog.Client, opts Options) driver.Driver {
+	if opts.Threshold == 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	if opts.Event == "" {
+		opts.Event = DefaultEvent
+	}
+	return &wrappedDriver{parent: d, recorder: &recorder{client: client, opts: opts, now: time.Now}}
+}
+
+type recorder struct {
+	client posthog.Client
+	opts   Options
+	now    func() time.Time
+}
+
+func (r *recorder) record(ctx context.Context, op string, query string, start time.Time, err error) {
+	duration := r.now().Sub(start)
+	if duration < r.opts.Threshold || r.opts.DistinctId == nil {
+		return
+	}
+
+	distinctId := r.opts.DistinctId(ctx)
+	if distinctId == "" {
+		return
+	}
+
+	properties := posthog.NewProperties()
+	for k, v := range r.opts.Properties {
+		properties[k] = v
+	}
+	properties.
+		Set("operation", op).
+		Set("statement", Normalize(query)).
+		Set("duration_ms", duration.Milliseconds())
+	if err != nil && err != driver.ErrSkip {
+		properties.Set("error", err.Error())
+	}
+
+	r.client.Enqueue(posthog.Capture{
+		DistinctId: distinctId,
+		Event:      r.opts.Event,
+		Properties: properties,
+	})
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$.])\d+(?:\.\d+)?\b`)
+	inList         = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+)
+
+// Normalize replaces string and numeric literals of a statement with `?`,
+// collapses `IN (?, ?, ...)` lists and whitespace so that equivalent queries
+// produce the same statement.
+func Normalize(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+	query = strings.Join(strings.Fields(query), " ")
+	return inList.ReplaceAllString(query, "(?)")
+}
@@ -0,0 +1,132 @@
+package posthogsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/posthog/posthog-go"
+)
+
+type testClient struct {
+	posthog.Client
+	msgs []posthog.Message
+}
+
+func (c *testClient) Enqueue(msg posthog.Message) error {
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) { return testConn{}, nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (testConn) Close() error                              { return nil }
+func (testConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (testConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return testRows{}, nil
+}
+
+type testRows struct{}
+
+func (testRows) Columns() []string              { return nil }
+func (testRows) Close() error                   { return nil }
+func (testRows) Next(dest []driver.Value) error { return io.EOF }
+
+type distinctIdKey struct{}
+
+func TestSlowQueriesAreCaptured(t *testing.T) {
+	client := &testClient{}
+	d := Wrap(testDriver{}, client, Options{
+		Threshold: time.Second,
+		DistinctId: func(ctx context.Context) string {
+			id, _ := ctx.Value(distinctIdKey{}).(string)
+			return id
+		},
+	}).(*wrappedDriver)
+
+	// Every query takes one second according to the mocked clock.
+	var clock time.Time
+	d.recorder.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	sql.Register("posthog-test", d)
+	db, err := sql.Open("posthog-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.WithValue(context.Background(), distinctIdKey{}, "user-1")
+	if _, err := db.ExecContext(ctx, "UPDATE users SET name = 'bob' WHERE id = 42"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queries without a distinct ID in the context are not captured.
+	rows, err := db.QueryContext(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	if len(client.msgs) != 1 {
+		t.Fatalf("expected 1 captured event, got %d", len(client.msgs))
+	}
+
+	capture := client.msgs[0].(posthog.Capture)
+	if capture.DistinctId != "user-1" || capture.Event != DefaultEvent {
+		t.Errorf("invalid capture: %+v", capture)
+	}
+
+	if capture.Properties["statement"] != "UPDATE users SET name = ? WHERE id = ?" || capture.Properties["operation"] != "exec" || capture.Properties["duration_ms"] != int64(1000) {
+		t.Errorf("invalid capture properties: %v", capture.Properties)
+	}
+}
+
+func TestBeginTxWithoutConnBeginTx(t *testing.T) {
+	conn := &wrappedConn{parent: testConn{}}
+
+	for _, opts := range []driver.TxOptions{
+		{Isolation: driver.IsolationLevel(sql.LevelSerializable)},
+		{ReadOnly: true},
+	} {
+		if _, err := conn.BeginTx(context.Background(), opts); err == nil || err == driver.ErrSkip {
+			t.Errorf("expected %+v to be rejected, got %v", opts, err)
+		}
+	}
+
+	// The default options are handed to Begin.
+	if _, err := conn.BeginTx(context.Background(), driver.TxOptions{}); err != driver.ErrSkip {
+		t.Error("expected the transaction to be begun by the driver, got", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"SELECT *\n  FROM users WHERE id = 1":       "SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM t WHERE name = 'it''s'":      "SELECT * FROM t WHERE name = ?",
+		"SELECT * FROM t WHERE id IN (1, 2, 3)":     "SELECT * FROM t WHERE id IN (?)",
+		"SELECT * FROM t2 WHERE price > 10.5":       "SELECT * FROM t2 WHERE price > ?",
+		"SELECT * FROM t WHERE id = $1 AND a = 'x'": "SELECT * FROM t WHERE id = $1 AND a = ?",
+	}
+
+	for query, expected := range tests {
+		if res := Normalize(query); res != expected {
+			t.Errorf("%q: expected %q, got %q", query, expected, res)
+		}
+	}
+}
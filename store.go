@@ -0,0 +1,162 @@
+package posthog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A Store persists state of the client across processes, like the feature
+// flag calls that were already reported. Implementations backed by Redis or
+// SQLite can be used to share the state between instances of an application.
+// Stores must be safe to use concurrently.
+type Store interface {
+
+	// Returns the value stored under key, ok is false when the key doesn't
+	// exist or expired.
+	Get(key string) (value []byte, ok bool, err error)
+
+	// Stores value under key, the key expires after ttl unless ttl is zero.
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// Deletes key, deleting a missing key isn't an error.
+	Delete(key string) error
+}
+
+// A Store keeping values in memory, expired keys are removed when they are
+// read.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]storeEntry
+	now     func() time.Time
+}
+
+type storeEntry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (e storeEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+func makeStoreEntry(value []byte, ttl time.Duration, now time.Time) storeEntry {
+	e := storeEntry{Value: value}
+	if ttl > 0 {
+		e.Expires = now.Add(ttl)
+	}
+	return e
+}
+
+// Returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]storeEntry{}, now: time.Now}
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if e.expired(s.now()) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[key] = makeStoreEntry(value, ttl, s.now())
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// A Store keeping each key in a file of a directory, values survive restarts
+// of the application. Files are replaced atomically so concurrent processes
+// never read partial values.
+type FileStore struct {
+	dir string
+	now func() time.Time
+}
+
+// Returns a store writing to dir, the directory is created if it doesn't
+// exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, now: time.Now}, nil
+}
+
+// Keys are hashed since they may contain characters that are invalid in file
+// names, like distinct IDs with slashes.
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *FileStore) Get(key string) ([]byte, bool, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var e storeEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, false, err
+	}
+	if e.expired(s.now()) {
+		return nil, false, s.Delete(key)
+	}
+	return e.Value, true, nil
+}
+
+func (s *FileStore) Set(key string, value []byte, ttl time.Duration) error {
+	b, err := json.Marshal(makeStoreEntry(value, ttl, s.now()))
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *FileStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package posthog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, store Store, setNow func(time.Time)) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	setNow(now)
+
+	if _, ok, err := store.Get("a"); ok || err != nil {
+		t.Errorf("expected missing key, got %v %v", ok, err)
+	}
+
+	store.Set("a", []byte("1"), 0)
+	store.Set("b/c", []byte("2"), time.Minute)
+
+	if v, ok, err := store.Get("a"); !ok || err != nil || string(v) != "1" {
+		t.Errorf("expected stored value, got %q %v %v", v, ok, err)
+	}
+	if v, ok, _ := store.Get("b/c"); !ok || string(v) != "2" {
+		t.Errorf("expected stored value, got %q %v", v, ok)
+	}
+
+	setNow(now.Add(time.Minute))
+
+	if _, ok, _ := store.Get("b/c"); ok {
+		t.Error("expected key to expire")
+	}
+	if _, ok, _ := store.Get("a"); !ok {
+		t.Error("expected key without ttl not to expire")
+	}
+
+	if err := store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get("a"); ok {
+		t.Error("expected key to be deleted")
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Error("expected deleting a missing key to succeed, got", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testStore(t, store, func(now time.Time) { store.now = func() time.Time { return now } })
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "posthog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store, func(now time.Time) { store.now = func() time.Time { return now } })
+}
+
+func TestFeatureFlagCalledSharedStore(t *testing.T) {
+	var called int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/batch") {
+			var batch struct{ Batch []struct{ Event string } }
+			json.NewDecoder(r.Body).Decode(&batch)
+			for _, m := range batch.Batch {
+				if m.Event == "$feature_flag_called" {
+					atomic.AddInt32(&called, 1)
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	store := NewMemoryStore()
+
+	for i := 0; i != 2; i++ {
+		client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+			PersonalApiKey: "some very secret key",
+			Endpoint:       server.URL,
+			Logger:         testLogger{t.Logf, t.Logf},
+			Store:          store,
+		})
+
+		client.GetFeatureFlag(FeatureFlagPayload{
+			Key:              "simple-flag",
+			DistinctId:       "some-distinct-id",
+			PersonProperties: NewProperties().Set("region", "USA"),
+		})
+		client.Close()
+	}
+
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Errorf("expected $feature_flag_called to be reported once across clients, got %d", n)
+	}
+}
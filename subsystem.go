@@ -0,0 +1,104 @@
+package posthog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The state of one of the background subsystems of a client, returned by
+// Client.Subsystems so operators can detect degraded internals.
+type SubsystemState struct {
+
+	// The name of the subsystem, "flusher" for the loop batching and sending
+	// messages, "poller" for the loop fetching feature flag definitions or
+	// "stream" for the listener of flag changes.
+	Name string
+
+	// Reports whether the subsystem is running, it is false once the client
+	// was closed.
+	Running bool
+
+	// The last error reported by the subsystem, like a batch that couldn't be
+	// sent or flag definitions that couldn't be fetched, and when it happened.
+	LastError   error
+	LastErrorAt time.Time
+
+	// The number of times the subsystem recovered from a panic and resumed.
+	Restarts int
+}
+
+// Tracks the state of a background loop and supervises it, panics of a unit
+// of work are recovered so the loop can resume with the next one.
+type subsystem struct {
+	name string
+	now  func() time.Time
+
+	mutex       sync.Mutex
+	running     bool
+	lastError   error
+	lastErrorAt time.Time
+	restarts    int
+}
+
+func newSubsystem(name string, now func() time.Time) *subsystem {
+	if now == nil {
+		now = time.Now
+	}
+	return &subsystem{name: name, now: now}
+}
+
+func (s *subsystem) setRunning(running bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.running = running
+}
+
+func (s *subsystem) recordError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastError = err
+	s.lastErrorAt = s.now()
+}
+
+// Runs fn, a panic is recorded as the last error and passed to onPanic before
+// returning normally.
+func (s *subsystem) protect(fn func(), onPanic func(error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("panic in %s: %v", s.name, r)
+
+			s.mutex.Lock()
+			s.lastError = err
+			s.lastErrorAt = s.now()
+			s.restarts++
+			s.mutex.Unlock()
+
+			onPanic(err)
+		}
+	}()
+	fn()
+}
+
+func (s *subsystem) state() SubsystemState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SubsystemState{
+		Name:        s.name,
+		Running:     s.running,
+		LastError:   s.lastError,
+		LastErrorAt: s.lastErrorAt,
+		Restarts:    s.restarts,
+	}
+}
+
+func (c *client) Subsystems() []SubsystemState {
+	states := []SubsystemState{c.flusher.state()}
+	if c.featureFlagsPoller != nil {
+		states = append(states, c.featureFlagsPoller.state.state())
+		if c.featureFlagsPoller.streamState != nil {
+			states = append(states, c.featureFlagsPoller.streamState.state())
+		}
+	}
+	return states
+}
@@ -0,0 +1,74 @@
+package posthog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientSubsystems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Endpoint:       server.URL,
+		PersonalApiKey: "some very secret key",
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+
+	// Evaluations wait for the first fetch to complete.
+	client.GetFeatureFlag(FeatureFlagPayload{Key: "flag", DistinctId: "-", OnlyEvaluateLocally: true, SendFeatureFlagEvents: new(bool)})
+
+	states := client.Subsystems()
+	if len(states) != 2 || states[0].Name != "flusher" || states[1].Name != "poller" {
+		t.Fatalf("unexpected subsystems: %+v", states)
+	}
+	if !states[0].Running || !states[1].Running {
+		t.Errorf("expected subsystems to be running: %+v", states)
+	}
+	if states[1].LastError == nil || states[1].LastErrorAt.IsZero() {
+		t.Errorf("expected the failed fetch to be recorded: %+v", states[1])
+	}
+
+	client.Close()
+
+	for _, state := range client.Subsystems() {
+		if state.Running {
+			t.Errorf("expected %s to be stopped", state.Name)
+		}
+	}
+}
+
+func TestClientFlusherRecoversFromPanics(t *testing.T) {
+	var panicked int32
+
+	client, _ := NewWithConfig("0123456789", Config{
+		Logger: testLogger{func(format string, args ...interface{}) {
+			if strings.Contains(fmt.Sprintf(format, args...), "buffer") && atomic.CompareAndSwapInt32(&panicked, 0, 1) {
+				panic("logger failure")
+			}
+		}, t.Logf},
+		Transport: testTransportOK,
+		Verbose:   true,
+	})
+	defer client.Close()
+
+	client.Enqueue(Capture{DistinctId: "1", Event: "A"})
+	client.Enqueue(Capture{DistinctId: "1", Event: "B"})
+
+	if err := client.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	state := client.Subsystems()[0]
+	if !state.Running || state.Restarts != 1 || state.LastError == nil {
+		t.Errorf("expected the flusher to recover from the panic: %+v", state)
+	}
+}
@@ -0,0 +1,159 @@
+// Package posthogtemporal provides a Temporal worker interceptor capturing
+// workflow and activity lifecycle events to PostHog.
+//
+//	w := worker.New(c, "orders", worker.Options{
+//		Interceptors: []interceptor.WorkerInterceptor{posthogtemporal.New(client, posthogtemporal.Options{})},
+//	})
+//
+// Events are attributed to a distinct ID derived from the workflow ID, which
+// can be customized with Options.DistinctId.
+package posthogtemporal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/posthog/posthog-go"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Options configures the interceptor.
+type Options struct {
+	// Maps a workflow ID to the distinct ID events are captured with, the
+	// workflow ID itself is used if nil. Applications typically embed the
+	// user or account ID in their workflow IDs (`checkout-<user id>`).
+	DistinctId func(workflowId string) string
+
+	// When set, activity events are not captured, only workflow ones.
+	SkipActivities bool
+}
+
+type workerInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	client posthog.Client
+	opts   Options
+}
+
+// New returns a worker interceptor capturing `workflow_started`,
+// `workflow_completed`, `workflow_failed`, `activity_started`,
+// `activity_completed` and `activity_failed` events to client.
+func New(client posthog.Client, opts Options) interceptor.WorkerInterceptor {
+	return &workerInterceptor{client: client, opts: opts}
+}
+
+func (w *workerInterceptor) distinctId(workflowId string) string {
+	if w.opts.DistinctId != nil {
+		if id := w.opts.DistinctId(workflowId); id != "" {
+			return id
+		}
+	}
+	return workflowId
+}
+
+func (w *workerInterceptor) capture(distinctId string, event string, properties posthog.Properties) {
+	w.client.Enqueue(posthog.Capture{
+		DistinctId: distinctId,
+		Event:      event,
+		Properties: properties,
+	})
+}
+
+func (w *workerInterceptor) InterceptWorkflow(ctx workflow.Context, next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	i := &workflowInterceptor{root: w}
+	i.Next = next
+	return i
+}
+
+func (w *workerInterceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	if w.opts.SkipActivities {
+		return next
+	}
+	i := &activityInterceptor{root: w}
+	i.Next = next
+	return i
+}
+
+type workflowInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *workerInterceptor
+}
+
+func (i *workflowInterceptor) ExecuteWorkflow(ctx workflow.Context, in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	// Workflow code is replayed when a worker recovers its state, events are
+	// only captured the first time the code runs.
+	replaying := workflow.IsReplaying(ctx)
+	info := workflow.GetInfo(ctx)
+	distinctId := i.root.distinctId(info.WorkflowExecution.ID)
+	properties := func() posthog.Properties {
+		return posthog.NewProperties().
+			Set("workflow_id", info.WorkflowExecution.ID).
+			Set("workflow_run_id", info.WorkflowExecution.RunID).
+			Set("workflow_type", info.WorkflowType.Name).
+			Set("task_queue", info.TaskQueueName).
+			Set("attempt", info.Attempt)
+	}
+
+	start := workflow.Now(ctx)
+	if !replaying {
+		i.root.capture(distinctId, "workflow_started", properties())
+	}
+
+	result, err := i.Next.ExecuteWorkflow(ctx, in)
+
+	if !workflow.IsReplaying(ctx) {
+		p := properties().Set("duration_ms", workflow.Now(ctx).Sub(start).Milliseconds())
+		if err != nil {
+			setError(p, err)
+			i.root.capture(distinctId, "workflow_failed", p)
+		} else {
+			i.root.capture(distinctId, "workflow_completed", p)
+		}
+	}
+
+	return result, err
+}
+
+type activityInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *workerInterceptor
+}
+
+func (i *activityInterceptor) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	info := activity.GetInfo(ctx)
+	distinctId := i.root.distinctId(info.WorkflowExecution.ID)
+	properties := func() posthog.Properties {
+		p := posthog.NewProperties().
+			Set("workflow_id", info.WorkflowExecution.ID).
+			Set("workflow_run_id", info.WorkflowExecution.RunID).
+			Set("activity_id", info.ActivityID).
+			Set("activity_type", info.ActivityType.Name).
+			Set("task_queue", info.TaskQueue).
+			Set("attempt", info.Attempt)
+		if info.WorkflowType != nil {
+			p.Set("workflow_type", info.WorkflowType.Name)
+		}
+		return p
+	}
+
+	start := time.Now()
+	i.root.capture(distinctId, "activity_started", properties())
+
+	result, err := i.Next.ExecuteActivity(ctx, in)
+
+	p := properties().Set("duration_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		setError(p, err)
+		i.root.capture(distinctId, "activity_failed", p)
+	} else {
+		i.root.capture(distinctId, "activity_completed", p)
+	}
+
+	return result, err
+}
+
+func setError(p posthog.Properties, err error) {
+	p.Set("error", err.Error()).Set("error_type", fmt.Sprintf("%T", err))
+}
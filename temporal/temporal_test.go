@@ -0,0 +1,89 @@
+package posthogtemporal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/posthog/posthog-go"
+	temporalclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+type testClient struct {
+	posthog.Client
+	mutex sync.Mutex
+	msgs  []posthog.Capture
+}
+
+func (c *testClient) Enqueue(msg posthog.Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.msgs = append(c.msgs, msg.(posthog.Capture))
+	return nil
+}
+
+func Greet(ctx context.Context, name string) (string, error) {
+	return "hello " + name, nil
+}
+
+func Checkout(ctx workflow.Context, name string) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Minute})
+	var greeting string
+	if err := workflow.ExecuteActivity(ctx, Greet, name).Get(ctx, &greeting); err != nil {
+		return err
+	}
+	return errors.New("payment declined")
+}
+
+func TestWorkflowLifecycleEvents(t *testing.T) {
+	client := &testClient{}
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{New(client, Options{
+			DistinctId: func(workflowId string) string {
+				return strings.TrimPrefix(workflowId, "checkout-")
+			},
+		})},
+	})
+	env.SetStartWorkflowOptions(temporalclient.StartWorkflowOptions{ID: "checkout-user-1"})
+	env.RegisterActivity(Greet)
+	env.ExecuteWorkflow(Checkout, "bob")
+
+	if env.GetWorkflowError() == nil {
+		t.Fatal("expected workflow to fail")
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	var events []string
+	for _, msg := range client.msgs {
+		if msg.DistinctId != "user-1" {
+			t.Errorf("invalid distinct id: %s", msg.DistinctId)
+		}
+		events = append(events, msg.Event)
+	}
+
+	expected := "workflow_started activity_started activity_completed workflow_failed"
+	if strings.Join(events, " ") != expected {
+		t.Fatalf("expected events %q, got %q", expected, events)
+	}
+
+	failed := client.msgs[3].Properties
+	if failed["workflow_type"] != "Checkout" || !strings.Contains(failed["error"].(string), "payment declined") {
+		t.Errorf("invalid workflow_failed properties: %v", failed)
+	}
+
+	if client.msgs[1].Properties["activity_type"] != "Greet" {
+		t.Errorf("invalid activity properties: %v", client.msgs[1].Properties)
+	}
+}
@@ -0,0 +1,165 @@
+package posthog
+
+import (
+	"sync"
+)
+
+// A User is a handle on a client scoped to a distinct ID, returned by
+// Client.ForUser. It remembers the person properties set through it and the
+// feature flag values it evaluated: properties are passed to flag evaluation
+// and flag values are attached to captured events.
+// Handles are meant to live for the duration of a request, flag values are
+// never refreshed. They are safe to use concurrently.
+// Handles created by Group.ForUser also attach events and flag evaluations to
+// the group.
+type User struct {
+	client     Client
+	distinctId string
+
+	// The group of the user when the handle was created by Group.ForUser.
+	group *Group
+
+	mutex      sync.Mutex
+	properties Properties
+	flags      map[string]interface{}
+}
+
+func newUser(client Client, distinctId string) *User {
+	return &User{
+		client:     client,
+		distinctId: distinctId,
+		properties: NewProperties(),
+		flags:      map[string]interface{}{},
+	}
+}
+
+func (c *client) ForUser(distinctId string) *User {
+	return newUser(c, distinctId)
+}
+
+func (c *childClient) ForUser(distinctId string) *User {
+	return newUser(c, distinctId)
+}
+
+// Returns the distinct ID of the user.
+func (u *User) DistinctId() string {
+	return u.distinctId
+}
+
+func (u *User) groups() Groups {
+	if u.group == nil {
+		return nil
+	}
+	return u.group.groups()
+}
+
+func (u *User) groupProperties() map[string]Properties {
+	if u.group == nil {
+		return nil
+	}
+	return u.group.groupProperties()
+}
+
+// Captures an event for the user, the flag values evaluated by the handle
+// are attached as `$feature/<key>` properties.
+func (u *User) Capture(event string, properties Properties) error {
+	props := NewProperties()
+
+	u.mutex.Lock()
+	for key, value := range u.flags {
+		props.Set("$feature/"+key, value)
+	}
+	u.mutex.Unlock()
+
+	return u.client.Enqueue(Capture{
+		DistinctId: u.distinctId,
+		Event:      event,
+		Properties: props.Merge(properties),
+		Groups:     u.groups(),
+	})
+}
+
+// Sets person properties of the user, they are remembered by the handle and
+// used to evaluate feature flags.
+func (u *User) Identify(properties Properties) error {
+	u.mutex.Lock()
+	u.properties.Merge(properties)
+	u.mutex.Unlock()
+
+	return u.client.Enqueue(Identify{
+		DistinctId: u.distinctId,
+		Properties: properties,
+	})
+}
+
+// Links the distinct ID of the user to alias.
+func (u *User) Alias(alias string) error {
+	return u.client.Enqueue(Alias{
+		DistinctId: u.distinctId,
+		Alias:      alias,
+	})
+}
+
+// Returns the value of a feature flag for the user, evaluated once per
+// handle.
+func (u *User) GetFeatureFlag(key string) (interface{}, error) {
+	u.mutex.Lock()
+	value, ok := u.flags[key]
+	properties := NewProperties().Merge(u.properties)
+	u.mutex.Unlock()
+
+	if ok {
+		return value, nil
+	}
+
+	value, err := u.client.GetFeatureFlag(FeatureFlagPayload{
+		Key:              key,
+		DistinctId:       u.distinctId,
+		Groups:           u.groups(),
+		PersonProperties: properties,
+		GroupProperties:  u.groupProperties(),
+	})
+	if err != nil {
+		return value, err
+	}
+
+	u.mutex.Lock()
+	u.flags[key] = value
+	u.mutex.Unlock()
+	return value, nil
+}
+
+// Reports whether a feature flag is enabled for the user, nil means the flag
+// is undefined (see Client.IsFeatureEnabled).
+func (u *User) IsFeatureEnabled(key string) (*bool, error) {
+	value, err := u.GetFeatureFlag(key)
+	if err != nil {
+		return nil, err
+	}
+	return flagEnabled(value), nil
+}
+
+// Returns the values of all feature flags for the user, they are remembered
+// by the handle.
+func (u *User) GetAllFlags() (map[string]interface{}, error) {
+	u.mutex.Lock()
+	properties := NewProperties().Merge(u.properties)
+	u.mutex.Unlock()
+
+	flags, err := u.client.GetAllFlags(FeatureFlagPayloadNoKey{
+		DistinctId:       u.distinctId,
+		Groups:           u.groups(),
+		PersonProperties: properties,
+		GroupProperties:  u.groupProperties(),
+	})
+	if err != nil {
+		return flags, err
+	}
+
+	u.mutex.Lock()
+	for key, value := range flags {
+		u.flags[key] = value
+	}
+	u.mutex.Unlock()
+	return flags, nil
+}
@@ -0,0 +1,55 @@
+package posthog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientForUser(t *testing.T) {
+	captures := make(chan CaptureInApi, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/feature_flag/local_evaluation") {
+			w.Write([]byte(fixture("feature_flag/test-simple-flag-person-prop.json")))
+		} else if strings.HasPrefix(r.URL.Path, "/batch") {
+			var b struct{ Batch []CaptureInApi }
+			json.NewDecoder(r.Body).Decode(&b)
+			for _, m := range b.Batch {
+				if m.Event == "purchase" {
+					captures <- m
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewWithConfig("Csyjlnlun3OzyNJAafdlv", Config{
+		PersonalApiKey: "some very secret key",
+		Endpoint:       server.URL,
+		Logger:         testLogger{t.Logf, t.Logf},
+	})
+
+	user := client.ForUser("some-distinct-id")
+
+	if err := user.Identify(NewProperties().Set("region", "USA")); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled, err := user.IsFeatureEnabled("simple-flag")
+	if err != nil || enabled == nil || !*enabled {
+		t.Fatalf("expected the flag to match the identified properties, got %v %v", enabled, err)
+	}
+
+	if err := user.Capture("purchase", NewProperties().Set("price", 10)); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	m := <-captures
+	if m.DistinctId != "some-distinct-id" || m.Properties["$feature/simple-flag"] != true || m.Properties["price"] != float64(10) {
+		t.Errorf("expected the capture to carry the user and flag values, got %+v", m)
+	}
+}
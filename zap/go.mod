@@ -0,0 +1,15 @@
+module github.com/posthog/posthog-go/zap
+
+go 1.19
+
+require (
+	github.com/posthog/posthog-go v0.0.0
+	go.uber.org/zap v1.27.0
+)
+
+require (
+	github.com/google/uuid v1.3.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+)
+
+replace github.com/posthog/posthog-go => ../
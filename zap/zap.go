@@ -0,0 +1,67 @@
+// Package posthogzap provides a posthog.Logger backed by a *zap.Logger.
+//
+//	client, _ := posthog.NewWithConfig(apiKey, posthog.Config{
+//		Logger: posthogzap.New(logger),
+//	})
+package posthogzap
+
+import (
+	"fmt"
+
+	"github.com/posthog/posthog-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ posthog.LeveledLogger = Logger{}
+
+// Logger adapts a *zap.Logger to the posthog.LeveledLogger interface, log
+// entries of the client are written with their level and fields mapped to
+// zap levels and fields.
+type Logger struct {
+	logger *zap.Logger
+}
+
+// New returns a Logger writing to logger. Entries are tagged with a
+// `component` field set to "posthog".
+func New(logger *zap.Logger) Logger {
+	return Logger{logger: logger.With(zap.String("component", "posthog"))}
+}
+
+func (l Logger) Logf(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Log(level posthog.LogLevel, msg string, fields ...posthog.LogField) {
+	if ce := l.logger.Check(zapLevel(level), msg); ce != nil {
+		ce.Write(zapFields(fields)...)
+	}
+}
+
+func zapLevel(level posthog.LogLevel) zapcore.Level {
+	switch level {
+	case posthog.LogLevelDebug:
+		return zapcore.DebugLevel
+	case posthog.LogLevelInfo:
+		return zapcore.InfoLevel
+	case posthog.LogLevelWarn:
+		return zapcore.WarnLevel
+	}
+	return zapcore.ErrorLevel
+}
+
+func zapFields(fields []posthog.LogField) []zap.Field {
+	zf := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		if err, ok := f.Value.(error); ok {
+			zf = append(zf, zap.NamedError(f.Key, err))
+		} else {
+			zf = append(zf, zap.Any(f.Key, f.Value))
+		}
+	}
+	return zf
+}
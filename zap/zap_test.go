@@ -0,0 +1,42 @@
+package posthogzap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerLevelsAndFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := New(zap.New(core))
+
+	logger.Logf("flushing %d messages", 3)
+	logger.Errorf("panic - %s", "boom")
+	logger.Log(posthog.LogLevelWarn, "request rejected",
+		posthog.LogField{Key: "endpoint", Value: "/batch/"},
+		posthog.LogField{Key: "status", Value: 400},
+		posthog.LogField{Key: "error", Value: errors.New("bad request")},
+	)
+
+	entries := logs.AllUntimed()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	if entries[0].Level != zapcore.InfoLevel || entries[0].Message != "flushing 3 messages" {
+		t.Errorf("invalid info entry: %+v", entries[0])
+	}
+
+	if entries[1].Level != zapcore.ErrorLevel || entries[1].Message != "panic - boom" {
+		t.Errorf("invalid error entry: %+v", entries[1])
+	}
+
+	fields := entries[2].ContextMap()
+	if entries[2].Level != zapcore.WarnLevel || fields["endpoint"] != "/batch/" || fields["status"] != int64(400) || fields["error"] != "bad request" || fields["component"] != "posthog" {
+		t.Errorf("invalid structured entry: %+v %v", entries[2], fields)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/posthog/posthog-go/zstd
+
+go 1.19
+
+require (
+	github.com/klauspost/compress v1.17.9
+	github.com/posthog/posthog-go v0.0.0
+)
+
+require github.com/google/uuid v1.3.0 // indirect
+
+replace github.com/posthog/posthog-go => ../
@@ -0,0 +1,35 @@
+// Package posthogzstd provides a posthog.Compressor using zstd, which gives a
+// better ratio for less CPU than gzip on batch payloads.
+//
+//	compressor, _ := posthogzstd.New(zstd.SpeedFastest)
+//	client, _ := posthog.NewWithConfig(apiKey, posthog.Config{
+//		Compression: compressor,
+//	})
+package posthogzstd
+
+import (
+	"github.com/klauspost/compress/zstd"
+	"github.com/posthog/posthog-go"
+)
+
+type compressor struct {
+	encoder *zstd.Encoder
+}
+
+// Returns a compressor using the given level, the encoder is shared by all
+// batches and safe to use concurrently.
+func New(level zstd.EncoderLevel) (posthog.Compressor, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	return &compressor{encoder: encoder}, nil
+}
+
+func (c *compressor) Encoding() string {
+	return "zstd"
+}
+
+func (c *compressor) Compress(b []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(b, make([]byte, 0, len(b)/2)), nil
+}
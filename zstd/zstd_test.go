@@ -0,0 +1,50 @@
+package posthogzstd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/posthog/posthog-go"
+)
+
+func TestCompressor(t *testing.T) {
+	events := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "zstd" {
+			t.Errorf("expected a zstd encoded request, got %q", r.Header.Get("Content-Encoding"))
+		}
+
+		var b struct{ Batch []posthog.CaptureInApi }
+		if d, err := zstd.NewReader(r.Body); err != nil {
+			t.Error(err)
+		} else if err := json.NewDecoder(d).Decode(&b); err != nil {
+			t.Error(err)
+		}
+		if len(b.Batch) == 1 {
+			events <- b.Batch[0].Event
+		}
+	}))
+	defer server.Close()
+
+	compressor, err := New(zstd.SpeedFastest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ := posthog.NewWithConfig("0123456789", posthog.Config{
+		Endpoint:    server.URL,
+		Compression: compressor,
+		BatchSize:   1,
+	})
+	defer client.Close()
+
+	client.Enqueue(posthog.Capture{DistinctId: "1", Event: "A"})
+
+	if event := <-events; event != "A" {
+		t.Errorf("expected the compressed batch to be decoded, got %q", event)
+	}
+}